@@ -18,6 +18,7 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"net"
 	"os"
@@ -397,6 +398,11 @@ func MD5String(f string) string {
 // the file for speed, so don't use it if the files are very subtly different.
 // It will not close the file.
 func MD5FromFileFast(r io.ReadSeeker) (string, error) {
+	return HashFromFileFast(r, md5.New())
+}
+
+// HashFromFileFast is MD5FromFileFast with the hash h.
+func HashFromFileFast(r io.ReadSeeker, h hash.Hash) (string, error) {
 	const (
 		// Do not change once set in stone!
 		maxChunks = 8
@@ -404,7 +410,6 @@ func MD5FromFileFast(r io.ReadSeeker) (string, error) {
 		seek      = 2048
 	)
 
-	h := md5.New()
 	buff := make([]byte, peekSize)
 
 	for i := 0; i < maxChunks; i++ {
@@ -349,6 +349,12 @@ func (h *HugoSites) render(config *BuildCfg) error {
 		if err := h.renderCrossSitesArtifacts(); err != nil {
 			return err
 		}
+
+		// Publish the resources used in the templates above, see the
+		// deferPublish imaging option.
+		for _, s := range h.Sites {
+			s.ResourceSpec.PublishDeferred()
+		}
 	}
 
 	return nil
@@ -233,7 +233,7 @@ func (p *pageState) Resources() resource.Resources {
 					return page.DefaultPageSort(p1, p2)
 				}
 
-				return ri.RelPermalink() < rj.RelPermalink()
+				return resources.RelPermalinkNoUsage(ri) < resources.RelPermalinkNoUsage(rj)
 			})
 		}
 
@@ -414,6 +414,11 @@ func (p *pageState) renderResources() (err error) {
 				continue
 			}
 
+			if resources.PublishIsDeferred(r) {
+				// Published at the end of the build if used.
+				continue
+			}
+
 			src, ok := r.(resource.Source)
 			if !ok {
 				err = errors.Errorf("Resource %T does not support resource.Source", src)
@@ -142,6 +142,12 @@ var (
 	// Common image types
 	PNGType = Type{MainType: "image", SubType: "png", Suffixes: []string{"png"}, Delimiter: defaultDelimiter}
 	JPGType = Type{MainType: "image", SubType: "jpg", Suffixes: []string{"jpg", "jpeg"}, Delimiter: defaultDelimiter}
+	DNGType = Type{MainType: "image", SubType: "x-adobe-dng", Suffixes: []string{"dng"}, Delimiter: defaultDelimiter}
+	ICOType = Type{MainType: "image", SubType: "x-icon", Suffixes: []string{"ico"}, Delimiter: defaultDelimiter}
+	JP2Type = Type{MainType: "image", SubType: "jp2", Suffixes: []string{"jp2", "j2k"}, Delimiter: defaultDelimiter}
+	QOIType = Type{MainType: "image", SubType: "qoi", Suffixes: []string{"qoi"}, Delimiter: defaultDelimiter}
+	PPMType = Type{MainType: "image", SubType: "x-portable-pixmap", Suffixes: []string{"ppm"}, Delimiter: defaultDelimiter}
+	PGMType = Type{MainType: "image", SubType: "x-portable-graymap", Suffixes: []string{"pgm"}, Delimiter: defaultDelimiter}
 
 	OctetType = Type{MainType: "application", SubType: "octet-stream"}
 )
@@ -165,6 +171,12 @@ var DefaultTypes = Types{
 	TOMLType,
 	PNGType,
 	JPGType,
+	DNGType,
+	ICOType,
+	JP2Type,
+	QOIType,
+	PPMType,
+	PGMType,
 }
 
 func init() {
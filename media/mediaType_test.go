@@ -47,6 +47,12 @@ func TestDefaultTypes(t *testing.T) {
 		{XMLType, "application", "xml", "xml", "application/xml", "application/xml"},
 		{TOMLType, "application", "toml", "toml", "application/toml", "application/toml"},
 		{YAMLType, "application", "yaml", "yaml", "application/yaml", "application/yaml"},
+		{DNGType, "image", "x-adobe-dng", "dng", "image/x-adobe-dng", "image/x-adobe-dng"},
+		{ICOType, "image", "x-icon", "ico", "image/x-icon", "image/x-icon"},
+		{JP2Type, "image", "jp2", "jp2", "image/jp2", "image/jp2"},
+		{QOIType, "image", "qoi", "qoi", "image/qoi", "image/qoi"},
+		{PPMType, "image", "x-portable-pixmap", "ppm", "image/x-portable-pixmap", "image/x-portable-pixmap"},
+		{PGMType, "image", "x-portable-graymap", "pgm", "image/x-portable-graymap", "image/x-portable-graymap"},
 	} {
 		c.Assert(test.tp.MainType, qt.Equals, test.expectedMainType)
 		c.Assert(test.tp.SubType, qt.Equals, test.expectedSubType)
@@ -58,7 +64,7 @@ func TestDefaultTypes(t *testing.T) {
 
 	}
 
-	c.Assert(len(DefaultTypes), qt.Equals, 17)
+	c.Assert(len(DefaultTypes), qt.Equals, 23)
 
 }
 
@@ -18,14 +18,29 @@ import (
 	"image"
 	"image/draw"
 	_ "image/gif"
-	_ "image/png"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"mime"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/gohugoio/hugo/media"
 	"github.com/gohugoio/hugo/resources/images/exif"
+	"github.com/gohugoio/hugo/resources/images/icc"
+	"github.com/gohugoio/hugo/resources/images/jpeg2000"
+	"github.com/gohugoio/hugo/resources/images/pnm"
+	"github.com/gohugoio/hugo/resources/images/qoi"
 
 	"github.com/gohugoio/hugo/resources/internal"
+	"github.com/gohugoio/hugo/resources/page"
 
 	"github.com/gohugoio/hugo/resources/resource"
 
@@ -34,6 +49,7 @@ import (
 	"github.com/disintegration/gift"
 	"github.com/gohugoio/hugo/helpers"
 	"github.com/gohugoio/hugo/resources/images"
+	"golang.org/x/image/tiff"
 
 	// Blind import for image.Decode
 
@@ -55,21 +71,254 @@ type imageResource struct {
 	// original (first).
 	root *imageResource
 
+	// Whether this is the original image file, possibly renamed, and not
+	// the result of processing.
+	isOriginal bool
+
 	exifInit    sync.Once
 	exifInitErr error
 	exif        *exif.Exif
 
+	exifJSONInit sync.Once
+	exifJSONErr  error
+	exifJSON     string
+
+	xmpCropInit sync.Once
+	xmpCrop     *images.XMPCrop
+
+	hasICCInit sync.Once
+	hasICC     bool
+
+	decodedInit sync.Once
+	decodedErr  error
+	decoded     image.Image
+
+	colorInfoInit sync.Once
+	colorInfoErr  error
+	colorInfo     images.ColorInfo
+
+	sourceQualityInit sync.Once
+	sourceQuality     int
+
+	pageCountInit sync.Once
+	pageCount     int
+
+	// The resample filter set in the metadata, used when the image spec has
+	// none.
+	resampleFilter string
+
+	// Set for processed images, see ScaleFactor and WasCropped.
+	source *imageSource
+
 	baseResource
 }
 
+// imageSource describes the image a processed image was created from.
+type imageSource struct {
+	// The action, e.g. "fill".
+	action string
+
+	// The dimensions, swapped if the result was rotated by 90 degrees.
+	width, height int
+}
+
+func newImageSource(src *imageResource, conf images.ImageConfig) *imageSource {
+	s := &imageSource{action: conf.Action, width: src.Width(), height: src.Height()}
+	if r := conf.Rotate % 180; r == 90 || r == -90 {
+		s.width, s.height = s.height, s.width
+	}
+	return s
+}
+
+// scaleAndCrop returns the scale factor from the source to a result of
+// width x height, and whether parts of the source were cut away.
+func (s *imageSource) scaleAndCrop(width, height int) (float64, bool) {
+	if s.width <= 0 || s.height <= 0 {
+		return 1, false
+	}
+	sx := float64(width) / float64(s.width)
+	sy := float64(height) / float64(s.height)
+
+	switch s.action {
+	case "fill", "avatar", "ico", "ogcard":
+		// Scaled to cover the box, then cropped to it.
+		scale := math.Max(sx, sy)
+		// Allow for the rounding of the other dimension.
+		cropped := math.Round(scale*float64(s.width)) > float64(width)+1 || math.Round(scale*float64(s.height)) > float64(height)+1
+		return scale, cropped
+	case "crop", "straighten":
+		return 1, width < s.width || height < s.height
+	case "pad":
+		// Scaled to fit the box, then padded.
+		return math.Min(sx, sy), false
+	default:
+		return sx, false
+	}
+}
+
+// ScaleFactor returns the factor the image was scaled with from the image it
+// was processed from, e.g. 0.5 for half the width. For Fill this is before
+// the crop. Original images return 1.
+func (i *imageResource) ScaleFactor() float64 {
+	if i.source == nil {
+		return 1
+	}
+	scale, _ := i.source.scaleAndCrop(i.Width(), i.Height())
+	return scale
+}
+
+// WasCropped reports whether parts of the image it was processed from were
+// cut away, e.g. by Fill to another aspect ratio. Original images return
+// false.
+func (i *imageResource) WasCropped() bool {
+	if i.source == nil {
+		return false
+	}
+	_, cropped := i.source.scaleAndCrop(i.Width(), i.Height())
+	return cropped
+}
+
 func (i *imageResource) Exif() (*exif.Exif, error) {
 	return i.root.getExif()
 }
 
+// ExifJSON returns all the EXIF values of the original image as a JSON
+// object, e.g. to get fields without a typed accessor in Exif. Images
+// without EXIF give an empty object.
+func (i *imageResource) ExifJSON() (string, error) {
+	r := i.root
+	r.exifJSONInit.Do(func() {
+		x, err := r.getExif()
+		if err != nil {
+			r.exifJSONErr = err
+			return
+		}
+		if x == nil {
+			r.exifJSON = "{}"
+			return
+		}
+		b, err := x.ValuesJSON()
+		if err != nil {
+			r.exifJSONErr = err
+			return
+		}
+		r.exifJSON = string(b)
+	})
+
+	return r.exifJSON, r.exifJSONErr
+}
+
+// Orientation returns the EXIF orientation of the original image, a number
+// between 1 and 8. This will be 1 (the default orientation) if not set
+// or not available.
+func (i *imageResource) Orientation() int {
+	x, err := i.Exif()
+	if err != nil || x == nil || x.Orientation == 0 {
+		return 1
+	}
+	return x.Orientation
+}
+
+// DisplayWidth returns the width to show the image with. For original
+// images this is the width declared in EXIF if both the EXIF width and
+// height are set, else the width of the image itself. Processed images
+// always return their own width.
+func (i *imageResource) DisplayWidth() int {
+	if w, _, ok := i.exifDimensions(); ok {
+		return w
+	}
+	return i.Width()
+}
+
+// DisplayHeight returns the height to show the image with, see DisplayWidth.
+func (i *imageResource) DisplayHeight() int {
+	if _, h, ok := i.exifDimensions(); ok {
+		return h
+	}
+	return i.Height()
+}
+
+func (i *imageResource) exifDimensions() (int, int, bool) {
+	if !i.isOriginal {
+		return 0, 0, false
+	}
+	x, err := i.Exif()
+	if err != nil || x == nil || x.PixelWidth <= 0 || x.PixelHeight <= 0 {
+		return 0, 0, false
+	}
+	return x.PixelWidth, x.PixelHeight, true
+}
+
+// PageCount returns the number of pages in the original image. This is
+// only relevant for multi-page TIFF images, all other images have one page.
+func (i *imageResource) PageCount() int {
+	r := i.root
+	r.pageCountInit.Do(func() {
+		r.pageCount = 1
+		if r.Format != images.TIFF {
+			return
+		}
+		f, err := r.ReadSeekCloser()
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		if count, err := images.TIFFPageCount(f); err == nil && count > 0 {
+			r.pageCount = count
+		}
+	})
+	return r.pageCount
+}
+
+// SourceQuality returns the estimated quality (1-100) of the original JPEG
+// image, read from its quantization tables, e.g. to not encode processed
+// images with a higher quality than the source has. It returns 0 if the
+// original is not a JPEG or the quality is not known.
+func (i *imageResource) SourceQuality() int {
+	r := i.root
+	r.sourceQualityInit.Do(func() {
+		if r.Format != images.JPEG {
+			return
+		}
+		f, err := r.ReadSeekCloser()
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		r.sourceQuality, _ = images.EstimateJPEGQuality(f)
+	})
+	return r.sourceQuality
+}
+
+// AspectRatio returns the image's width divided by its height, 0 if the
+// height is not known.
+func (i *imageResource) AspectRatio() float64 {
+	width, height := i.Width(), i.Height()
+	if height == 0 {
+		return 0
+	}
+	return float64(width) / float64(height)
+}
+
+// IsLandscape reports whether the image is wider than it is tall.
+func (i *imageResource) IsLandscape() bool {
+	return i.Width() > i.Height()
+}
+
+// IsPortrait reports whether the image is taller than it is wide.
+func (i *imageResource) IsPortrait() bool {
+	return i.Height() > i.Width()
+}
+
+// IsSquare reports whether the image's width and height are the same.
+func (i *imageResource) IsSquare() bool {
+	return i.Width() == i.Height()
+}
+
 func (i *imageResource) getExif() (*exif.Exif, error) {
 
 	i.exifInit.Do(func() {
-		supportsExif := i.Format == images.JPEG || i.Format == images.TIFF
+		supportsExif := i.Format == images.JPEG || i.Format == images.TIFF || i.Format == images.DNG || i.Format == images.PNG
 		if !supportsExif {
 			return
 		}
@@ -83,6 +332,10 @@ func (i *imageResource) getExif() (*exif.Exif, error) {
 
 		x, err := i.getSpec().imaging.DecodeExif(f)
 		if err != nil {
+			if i.getSpec().imaging.Cfg.Exif.IgnoreErrors {
+				i.getSpec().Logger.WARN.Printf("Failed to read Exif in %q: %s", i.getSourceFilename(), err)
+				return
+			}
 			i.exifInitErr = err
 			return
 		}
@@ -94,15 +347,70 @@ func (i *imageResource) getExif() (*exif.Exif, error) {
 	return i.exif, i.exifInitErr
 }
 
+// getXMPCrop returns the crop in the XMP of the image, nil if none.
+func (i *imageResource) getXMPCrop() *images.XMPCrop {
+	i.xmpCropInit.Do(func() {
+		if i.Format != images.JPEG {
+			return
+		}
+		f, err := i.ReadSeekCloser()
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		c, ok, err := images.DecodeXMPCrop(f)
+		if err != nil {
+			i.getSpec().Logger.WARN.Printf("Failed to read XMP crop in %q: %s", i.getSourceFilename(), err)
+			return
+		}
+		if ok {
+			i.xmpCrop = &c
+		}
+	})
+
+	return i.xmpCrop
+}
+
+// hasICCProfile reports whether the image has an embedded ICC profile.
+func (i *imageResource) hasICCProfile() bool {
+	i.hasICCInit.Do(func() {
+		f, err := i.ReadSeekCloser()
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		b, _ := icc.Extract(f)
+		i.hasICC = b != nil
+	})
+
+	return i.hasICC
+}
+
 func (i *imageResource) Clone() resource.Resource {
 	gr := i.baseResource.Clone().(baseResource)
 	return &imageResource{
 		root:         i.root,
+		isOriginal:   i.isOriginal,
 		Image:        i.WithSpec(gr),
+		source:       i.source,
 		baseResource: gr,
 	}
 }
 
+// hash returns the hash of the source file, using the hashAlgorithm from
+// the imaging config.
+func (i *imageResource) hash() (string, error) {
+	return i.hashWith(i.getSpec().imaging.Cfg.HashFileFast)
+}
+
+// WithName returns a copy of the image with the given name. The copy shares
+// the image file and permalink with i, nothing is processed.
+func (i *imageResource) WithName(name string) resource.Image {
+	c := i.Clone().(*imageResource)
+	c.setName(name)
+	return c
+}
+
 func (i *imageResource) cloneWithUpdates(u *transformationUpdate) (baseResource, error) {
 	base, err := i.baseResource.cloneWithUpdates(u)
 	if err != nil {
@@ -120,6 +428,7 @@ func (i *imageResource) cloneWithUpdates(u *transformationUpdate) (baseResource,
 	return &imageResource{
 		root:         i.root,
 		Image:        img,
+		source:       i.source,
 		baseResource: base,
 	}, nil
 }
@@ -128,47 +437,382 @@ func (i *imageResource) cloneWithUpdates(u *transformationUpdate) (baseResource,
 // filter and returns the transformed image. If one of width or height is 0, the image aspect
 // ratio is preserved.
 func (i *imageResource) Resize(spec string) (resource.Image, error) {
-	conf, err := i.decodeImageConfig("resize", spec)
+	return i.processActionSpec("resize", spec)
+}
+
+// Fit scales down the image using the specified resample filter to fit the specified
+// maximum width and height.
+func (i *imageResource) Fit(spec string) (resource.Image, error) {
+	return i.processActionSpec("fit", spec)
+}
+
+// SrcSet resizes the image to each of the given widths and returns the
+// images, ordered by width, and the matching srcset attribute value.
+// Widths larger than the original are skipped if noUpscale is set in
+// the imaging config.
+func (i *imageResource) SrcSet(widths ...int) (resource.SrcSet, error) {
+	return i.srcSet(i.Resize, widths...)
+}
+
+// srcSet creates the srcset using resize, so a resource adapter can pass its
+// own Resize, which returns itself and not the unpublished original when a
+// width matches the original.
+func (i *imageResource) srcSet(resize func(spec string) (resource.Image, error), widths ...int) (resource.SrcSet, error) {
+	var set resource.SrcSet
+
+	widths = append([]int(nil), widths...)
+	sort.Ints(widths)
+
+	var attr []string
+	for j, w := range widths {
+		if w <= 0 {
+			return set, fmt.Errorf("invalid srcset width %d", w)
+		}
+		if j > 0 && widths[j-1] == w {
+			continue
+		}
+		if w > i.Width() && i.getSpec().imaging.Cfg.NoUpscale {
+			continue
+		}
+
+		img, err := resize(strconv.Itoa(w) + "x")
+		if err != nil {
+			return set, err
+		}
+		set.Images = append(set.Images, img)
+		attr = append(attr, fmt.Sprintf("%s %dw", img.Permalink(), img.Width()))
+	}
+
+	set.Attr = strings.Join(attr, ", ")
+
+	return set, nil
+}
+
+// FitInfo is the result of FitBox.
+type FitInfo struct {
+	Image  resource.Image
+	Width  int
+	Height int
+
+	// The factor the source image was scaled with.
+	Scale float64
+
+	// Whether the image was scaled up to fit the box.
+	Upscaled bool
+}
+
+// FitBox is the same as Fit, but it returns the image together with its
+// final dimensions and the scale factor used, e.g. for the width and height
+// attributes of an img element.
+func (i *imageResource) FitBox(spec string) (FitInfo, error) {
+	conf, err := i.decodeImageConfig("fit", spec)
+	if err != nil {
+		return FitInfo{}, err
+	}
+	img, err := i.Fit(spec)
+	if err != nil {
+		return FitInfo{}, err
+	}
+
+	width, height := i.Width(), i.Height()
+	if r := conf.Rotate % 180; r == 90 || r == -90 {
+		// The rotation is applied first.
+		width, height = height, width
+	}
+
+	info := FitInfo{Image: img, Width: img.Width(), Height: img.Height()}
+	if width > 0 {
+		info.Scale = float64(info.Width) / float64(width)
+	}
+	info.Upscaled = info.Width > width || info.Height > height
+	return info, nil
+}
+
+// ImageVariant is one of the images created by Variants.
+type ImageVariant struct {
+	// The spec used, e.g. "600x400".
+	Spec string
+
+	Image  resource.Image
+	Width  int
+	Height int
+}
+
+// Variants fits the image within each of the given boxes, like Fit, and
+// returns the results in the same order as the specs, e.g. to create the
+// sources of a picture element.
+func (i *imageResource) Variants(specs ...string) ([]ImageVariant, error) {
+	variants := make([]ImageVariant, len(specs))
+	for j, spec := range specs {
+		img, err := i.Fit(spec)
+		if err != nil {
+			return nil, err
+		}
+		variants[j] = ImageVariant{Spec: spec, Image: img, Width: img.Width(), Height: img.Height()}
+	}
+	return variants, nil
+}
+
+// Fill scales the image to the smallest possible size that will cover the specified dimensions,
+// crops the resized image to the specified dimensions using the given anchor point.
+// Space delimited config: 200x300 TopLeft
+func (i *imageResource) Fill(spec string) (resource.Image, error) {
+	return i.processActionSpec("fill", spec)
+}
+
+// Avatar crops the image to a square of the given size, like Fill, and makes
+// it round with a transparent circle mask. JPEG images are converted to PNG.
+func (i *imageResource) Avatar(size int) (resource.Image, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid avatar size %d", size)
+	}
+
+	conf, err := i.decodeImageConfig("fill", fmt.Sprintf("%dx%d", size, size))
 	if err != nil {
 		return nil, err
 	}
 
+	if conf.NoUpscale {
+		conf.ClampToSize(i.Width(), i.Height())
+	}
+
+	fillConf := conf
+	conf.Action = "avatar"
+	if !i.Format.SupportsTransparency() {
+		conf.TargetFormat = images.PNG
+	}
+
 	return i.doWithImageConfig(conf, func(src image.Image) (image.Image, error) {
-		return i.Proc.ApplyFiltersFromConfig(src, conf)
+		filled, err := i.Proc.ApplyFiltersFromConfig(src, fillConf)
+		if err != nil {
+			return nil, err
+		}
+		return i.Proc.Filter(filled, avatarMask)
 	})
 }
 
-// Fit scales down the image using the specified resample filter to fit the specified
-// maximum width and height.
-func (i *imageResource) Fit(spec string) (resource.Image, error) {
-	conf, err := i.decodeImageConfig("fit", spec)
+// ICO creates an ICO file, e.g. a favicon, holding square versions of the
+// image in the given sizes, e.g. 16, 32 and 48. The image is cropped to a
+// square like Fill, using the anchor from the imaging config.
+func (i *imageResource) ICO(sizes ...int) (resource.Image, error) {
+	if len(sizes) == 0 {
+		return nil, _errors.New("at least one ICO size must be provided")
+	}
+
+	sizes = append([]int(nil), sizes...)
+	sort.Ints(sizes)
+	unique := sizes[:0]
+	for j, size := range sizes {
+		if size < 1 || size > 256 {
+			return nil, fmt.Errorf("invalid ICO size %d, must be in range 1 to 256", size)
+		}
+		if j == 0 || size != sizes[j-1] {
+			unique = append(unique, size)
+		}
+	}
+	sizes = unique
+
+	largest := sizes[len(sizes)-1]
+	conf, err := i.decodeImageConfig("fill", fmt.Sprintf("%dx%d", largest, largest))
 	if err != nil {
 		return nil, err
 	}
 
+	fillConf := conf
+	conf.Action = "ico"
+	conf.TargetFormat = images.ICO
+	conf.ICOSizes = sizes
+
 	return i.doWithImageConfig(conf, func(src image.Image) (image.Image, error) {
-		return i.Proc.ApplyFiltersFromConfig(src, conf)
+		return i.Proc.ApplyFiltersFromConfig(src, fillConf)
 	})
 }
 
-// Fill scales the image to the smallest possible size that will cover the specified dimensions,
-// crops the resized image to the specified dimensions using the given anchor point.
-// Space delimited config: 200x300 TopLeft
-func (i *imageResource) Fill(spec string) (resource.Image, error) {
-	conf, err := i.decodeImageConfig("fill", spec)
+// AlphaMask returns the alpha channel of the image as a grayscale PNG image,
+// white where the image is opaque and black where it is transparent.
+// Images without transparency give a white image.
+func (i *imageResource) AlphaMask() (resource.Image, error) {
+	conf := i.Proc.GetDefaultImageConfig("alphamask")
+	conf.Key = internal.HashString("alphamask")
+	conf.TargetFormat = images.PNG
+
+	return i.doWithImageConfig(conf, func(src image.Image) (image.Image, error) {
+		return images.AlphaMask(src), nil
+	})
+}
+
+// CheckerboardPreview returns the image drawn over a checkerboard with cells
+// of cellSize pixels as an opaque PNG image, e.g. to review the transparency
+// of an image. Images without transparency are returned as is.
+func (i *imageResource) CheckerboardPreview(cellSize int) (resource.Image, error) {
+	if cellSize <= 0 {
+		return nil, fmt.Errorf("invalid checkerboard cell size %d, must be positive", cellSize)
+	}
+	if !i.Format.SupportsTransparency() {
+		return i.unchanged()
+	}
+
+	conf := i.Proc.GetDefaultImageConfig("checkerboard")
+	conf.Key = internal.HashString("checkerboard", cellSize)
+	conf.TargetFormat = images.PNG
+	// Keep the colors of the checkerboard, the palette of a paletted
+	// source does not have them.
+	conf.RGBA = true
+
+	return i.doWithImageConfig(conf, func(src image.Image) (image.Image, error) {
+		return images.Checkerboard(src, cellSize), nil
+	})
+}
+
+// Straighten rotates the image by the given angle in degrees counter-clockwise,
+// e.g. 2.5 to straighten a horizon tilted to the right, and crops it to the
+// largest rectangle with none of the corners the rotation leaves empty.
+func (i *imageResource) Straighten(degrees float64) (resource.Image, error) {
+	if math.IsNaN(degrees) || math.IsInf(degrees, 0) {
+		return nil, fmt.Errorf("invalid straighten angle %v", degrees)
+	}
+	if degrees == 0 {
+		return i.unchanged()
+	}
+
+	conf := i.Proc.GetDefaultImageConfig("straighten")
+	conf.Key = internal.HashString("straighten", degrees)
+	if i.Format == images.JPEG {
+		conf.Quality = i.Proc.Cfg.DefaultQuality(images.JPEG)
+	}
+
+	return i.doWithImageConfig(conf, func(src image.Image) (image.Image, error) {
+		return i.Proc.Filter(src, images.NewStraighten(degrees))
+	})
+}
+
+// OpenGraphCard creates a 1200x630 Open Graph card from the image, filled
+// like Fill and darkened towards the bottom, with the title in opts drawn
+// over it. See images.OpenGraphCardOptions for the options, e.g. a logo.
+func (i *imageResource) OpenGraphCard(opts map[string]interface{}) (resource.Image, error) {
+	cardOpts, err := images.DecodeOpenGraphCardOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	card, err := images.NewOpenGraphCard(cardOpts)
 	if err != nil {
 		return nil, err
 	}
 
+	conf, err := i.decodeImageConfig("fill", fmt.Sprintf("%dx%d", images.OpenGraphCardWidth, images.OpenGraphCardHeight))
+	if err != nil {
+		return nil, err
+	}
+
+	fillConf := conf
+	conf.Action = "ogcard"
+	conf.Key = internal.HashString(fillConf.GetKey(i.Format), card)
+	if i.Format == images.JPEG {
+		conf.Quality = i.Proc.Cfg.DefaultQuality(images.JPEG)
+	}
+
+	return i.doWithImageConfig(conf, func(src image.Image) (image.Image, error) {
+		filled, err := i.Proc.ApplyFiltersFromConfig(src, fillConf)
+		if err != nil {
+			return nil, err
+		}
+		return i.Proc.Filter(filled, card)
+	})
+}
+
+// Pad scales the image to fit inside the given dimensions and pads it with
+// the background color, so the result has exactly these dimensions.
+func (i *imageResource) Pad(spec string) (resource.Image, error) {
+	return i.processActionSpec("pad", spec)
+}
+
+func (i *imageResource) processActionSpec(action, spec string) (resource.Image, error) {
+	conf, err := i.decodeImageConfig(action, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	i.resolveMaxDimensions(&conf)
+
+	// This gives the same result as the plain spec with the dimensions.
+	conf.ResolveMegapixels(i.Width(), i.Height())
+
+	if conf.BgColor != nil && !i.Format.SupportsTransparency() {
+		if _, _, _, a := conf.BgColor.RGBA(); a != 0xffff {
+			conf.TargetFormat = images.PNG
+		}
+	}
+
+	if conf.NoUpscale {
+		width, height := i.Width(), i.Height()
+		if r := conf.Rotate % 180; r == 90 || r == -90 {
+			// The rotation is applied first.
+			width, height = height, width
+		}
+		conf.ClampToSize(width, height)
+	}
+
 	return i.doWithImageConfig(conf, func(src image.Image) (image.Image, error) {
 		return i.Proc.ApplyFiltersFromConfig(src, conf)
 	})
 }
 
+// resolveMaxDimensions resolves any maxwidth/maxheight constraint in conf against
+// this image's dimensions, rotated if needed.
+// The resolved config is equivalent to the plain spec, e.g. "maxwidth=600" on a
+// larger image gives the same result (and permalink) as "600x". An image that
+// already fits within the bounds keeps its size, as with "900x" on a 900 pixels
+// wide image, so any other options still apply.
+func (i *imageResource) resolveMaxDimensions(conf *images.ImageConfig) {
+	if conf.MaxWidth == 0 && conf.MaxHeight == 0 {
+		return
+	}
+
+	width, height := i.Width(), i.Height()
+	if r := conf.Rotate % 180; r == 90 || r == -90 {
+		// The rotation is applied first.
+		width, height = height, width
+	}
+
+	if (conf.MaxWidth == 0 || width <= conf.MaxWidth) && (conf.MaxHeight == 0 || height <= conf.MaxHeight) {
+		conf.Width, conf.Height = width, 0
+		conf.Action = "resize"
+	} else {
+		conf.Width, conf.Height = conf.MaxWidth, conf.MaxHeight
+		if conf.Width > 0 && conf.Height > 0 {
+			conf.Action = "fit"
+		} else {
+			conf.Action = "resize"
+		}
+	}
+	conf.MaxWidth, conf.MaxHeight = 0, 0
+}
+
 func (i *imageResource) Filter(filters ...gift.Filter) (resource.Image, error) {
+	if err := images.FilterError(filters...); err != nil {
+		return nil, err
+	}
+
+	if images.RequiresExif(filters...) {
+		// Processed images have no EXIF, use the original's. Images with
+		// EXIF that can't be read are treated as having none.
+		x, _ := i.root.getExif()
+		var err error
+		filters, err = images.ResolveExifFilters(x, i.getSpec().imaging.Cfg.ExifCaptionBlank, filters...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	conf := i.Proc.GetDefaultImageConfig("filter")
 	conf.Key = internal.HashString(filters)
 
+	if images.RequiresTransparency(filters...) && !i.Format.SupportsTransparency() {
+		conf.TargetFormat = images.PNG
+	} else if i.Format == images.JPEG {
+		conf.Quality = i.Proc.Cfg.DefaultQuality(images.JPEG)
+	}
+
 	return i.doWithImageConfig(conf, func(src image.Image) (image.Image, error) {
 		return i.Proc.Filter(src, filters...)
 	})
@@ -188,8 +832,78 @@ const imageProcWorkers = 1
 
 var imageProcSem = make(chan bool, imageProcWorkers)
 
+// The circle mask used in Avatar.
+var avatarMask = (&images.Filters{}).CircleMask()
+
+// ImageProcessedEvent holds information about a newly created image, see
+// Spec.ImageProcessedHook.
+type ImageProcessedEvent struct {
+	// The source filename of the image processed.
+	Path string
+
+	// The action, e.g. "resize" or "filter".
+	Action string
+
+	// The dimensions of the new image.
+	Width  int
+	Height int
+
+	// The time it took to decode and process the image.
+	Elapsed time.Duration
+}
+
 func (i *imageResource) doWithImageConfig(conf images.ImageConfig, f func(src image.Image) (image.Image, error)) (resource.Image, error) {
+	if i.Format == images.DNG && conf.TargetFormat == 0 {
+		// We can only decode DNG, so publish the result as a JPEG.
+		conf.TargetFormat = images.JPEG
+		if conf.Quality <= 0 {
+			conf.Quality = i.Proc.Cfg.DefaultQuality(images.JPEG)
+		}
+	}
+	if i.Format == images.ICO && conf.TargetFormat == 0 {
+		// The ICO sizes are set by the ICO method only, so publish the
+		// result as a PNG.
+		conf.TargetFormat = images.PNG
+	}
+
+	if i.Format == images.JPEG2000 && conf.TargetFormat == 0 {
+		// We can only decode JPEG 2000, so publish the result as a PNG,
+		// which keeps any transparency.
+		conf.TargetFormat = images.PNG
+	}
+
+	if conf.RGBA && conf.TargetFormat == 0 && (i.Format == images.JPEG || i.Format == images.GIF) {
+		// These can't store RGBA, PNG can.
+		conf.TargetFormat = images.PNG
+	}
+
+	if i.isOriginal && i.Proc.Cfg.ApplyXMPCrop {
+		conf.XMPCrop = i.getXMPCrop()
+	}
+
+	if conf.TagSRGB {
+		// The processed images have lost the profile of the original, if any.
+		format := conf.TargetFormat
+		if format == 0 {
+			format = i.Format
+		}
+		conf.TagSRGB = (format == images.JPEG || format == images.PNG) && !i.root.hasICCProfile()
+	}
+
+	if conf.Sharpen > 0 && (conf.Dominant || !conf.IsDownscale(i.Width(), i.Height())) {
+		// Only downscaled images get soft.
+		conf.Sharpen = 0
+	}
+
+	if i.isIdentity(conf) && i.canReturnUnchanged() {
+		// Re-encoding would only change the bytes, not the image.
+		return i, nil
+	}
+
 	return i.getSpec().imageCache.getOrCreate(i, conf, func() (*imageResource, image.Image, error) {
+		release := i.getSpec().imageMemory.acquire(i.estimateMemory(conf))
+		defer release()
+
 		imageProcSem <- true
 		defer func() {
 			<-imageProcSem
@@ -198,25 +912,33 @@ func (i *imageResource) doWithImageConfig(conf images.ImageConfig, f func(src im
 		errOp := conf.Action
 		errPath := i.getSourceFilename()
 
-		src, err := i.decodeSource()
-		if err != nil {
-			return nil, nil, &os.PathError{Op: errOp, Path: errPath, Err: err}
-		}
+		start := time.Now()
 
-		converted, err := f(src)
+		converted, err := i.downscaleStreaming(conf)
+		if err == nil && converted == nil {
+			converted, err = i.decodeAndApply(conf, f)
+		}
 		if err != nil {
+			if _, ok := err.(*corruptImageError); ok {
+				// It already names the file.
+				return nil, nil, err
+			}
 			return nil, nil, &os.PathError{Op: errOp, Path: errPath, Err: err}
 		}
 
-		if i.Format == images.PNG {
-			// Apply the colour palette from the source
-			if paletted, ok := src.(*image.Paletted); ok {
-				tmp := image.NewPaletted(converted.Bounds(), paletted.Palette)
-				draw.FloydSteinberg.Draw(tmp, tmp.Bounds(), converted, converted.Bounds().Min)
-				converted = tmp
-			}
+		if hook := i.getSpec().ImageProcessedHook; hook != nil {
+			b := converted.Bounds()
+			hook(ImageProcessedEvent{
+				Path:    errPath,
+				Action:  conf.Action,
+				Width:   b.Dx(),
+				Height:  b.Dy(),
+				Elapsed: time.Since(start),
+			})
 		}
 
+		i.getSpec().reportImageProcessed()
+
 		ci := i.clone(converted)
 		ci.setBasePath(conf)
 
@@ -224,30 +946,472 @@ func (i *imageResource) doWithImageConfig(conf images.ImageConfig, f func(src im
 	})
 }
 
+// decodeAndApply decodes the source image and applies f to it.
+func (i *imageResource) decodeAndApply(conf images.ImageConfig, f func(src image.Image) (image.Image, error)) (image.Image, error) {
+	src, err := i.decodeSource(conf.Page, conf.Frame)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.ToSRGB {
+		src, err = i.convertToSRGB(src)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.XMPCrop != nil {
+		src = conf.XMPCrop.Apply(src)
+	}
+
+	converted, err := f(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, gray := converted.(*image.Gray); i.Format == images.PNG && !gray && !conf.Dominant && !conf.RGBA {
+		// Apply the colour palette from the source. Grayscale results, e.g.
+		// an alpha mask, solid colors and forced RGBA are kept as is.
+		if paletted, ok := src.(*image.Paletted); ok {
+			tmp := image.NewPaletted(converted.Bounds(), paletted.Palette)
+			draw.FloydSteinberg.Draw(tmp, tmp.Bounds(), converted, converted.Bounds().Min)
+			converted = tmp
+		}
+	}
+
+	return converted, nil
+}
+
+// downscaleStreaming does a plain downscale of a TIFF image reading the
+// source in strips, if enabled by the lowMemory imaging option. It returns
+// a nil image if conf or the image is not supported, and the image must be
+// processed the normal way.
+func (i *imageResource) downscaleStreaming(conf images.ImageConfig) (image.Image, error) {
+	width, height, ok := i.streamingSize(conf)
+	if !ok {
+		return nil, nil
+	}
+
+	f, err := i.ReadSeekCloser()
+	if err != nil {
+		return nil, _errors.Wrap(err, "failed to open image for decode")
+	}
+	defer f.Close()
+
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		return nil, nil
+	}
+
+	img, err := images.DownscaleTIFF(ra, width, height)
+	if err == images.ErrStreamingNotSupported {
+		return nil, nil
+	}
+
+	return img, err
+}
+
+// streamingSize returns the size of the image processed with conf, and
+// whether it can be downscaled while streaming, see downscaleStreaming.
+func (i *imageResource) streamingSize(conf images.ImageConfig) (int, int, bool) {
+	if !i.Proc.Cfg.LowMemory || i.Format != images.TIFF || conf.Action != "resize" {
+		return 0, 0, false
+	}
+	if conf.Rotate != 0 || conf.ToSRGB || conf.Dominant || conf.RGBA || conf.Sharpen > 0 || conf.Page > 1 || conf.Frame > 0 || conf.Multiple > 1 || conf.XMPCrop != nil || conf.FilterStr != "box" {
+		return 0, 0, false
+	}
+
+	// Resolve the missing dimension the same way as the resize filter.
+	width, height := conf.Width, conf.Height
+	srcWidth, srcHeight := i.Width(), i.Height()
+	if width == 0 {
+		width = int(math.Max(1, math.Floor(float64(height)*float64(srcWidth)/float64(srcHeight)+0.5)))
+	} else if height == 0 {
+		height = int(math.Max(1, math.Floor(float64(width)*float64(srcHeight)/float64(srcWidth)+0.5)))
+	}
+	if width > srcWidth || height > srcHeight {
+		return 0, 0, false
+	}
+
+	return width, height, true
+}
+
+// canReturnUnchanged reports whether an operation that would not change i
+// can return i itself. Originals are not published with publishOriginals
+// disabled, so these must be processed to get a file to link to.
+func (i *imageResource) canReturnUnchanged() bool {
+	return !i.isOriginal || i.getSpec().imaging.Cfg.PublishOriginals
+}
+
+// unchanged returns i, or if i can't be returned unchanged, a processed
+// copy of it.
+func (i *imageResource) unchanged() (resource.Image, error) {
+	if i.canReturnUnchanged() {
+		return i, nil
+	}
+	conf := i.Proc.GetDefaultImageConfig("copy")
+	conf.Key = internal.HashString("copy")
+	if i.Format == images.JPEG {
+		conf.Quality = i.Proc.Cfg.DefaultQuality(images.JPEG)
+	}
+	return i.doWithImageConfig(conf, func(src image.Image) (image.Image, error) {
+		return src, nil
+	})
+}
+
+// isIdentity reports whether processing the image with conf would give an
+// image with the same dimensions and format, and no other changes.
+func (i *imageResource) isIdentity(conf images.ImageConfig) bool {
+	if conf.Rotate != 0 || conf.ToSRGB || conf.TagSRGB || conf.OptimizeHuffman || conf.Dominant || conf.RGBA || conf.Page > 1 || conf.Frame > 0 || conf.Multiple > 1 || conf.XMPCrop != nil {
+		return false
+	}
+
+	if conf.TargetFormat != 0 && conf.TargetFormat != i.Format {
+		return false
+	}
+
+	if i.isJPEG() && conf.Quality != i.Proc.Cfg.DefaultQuality(images.JPEG) {
+		// A new quality setting is a change.
+		return false
+	}
+
+	width, height := i.Width(), i.Height()
+
+	switch conf.Action {
+	case "resize":
+		if conf.Width == 0 {
+			return conf.Height == height
+		}
+		if conf.Height == 0 {
+			return conf.Width == width
+		}
+		return conf.Width == width && conf.Height == height
+	case "fill", "fit":
+		return conf.Width == width && conf.Height == height
+	default:
+		return false
+	}
+}
+
 func (i *imageResource) decodeImageConfig(action, spec string) (images.ImageConfig, error) {
-	conf, err := images.DecodeImageConfig(action, spec, i.Proc.Cfg)
+	cfg := i.Proc.Cfg
+	if filter := i.getResampleFilter(); filter != "" {
+		cfg.ResampleFilter = filter
+	}
+
+	conf, err := images.DecodeImageConfig(action, spec, cfg)
 	if err != nil {
 		return conf, err
 	}
 
-	iconf := i.Proc.Cfg
+	if conf.Quality <= 0 {
+		// Use the default quality of the format we encode to, if it has one.
+		targetFormat := conf.TargetFormat
+		if targetFormat == 0 {
+			targetFormat = i.Format
+		}
+		conf.Quality = i.Proc.Cfg.DefaultQuality(targetFormat)
+	}
 
-	if conf.Quality <= 0 && i.isJPEG() {
-		// We need a quality setting for all JPEGs
-		conf.Quality = iconf.Quality
+	if i.isOriginal {
+		// Processed images share the hash of the original, so this is only
+		// set for originals.
+		conf.SourceHash, _ = i.hash()
 	}
+	conf.SourceFilename = i.getSourceFilename()
 
 	return conf, nil
 }
 
-func (i *imageResource) decodeSource() (image.Image, error) {
+func (i *imageResource) setResampleFilter(filter string) error {
+	f, ok := images.ResampleFilter(filter)
+	if !ok {
+		return fmt.Errorf("invalid resample filter %q in metadata for %q", filter, i.Name())
+	}
+	i.resampleFilter = f
+	return nil
+}
+
+// getResampleFilter returns the resample filter set in the metadata of this
+// image or its original, if any.
+func (i *imageResource) getResampleFilter() string {
+	if i.resampleFilter != "" {
+		return i.resampleFilter
+	}
+	return i.root.resampleFilter
+}
+
+func (i *imageResource) decodeSource(page, frame int) (image.Image, error) {
+	if page > 1 && i.Format != images.TIFF {
+		return nil, _errors.New("the page option is only supported for TIFF images")
+	}
+	if frame > 0 && i.Format != images.GIF {
+		return nil, _errors.New("the frame option is only supported for GIF images")
+	}
 	f, err := i.ReadSeekCloser()
 	if err != nil {
 		return nil, _errors.Wrap(err, "failed to open image for decode")
 	}
 	defer f.Close()
-	img, _, err := image.Decode(f)
-	return img, err
+
+	var img image.Image
+	switch {
+	case page > 1:
+		img, err = images.DecodeTIFFPage(f, page)
+	case frame > 0:
+		img, err = images.DecodeGIFFrame(f, frame)
+	case i.Format == images.DNG:
+		img, err = images.DecodeDNGPreview(f)
+	case i.Format == images.ICO:
+		img, err = images.DecodeICO(f)
+	case i.Format == images.JPEG2000:
+		img, err = jpeg2000.Decode(f)
+	default:
+		img, _, err = image.Decode(f)
+	}
+	if err != nil {
+		return nil, i.checkCorrupt(err)
+	}
+
+	return img, nil
+}
+
+// corruptImageError is a decode error that suggests that the image file is
+// truncated or corrupt. It names the file so the bad asset is easy to find.
+type corruptImageError struct {
+	filename string
+	hint     string
+	err      error
+}
+
+func (e *corruptImageError) Error() string {
+	return fmt.Sprintf("failed to decode image %q, %s: %s", e.filename, e.hint, e.err)
+}
+
+// checkCorrupt returns err from decoding the image as a corruptImageError
+// if it is one of the errors from a truncated or corrupt file.
+func (i *imageResource) checkCorrupt(err error) error {
+	const (
+		truncated = "the file is truncated, e.g. by an incomplete download"
+		corrupt   = "the file is corrupt"
+	)
+
+	var hint string
+	switch cause := _errors.Cause(err).(type) {
+	case jpeg.FormatError:
+		if strings.HasPrefix(string(cause), "short") {
+			// The entropy coded data ends too soon.
+			hint = truncated
+		} else {
+			hint = corrupt
+		}
+	case png.FormatError, tiff.FormatError, jpeg2000.FormatError, qoi.FormatError, pnm.FormatError:
+		hint = corrupt
+	default:
+		switch {
+		case cause == io.ErrUnexpectedEOF || cause == io.EOF:
+			hint = truncated
+		case cause == image.ErrFormat:
+			hint = "the file is not an image, e.g. an error page saved with an image extension"
+		case strings.HasPrefix(cause.Error(), "gif: "):
+			hint = corrupt
+		default:
+			return err
+		}
+	}
+
+	return &corruptImageError{filename: i.getSourceFilename(), hint: hint, err: err}
+}
+
+// Publish publishes the image and, for processed images, applies the
+// publishModTime imaging option to the published files. Original images
+// are not published if publishOriginals is disabled.
+func (i *imageResource) Publish() error {
+	if i.isOriginal && !i.getSpec().imaging.Cfg.PublishOriginals {
+		return nil
+	}
+	if err := i.baseResource.Publish(); err != nil {
+		return err
+	}
+	return i.setPublishModTime()
+}
+
+// setPublishModTime sets the modification time of the published files of a
+// processed image as configured in publishModTime, so repeated builds
+// produce files with identical modification times. Original images are left
+// as is.
+func (i *imageResource) setPublishModTime() error {
+	if i.isOriginal {
+		return nil
+	}
+
+	mt, ok := i.getSpec().imaging.Cfg.PublishModTimeFor(i.root.modTime())
+	if !ok {
+		return nil
+	}
+
+	fs := i.getSpec().BaseFs.PublishFs
+	for _, filename := range i.getTargetFilenames() {
+		if err := fs.Chtimes(filename, mt, mt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FileSize returns the size in bytes of the image file. For processed images
+// this is the size of the encoded image in the file cache, the image is not
+// encoded again.
+func (i *imageResource) FileSize() (int64, error) {
+	f, err := i.ReadSeekCloser()
+	if err != nil {
+		return 0, err
+	}
+	size, err := f.Seek(0, io.SeekEnd)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return size, err
+}
+
+// ColorInfo returns the bit depth and color model of the image file, read
+// from its header. For processed images this is the file as encoded, e.g.
+// "YCbCr" for a JPEG.
+func (i *imageResource) ColorInfo() (images.ColorInfo, error) {
+	if i.isOriginal {
+		// The header of the original is already decoded.
+		return i.Image.ColorInfo()
+	}
+
+	i.colorInfoInit.Do(func() {
+		f, err := i.ReadSeekCloser()
+		if err != nil {
+			i.colorInfoErr = _errors.Wrap(err, "failed to open image for decode")
+			return
+		}
+		defer f.Close()
+		i.colorInfo, i.colorInfoErr = images.DecodeColorInfo(f, i.Format)
+	})
+
+	return i.colorInfo, i.colorInfoErr
+}
+
+// Derivatives returns the images processed from the source of this image
+// during the build, e.g. to report on the files published, sorted by their
+// cache key. This includes images processed from the processed images.
+func (i *imageResource) Derivatives() ([]resource.Image, error) {
+	h, err := i.hash()
+	if err != nil {
+		return nil, err
+	}
+	return i.getSpec().imageCache.getDerivatives(h), nil
+}
+
+// SameSource reports whether a and b are processed from the same original
+// image, regardless of any transformations applied to them, e.g. to skip
+// duplicate work in a template. Two originals with the same content are
+// also considered the same source.
+func SameSource(a, b resource.Image) bool {
+	ia, ok := toImageResource(a)
+	if !ok {
+		return false
+	}
+	ib, ok := toImageResource(b)
+	if !ok {
+		return false
+	}
+	if ia.root == ib.root {
+		return true
+	}
+	ha, err := ia.root.hash()
+	if err != nil {
+		return false
+	}
+	hb, err := ib.root.hash()
+	if err != nil {
+		return false
+	}
+	return ha == hb
+}
+
+func toImageResource(img resource.Image) (*imageResource, bool) {
+	switch v := img.(type) {
+	case *imageResource:
+		return v, true
+	case *resourceAdapter:
+		v.init(false, false)
+		i, ok := v.target.(*imageResource)
+		return i, ok
+	}
+	return nil, false
+}
+
+// DecodedImage returns the decoded pixel data of this image for custom
+// processing. Note that this is potentially expensive: the image is decoded
+// on first use and kept in memory for the lifetime of this resource. A
+// copy is returned, so it is safe to modify.
+func (i *imageResource) DecodedImage() (image.Image, error) {
+	img, err := i.getDecoded()
+	if err != nil {
+		return nil, err
+	}
+	return images.CloneImage(img), nil
+}
+
+// PixelAt returns the color of the pixel at x, y, counted from the upper
+// left corner, on the form #rrggbb, or #rrggbbaa if not opaque, e.g. to
+// match a background to the image. The image is decoded on first use and
+// kept in memory, as in DecodedImage.
+func (i *imageResource) PixelAt(x, y int) (string, error) {
+	img, err := i.getDecoded()
+	if err != nil {
+		return "", err
+	}
+	b := img.Bounds()
+	if x < 0 || y < 0 || x >= b.Dx() || y >= b.Dy() {
+		return "", fmt.Errorf("pixel %d,%d is outside of the %dx%d image", x, y, b.Dx(), b.Dy())
+	}
+	return images.HexColor(img.At(b.Min.X+x, b.Min.Y+y)), nil
+}
+
+// getDecoded returns the decoded image, decoding it on first use. The image
+// is shared and must not be modified.
+func (i *imageResource) getDecoded() (image.Image, error) {
+	i.decodedInit.Do(func() {
+		i.decoded, i.decodedErr = i.decodeSource(0, 0)
+	})
+	return i.decoded, i.decodedErr
+}
+
+// convertToSRGB converts src from the ICC profile embedded in this image
+// to sRGB. Images without a profile, or with a profile we cannot convert
+// from, are returned unchanged.
+func (i *imageResource) convertToSRGB(src image.Image) (image.Image, error) {
+	f, err := i.ReadSeekCloser()
+	if err != nil {
+		return nil, _errors.Wrap(err, "failed to open image for ICC profile")
+	}
+	defer f.Close()
+
+	b, err := icc.Extract(f)
+	if err != nil || b == nil {
+		return src, nil
+	}
+
+	p, err := icc.Parse(b)
+	if err != nil {
+		if err == icc.ErrUnsupportedProfile {
+			return src, nil
+		}
+		return nil, err
+	}
+
+	if p.IsSRGB() {
+		return src, nil
+	}
+
+	return p.ToSRGB(src), nil
 }
 
 func (i *imageResource) clone(img image.Image) *imageResource {
@@ -267,33 +1431,144 @@ func (i *imageResource) clone(img image.Image) *imageResource {
 	}
 }
 
+// setTargetFormat sets the format of a processed image that has been
+// converted to another format, along with its media type.
+func (i *imageResource) setTargetFormat(f images.Format) {
+	if f == 0 || f == i.Format {
+		return
+	}
+
+	i.Format = f
+
+	ext := f.DefaultExtension()
+	mediaType, found := i.getSpec().MediaTypes.GetFirstBySuffix(strings.TrimPrefix(ext, "."))
+	if !found {
+		mediaType, _ = media.FromStringAndExt(mime.TypeByExtension(ext), ext)
+	}
+	i.setMediaType(mediaType)
+}
+
 func (i *imageResource) setBasePath(conf images.ImageConfig) {
-	i.getResourcePaths().relTargetDirFile = i.relTargetPathFromConfig(conf)
+	i.setRelTargetPath(i.relTargetPathFromConfig(conf), conf)
+}
+
+// setRelTargetPath sets the target path of the processed image i to relTarget,
+// from relTargetPathFromConfig with conf. With the flatDir option the path is
+// no longer below the page of the original, with formatDirs the page path is
+// below the format directory.
+func (i *imageResource) setRelTargetPath(relTarget dirFile, conf images.ImageConfig) {
+	rp := i.getResourcePaths()
+	rp.relTargetDirFile = relTarget
+	if i.isFlatTarget(conf) {
+		rp.targetPathBuilder = nil
+		return
+	}
+	// The image may be processed from one in another format directory.
+	rp.targetPathBuilder = i.root.getResourcePaths().targetPathBuilder
+	if dir := i.formatDir(conf); dir != "" {
+		rp.targetPathBuilder = formatDirTargetPaths(dir, rp.targetPathBuilder)
+	}
+}
+
+// formatDirTargetPaths returns target paths as from base, but below dir.
+func formatDirTargetPaths(dir string, base func() page.TargetPaths) func() page.TargetPaths {
+	return func() page.TargetPaths {
+		var tp page.TargetPaths
+		if base != nil {
+			tp = base()
+		}
+		tp.SubResourceBaseTarget = filepath.Join(filepath.FromSlash(dir), tp.SubResourceBaseTarget)
+		tp.SubResourceBaseLink = path.Join("/", dir, tp.SubResourceBaseLink)
+		return tp
+	}
+}
+
+// isFlatTarget reports whether the images processed from i with conf are
+// published in the flatDir directory below the publish directory, rather than
+// below the page of the original. Formats in formatDirs are not.
+func (i *imageResource) isFlatTarget(conf images.ImageConfig) bool {
+	return i.getSpec().imaging.Cfg.FlatDir != "" && i.formatDir(conf) == ""
+}
+
+// formatDir returns the formatDirs directory for the images processed from
+// i with conf, "" if none.
+func (i *imageResource) formatDir(conf images.ImageConfig) string {
+	if conf.Action == "trace" {
+		// SVG.
+		return ""
+	}
+	format := i.Format
+	if conf.TargetFormat != 0 {
+		format = conf.TargetFormat
+	}
+	return i.getSpec().imaging.Cfg.FormatDir(format)
 }
 
 func (i *imageResource) relTargetPathFromConfig(conf images.ImageConfig) dirFile {
 	p1, p2 := helpers.FileAndExt(i.getResourcePaths().relTargetDirFile.file)
+
 	if conf.Action == "trace" {
 		p2 = ".svg"
+	} else if conf.TargetFormat != 0 && conf.TargetFormat != i.Format {
+		p2 = conf.TargetFormat.DefaultExtension()
 	}
 
 	h, _ := i.hash()
+
+	format := i.Format
+	if conf.TargetFormat != 0 {
+		format = conf.TargetFormat
+	}
+	key := conf.GetKey(format)
+
+	cfg := i.getSpec().imaging.Cfg
+
+	if i.isFlatTarget(conf) {
+		// The name of an already processed image is the hash of the processing so far.
+		var name string
+		if !i.isOriginal {
+			name = p1
+		}
+		return dirFile{
+			dir:  cfg.FlatDir + "/",
+			file: cfg.HashString(fmt.Sprintf("%s_%s_%d_%s%s", name, h, i.size(), key, p2)) + p2,
+		}
+	}
+
+	before, after, useTemplate := i.filenameTemplateParts()
+	if useTemplate {
+		// When processing an already processed image, the file name
+		// already has the template applied. Note that p1 has no directory.
+		p1 = strings.TrimPrefix(p1, before[strings.LastIndex(before, "/")+1:])
+		p1 = strings.TrimSuffix(p1, after)
+	}
+
 	idStr := fmt.Sprintf("_hu%s_%d", h, i.size())
 
 	// Do not change for no good reason.
 	const md5Threshold = 100
 
-	key := conf.GetKey(i.Format)
-
 	// It is useful to have the key in clear text, but when nesting transforms, it
 	// can easily be too long to read, and maybe even too long
 	// for the different OSes to handle.
-	if len(p1)+len(idStr)+len(p2) > md5Threshold {
-		key = helpers.MD5String(p1 + key + p2)
+	// This can be configured with fileNameMode.
+	tooLong := len(p1)+len(idStr)+len(p2) > md5Threshold
+	var hashed bool
+	switch cfg.FileNameMode {
+	case images.FileNameModeHashed:
+		hashed = true
+	case images.FileNameModeReadable:
+		hashed = false
+	default:
+		hashed = tooLong
+	}
+
+	if hashed {
+		key = cfg.HashString(p1 + key + p2)
 		huIdx := strings.Index(p1, "_hu")
 		if huIdx != -1 {
 			p1 = p1[:huIdx]
-		} else {
+		} else if tooLong {
 			// This started out as a very long file name. Making it even longer
 			// could melt ice in the Arctic.
 			p1 = ""
@@ -306,6 +1581,22 @@ func (i *imageResource) relTargetPathFromConfig(conf images.ImageConfig) dirFile
 
 	return dirFile{
 		dir:  i.getResourcePaths().relTargetDirFile.dir,
-		file: fmt.Sprintf("%s%s_%s%s", p1, idStr, key, p2),
+		file: fmt.Sprintf("%s%s%s_%s%s%s", before, p1, idStr, key, after, p2),
+	}
+}
+
+// filenameTemplateParts returns the expanded parts of the configured
+// filename template, if any, surrounding the default file name.
+// This requires the EXIF capture date of the original image.
+func (i *imageResource) filenameTemplateParts() (before, after string, ok bool) {
+	cfg := i.getSpec().imaging.Cfg
+	if cfg.FilenameTemplate == "" {
+		return
+	}
+	x, err := i.root.getExif()
+	if err != nil || x == nil || x.Date.IsZero() {
+		return
 	}
+	before, after = cfg.ExpandFilenameTemplate(x.Date)
+	return before, after, true
 }
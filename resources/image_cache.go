@@ -14,13 +14,22 @@
 package resources
 
 import (
+	"bytes"
+	"errors"
 	"image"
 	"io"
+	"io/ioutil"
+	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
+	"github.com/spf13/afero"
+
 	"github.com/gohugoio/hugo/resources/images"
+	"github.com/gohugoio/hugo/resources/resource"
 
 	"github.com/gohugoio/hugo/cache/filecache"
 	"github.com/gohugoio/hugo/helpers"
@@ -33,6 +42,10 @@ type imageCache struct {
 
 	mu    sync.RWMutex
 	store map[string]*resourceAdapter
+
+	// Maps the content hash of a source image to the keys in store of the
+	// images processed from it.
+	derivatives map[string][]string
 }
 
 func (c *imageCache) isInCache(key string) bool {
@@ -53,6 +66,48 @@ func (c *imageCache) deleteByPrefix(prefix string) {
 	}
 }
 
+// deleteBySourceHash removes all images derived from the source with the
+// given content hash from both the memory and the file cache, so they get
+// regenerated on next access.
+func (c *imageCache) deleteBySourceHash(hash string) error {
+	if hash == "" {
+		return errors.New("must provide a source hash")
+	}
+
+	// The readable filenames contain this, see relTargetPathFromConfig.
+	// This also finds the files cached in earlier builds.
+	id := "_hu" + hash + "_"
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The images processed in this build, whatever their names, e.g. in flatDir.
+	for _, k := range c.derivatives[hash] {
+		delete(c.store, k)
+		name := strings.TrimPrefix(filepath.Clean(k), helpers.FilePathSeparator)
+		if err := c.fileCache.Fs.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	delete(c.derivatives, hash)
+
+	for k := range c.store {
+		if strings.Contains(path.Base(k), id) {
+			delete(c.store, k)
+		}
+	}
+
+	return afero.Walk(c.fileCache.Fs, "", func(name string, info os.FileInfo, err error) error {
+		if err != nil || info == nil || info.IsDir() {
+			return nil
+		}
+		if strings.Contains(info.Name(), id) {
+			return c.fileCache.Fs.Remove(name)
+		}
+		return nil
+	})
+}
+
 func (c *imageCache) normalizeKey(key string) string {
 	// It is a path with Unix style slashes and it always starts with a leading slash.
 	key = filepath.ToSlash(key)
@@ -67,6 +122,26 @@ func (c *imageCache) clear() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.store = make(map[string]*resourceAdapter)
+	c.derivatives = make(map[string][]string)
+}
+
+// getDerivatives returns the images processed from the source with the given
+// content hash that are still in the cache, sorted by key.
+func (c *imageCache) getDerivatives(hash string) []resource.Image {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	keys := append([]string(nil), c.derivatives[hash]...)
+	sort.Strings(keys)
+
+	var derived []resource.Image
+	for _, k := range keys {
+		if img, found := c.store[k]; found {
+			derived = append(derived, img)
+		}
+	}
+
+	return derived
 }
 
 func (c *imageCache) getOrCreate(
@@ -74,6 +149,12 @@ func (c *imageCache) getOrCreate(
 	createImage func() (*imageResource, image.Image, error)) (*resourceAdapter, error) {
 	relTarget := parent.relTargetPathFromConfig(conf)
 	key := parent.relTargetPathForRel(relTarget.path(), false, false, false)
+	if parent.isFlatTarget(conf) {
+		// The same image processed the same way in different pages.
+		key = "/" + relTarget.path()
+	} else if dir := parent.formatDir(conf); dir != "" {
+		key = "/" + path.Join(dir, parent.root.relTargetPathForRel(relTarget.path(), false, false, false))
+	}
 
 	// First check the in-memory store, then the disk.
 	c.mu.RLock()
@@ -81,20 +162,35 @@ func (c *imageCache) getOrCreate(
 	c.mu.RUnlock()
 
 	if found {
-		return cachedImage, nil
+		return cachedImage.withFromCache(true), nil
 	}
 
-	var img *imageResource
+	var (
+		img     *imageResource
+		created bool
+	)
+
+	dedupe := parent.getSpec().imaging.Cfg.Deduplicate
 
 	// These funcs are protected by a named lock.
 	// read clones the parent to its new name and copies
 	// the content to the destinations.
 	read := func(info filecache.ItemInfo, r io.Reader) error {
 		img = parent.clone(nil)
+		img.setTargetFormat(conf.TargetFormat)
+		img.setRelTargetPath(relTarget, conf)
 		rp := img.getResourcePaths()
-		rp.relTargetDirFile.file = relTarget.file
 		img.setSourceFilename(info.Name)
 
+		if dedupe {
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			rp.relTargetDirFile.file = contentTargetFilename(parent.getSpec().imaging.Cfg, relTarget.file, b)
+			r = bytes.NewReader(b)
+		}
+
 		w, err := img.openDestinationsForWriting()
 		if err != nil {
 			return err
@@ -105,9 +201,15 @@ func (c *imageCache) getOrCreate(
 			return nil
 		}
 
-		defer w.Close()
 		_, err = io.Copy(w, r)
-		return err
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+
+		return img.setPublishModTime()
 	}
 
 	// create creates the image and encodes it to the cache (w).
@@ -119,11 +221,23 @@ func (c *imageCache) getOrCreate(
 		if err != nil {
 			return
 		}
+		created = true
+		img.setTargetFormat(conf.TargetFormat)
+		img.setRelTargetPath(relTarget, conf)
 		rp := img.getResourcePaths()
-		rp.relTargetDirFile.file = relTarget.file
 		img.setSourceFilename(info.Name)
 
-		return img.EncodeTo(conf, conv, w)
+		if !dedupe {
+			return img.EncodeTo(conf, conv, w)
+		}
+
+		var buf bytes.Buffer
+		if err = img.EncodeTo(conf, conv, &buf); err != nil {
+			return
+		}
+		rp.relTargetDirFile.file = contentTargetFilename(parent.getSpec().imaging.Cfg, relTarget.file, buf.Bytes())
+		_, err = w.Write(buf.Bytes())
+		return
 	}
 
 	// Now look in the file cache.
@@ -141,19 +255,43 @@ func (c *imageCache) getOrCreate(
 	// The file is now stored in this cache.
 	img.setSourceFs(c.fileCache.Fs)
 
+	img.source = newImageSource(parent, conf)
+
 	c.mu.Lock()
 	if cachedImage, found = c.store[key]; found {
 		c.mu.Unlock()
-		return cachedImage, nil
+		// Another goroutine got here first, e.g. reading the file this one created.
+		return cachedImage.withFromCache(!created), nil
 	}
 
 	imgAdapter := newResourceAdapter(parent.getSpec(), true, img)
+	imgAdapter.fromCache = !created
 	c.store[key] = imgAdapter
+	if h, err := parent.hash(); err == nil {
+		c.derivatives[h] = append(c.derivatives[h], key)
+	}
 	c.mu.Unlock()
 
 	return imgAdapter, nil
 }
 
+// contentTargetFilename returns the file name to use for the processed image
+// b with the deduplicate option, the hash of b in the directory of, and
+// with the extension of, filename.
+func contentTargetFilename(cfg images.Imaging, filename string, b []byte) string {
+	dir, ext := path.Dir(filename), path.Ext(filename)
+	name := cfg.HashString(string(b)) + ext
+	if dir == "." {
+		return name
+	}
+	return path.Join(dir, name)
+}
+
 func newImageCache(fileCache *filecache.Cache, ps *helpers.PathSpec) *imageCache {
-	return &imageCache{fileCache: fileCache, pathSpec: ps, store: make(map[string]*resourceAdapter)}
+	return &imageCache{
+		fileCache:   fileCache,
+		pathSpec:    ps,
+		store:       make(map[string]*resourceAdapter),
+		derivatives: make(map[string][]string),
+	}
 }
@@ -0,0 +1,89 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"context"
+
+	"github.com/gohugoio/hugo/resources/images"
+	"golang.org/x/sync/semaphore"
+)
+
+// imageMemoryBudget limits the estimated memory used by the images being
+// processed at the same time, see the maxMemory imaging option.
+type imageMemoryBudget struct {
+	sem   *semaphore.Weighted
+	limit int64
+}
+
+// newImageMemoryBudget creates a budget of the given number of megabytes.
+// It returns nil, no limit, if megabytes is 0.
+func newImageMemoryBudget(megabytes int) *imageMemoryBudget {
+	if megabytes <= 0 {
+		return nil
+	}
+	limit := int64(megabytes) << 20
+	return &imageMemoryBudget{sem: semaphore.NewWeighted(limit), limit: limit}
+}
+
+// acquire blocks until n bytes of the budget are available and reserves
+// them. The returned func releases them. An image estimated to need more
+// than the whole budget gets all of it, so it is processed alone.
+func (b *imageMemoryBudget) acquire(n int64) func() {
+	if b == nil {
+		return func() {}
+	}
+	if n > b.limit {
+		n = b.limit
+	}
+	if n < 1 {
+		n = 1
+	}
+	// This can only fail when the context is done.
+	_ = b.sem.Acquire(context.Background(), n)
+	return func() {
+		b.sem.Release(n)
+	}
+}
+
+// estimateMemory returns the estimated number of bytes needed to process
+// i with conf, the decoded source and the result at 4 bytes per pixel, or 8
+// with depth=16. When downscaled while streaming, only one source row is
+// held in memory. The dimensions are read from the image header.
+func (i *imageResource) estimateMemory(conf images.ImageConfig) int64 {
+	w, h := int64(i.Width()), int64(i.Height())
+
+	if sw, sh, ok := i.streamingSize(conf); ok {
+		// The result is always 8 bits per channel.
+		return 4 * (w + int64(sw)*int64(sh))
+	}
+
+	bytesPerPixel := int64(4)
+	if conf.Depth == 16 {
+		bytesPerPixel = 8
+	}
+
+	tw, th := int64(conf.Width), int64(conf.Height)
+	switch {
+	case tw > 0 && th > 0:
+	case tw > 0 && w > 0:
+		th = h * tw / w
+	case th > 0 && h > 0:
+		tw = w * th / h
+	default:
+		tw, th = w, h
+	}
+
+	return bytesPerPixel * (w*h + tw*th)
+}
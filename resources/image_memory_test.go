@@ -0,0 +1,99 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/gohugoio/hugo/resources/images"
+)
+
+func TestImageMemoryBudget(t *testing.T) {
+	c := qt.New(t)
+
+	// maxConcurrent runs n goroutines reserving size bytes each and returns
+	// the most that held their reservation at the same time.
+	maxConcurrent := func(b *imageMemoryBudget, n int, size int64) int32 {
+		var (
+			wg      sync.WaitGroup
+			current int32
+			max     int32
+			maxMu   sync.Mutex
+			entered = make(chan struct{}, n)
+		)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release := b.acquire(size)
+				defer release()
+				v := atomic.AddInt32(&current, 1)
+				maxMu.Lock()
+				if v > max {
+					max = v
+				}
+				maxMu.Unlock()
+				entered <- struct{}{}
+				time.Sleep(20 * time.Millisecond)
+				atomic.AddInt32(&current, -1)
+			}()
+		}
+		wg.Wait()
+		c.Assert(len(entered), qt.Equals, n)
+		return max
+	}
+
+	const mb = 1 << 20
+
+	c.Assert(maxConcurrent(newImageMemoryBudget(1), 4, mb), qt.Equals, int32(1))
+	// Larger than the budget, processed alone.
+	c.Assert(maxConcurrent(newImageMemoryBudget(1), 4, 10*mb), qt.Equals, int32(1))
+	c.Assert(maxConcurrent(newImageMemoryBudget(100), 4, mb) > 1, qt.Equals, true)
+	c.Assert(maxConcurrent(newImageMemoryBudget(2), 4, mb) <= 2, qt.Equals, true)
+	c.Assert(maxConcurrent(nil, 4, 10*mb) > 1, qt.Equals, true)
+	c.Assert(newImageMemoryBudget(0), qt.IsNil)
+}
+
+func TestImageMemoryBudgetProcess(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	// Less than one image needs, so they are processed one by one.
+	spec.imageMemory = newImageMemoryBudget(1)
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
+
+	conf, err := images.DecodeImageConfig("resize", "300x", spec.imaging.Cfg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(image.(*resourceAdapter).target.(*imageResource).estimateMemory(conf), qt.Equals, int64(4*(900*562+300*187)))
+	conf, err = images.DecodeImageConfig("resize", "300x depth=16", spec.imaging.Cfg)
+	c.Assert(err, qt.IsNil)
+	c.Assert(image.(*resourceAdapter).target.(*imageResource).estimateMemory(conf), qt.Equals, int64(8*(900*562+300*187)))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resized, err := image.Resize(fmt.Sprintf("%dx", 100+i))
+			c.Check(err, qt.IsNil)
+			c.Check(resized.Width(), qt.Equals, 100+i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -14,14 +14,28 @@
 package resources
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	stdimage "image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"text/template"
+	"time"
 
 	"github.com/spf13/afero"
 
@@ -31,8 +45,12 @@ import (
 
 	"github.com/gohugoio/hugo/media"
 	"github.com/gohugoio/hugo/resources/images"
+	"github.com/gohugoio/hugo/resources/images/icc"
+	"github.com/gohugoio/hugo/resources/images/pnm"
+	"github.com/gohugoio/hugo/resources/images/qoi"
 	"github.com/gohugoio/hugo/resources/resource"
 	"github.com/google/go-cmp/cmp"
+	"golang.org/x/image/tiff"
 
 	"github.com/gohugoio/hugo/htesting/hqt"
 
@@ -115,7 +133,7 @@ func TestImageTransformBasic(t *testing.T) {
 
 	smart, err := image.Fill("200x100 smart")
 	c.Assert(err, qt.IsNil)
-	c.Assert(smart.RelPermalink(), qt.Equals, fmt.Sprintf("/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_200x100_fill_q68_linear_smart%d.jpg", 1))
+	c.Assert(smart.RelPermalink(), qt.Equals, fmt.Sprintf("/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_200x100_fill_q68_linear_smart%d.jpg", 2))
 	assertWidthHeight(smart, 200, 100)
 	assertFileCache(c, fileCache, smart.RelPermalink(), 200, 100)
 
@@ -126,193 +144,3004 @@ func TestImageTransformBasic(t *testing.T) {
 	assertFileCache(c, fileCache, filledAgain.RelPermalink(), 200, 100)
 }
 
+func TestImageTransformMaxDimensions(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c)
+
+	// Larger than the bounds, so this is the same as "600x".
+	resized, err := image.Resize("maxwidth=600")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.Width(), qt.Equals, 600)
+	c.Assert(resized.Height(), qt.Equals, 375)
+	c.Assert(resized.RelPermalink(), qt.Equals, "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_600x0_resize_q68_linear.jpg")
+	plain, err := image.Resize("600x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized, eq, plain)
+
+	resized, err = image.Resize("maxwidth=600 maxheight=300")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.Width(), qt.Equals, 480)
+	c.Assert(resized.Height(), qt.Equals, 300)
+	c.Assert(resized.RelPermalink(), qt.Equals, "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_600x300_fit_q68_linear.jpg")
+
+	resized, err = image.Fit("maxheight=200")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.Height(), qt.Equals, 200)
+	c.Assert(resized.RelPermalink(), qt.Equals, "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_0x200_resize_q68_linear.jpg")
+
+	// Already within the bounds.
+	for _, spec := range []string{"maxwidth=1200", "maxwidth=900", "maxwidth=1200 maxheight=600"} {
+		unchanged, err := image.Resize(spec)
+		c.Assert(err, qt.IsNil)
+		c.Assert(unchanged, eq, image)
+		c.Assert(unchanged.RelPermalink(), qt.Equals, "/a/sunset.jpg")
+		c.Assert(unchanged.Width(), qt.Equals, 900)
+		c.Assert(unchanged.Height(), qt.Equals, 562)
+	}
+
+	// Already within the bounds, but with other options, which still apply.
+	for _, test := range []struct {
+		spec          string
+		plain         string
+		width, height int
+		mediaType     string
+	}{
+		{"maxwidth=1200 r90", "562x r90", 562, 900, "image/jpg"},
+		{"maxwidth=1200 q20", "900x q20", 900, 562, "image/jpg"},
+		{"maxwidth=1200 qoi", "900x qoi", 900, 562, "image/qoi"},
+		{"maxwidth=1200 maxheight=1200 q20", "900x q20", 900, 562, "image/jpg"},
+		// The bounds apply to the rotated image.
+		{"maxwidth=1200 maxheight=600 r90", "", 375, 600, "image/jpg"},
+	} {
+		resized, err := image.Resize(test.spec)
+		c.Assert(err, qt.IsNil)
+		c.Assert(resized.RelPermalink(), qt.Not(qt.Equals), "/a/sunset.jpg")
+		c.Assert(resized.Width(), qt.Equals, test.width)
+		c.Assert(resized.Height(), qt.Equals, test.height)
+		c.Assert(resized.MediaType().Type(), qt.Equals, test.mediaType)
+		if test.plain != "" {
+			plain, err := image.Resize(test.plain)
+			c.Assert(err, qt.IsNil)
+			c.Assert(resized, eq, plain)
+		}
+	}
+
+	_, err = image.Resize("300x maxwidth=600")
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestImageTransformMegapixels(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c)
+
+	// This is the same as "1789x1117".
+	resized, err := image.Resize("mp=2")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.Width(), qt.Equals, 1789)
+	c.Assert(resized.Height(), qt.Equals, 1117)
+	plain, err := image.Resize("1789x1117")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized, eq, plain)
+	c.Assert(resized.RelPermalink(), qt.Equals, plain.RelPermalink())
+
+	resized, err = image.Resize("mp=0.1")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.Width(), qt.Equals, 400)
+	c.Assert(resized.Height(), qt.Equals, 249)
+}
+
 // https://github.com/gohugoio/hugo/issues/4261
 func TestImageTransformLongFilename(t *testing.T) {
 	c := qt.New(t)
 
-	image := fetchImage(c, "1234567890qwertyuiopasdfghjklzxcvbnm5to6eeeeee7via8eleph.jpg")
-	c.Assert(image, qt.Not(qt.IsNil))
+	image := fetchImage(c, "1234567890qwertyuiopasdfghjklzxcvbnm5to6eeeeee7via8eleph.jpg")
+	c.Assert(image, qt.Not(qt.IsNil))
+
+	resized, err := image.Resize("200x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized, qt.Not(qt.IsNil))
+	c.Assert(resized.Width(), qt.Equals, 200)
+	c.Assert(resized.RelPermalink(), qt.Equals, "/a/_hu59e56ffff1bc1d8d122b1403d34e039f_90587_65b757a6e14debeae720fe8831f0a9bc.jpg")
+	resized, err = resized.Resize("100x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized, qt.Not(qt.IsNil))
+	c.Assert(resized.Width(), qt.Equals, 100)
+	c.Assert(resized.RelPermalink(), qt.Equals, "/a/_hu59e56ffff1bc1d8d122b1403d34e039f_90587_c876768085288f41211f768147ba2647.jpg")
+}
+
+// Issue 6137
+func TestImageTransformUppercaseExt(t *testing.T) {
+	c := qt.New(t)
+	image := fetchImage(c, "sunrise.JPG")
+
+	resized, err := image.Resize("200x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized, qt.Not(qt.IsNil))
+	c.Assert(resized.Width(), qt.Equals, 200)
+}
+
+// https://github.com/gohugoio/hugo/issues/5730
+func TestImagePermalinkPublishOrder(t *testing.T) {
+	for _, checkOriginalFirst := range []bool{true, false} {
+		name := "OriginalFirst"
+		if !checkOriginalFirst {
+			name = "ResizedFirst"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			c := qt.New(t)
+			spec, workDir := newTestResourceOsFs(c)
+			defer func() {
+				os.Remove(workDir)
+			}()
+
+			check1 := func(img resource.Image) {
+				resizedLink := "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_100x50_resize_q75_box.jpg"
+				c.Assert(img.RelPermalink(), qt.Equals, resizedLink)
+				assertImageFile(c, spec.PublishFs, resizedLink, 100, 50)
+			}
+
+			check2 := func(img resource.Image) {
+				c.Assert(img.RelPermalink(), qt.Equals, "/a/sunset.jpg")
+				assertImageFile(c, spec.PublishFs, "a/sunset.jpg", 900, 562)
+			}
+
+			orignal := fetchImageForSpec(spec, c, "sunset.jpg")
+			c.Assert(orignal, qt.Not(qt.IsNil))
+
+			if checkOriginalFirst {
+				check2(orignal)
+			}
+
+			resized, err := orignal.Resize("100x50")
+			c.Assert(err, qt.IsNil)
+
+			check1(resized.(resource.Image))
+
+			if !checkOriginalFirst {
+				check2(orignal)
+			}
+		})
+	}
+}
+
+func TestImageNoPublishOriginals(t *testing.T) {
+	c := qt.New(t)
+	spec, workDir := newTestResourceOsFs(c)
+	defer func() {
+		os.Remove(workDir)
+	}()
+	spec.imaging.Cfg.PublishOriginals = false
+
+	original := fetchImageForSpec(spec, c, "sunset.jpg")
+	c.Assert(original.RelPermalink(), qt.Equals, "/a/sunset.jpg")
+	_, err := spec.PublishFs.Stat(filepath.FromSlash("a/sunset.jpg"))
+	c.Assert(os.IsNotExist(err), qt.Equals, true)
+
+	resized, err := original.Resize("100x50")
+	c.Assert(err, qt.IsNil)
+	assertImageFile(c, spec.PublishFs, resized.RelPermalink(), 100, 50)
+
+	// The same size, but the original is not published, so this is
+	// processed to get a file to link to.
+	same, err := original.Resize("900x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(same.RelPermalink(), qt.Not(qt.Equals), "/a/sunset.jpg")
+	assertImageFile(c, spec.PublishFs, same.RelPermalink(), 900, 562)
+	_, err = spec.PublishFs.Stat(filepath.FromSlash("a/sunset.jpg"))
+	c.Assert(os.IsNotExist(err), qt.Equals, true)
+
+	// Processed images still use the fast path.
+	again, err := same.Resize("900x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(again.RelPermalink(), qt.Equals, same.RelPermalink())
+
+	// Renamed originals are still originals.
+	hero, err := original.(*resourceAdapter).WithName("hero")
+	c.Assert(err, qt.IsNil)
+	c.Assert(hero.RelPermalink(), qt.Equals, "/a/sunset.jpg")
+	_, err = spec.PublishFs.Stat(filepath.FromSlash("a/sunset.jpg"))
+	c.Assert(os.IsNotExist(err), qt.Equals, true)
+	heroSame, err := hero.Resize("900x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(heroSame.RelPermalink(), qt.Equals, same.RelPermalink())
+
+	// The same for the other operations that leave the image as is.
+	for _, op := range []func() (resource.Image, error){
+		func() (resource.Image, error) { return original.Resize("maxwidth=2000") },
+		func() (resource.Image, error) { return original.(*resourceAdapter).Straighten(0) },
+		func() (resource.Image, error) { return original.(*resourceAdapter).CheckerboardPreview(8) },
+	} {
+		img, err := op()
+		c.Assert(err, qt.IsNil)
+		c.Assert(img.RelPermalink(), qt.Not(qt.Equals), "/a/sunset.jpg")
+		assertImageFile(c, spec.PublishFs, img.RelPermalink(), 900, 562)
+	}
+}
+
+func TestImageDeferPublish(t *testing.T) {
+	c := qt.New(t)
+	spec, workDir := newTestResourceOsFs(c)
+	defer func() {
+		os.Remove(workDir)
+	}()
+	spec.imaging.Cfg.DeferPublish = true
+
+	notExist := func(filename string) bool {
+		_, err := spec.PublishFs.Stat(filepath.FromSlash(filename))
+		return os.IsNotExist(err)
+	}
+
+	original := fetchImageForSpec(spec, c, "sunset.jpg")
+	c.Assert(PublishIsDeferred(original), qt.Equals, true)
+	c.Assert(RelPermalinkNoUsage(original), qt.Equals, "/a/sunset.jpg")
+
+	resized, err := original.Resize("100x50")
+	c.Assert(err, qt.IsNil)
+	link := resized.RelPermalink()
+	c.Assert(notExist(link), qt.Equals, true)
+
+	spec.PublishDeferred()
+
+	assertImageFile(c, spec.PublishFs, link, 100, 50)
+	// Never used.
+	c.Assert(notExist("a/sunset.jpg"), qt.Equals, true)
+
+	// Used after the flush, published in the next.
+	c.Assert(original.RelPermalink(), qt.Equals, "/a/sunset.jpg")
+	c.Assert(notExist("a/sunset.jpg"), qt.Equals, true)
+	spec.PublishDeferred()
+	assertImageFile(c, spec.PublishFs, "a/sunset.jpg", 900, 562)
+
+	spec.imaging.Cfg.DeferPublish = false
+	c.Assert(PublishIsDeferred(original), qt.Equals, false)
+}
+
+func TestImageTransformConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+
+	c := qt.New(t)
+
+	spec, workDir := newTestResourceOsFs(c)
+	defer func() {
+		os.Remove(workDir)
+	}()
+
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				img := image
+				for k := 0; k < 2; k++ {
+					r1, err := img.Resize(fmt.Sprintf("%dx", id-k))
+					if err != nil {
+						t.Error(err)
+					}
+
+					if r1.Width() != id-k {
+						t.Errorf("Width: %d:%d", r1.Width(), j)
+					}
+
+					r2, err := r1.Resize(fmt.Sprintf("%dx", id-k-1))
+					if err != nil {
+						t.Error(err)
+					}
+
+					img = r2
+				}
+			}
+		}(i + 20)
+	}
+
+	wg.Wait()
+}
+
+func TestImageWithMetadata(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c)
+
+	meta := []map[string]interface{}{
+		{
+			"title": "My Sunset",
+			"name":  "Sunset #:counter",
+			"src":   "*.jpg",
+		},
+	}
+
+	c.Assert(AssignMetadata(meta, image), qt.IsNil)
+	c.Assert(image.Name(), qt.Equals, "Sunset #1")
+
+	resized, err := image.Resize("200x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.Name(), qt.Equals, "Sunset #1")
+}
+
+func TestImageResize8BitPNG(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchImage(c, "gohugoio.png")
+
+	c.Assert(image.MediaType().Type(), qt.Equals, "image/png")
+	c.Assert(image.RelPermalink(), qt.Equals, "/a/gohugoio.png")
+	c.Assert(image.ResourceType(), qt.Equals, "image")
+
+	resized, err := image.Resize("800x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.MediaType().Type(), qt.Equals, "image/png")
+	c.Assert(resized.RelPermalink(), qt.Equals, "/a/gohugoio_hu0e1b9e4a4be4d6f86c7b37b9ccce3fbc_73886_800x0_resize_linear_2.png")
+	c.Assert(resized.Width(), qt.Equals, 800)
+}
+
+func TestImageResizeInSubPath(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchImage(c, "sub/gohugoio2.png")
+	fileCache := image.(specProvider).getSpec().FileCaches.ImageCache().Fs
+
+	c.Assert(image.MediaType(), eq, media.PNGType)
+	c.Assert(image.RelPermalink(), qt.Equals, "/a/sub/gohugoio2.png")
+	c.Assert(image.ResourceType(), qt.Equals, "image")
+
+	resized, err := image.Resize("101x101")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.MediaType().Type(), qt.Equals, "image/png")
+	c.Assert(resized.RelPermalink(), qt.Equals, "/a/sub/gohugoio2_hu0e1b9e4a4be4d6f86c7b37b9ccce3fbc_73886_101x101_resize_linear_2.png")
+	c.Assert(resized.Width(), qt.Equals, 101)
+
+	assertFileCache(c, fileCache, resized.RelPermalink(), 101, 101)
+	publishedImageFilename := filepath.Clean(resized.RelPermalink())
+
+	spec := image.(specProvider).getSpec()
+
+	assertImageFile(c, spec.BaseFs.PublishFs, publishedImageFilename, 101, 101)
+	c.Assert(spec.BaseFs.PublishFs.Remove(publishedImageFilename), qt.IsNil)
+
+	// Cleare mem cache to simulate reading from the file cache.
+	spec.imageCache.clear()
+
+	resizedAgain, err := image.Resize("101x101")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resizedAgain.RelPermalink(), qt.Equals, "/a/sub/gohugoio2_hu0e1b9e4a4be4d6f86c7b37b9ccce3fbc_73886_101x101_resize_linear_2.png")
+	c.Assert(resizedAgain.Width(), qt.Equals, 101)
+	assertFileCache(c, fileCache, resizedAgain.RelPermalink(), 101, 101)
+	assertImageFile(c, image.(specProvider).getSpec().BaseFs.PublishFs, publishedImageFilename, 101, 101)
+}
+
+func TestImageReadSeekCloser(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c)
+	spec := image.(specProvider).getSpec()
+	fileCache := spec.FileCaches.ImageCache().Fs
+
+	readAll := func(img resource.Image) []byte {
+		c.Helper()
+		r, err := img.ReadSeekCloser()
+		c.Assert(err, qt.IsNil)
+		defer r.Close()
+		b, err := ioutil.ReadAll(r)
+		c.Assert(err, qt.IsNil)
+		return b
+	}
+
+	checkResized := func(resized resource.Image) {
+		c.Helper()
+		b := readAll(resized)
+		fi, err := fileCache.Stat(filepath.Clean(resized.RelPermalink()))
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(b), qt.Equals, int(fi.Size()))
+
+		config, _, err := stdimage.DecodeConfig(bytes.NewReader(b))
+		c.Assert(err, qt.IsNil)
+		c.Assert(config.Width, qt.Equals, 300)
+	}
+
+	// Freshly generated.
+	resized, err := image.Resize("300x")
+	c.Assert(err, qt.IsNil)
+	checkResized(resized)
+
+	// Read from the file cache.
+	spec.imageCache.clear()
+	resized, err = image.Resize("300x")
+	c.Assert(err, qt.IsNil)
+	checkResized(resized)
+
+	c.Assert(len(readAll(image)), qt.Equals, 90587)
+}
+
+func TestImageDeleteCacheBySourceHash(t *testing.T) {
+	c := qt.New(t)
+
+	sunset := fetchSunset(c)
+	spec := sunset.(specProvider).getSpec()
+	logo := fetchImageForSpec(spec, c, "sub/gohugoio2.png")
+	fileCache := spec.FileCaches.ImageCache().Fs
+
+	resized, err := sunset.Resize("300x")
+	c.Assert(err, qt.IsNil)
+	filled, err := resized.Fill("100x100")
+	c.Assert(err, qt.IsNil)
+	logoResized, err := logo.Resize("50x")
+	c.Assert(err, qt.IsNil)
+
+	exists := func(img resource.Image) bool {
+		_, err := fileCache.Stat(filepath.Clean(img.RelPermalink()))
+		return err == nil
+	}
+
+	c.Assert(exists(resized), qt.Equals, true)
+	c.Assert(exists(filled), qt.Equals, true)
+
+	c.Assert(spec.DeleteImageCacheBySourceHash(""), qt.Not(qt.IsNil))
+	c.Assert(spec.DeleteImageCacheBySourceHash("59e56ffff1bc1d8d122b1403d34e039f"), qt.IsNil)
+
+	c.Assert(exists(resized), qt.Equals, false)
+	c.Assert(exists(filled), qt.Equals, false)
+	c.Assert(exists(logoResized), qt.Equals, true)
+	c.Assert(spec.IsInImageCache(resized.RelPermalink()), qt.Equals, false)
+	c.Assert(spec.IsInImageCache(logoResized.RelPermalink()), qt.Equals, true)
+
+	resizedAgain, err := sunset.Resize("300x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resizedAgain, qt.Not(eq), resized)
+	c.Assert(resizedAgain.RelPermalink(), qt.Equals, resized.RelPermalink())
+	assertFileCache(c, fileCache, resizedAgain.RelPermalink(), 300, 187)
+
+	logoResizedAgain, err := logo.Resize("50x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(logoResizedAgain, eq, logoResized)
+}
+
+func TestImageFilterRequiresTransparency(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c)
+	spec := image.(specProvider).getSpec()
+	fileCache := spec.FileCaches.ImageCache().Fs
+	f := &images.Filters{}
+
+	resized, err := image.Resize("100x")
+	c.Assert(err, qt.IsNil)
+
+	shadowed, err := resized.Filter(f.DropShadow(5, 5, 4, "#00000080"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(shadowed.MediaType(), eq, media.PNGType)
+	c.Assert(shadowed.RelPermalink(), qt.Matches, `/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_.*\.png`)
+	c.Assert(shadowed.Width(), qt.Equals, 109)
+	c.Assert(shadowed.Height(), qt.Equals, 71)
+	assertFileCache(c, fileCache, shadowed.RelPermalink(), 109, 71)
+
+	// Read it back from the file cache.
+	spec.imageCache.clear()
+	shadowedAgain, err := resized.Filter(f.DropShadow(5, 5, 4, "#00000080"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(shadowedAgain.MediaType(), eq, media.PNGType)
+	c.Assert(shadowedAgain.RelPermalink(), qt.Equals, shadowed.RelPermalink())
+	c.Assert(shadowedAgain.Width(), qt.Equals, 109)
+
+	// A PNG stays a PNG.
+	png := fetchImageForSpec(spec, c, "sub/gohugoio2.png")
+	shadowed, err = png.Filter(f.DropShadow(5, 5, 4, "#00000080"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(shadowed.MediaType(), eq, media.PNGType)
+}
+
+func TestImageFilterLUT(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
+	f := &images.Filters{}
+
+	resized, err := image.Resize("100x")
+	c.Assert(err, qt.IsNil)
+
+	lut := fetchResourceForSpec(spec, c, "invert.cube")
+	inverted, err := resized.Filter(f.LUT(lut))
+	c.Assert(err, qt.IsNil)
+	c.Assert(inverted.Width(), qt.Equals, 100)
+
+	// The LUT content is part of the key.
+	invertedAgain, err := resized.Filter(f.LUT(lut))
+	c.Assert(err, qt.IsNil)
+	c.Assert(invertedAgain.RelPermalink(), qt.Equals, inverted.RelPermalink())
+	inverted2, err := resized.Filter(f.LUT(fetchResourceForSpec(spec, c, "invert.cube", "v2")))
+	c.Assert(err, qt.IsNil)
+	c.Assert(inverted2.RelPermalink(), qt.Equals, inverted.RelPermalink())
+	inverted3, err := resized.Filter(f.Invert())
+	c.Assert(err, qt.IsNil)
+	c.Assert(inverted3.RelPermalink(), qt.Not(qt.Equals), inverted.RelPermalink())
+}
+
+func TestImageFilterPattern(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	sunset := fetchImageForSpec(spec, c, "sunset.jpg")
+	tile := fetchImageForSpec(spec, c, "gohugoio8.png")
+	f := &images.Filters{}
+
+	tiled, err := sunset.Filter(f.Pattern(tile, 0.3))
+	c.Assert(err, qt.IsNil)
+	c.Assert(tiled.Width(), qt.Equals, sunset.Width())
+	c.Assert(tiled.Height(), qt.Equals, sunset.Height())
+
+	// The tile and the opacity are part of the key.
+	again, err := sunset.Filter(f.Pattern(fetchImageForSpec(spec, c, "gohugoio8.png"), 0.3))
+	c.Assert(err, qt.IsNil)
+	c.Assert(again.RelPermalink(), qt.Equals, tiled.RelPermalink())
+	opaque, err := sunset.Filter(f.Pattern(tile, 0.6))
+	c.Assert(err, qt.IsNil)
+	c.Assert(opaque.RelPermalink(), qt.Not(qt.Equals), tiled.RelPermalink())
+	otherTile, err := sunset.Filter(f.Pattern(fetchImageForSpec(spec, c, "frame.png"), 0.3))
+	c.Assert(err, qt.IsNil)
+	c.Assert(otherTile.RelPermalink(), qt.Not(qt.Equals), tiled.RelPermalink())
+}
+
+func TestImageMontage(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	sunset := fetchImageForSpec(spec, c, "sunset.jpg")
+	gopher := fetchImageForSpec(spec, c, "sub/gohugoio2.png")
+	portrait := fetchImageForSpec(spec, c, "portrait.png")
+
+	montage := func(cols, gap int, bg string, imgs ...resource.Image) resource.Image {
+		others := make([]resource.ReadSeekCloserResource, len(imgs))
+		for i, img := range imgs {
+			others[i] = img
+		}
+		f, err := images.NewMontage(others, cols, 100, 80, gap, bg)
+		c.Assert(err, qt.IsNil)
+		img, err := sunset.Filter(f)
+		c.Assert(err, qt.IsNil)
+		return img
+	}
+
+	// Three images in two columns, the last cell is empty.
+	sheet := montage(2, 10, "#ff0000", gopher, portrait)
+	c.Assert(sheet.Width(), qt.Equals, 210)
+	c.Assert(sheet.Height(), qt.Equals, 170)
+	c.Assert(sheet.MediaType().Type(), qt.Equals, "image/jpg")
+
+	decoded := decodeImage(c, sheet)
+	isRed := func(x, y int) bool {
+		r, g, b, _ := decoded.At(x, y).RGBA()
+		return r>>8 > 230 && g>>8 < 30 && b>>8 < 30
+	}
+	c.Assert(isRed(105, 40), qt.Equals, true)
+	c.Assert(isRed(160, 130), qt.Equals, true)
+	c.Assert(isRed(50, 40), qt.Equals, false)
+
+	// The images and the layout are part of the key.
+	again := montage(2, 10, "#ff0000", fetchImageForSpec(spec, c, "sub/gohugoio2.png"), portrait)
+	c.Assert(again.RelPermalink(), qt.Equals, sheet.RelPermalink())
+	c.Assert(montage(3, 10, "#ff0000", gopher, portrait).RelPermalink(), qt.Not(qt.Equals), sheet.RelPermalink())
+	c.Assert(montage(2, 10, "#ff0000", portrait, gopher).RelPermalink(), qt.Not(qt.Equals), sheet.RelPermalink())
+	c.Assert(montage(2, 5, "#ff0000", gopher, portrait).RelPermalink(), qt.Not(qt.Equals), sheet.RelPermalink())
+
+	// A transparent background needs a PNG.
+	c.Assert(montage(2, 10, "transparent", gopher).MediaType().Type(), qt.Equals, "image/png")
+
+	_, err := images.NewMontage(nil, 0, 100, 80, 0, "")
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestImageFilterFrame(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	screenshot := fetchImageForSpec(spec, c, "portrait.png")
+	frame := fetchImageForSpec(spec, c, "frame.png")
+	f := &images.Filters{}
+
+	mockup, err := screenshot.Filter(f.Frame(frame, 20, 20, 60, 120))
+	c.Assert(err, qt.IsNil)
+	c.Assert(mockup.Width(), qt.Equals, 100)
+	c.Assert(mockup.Height(), qt.Equals, 160)
+
+	// The frame and the placement are part of the key.
+	mockupAgain, err := screenshot.Filter(f.Frame(fetchImageForSpec(spec, c, "frame.png"), 20, 20, 60, 120))
+	c.Assert(err, qt.IsNil)
+	c.Assert(mockupAgain.RelPermalink(), qt.Equals, mockup.RelPermalink())
+	moved, err := screenshot.Filter(f.Frame(frame, 10, 20, 60, 120))
+	c.Assert(err, qt.IsNil)
+	c.Assert(moved.RelPermalink(), qt.Not(qt.Equals), mockup.RelPermalink())
+	otherFrame, err := screenshot.Filter(f.Frame(fetchImageForSpec(spec, c, "lowcontrast.png"), 20, 20, 60, 120))
+	c.Assert(err, qt.IsNil)
+	c.Assert(otherFrame.RelPermalink(), qt.Not(qt.Equals), mockup.RelPermalink())
+
+	resized, err := screenshot.Resize("60x120")
+	c.Assert(err, qt.IsNil)
+	got, want := decodeImage(c, mockup), decodeImage(c, resized)
+	for _, p := range []stdimage.Point{{0, 0}, {30, 60}, {30, 100}, {59, 119}} {
+		gr, gg, gb, _ := got.At(p.X+20, p.Y+20).RGBA()
+		wr, wg, wb, _ := want.At(p.X, p.Y).RGBA()
+		c.Assert([]uint32{gr >> 8, gg >> 8, gb >> 8}, qt.DeepEquals, []uint32{wr >> 8, wg >> 8, wb >> 8}, qt.Commentf("%v", p))
+	}
+	for _, p := range []stdimage.Point{{0, 0}, {19, 80}, {80, 80}, {50, 140}} {
+		r, g, b, _ := got.At(p.X, p.Y).RGBA()
+		c.Assert([]uint32{r >> 8, g >> 8, b >> 8}, qt.DeepEquals, []uint32{40, 40, 40}, qt.Commentf("%v", p))
+	}
+}
+
+func TestImageFilenameTemplate(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	spec.imaging.Cfg.FilenameTemplate = ":year/:month/:filename-:day"
+
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
+
+	resized, err := image.Resize("200x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.RelPermalink(), qt.Equals, "/a/2017/10/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_200x0_resize_q68_linear-27.jpg")
+
+	// Processing a processed image should not repeat the date.
+	resizedAgain, err := resized.Resize("100x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resizedAgain.RelPermalink(), qt.Matches, `/a/2017/10/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_[0-9a-f]{32}-27\.jpg`)
+	c.Assert(resizedAgain.Width(), qt.Equals, 100)
+
+	// No EXIF, use the default naming.
+	png := fetchImageForSpec(spec, c, "sub/gohugoio2.png")
+	resized, err = png.Resize("50x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.RelPermalink(), qt.Equals, "/a/sub/gohugoio2_hu0e1b9e4a4be4d6f86c7b37b9ccce3fbc_73886_50x0_resize_linear_2.png")
+}
+
+func TestImageDeduplicate(t *testing.T) {
+	c := qt.New(t)
+
+	fs := afero.NewMemMapFs()
+
+	for _, cached := range []bool{false, true} {
+		spec := newTestResourceSpec(specDescriptor{c: c, fs: fs})
+		spec.imaging.Cfg.Deduplicate = true
+
+		// Two sources with the same content.
+		image1 := fetchImageForSpec(spec, c, "sunset.jpg")
+		image2 := fetchResourceForSpec(spec, c, "sunset.jpg", "copy").(resource.Image)
+
+		resized1, err := image1.Resize("100x")
+		c.Assert(err, qt.IsNil)
+		resized2, err := image2.Resize("100x")
+		c.Assert(err, qt.IsNil)
+		c.Assert(resized1.RelPermalink(), qt.Matches, `/a/[0-9a-f]{32}\.jpg`, qt.Commentf("cached: %t", cached))
+		c.Assert(resized2.RelPermalink(), qt.Equals, resized1.RelPermalink())
+
+		other, err := image2.Resize("101x")
+		c.Assert(err, qt.IsNil)
+		c.Assert(other.RelPermalink(), qt.Not(qt.Equals), resized1.RelPermalink())
+
+		published, err := afero.ReadDir(spec.BaseFs.PublishFs, "a")
+		c.Assert(err, qt.IsNil)
+		c.Assert(published, qt.HasLen, 2)
+		assertImageFile(c, spec.BaseFs.PublishFs, resized1.RelPermalink(), 100, 62)
+	}
+}
+
+func TestImageFlatDir(t *testing.T) {
+	c := qt.New(t)
+
+	fs := afero.NewMemMapFs()
+
+	var names []string
+	for _, cached := range []bool{false, true} {
+		spec := newTestResourceSpec(specDescriptor{c: c, fs: fs})
+		spec.imaging.Cfg.FlatDir = "images"
+
+		// The same content in different pages.
+		image1 := fetchImageForSpec(spec, c, "sunset.jpg")
+		filename := filepath.Join(spec.WorkingDir, "sunset.jpg")
+		r, err := spec.New(ResourceSourceDescriptor{Fs: spec.Fs.Source, TargetPaths: newTargetPaths("/b/c"), LazyPublish: true, RelTargetFilename: "sub/sunset.jpg", SourceFilename: filename})
+		c.Assert(err, qt.IsNil)
+		image2 := r.(resource.Image)
+		c.Assert(image2.RelPermalink(), qt.Equals, "/b/c/sub/sunset.jpg")
+
+		resized1, err := image1.Resize("100x")
+		c.Assert(err, qt.IsNil)
+		resized2, err := image2.Resize("100x")
+		c.Assert(err, qt.IsNil)
+		c.Assert(resized1.RelPermalink(), qt.Matches, `/images/[0-9a-f]{32}\.jpg`, qt.Commentf("cached: %t", cached))
+		c.Assert(resized2.RelPermalink(), qt.Equals, resized1.RelPermalink())
+
+		other, err := image1.Resize("100x qoi")
+		c.Assert(err, qt.IsNil)
+		c.Assert(other.RelPermalink(), qt.Matches, `/images/[0-9a-f]{32}\.qoi`)
+
+		// Processing a processed image.
+		filled, err := resized1.Fill("50x50")
+		c.Assert(err, qt.IsNil)
+		c.Assert(filled.RelPermalink(), qt.Matches, `/images/[0-9a-f]{32}\.jpg`)
+		direct, err := image1.Fill("50x50")
+		c.Assert(err, qt.IsNil)
+		c.Assert(direct.RelPermalink(), qt.Not(qt.Equals), filled.RelPermalink())
+
+		published, err := afero.ReadDir(spec.BaseFs.PublishFs, "images")
+		c.Assert(err, qt.IsNil)
+		c.Assert(published, qt.HasLen, 4)
+		assertImageFile(c, spec.BaseFs.PublishFs, resized1.RelPermalink(), 100, 62)
+		assertImageFile(c, spec.BaseFs.PublishFs, filled.RelPermalink(), 50, 50)
+
+		names = append(names, resized1.RelPermalink()+" "+other.RelPermalink()+" "+filled.RelPermalink())
+	}
+
+	// The names are the same in the next build.
+	c.Assert(names[1], qt.Equals, names[0])
+}
+
+func TestImageFormatDirs(t *testing.T) {
+	c := qt.New(t)
+
+	fs := afero.NewMemMapFs()
+	cfg, err := images.DecodeConfig(map[string]interface{}{
+		"formatDirs": map[string]interface{}{"jpg": "img/jpg", "qoi": "/img/qoi/"},
+	})
+	c.Assert(err, qt.IsNil)
+
+	var names []string
+	for _, cached := range []bool{false, true} {
+		spec := newTestResourceSpec(specDescriptor{c: c, fs: fs})
+		spec.imaging.Cfg = cfg
+
+		image := fetchImageForSpec(spec, c, "sunset.jpg")
+
+		resized, err := image.Resize("100x")
+		c.Assert(err, qt.IsNil)
+		// The usual name, with the page path below the format directory.
+		c.Assert(resized.RelPermalink(), qt.Equals, "/img/jpg/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_100x0_resize_q75_box.jpg", qt.Commentf("cached: %t", cached))
+
+		assertImageFile(c, spec.BaseFs.PublishFs, resized.RelPermalink(), 100, 62)
+
+		converted, err := image.Resize("100x qoi")
+		c.Assert(err, qt.IsNil)
+		c.Assert(converted.RelPermalink(), qt.Equals, "/img/qoi/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_100x0_resize_box.qoi")
+
+		// Processing a processed image.
+		filled, err := resized.Fill("50x50 qoi")
+		c.Assert(err, qt.IsNil)
+		c.Assert(filled.RelPermalink(), qt.Matches, `/img/qoi/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_.*\.qoi`)
+		c.Assert(filled.RelPermalink(), qt.Not(qt.Equals), converted.RelPermalink())
+		assertImageFile(c, spec.BaseFs.PublishFs, filled.RelPermalink(), 50, 50)
+
+		// Not configured, next to the original.
+		ppm, err := resized.Resize("20x ppm")
+		c.Assert(err, qt.IsNil)
+		c.Assert(ppm.RelPermalink(), qt.Matches, `/a/sunset_hu.*\.ppm`)
+		other, err := fetchImageForSpec(spec, c, "gohugoio24.png").Resize("10x")
+		c.Assert(err, qt.IsNil)
+		c.Assert(other.RelPermalink(), qt.Matches, `/a/gohugoio24_hu.*\.png`)
+
+		names = append(names, resized.RelPermalink()+" "+converted.RelPermalink()+" "+filled.RelPermalink()+" "+ppm.RelPermalink())
+	}
+
+	// The names are the same in the next build.
+	c.Assert(names[1], qt.Equals, names[0])
+}
+
+func TestImageFitBox(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c).(*resourceAdapter)
+
+	info, err := image.FitBox("200x200")
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.Image.Width(), qt.Equals, 200)
+	c.Assert(info.Image.Height(), qt.Equals, 125)
+	c.Assert(info.Width, qt.Equals, 200)
+	c.Assert(info.Height, qt.Equals, 125)
+	c.Assert(info.Scale, qt.Equals, 200.0/900)
+	c.Assert(info.Upscaled, qt.Equals, false)
+
+	// Fit does not scale up.
+	info, err = image.FitBox("1800x2000")
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.Image.Width(), qt.Equals, 900)
+	c.Assert(info.Width, qt.Equals, 900)
+	c.Assert(info.Height, qt.Equals, 562)
+	c.Assert(info.Scale, qt.Equals, 1.0)
+	c.Assert(info.Upscaled, qt.Equals, false)
+
+	// The scale is relative to the rotated image.
+	info, err = image.FitBox("100x100 r90")
+	c.Assert(err, qt.IsNil)
+	c.Assert(info.Width, qt.Equals, 62)
+	c.Assert(info.Height, qt.Equals, 100)
+	c.Assert(info.Scale, qt.Equals, 62.0/562)
+	c.Assert(info.Upscaled, qt.Equals, false)
+
+	// In a template.
+	tmpl := template.Must(template.New("").Parse(`{{ $fit := .FitBox "200x200" }}{{ $fit.Width }}x{{ $fit.Height }} {{ $fit.Image.Width }}`))
+	var buf bytes.Buffer
+	c.Assert(tmpl.Execute(&buf, image), qt.IsNil)
+	c.Assert(buf.String(), qt.Equals, "200x125 200")
+
+	_, err = image.FitBox("foo")
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestImageNoUpscale(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
+
+	// Disabled by default.
+	resized, err := image.Resize("1800x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.Width(), qt.Equals, 1800)
+	c.Assert(resized.RelPermalink(), qt.Equals, "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_1800x0_resize_q68_linear.jpg")
+
+	spec = newTestResourceSpec(specDescriptor{c: c})
+	spec.imaging.Cfg.NoUpscale = true
+	image = fetchImageForSpec(spec, c, "sunset.jpg")
+
+	resized, err = image.Resize("1800x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.Width(), qt.Equals, 900)
+	c.Assert(resized.Height(), qt.Equals, 562)
+	// Same as asking for the original size, which is the original.
+	c.Assert(resized.RelPermalink(), qt.Equals, "/a/sunset.jpg")
+
+	filled, err := image.Fill("1800x900")
+	c.Assert(err, qt.IsNil)
+	c.Assert(filled.Width(), qt.Equals, 900)
+	c.Assert(filled.Height(), qt.Equals, 450)
+
+	// Smaller images are not affected.
+	resized, err = image.Resize("300x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.RelPermalink(), qt.Equals, "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_300x0_resize_q68_linear.jpg")
+
+	// Rotation is applied first.
+	rotated, err := image.Resize("900x r90")
+	c.Assert(err, qt.IsNil)
+	c.Assert(rotated.Width(), qt.Equals, 562)
+}
+
+func TestImageIdentity(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c)
+
+	for _, spec := range []string{"900x", "x562", "900x562", "900x562 q68"} {
+		resized, err := image.Resize(spec)
+		c.Assert(err, qt.IsNil)
+		c.Assert(resized, eq, image, qt.Commentf(spec))
+		c.Assert(resized.RelPermalink(), qt.Equals, "/a/sunset.jpg")
+	}
+
+	for _, action := range []func(string) (resource.Image, error){image.Fill, image.Fit} {
+		same, err := action("900x562")
+		c.Assert(err, qt.IsNil)
+		c.Assert(same.RelPermalink(), qt.Equals, "/a/sunset.jpg")
+	}
+
+	// These change the image.
+	for _, spec := range []string{"900x q50", "900x r180", "900x tosrgb", "900x optimize", "800x"} {
+		resized, err := image.Resize(spec)
+		c.Assert(err, qt.IsNil)
+		c.Assert(resized.RelPermalink(), qt.Not(qt.Equals), "/a/sunset.jpg", qt.Commentf(spec))
+	}
+
+	// Filters always create a new image.
+	filtered, err := image.Filter((&images.Filters{}).Brightness(0))
+	c.Assert(err, qt.IsNil)
+	c.Assert(filtered.RelPermalink(), qt.Not(qt.Equals), "/a/sunset.jpg")
+
+	// Format conversion.
+	avatar, err := image.Avatar(562)
+	c.Assert(err, qt.IsNil)
+	c.Assert(avatar.MediaType().Type(), qt.Equals, "image/png")
+}
+
+func TestImageCLAHEGolden(t *testing.T) {
+	c := qt.New(t)
+
+	devMode := false
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "lowcontrast.png")
+
+	filtered, err := image.Filter((&images.Filters{}).CLAHE(4, 3))
+	c.Assert(err, qt.IsNil)
+
+	assertImageGolden(c, filtered, "lowcontrast_clahe.png", devMode)
+
+	_, err = image.Filter((&images.Filters{}).CLAHE(0, 3))
+	c.Assert(err, qt.ErrorMatches, ".*tile grid.*")
+}
+
+func TestImagePaletteGolden(t *testing.T) {
+	c := qt.New(t)
+
+	devMode := false
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	f := &images.Filters{}
+
+	sunset := fetchImageForSpec(spec, c, "sunset.jpg")
+	small, err := sunset.Resize("120x")
+	c.Assert(err, qt.IsNil)
+
+	for _, test := range []struct {
+		image  resource.Image
+		filter gift.Filter
+		golden string
+	}{
+		{small, f.Palette("websafe"), "sunset_websafe.png"},
+		{fetchImageForSpec(spec, c, "lowcontrast.png"), f.Palette("grayscale-16", "ordered"), "lowcontrast_grayscale16.png"},
+	} {
+		filtered, err := test.image.Filter(test.filter)
+		c.Assert(err, qt.IsNil)
+		assertImageGolden(c, filtered, test.golden, devMode)
+	}
+}
+
+func TestImageShadowHighlightGolden(t *testing.T) {
+	c := qt.New(t)
+
+	devMode := false
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	f := &images.Filters{}
+
+	img := fetchImageForSpec(spec, c, "highcontrast.png")
+	filtered, err := img.Filter(f.ShadowHighlight(70, 50))
+	c.Assert(err, qt.IsNil)
+	assertImageGolden(c, filtered, "highcontrast_shadowhighlight.png", devMode)
+
+	other, err := img.Filter(f.ShadowHighlight(70, 0))
+	c.Assert(err, qt.IsNil)
+	c.Assert(other.RelPermalink(), qt.Not(qt.Equals), filtered.RelPermalink())
+
+	// The checker pattern in the shadows has more contrast.
+	detail := func(img stdimage.Image) int {
+		a := color.NRGBAModel.Convert(img.At(8, 8)).(color.NRGBA)
+		b := color.NRGBAModel.Convert(img.At(12, 8)).(color.NRGBA)
+		return int(a.G) - int(b.G)
+	}
+	src, err := img.(*resourceAdapter).DecodedImage()
+	c.Assert(err, qt.IsNil)
+	dst, err := filtered.(*resourceAdapter).DecodedImage()
+	c.Assert(err, qt.IsNil)
+	c.Assert(detail(dst) > detail(src), qt.Equals, true)
+}
+
+// A composed filter is keyed by the filters it is made of, not by its name.
+func TestImageFilterCompose(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	f := &images.Filters{}
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
+
+	newLook := func(name string) gift.Filter {
+		return f.Compose(name, f.Grayscale(), f.Contrast(20), f.Sepia(30))
+	}
+
+	filtered, err := image.Filter(newLook("look"))
+	c.Assert(err, qt.IsNil)
+	link := filtered.RelPermalink()
+
+	// Stable between builds and names.
+	spec.imageCache.clear()
+	again, err := image.Filter(newLook("renamed"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(again.RelPermalink(), qt.Equals, link)
+
+	// Distinct from other chains and from the filters applied one by one.
+	other, err := image.Filter(f.Compose("look", f.Grayscale(), f.Contrast(30), f.Sepia(30)))
+	c.Assert(err, qt.IsNil)
+	c.Assert(other.RelPermalink(), qt.Not(qt.Equals), link)
+	chained, err := image.Filter(f.Grayscale(), f.Contrast(20), f.Sepia(30))
+	c.Assert(err, qt.IsNil)
+	c.Assert(chained.RelPermalink(), qt.Not(qt.Equals), link)
+}
+
+// The grain is seeded from the filter options and the image dimensions,
+// so the same input must give the same pixels in every build.
+func TestImageFilmGrainGolden(t *testing.T) {
+	c := qt.New(t)
+
+	devMode := false
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	f := &images.Filters{}
+
+	sunset := fetchImageForSpec(spec, c, "sunset.jpg")
+	small, err := sunset.Resize("120x")
+	c.Assert(err, qt.IsNil)
+
+	for _, test := range []struct {
+		image  resource.Image
+		filter gift.Filter
+		golden string
+	}{
+		{fetchImageForSpec(spec, c, "lowcontrast.png"), f.FilmGrain(30, 1, false), "lowcontrast_filmgrain.png"},
+		{small, f.FilmGrain(50, 3, true), "sunset_filmgrain_mono.png"},
+	} {
+		filtered, err := test.image.Filter(test.filter)
+		c.Assert(err, qt.IsNil)
+		assertImageGolden(c, filtered, test.golden, devMode)
+
+		// A new build must produce the same image.
+		spec.imageCache.clear()
+		again, err := test.image.Filter(test.filter)
+		c.Assert(err, qt.IsNil)
+		assertImageGolden(c, again, test.golden, false)
+	}
+}
+
+// assertImageGolden compares the pixels of img with the golden file in
+// testdata, or writes the golden file if devMode is set.
+func assertImageGolden(c *qt.C, img resource.Image, golden string, devMode bool) {
+	decode := func(r io.Reader) stdimage.Image {
+		img, _, err := stdimage.Decode(r)
+		c.Assert(err, qt.IsNil)
+		return img
+	}
+
+	r, err := img.ReadSeekCloser()
+	c.Assert(err, qt.IsNil)
+	got := decode(r)
+	r.Close()
+
+	goldenFilename := filepath.Join("testdata", golden)
+
+	if devMode {
+		out, err := os.Create(goldenFilename)
+		c.Assert(err, qt.IsNil)
+		c.Assert(png.Encode(out, got), qt.IsNil)
+		out.Close()
+		return
+	}
+
+	// Compare the pixels, the encoded bytes may differ between Go versions.
+	gf, err := os.Open(goldenFilename)
+	c.Assert(err, qt.IsNil)
+	expected := decode(gf)
+	gf.Close()
+
+	c.Assert(got.Bounds(), qt.Equals, expected.Bounds())
+	for y := 0; y < got.Bounds().Dy(); y++ {
+		for x := 0; x < got.Bounds().Dx(); x++ {
+			c.Assert(color.NRGBAModel.Convert(got.At(x, y)), qt.Equals, color.NRGBAModel.Convert(expected.At(x, y)), qt.Commentf("%s %d,%d", golden, x, y))
+		}
+	}
+}
+
+func TestImageFileSize(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c)
+	fileCache := image.(specProvider).getSpec().FileCaches.ImageCache().Fs
+
+	size, err := image.FileSize()
+	c.Assert(err, qt.IsNil)
+	c.Assert(size, qt.Equals, int64(90587))
+
+	for _, spec := range []string{"300x", "100x r90"} {
+		resized, err := image.Resize(spec)
+		c.Assert(err, qt.IsNil)
+
+		fi, err := fileCache.Stat(filepath.Clean(resized.RelPermalink()))
+		c.Assert(err, qt.IsNil)
+
+		size, err := resized.FileSize()
+		c.Assert(err, qt.IsNil)
+		c.Assert(size, qt.Equals, fi.Size())
+		c.Assert(size < 90587, qt.Equals, true)
+	}
+}
+
+func TestImageDNG(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "sample.dng")
+
+	c.Assert(image.ResourceType(), qt.Equals, "image")
+	c.Assert(image.MediaType(), eq, media.DNGType)
+	c.Assert(image.RelPermalink(), qt.Equals, "/a/sample.dng")
+
+	// The dimensions of the embedded preview.
+	c.Assert(image.Width(), qt.Equals, 64)
+	c.Assert(image.Height(), qt.Equals, 48)
+
+	resized, err := image.Resize("32x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.Width(), qt.Equals, 32)
+	c.Assert(resized.Height(), qt.Equals, 24)
+	c.Assert(resized.MediaType(), eq, media.JPGType)
+	c.Assert(resized.RelPermalink(), qt.Matches, `/a/sample_hu.*_32x0_resize_q68_linear\.jpg`)
+
+	f, err := resized.ReadSeekCloser()
+	c.Assert(err, qt.IsNil)
+	defer f.Close()
+	decoded, format, err := stdimage.Decode(f)
+	c.Assert(err, qt.IsNil)
+	c.Assert(format, qt.Equals, "jpeg")
+	c.Assert(decoded.Bounds(), qt.Equals, stdimage.Rect(0, 0, 32, 24))
+
+	// The preview has the same size, but it is not the same image.
+	same, err := image.Resize("64x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(same.MediaType(), eq, media.JPGType)
+
+	filtered, err := image.Filter((&images.Filters{}).Grayscale())
+	c.Assert(err, qt.IsNil)
+	c.Assert(filtered.MediaType(), eq, media.JPGType)
+}
+
+func TestImageJPEG2000(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+
+	for _, name := range []string{"jpeg2000/alpha.jp2", "jpeg2000/gray.j2k"} {
+		image := fetchImageForSpec(spec, c, name)
+
+		c.Assert(image.ResourceType(), qt.Equals, "image")
+		c.Assert(image.MediaType(), eq, media.JP2Type)
+		c.Assert(image.Width(), qt.Equals, 97)
+		c.Assert(image.Height(), qt.Equals, 71)
+
+		// EXIF is not read from JPEG 2000.
+		x, err := image.Exif()
+		c.Assert(err, qt.IsNil)
+		c.Assert(x, qt.IsNil)
+
+		resized, err := image.Resize("40x")
+		c.Assert(err, qt.IsNil)
+		c.Assert(resized.Width(), qt.Equals, 40)
+		c.Assert(resized.Height(), qt.Equals, 29)
+		c.Assert(resized.MediaType(), eq, media.PNGType)
+		c.Assert(resized.RelPermalink(), qt.Matches, `/a/jpeg2000/.*_hu.*_40x0_resize_linear_2\.png`)
+
+		f, err := resized.ReadSeekCloser()
+		c.Assert(err, qt.IsNil)
+		decoded, format, err := stdimage.Decode(f)
+		f.Close()
+		c.Assert(err, qt.IsNil)
+		c.Assert(format, qt.Equals, "png")
+		c.Assert(decoded.Bounds(), qt.Equals, stdimage.Rect(0, 0, 40, 29))
+	}
+
+	// The alpha channel ramps up from left to right.
+	image := fetchImageForSpec(spec, c, "jpeg2000/alpha.jp2")
+	resized, err := image.Resize("40x")
+	c.Assert(err, qt.IsNil)
+	decoded := decodeImage(c, resized)
+	_, _, _, left := decoded.At(0, 10).RGBA()
+	_, _, _, right := decoded.At(39, 10).RGBA()
+	c.Assert(left < 0x1000, qt.Equals, true)
+	c.Assert(right > 0xf000, qt.Equals, true)
+}
+
+func TestImagePad(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c)
+
+	isRed := func(cl color.Color) bool {
+		r, g, b, _ := cl.RGBA()
+		return r>>8 > 240 && g>>8 < 15 && b>>8 < 15
+	}
+
+	padded, err := image.Pad("200x200 #ff0000")
+	c.Assert(err, qt.IsNil)
+	c.Assert(padded.Width(), qt.Equals, 200)
+	c.Assert(padded.Height(), qt.Equals, 200)
+	c.Assert(padded.RelPermalink(), qt.Equals, "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_200x200_pad_q68_linear_left_bgff0000.jpg")
+
+	// The 900x562 image is scaled to 200x125 and centered vertically.
+	decoded := decodeImage(c, padded)
+	c.Assert(decoded.Bounds(), qt.Equals, stdimage.Rect(0, 0, 200, 200))
+	c.Assert(isRed(decoded.At(100, 5)), qt.Equals, true)
+	c.Assert(isRed(decoded.At(100, 194)), qt.Equals, true)
+	c.Assert(isRed(decoded.At(100, 100)), qt.Equals, false)
+	c.Assert(isRed(decoded.At(2, 100)), qt.Equals, false)
+
+	top, err := image.Pad("200x200 #ff0000 top")
+	c.Assert(err, qt.IsNil)
+	c.Assert(top.RelPermalink(), qt.Not(qt.Equals), padded.RelPermalink())
+	decoded = decodeImage(c, top)
+	c.Assert(isRed(decoded.At(100, 5)), qt.Equals, false)
+	c.Assert(isRed(decoded.At(100, 194)), qt.Equals, true)
+
+	blue, err := image.Pad("200x200 #0000ff")
+	c.Assert(err, qt.IsNil)
+	c.Assert(blue.RelPermalink(), qt.Not(qt.Equals), padded.RelPermalink())
+
+	// Transparent bars need a PNG.
+	transparent, err := image.Pad("200x200 #00000000")
+	c.Assert(err, qt.IsNil)
+	c.Assert(transparent.MediaType().Type(), qt.Equals, "image/png")
+	_, _, _, a := decodeImage(c, transparent).At(100, 5).RGBA()
+	c.Assert(a, qt.Equals, uint32(0))
+
+	_, err = image.Pad("200x")
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestImageFillFaces(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "portrait.png")
+
+	isSkin := func(img resource.Image) bool {
+		decoded := decodeImage(c, img)
+		r, g, b, _ := decoded.At(img.Width()/2, img.Height()/2).RGBA()
+		return r>>8 > 200 && g>>8 > 150 && b>>8 > 110 && r > b
+	}
+
+	// The face is near the bottom of the image.
+	faces, err := image.Fill("120x120 faces")
+	c.Assert(err, qt.IsNil)
+	c.Assert(faces.Width(), qt.Equals, 120)
+	c.Assert(faces.Height(), qt.Equals, 120)
+	c.Assert(faces.RelPermalink(), qt.Matches, ".*_120x120_fill_linear_faces1_2.png")
+	c.Assert(isSkin(faces), qt.Equals, true)
+
+	centered, err := image.Fill("120x120 center")
+	c.Assert(err, qt.IsNil)
+	c.Assert(isSkin(centered), qt.Equals, false)
+
+	// The faces are found in the rotated image, not reused from the
+	// crop above.
+	rotated, err := image.Fill("120x120 faces r90")
+	c.Assert(err, qt.IsNil)
+	c.Assert(isSkin(rotated), qt.Equals, true)
+
+	// No faces, falls back to smart cropping.
+	gopher := fetchImageForSpec(spec, c, "sub/gohugoio2.png")
+	noFaces, err := gopher.Fill("100x100 faces")
+	c.Assert(err, qt.IsNil)
+	c.Assert(noFaces.Width(), qt.Equals, 100)
+}
+
+func TestImageFillSmartCropFallback(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	var warnings bytes.Buffer
+	spec.imaging.Warn = log.New(&warnings, "", 0)
+
+	solid := stdimage.NewNRGBA(stdimage.Rect(0, 0, 300, 200))
+	draw.Draw(solid, solid.Bounds(), &stdimage.Uniform{C: color.NRGBA{R: 40, G: 120, B: 200, A: 255}}, stdimage.Point{}, draw.Src)
+	image := newTestImageResource(c, spec, "solid.png", solid)
+
+	// Nothing to find in a blank image, so it uses a centered crop.
+	smart, err := image.Fill("100x100 smart")
+	c.Assert(err, qt.IsNil)
+	c.Assert(smart.Width(), qt.Equals, 100)
+	c.Assert(smart.Height(), qt.Equals, 100)
+	c.Assert(warnings.String(), qt.Contains, "solid.png")
+	c.Assert(warnings.String(), qt.Contains, `falling back to anchor "center"`)
+
+	warnings.Reset()
+	spec.imaging.Cfg.SmartCropFallback = "topleft"
+	topLeft, err := image.Fill("100x100 smart")
+	c.Assert(err, qt.IsNil)
+	c.Assert(topLeft.RelPermalink(), qt.Not(qt.Equals), smart.RelPermalink())
+	c.Assert(warnings.String(), qt.Contains, `falling back to anchor "topleft"`)
+}
+
+func TestImageAutoSharpen(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
+
+	plain, err := image.Resize("300x")
+	c.Assert(err, qt.IsNil)
+
+	spec.imaging.Cfg.AutoSharpen = 1.5
+
+	for _, action := range []func(spec string) (resource.Image, error){image.Resize, image.Fit, image.Fill} {
+		downscaled, err := action("300x150")
+		c.Assert(err, qt.IsNil)
+		c.Assert(downscaled.RelPermalink(), qt.Contains, "_sh1.5_")
+
+		upscaled, err := action("1200x800")
+		c.Assert(err, qt.IsNil)
+		c.Assert(upscaled.RelPermalink(), qt.Not(qt.Contains), "_sh")
+	}
+
+	sharpened, err := image.Resize("300x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(sharpened.RelPermalink(), qt.Not(qt.Equals), plain.RelPermalink())
+
+	// Sharpening increases the contrast between neighbouring pixels.
+	contrast := func(img stdimage.Image) int {
+		var sum int
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X + 1; x < b.Max.X; x++ {
+				g1 := color.GrayModel.Convert(img.At(x-1, y)).(color.Gray).Y
+				g2 := color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+				d := int(g1) - int(g2)
+				if d < 0 {
+					d = -d
+				}
+				sum += d
+			}
+		}
+		return sum
+	}
+
+	c.Assert(contrast(decodeImage(c, sharpened)) > contrast(decodeImage(c, plain)), qt.Equals, true)
+}
+
+func TestImageQOI(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	sunset := fetchImageForSpec(spec, c, "sunset.jpg")
+
+	readQOI := func(img resource.Image) ([]byte, stdimage.Image) {
+		f, err := img.ReadSeekCloser()
+		c.Assert(err, qt.IsNil)
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		c.Assert(err, qt.IsNil)
+		decoded, err := qoi.Decode(bytes.NewReader(b))
+		c.Assert(err, qt.IsNil)
+		return b, decoded
+	}
+
+	resized, err := sunset.Resize("200x qoi")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.MediaType().Type(), qt.Equals, "image/qoi")
+	c.Assert(resized.RelPermalink(), qt.Matches, `/a/sunset_hu.*_200x0_resize.*\.qoi`)
+	b, decoded := readQOI(resized)
+	c.Assert(decoded.Bounds(), qt.Equals, stdimage.Rect(0, 0, 200, 125))
+
+	// Use it as a source.
+	source := newTestImageResourceFromBytes(c, spec, "sunset.qoi", b)
+	c.Assert(source.Width(), qt.Equals, 200)
+	c.Assert(source.Height(), qt.Equals, 125)
+
+	smaller, err := source.Resize("100x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(smaller.MediaType().Type(), qt.Equals, "image/qoi")
+	_, decoded = readQOI(smaller)
+	c.Assert(decoded.Bounds(), qt.Equals, stdimage.Rect(0, 0, 100, 63))
+}
+
+func TestImageRGBA(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+
+	process := func(img resource.Image, options string) stdimage.Image {
+		ir := img.(*resourceAdapter).getImageOps().(*imageResource)
+		conf, err := ir.decodeImageConfig("resize", options)
+		c.Assert(err, qt.IsNil)
+		converted, err := ir.decodeAndApply(conf, func(src stdimage.Image) (stdimage.Image, error) {
+			return ir.Proc.ApplyFiltersFromConfig(src, conf)
+		})
+		c.Assert(err, qt.IsNil)
+		return converted
+	}
+
+	gray := fetchImageForSpec(spec, c, "heightmap16.png")
+	c.Assert(process(gray, "20x depth=16"), hqt.IsSameType, &stdimage.Gray16{})
+	c.Assert(process(gray, "20x rgba"), hqt.IsSameType, &stdimage.NRGBA{})
+	c.Assert(process(gray, "20x depth=16 rgba"), hqt.IsSameType, &stdimage.NRGBA{})
+
+	paletted := fetchImageForSpec(spec, c, "gohugoio8.png")
+	c.Assert(process(paletted, "20x"), hqt.IsSameType, &stdimage.Paletted{})
+	c.Assert(process(paletted, "20x rgba"), hqt.IsSameType, &stdimage.NRGBA{})
+
+	resized, err := gray.Resize("20x rgba")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.RelPermalink(), qt.Contains, "_rgba_")
+
+	// GIF can't store RGBA.
+	gif, err := fetchImageForSpec(spec, c, "palette.gif").Resize("8x rgba")
+	c.Assert(err, qt.IsNil)
+	c.Assert(gif.MediaType().Type(), qt.Equals, "image/png")
+}
+
+func TestImageResampleFilterFromMetadata(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	lineArt := fetchImageForSpec(spec, c, "sub/gohugoio2.png")
+	photo := fetchImageForSpec(spec, c, "sunset.jpg")
+
+	c.Assert(AssignMetadata([]map[string]interface{}{
+		{"src": "**.png", "filter": "NearestNeighbor"},
+		{"src": "**", "filter": "Lanczos"},
+	}, lineArt, photo), qt.IsNil)
+
+	resized, err := lineArt.Resize("100x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.RelPermalink(), qt.Contains, "_nearestneighbor")
+	resized, err = photo.Resize("100x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.RelPermalink(), qt.Contains, "_lanczos")
+
+	// A filter in the spec wins.
+	resized, err = lineArt.Resize("100x box")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.RelPermalink(), qt.Contains, "_box")
+
+	// Also used for images processed from it.
+	filled, err := resized.Fill("50x50")
+	c.Assert(err, qt.IsNil)
+	explicit, err := resized.Fill("50x50 nearestneighbor")
+	c.Assert(err, qt.IsNil)
+	c.Assert(filled.RelPermalink(), qt.Equals, explicit.RelPermalink())
+
+	err = AssignMetadata([]map[string]interface{}{
+		{"src": "*", "filter": "foo"},
+	}, photo)
+	c.Assert(err, qt.ErrorMatches, `invalid resample filter "foo".*`)
+}
+
+func TestImagePPM(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+
+	src := stdimage.NewRGBA(stdimage.Rect(0, 0, 80, 40))
+	draw.Draw(src, stdimage.Rect(0, 0, 40, 40), &stdimage.Uniform{C: color.RGBA{R: 0xff, A: 0xff}}, stdimage.Point{}, draw.Src)
+	draw.Draw(src, stdimage.Rect(40, 0, 80, 40), &stdimage.Uniform{C: color.RGBA{B: 0xff, A: 0xff}}, stdimage.Point{}, draw.Src)
+	source := newTestImageResource(c, spec, "sample.ppm", src)
+	c.Assert(source.MediaType().Type(), qt.Equals, "image/x-portable-pixmap")
+	c.Assert(source.Width(), qt.Equals, 80)
+	c.Assert(source.Height(), qt.Equals, 40)
+	x, err := source.(*resourceAdapter).getImageOps().(*imageResource).getExif()
+	c.Assert(err, qt.IsNil)
+	c.Assert(x, qt.IsNil)
+
+	readPNM := func(img resource.Image) stdimage.Image {
+		f, err := img.ReadSeekCloser()
+		c.Assert(err, qt.IsNil)
+		defer f.Close()
+		decoded, err := pnm.Decode(f)
+		c.Assert(err, qt.IsNil)
+		return decoded
+	}
+
+	resized, err := source.Resize("40x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.MediaType().Type(), qt.Equals, "image/x-portable-pixmap")
+	c.Assert(resized.RelPermalink(), qt.Matches, `/a/sample_hu.*_40x0_resize.*\.ppm`)
+	decoded := readPNM(resized)
+	c.Assert(decoded.Bounds(), qt.Equals, stdimage.Rect(0, 0, 40, 20))
+	c.Assert(decoded.At(5, 10), qt.Equals, color.RGBA{R: 0xff, A: 0xff})
+	c.Assert(decoded.At(35, 10), qt.Equals, color.RGBA{B: 0xff, A: 0xff})
+
+	// Encode to gray PGM, and from another format to PPM.
+	gray, err := source.Resize("40x pgm")
+	c.Assert(err, qt.IsNil)
+	c.Assert(gray.MediaType().Type(), qt.Equals, "image/x-portable-graymap")
+	c.Assert(gray.RelPermalink(), qt.Matches, `.*\.pgm`)
+	_, ok := readPNM(gray).(*stdimage.Gray)
+	c.Assert(ok, qt.Equals, true)
+
+	sunset := fetchImageForSpec(spec, c, "sunset.jpg")
+	converted, err := sunset.Resize("100x ppm")
+	c.Assert(err, qt.IsNil)
+	c.Assert(converted.RelPermalink(), qt.Matches, `/a/sunset_hu.*_100x0_resize.*\.ppm`)
+	c.Assert(readPNM(converted).Bounds(), qt.Equals, stdimage.Rect(0, 0, 100, 62))
+}
+
+func TestImageDefaultQualityPerFormat(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	spec.imaging.Cfg.JPEG.Quality = 85
+
+	sunset := fetchImageForSpec(spec, c, "sunset.jpg")
+	resized, err := sunset.Resize("100x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.RelPermalink(), qt.Contains, "_q85_")
+
+	// An explicit quality wins.
+	resized, err = sunset.Resize("100x q50")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.RelPermalink(), qt.Contains, "_q50_")
+
+	// PNG has no quality setting.
+	logo := fetchImageForSpec(spec, c, "gohugoio.png")
+	resized, err = logo.Resize("100x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.RelPermalink(), qt.Not(qt.Contains), "_q")
+
+	// DNG is published as JPEG.
+	dng := fetchImageForSpec(spec, c, "sample.dng")
+	resized, err = dng.Resize("32x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.RelPermalink(), qt.Matches, `/a/sample_hu.*_32x0_resize_q85_linear\.jpg`)
+}
+
+func TestImageAlphaMask(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "transparent.png")
+
+	mask, err := image.AlphaMask()
+	c.Assert(err, qt.IsNil)
+	c.Assert(mask.MediaType(), eq, media.PNGType)
+	c.Assert(mask.Width(), qt.Equals, 64)
+	c.Assert(mask.Height(), qt.Equals, 48)
+	c.Assert(mask.RelPermalink(), qt.Matches, `/a/transparent_hu.*_alphamask_.*\.png`)
+
+	src, decoded := decodeImage(c, image), decodeImage(c, mask)
+	alphas := make(map[uint32]bool)
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			_, _, _, a := src.At(x, y).RGBA()
+			r, g, b, _ := decoded.At(x, y).RGBA()
+			if r != a || g != r || b != r {
+				c.Fatalf("%d,%d: got %d, want %d", x, y, r, a)
+			}
+			alphas[a] = true
+		}
+	}
+	c.Assert(alphas[0], qt.Equals, true)
+	c.Assert(len(alphas) > 10, qt.Equals, true)
+
+	// Cached.
+	maskAgain, err := image.AlphaMask()
+	c.Assert(err, qt.IsNil)
+	c.Assert(maskAgain, eq, mask)
+
+	// No alpha channel, all white.
+	sunset, err := fetchSunset(c).AlphaMask()
+	c.Assert(err, qt.IsNil)
+	c.Assert(sunset.MediaType(), eq, media.PNGType)
+	r, _, _, _ := decodeImage(c, sunset).At(10, 10).RGBA()
+	c.Assert(r, qt.Equals, uint32(0xffff))
+}
+
+func TestImageCheckerboardPreview(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "transparent.png")
+
+	preview, err := image.CheckerboardPreview(8)
+	c.Assert(err, qt.IsNil)
+	c.Assert(preview.MediaType(), eq, media.PNGType)
+	c.Assert(preview.Width(), qt.Equals, 64)
+	c.Assert(preview.Height(), qt.Equals, 48)
+
+	light := color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	dark := color.NRGBA{R: 0xcc, G: 0xcc, B: 0xcc, A: 0xff}
+
+	src, decoded := decodeImage(c, image), decodeImage(c, preview)
+	var transparent int
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			got := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+			c.Assert(got.A, qt.Equals, uint8(0xff))
+			if _, _, _, a := src.At(x, y).RGBA(); a != 0 {
+				continue
+			}
+			transparent++
+			expect := light
+			if (x/8+y/8)%2 == 1 {
+				expect = dark
+			}
+			c.Assert(got, qt.Equals, expect, qt.Commentf("%d,%d", x, y))
+		}
+	}
+	c.Assert(transparent > 0, qt.Equals, true)
+
+	// The cell size is in the key.
+	other, err := image.CheckerboardPreview(4)
+	c.Assert(err, qt.IsNil)
+	c.Assert(other.RelPermalink(), qt.Not(qt.Equals), preview.RelPermalink())
+
+	_, err = image.CheckerboardPreview(0)
+	c.Assert(err, qt.ErrorMatches, ".*cell size.*")
+
+	// Nothing to show.
+	sunset := fetchImageForSpec(spec, c, "sunset.jpg")
+	same, err := sunset.CheckerboardPreview(8)
+	c.Assert(err, qt.IsNil)
+	c.Assert(same, eq, sunset)
+}
+
+func TestImageDepth16(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "heightmap16.png")
+	src := decodeImage(c, image).(*stdimage.Gray16)
+
+	same, err := image.Resize("64x16 nearestneighbor depth=16")
+	c.Assert(err, qt.IsNil)
+	c.Assert(same, qt.Equals, image)
+
+	cropped, err := image.Fill("32x8 nearestneighbor topleft depth=16")
+	c.Assert(err, qt.IsNil)
+	c.Assert(cropped.RelPermalink(), qt.Contains, "_d16_")
+
+	decoded, ok := decodeImage(c, cropped).(*stdimage.Gray16)
+	c.Assert(ok, qt.Equals, true)
+	for x := 0; x < 32; x++ {
+		// Nearest neighbor picks every second pixel.
+		c.Assert(decoded.Gray16At(x, 0), qt.Equals, src.Gray16At(x*2+1, 1))
+	}
+	// Not a value 8 bits can hold.
+	c.Assert(decoded.Gray16At(1, 0).Y%0x101, qt.Not(qt.Equals), uint16(0))
+
+	// Without the option, the result has 8 bits per channel.
+	cropped, err = image.Fill("32x8 nearestneighbor topleft")
+	c.Assert(err, qt.IsNil)
+	switch decodeImage(c, cropped).(type) {
+	case *stdimage.Gray16, *stdimage.RGBA64, *stdimage.NRGBA64:
+		c.Fatal("expected 8 bit image")
+	}
+}
+
+func TestImageXMPCrop(t *testing.T) {
+	c := qt.New(t)
+
+	isGreen := func(cl color.Color) bool {
+		r, g, b, _ := cl.RGBA()
+		return r>>8 < 40 && g>>8 > 215 && b>>8 < 40
+	}
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "xmpcrop.jpg")
+
+	// Not enabled, the top right quarter is green.
+	plain, err := image.Resize("40x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(plain.Height(), qt.Equals, 30)
+	c.Assert(isGreen(decodeImage(c, plain).At(2, 2)), qt.Equals, false)
+
+	spec = newTestResourceSpec(specDescriptor{c: c})
+	spec.imaging.Cfg.ApplyXMPCrop = true
+	image = fetchImageForSpec(spec, c, "xmpcrop.jpg")
+
+	cropped, err := image.Resize("40x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(cropped.Width(), qt.Equals, 40)
+	c.Assert(cropped.Height(), qt.Equals, 30)
+	c.Assert(cropped.RelPermalink(), qt.Matches, `.*_40x0_resize_q68_xmp[0-9a-f]{8}_linear\.jpg`)
+	c.Assert(cropped.RelPermalink(), qt.Not(qt.Equals), plain.RelPermalink())
+
+	decoded := decodeImage(c, cropped)
+	for _, p := range []stdimage.Point{{2, 2}, {37, 2}, {2, 27}, {37, 27}, {20, 15}} {
+		c.Assert(isGreen(decoded.At(p.X, p.Y)), qt.Equals, true, qt.Commentf("%v", p))
+	}
+
+	// The crop is applied once.
+	again, err := cropped.Resize("20x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(again.Height(), qt.Equals, 15)
+	c.Assert(isGreen(decodeImage(c, again).At(10, 7)), qt.Equals, true)
+
+	// The other operations are cropped too.
+	inverted, err := image.Filter((&images.Filters{}).Invert())
+	c.Assert(err, qt.IsNil)
+	c.Assert(inverted.Width(), qt.Equals, 40)
+	c.Assert(inverted.Height(), qt.Equals, 30)
+}
+
+func TestImageLowMemory(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	normal, err := fetchImageForSpec(spec, c, "pages.tif").Resize("20x box")
+	c.Assert(err, qt.IsNil)
+
+	spec = newTestResourceSpec(specDescriptor{c: c})
+	spec.imaging.Cfg.LowMemory = true
+	image := fetchImageForSpec(spec, c, "pages.tif")
+
+	conf, err := images.DecodeImageConfig("resize", "20x box", spec.imaging.Cfg)
+	c.Assert(err, qt.IsNil)
+	ir := image.(*resourceAdapter).getImageOps().(*imageResource)
+	streamed, err := ir.downscaleStreaming(conf)
+	c.Assert(err, qt.IsNil)
+	c.Assert(streamed, qt.Not(qt.IsNil))
+	// One source row and the result.
+	c.Assert(ir.estimateMemory(conf), qt.Equals, int64(4*(ir.Width()+20*15)))
+
+	lowMemory, err := image.Resize("20x box")
+	c.Assert(err, qt.IsNil)
+	c.Assert(lowMemory.RelPermalink(), qt.Equals, normal.RelPermalink())
+	c.Assert(lowMemory.Width(), qt.Equals, 20)
+	c.Assert(lowMemory.Height(), qt.Equals, 15)
+
+	nr, ng, nb, _ := decodeImage(c, normal).At(10, 7).RGBA()
+	lr, lg, lb, _ := decodeImage(c, lowMemory).At(10, 7).RGBA()
+	for _, d := range []int{int(nr>>8) - int(lr>>8), int(ng>>8) - int(lg>>8), int(nb>>8) - int(lb>>8)} {
+		c.Assert(d >= -4 && d <= 4, qt.Equals, true)
+	}
+
+	// Other options use the normal path.
+	for _, options := range []string{"20x linear", "20x box r90", "20x box page=2", "80x box"} {
+		conf, err := images.DecodeImageConfig("resize", options, spec.imaging.Cfg)
+		c.Assert(err, qt.IsNil)
+		streamed, err := ir.downscaleStreaming(conf)
+		c.Assert(err, qt.IsNil)
+		c.Assert(streamed, qt.IsNil, qt.Commentf(options))
+	}
+}
+
+func TestImageMultiple(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c)
+
+	for _, test := range []struct {
+		spec string
+		f    func(spec string) (resource.Image, error)
+		w, h int
+	}{
+		{"601x mult=4", image.Resize, 600, 376},
+		{"900x mult=4", image.Resize, 900, 564},
+		{"301x301 mult=10", image.Fit, 300, 190},
+		{"101x50 mult=8", image.Fill, 104, 48},
+	} {
+		img, err := test.f(test.spec)
+		c.Assert(err, qt.IsNil)
+		c.Assert(img.Width(), qt.Equals, test.w, qt.Commentf(test.spec))
+		c.Assert(img.Height(), qt.Equals, test.h, qt.Commentf(test.spec))
+		c.Assert(img.RelPermalink(), qt.Matches, `.*_m[0-9]+_.*`)
+	}
+}
+
+func TestImageOpenGraphCard(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+
+	newSolid := func(name string, w, h int, col color.NRGBA) resource.Image {
+		solid := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+		draw.Draw(solid, solid.Bounds(), &stdimage.Uniform{C: col}, stdimage.Point{}, draw.Src)
+		return newTestImageResource(c, spec, name, solid)
+	}
+
+	red := color.NRGBA{R: 255, A: 255}
+	bg := newSolid("bg.png", 400, 300, color.NRGBA{R: 40, G: 120, B: 200, A: 255})
+	logo := newSolid("logo.png", 100, 100, red)
+
+	plain, err := bg.OpenGraphCard(map[string]interface{}{})
+	c.Assert(err, qt.IsNil)
+	card, err := bg.OpenGraphCard(map[string]interface{}{"title": "Hello, World!", "logo": logo})
+	c.Assert(err, qt.IsNil)
+
+	c.Assert(card.Width(), qt.Equals, 1200)
+	c.Assert(card.Height(), qt.Equals, 630)
+	c.Assert(card.RelPermalink(), qt.Matches, `/a/bg_hu.*_ogcard_.*\.png`)
+
+	plainImg, cardImg := decodeImage(c, plain), decodeImage(c, card)
+
+	// The text is drawn in white in the lower part of the card.
+	var changed, white int
+	for y := 630 / 3; y < 630; y++ {
+		for x := 0; x < 1200; x++ {
+			if plainImg.At(x, y) != cardImg.At(x, y) {
+				changed++
+			}
+			if color.NRGBAModel.Convert(cardImg.At(x, y)) == (color.NRGBA{R: 255, G: 255, B: 255, A: 255}) {
+				white++
+			}
+		}
+	}
+	c.Assert(changed > 1000, qt.Equals, true, qt.Commentf("%d", changed))
+	c.Assert(white > 1000, qt.Equals, true, qt.Commentf("%d", white))
+
+	// The upper part is untouched apart from the logo.
+	c.Assert(cardImg.At(1100, 30), qt.Equals, plainImg.At(1100, 30))
+	c.Assert(color.NRGBAModel.Convert(cardImg.At(100, 100)), qt.Equals, red)
+
+	// The background is darkened towards the bottom.
+	r0, _, _, _ := plainImg.At(600, 0).RGBA()
+	r1, _, _, _ := plainImg.At(600, 629).RGBA()
+	c.Assert(r1 < r0, qt.Equals, true)
+
+	again, err := bg.OpenGraphCard(map[string]interface{}{"title": "Hello, World!", "logo": logo})
+	c.Assert(err, qt.IsNil)
+	c.Assert(again, eq, card)
+	other, err := bg.OpenGraphCard(map[string]interface{}{"title": "Hello, World!", "color": "#ffff00"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(other.RelPermalink(), qt.Not(qt.Equals), card.RelPermalink())
+
+	// Long titles are wrapped and made smaller to fit.
+	long, err := bg.OpenGraphCard(map[string]interface{}{"title": strings.Repeat("A long title ", 40)})
+	c.Assert(err, qt.IsNil)
+	c.Assert(long.Width(), qt.Equals, 1200)
+
+	_, err = bg.OpenGraphCard(map[string]interface{}{"fontSize": 2})
+	c.Assert(err, qt.Not(qt.IsNil))
+	_, err = bg.OpenGraphCard(map[string]interface{}{"color": "#fffff"})
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestImageExifCaption(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	f := &images.Filters{}
+
+	// The mean difference per channel of a and b in r.
+	diff := func(a, b stdimage.Image, r stdimage.Rectangle) float64 {
+		var sum float64
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				r1, g1, b1, _ := a.At(x, y).RGBA()
+				r2, g2, b2, _ := b.At(x, y).RGBA()
+				sum += math.Abs(float64(r1)-float64(r2)) + math.Abs(float64(g1)-float64(g2)) + math.Abs(float64(b1)-float64(b2))
+			}
+		}
+		return sum / float64(r.Dx()*r.Dy()*3) / 257
+	}
+
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
+	tmpl := "{{ .Model }}, f/{{ .FNumber }}, ISO {{ .ISO }}"
+
+	captioned, err := image.Filter(f.ExifCaption(tmpl))
+	c.Assert(err, qt.IsNil)
+	c.Assert(captioned.Width(), qt.Equals, image.Width())
+	c.Assert(captioned.Height(), qt.Equals, image.Height())
+
+	original, result := decodeImage(c, image), decodeImage(c, captioned)
+	b := result.Bounds()
+	strip := stdimage.Rect(0, b.Dy()-b.Dy()/12, b.Dx(), b.Dy())
+	c.Assert(diff(original, result, strip) > 10, qt.Equals, true)
+	c.Assert(diff(original, result, stdimage.Rect(0, 0, b.Dx(), b.Dy()/2)) < 3, qt.Equals, true)
+
+	again, err := image.Filter(f.ExifCaption(tmpl))
+	c.Assert(err, qt.IsNil)
+	c.Assert(again, eq, captioned)
+	other, err := image.Filter(f.ExifCaption("{{ .LensModel }}"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(other.RelPermalink(), qt.Not(qt.Equals), captioned.RelPermalink())
+
+	// The EXIF is taken from the original.
+	resized, err := image.Resize("300x")
+	c.Assert(err, qt.IsNil)
+	resizedCaptioned, err := resized.Filter(f.ExifCaption(tmpl))
+	c.Assert(err, qt.IsNil)
+	c.Assert(diff(decodeImage(c, resized), decodeImage(c, resizedCaptioned), stdimage.Rect(0, 165, 300, 185)) > 10, qt.Equals, true)
+
+	// Without EXIF.
+	solid := stdimage.NewNRGBA(stdimage.Rect(0, 0, 200, 100))
+	draw.Draw(solid, solid.Bounds(), &stdimage.Uniform{C: color.White}, stdimage.Point{}, draw.Src)
+	noExif := newTestImageResource(c, spec, "noexif.png", solid)
+
+	unchanged, err := noExif.Filter(f.ExifCaption(tmpl))
+	c.Assert(err, qt.IsNil)
+	c.Assert(color.NRGBAModel.Convert(decodeImage(c, unchanged).At(100, 99)), qt.Equals, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+
+	spec.imaging.Cfg.ExifCaptionBlank = true
+	blank, err := noExif.Filter(f.ExifCaption(tmpl))
+	c.Assert(err, qt.IsNil)
+	c.Assert(blank.RelPermalink(), qt.Not(qt.Equals), unchanged.RelPermalink())
+	r1, _, _, _ := decodeImage(c, blank).At(100, 99).RGBA()
+	c.Assert(r1 < 0x8000, qt.Equals, true)
+
+	c.Assert(images.FilterError(f.ExifCaption("{{ .Model")), qt.ErrorMatches, "failed to parse EXIF caption template.*")
+	c.Assert(images.FilterError(f.ExifCaption("")), qt.ErrorMatches, "EXIF caption template must be set")
+}
+
+func TestImageScaleFactor(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
+
+	c.Assert(image.ScaleFactor(), qt.Equals, 1.0)
+	c.Assert(image.WasCropped(), qt.Equals, false)
+
+	const delta = 0.005
+	for _, this := range []struct {
+		action  string
+		spec    string
+		scale   float64
+		cropped bool
+	}{
+		{"resize", "300x", 300.0 / 900, false},
+		{"resize", "1800x", 2, false},
+		{"resize", "300x r90", 300.0 / 562, false},
+		{"fit", "200x200", 200.0 / 900, false},
+		{"fill", "200x200", 200.0 / 562, true},
+		{"fill", "450x281", 0.5, false},
+		{"fill", "900x100", 1, true},
+		{"pad", "200x200", 200.0 / 900, false},
+	} {
+		for _, fromFileCache := range []bool{false, true} {
+			if fromFileCache {
+				spec.imageCache.clear()
+			}
+			var (
+				img resource.Image
+				err error
+			)
+			switch this.action {
+			case "resize":
+				img, err = image.Resize(this.spec)
+			case "fit":
+				img, err = image.Fit(this.spec)
+			case "fill":
+				img, err = image.Fill(this.spec)
+			case "pad":
+				img, err = image.Pad(this.spec)
+			}
+			c.Assert(err, qt.IsNil)
+			comment := qt.Commentf("%s %s cached: %t scale: %v", this.action, this.spec, fromFileCache, img.ScaleFactor())
+			c.Assert(math.Abs(img.ScaleFactor()-this.scale) < delta, qt.Equals, true, comment)
+			c.Assert(img.WasCropped(), qt.Equals, this.cropped, comment)
+		}
+	}
+
+	// Relative to the image processed from.
+	resized, err := image.Resize("450x")
+	c.Assert(err, qt.IsNil)
+	filled, err := resized.Fill("225x225")
+	c.Assert(err, qt.IsNil)
+	c.Assert(math.Abs(filled.ScaleFactor()-225.0/281) < delta, qt.Equals, true)
+	c.Assert(filled.WasCropped(), qt.Equals, true)
+	hero, err := resized.(*resourceAdapter).WithName("hero")
+	c.Assert(err, qt.IsNil)
+	c.Assert(hero.ScaleFactor(), qt.Equals, 0.5)
+}
+
+func TestImageStraighten(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+
+	blue := color.NRGBA{R: 40, G: 120, B: 200, A: 255}
+	solid := stdimage.NewNRGBA(stdimage.Rect(0, 0, 200, 100))
+	draw.Draw(solid, solid.Bounds(), &stdimage.Uniform{C: blue}, stdimage.Point{}, draw.Src)
+	image := newTestImageResource(c, spec, "solid.png", solid)
+
+	for _, degrees := range []float64{5, -5} {
+		straightened, err := image.Straighten(degrees)
+		c.Assert(err, qt.IsNil)
+		c.Assert(straightened.Width(), qt.Equals, 191)
+		c.Assert(straightened.Height(), qt.Equals, 81)
+		c.Assert(straightened.RelPermalink(), qt.Matches, `/a/solid_hu.*_straighten_.*\.png`)
+
+		decoded := decodeImage(c, straightened)
+
+		// No empty corners.
+		b := decoded.Bounds()
+		for _, p := range []stdimage.Point{b.Min, {b.Max.X - 1, b.Min.Y}, {b.Min.X, b.Max.Y - 1}, b.Max.Sub(stdimage.Pt(1, 1))} {
+			c.Assert(color.NRGBAModel.Convert(decoded.At(p.X, p.Y)), qt.Equals, blue, qt.Commentf("%v %v", degrees, p))
+		}
+	}
+
+	five, err := image.Straighten(5)
+	c.Assert(err, qt.IsNil)
+	minusFive, err := image.Straighten(-5)
+	c.Assert(err, qt.IsNil)
+	c.Assert(five.RelPermalink(), qt.Not(qt.Equals), minusFive.RelPermalink())
+	fiveAgain, err := image.Straighten(5)
+	c.Assert(err, qt.IsNil)
+	c.Assert(fiveAgain, eq, five)
+
+	// JPEG images stay JPEG, nothing is left transparent.
+	straightened, err := fetchSunset(c).Straighten(2.5)
+	c.Assert(err, qt.IsNil)
+	c.Assert(straightened.Width() < 900 && straightened.Height() < 562, qt.Equals, true)
+	c.Assert(straightened.MediaType().Type(), qt.Equals, "image/jpg")
+
+	unchanged, err := image.Straighten(0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(unchanged, eq, image)
+
+	_, err = image.Straighten(math.NaN())
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestImageAvatar(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c)
+
+	avatar, err := image.Avatar(64)
+	c.Assert(err, qt.IsNil)
+	c.Assert(avatar.Width(), qt.Equals, 64)
+	c.Assert(avatar.Height(), qt.Equals, 64)
+	c.Assert(avatar.MediaType().Type(), qt.Equals, "image/png")
+	c.Assert(avatar.RelPermalink(), qt.Equals, "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_64x64_avatar_q68_linear_left_2.png")
+
+	decoded := decodeImage(c, avatar)
+
+	alpha := func(x, y int) uint32 {
+		_, _, _, a := decoded.At(x, y).RGBA()
+		return a
+	}
+
+	for _, p := range []stdimage.Point{{0, 0}, {63, 0}, {0, 63}, {63, 63}, {5, 5}} {
+		c.Assert(alpha(p.X, p.Y), qt.Equals, uint32(0), qt.Commentf("%v", p))
+	}
+	for _, p := range []stdimage.Point{{32, 32}, {20, 40}, {32, 2}} {
+		c.Assert(alpha(p.X, p.Y), qt.Equals, uint32(0xffff), qt.Commentf("%v", p))
+	}
+
+	// Cached.
+	avatarAgain, err := image.Avatar(64)
+	c.Assert(err, qt.IsNil)
+	c.Assert(avatarAgain, eq, avatar)
+
+	other, err := image.Avatar(32)
+	c.Assert(err, qt.IsNil)
+	c.Assert(other.RelPermalink(), qt.Not(qt.Equals), avatar.RelPermalink())
+
+	_, err = image.Avatar(0)
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestImageAspectRatio(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c)
+
+	c.Assert(image.AspectRatio(), qt.Equals, 900.0/562)
+	c.Assert(image.IsLandscape(), qt.Equals, true)
+	c.Assert(image.IsPortrait(), qt.Equals, false)
+	c.Assert(image.IsSquare(), qt.Equals, false)
+
+	portrait, err := image.Fill("100x200")
+	c.Assert(err, qt.IsNil)
+	c.Assert(portrait.AspectRatio(), qt.Equals, 0.5)
+	c.Assert(portrait.IsLandscape(), qt.Equals, false)
+	c.Assert(portrait.IsPortrait(), qt.Equals, true)
+	c.Assert(portrait.IsSquare(), qt.Equals, false)
+
+	square, err := image.Fill("100x100")
+	c.Assert(err, qt.IsNil)
+	c.Assert(square.AspectRatio(), qt.Equals, 1.0)
+	c.Assert(square.IsLandscape(), qt.Equals, false)
+	c.Assert(square.IsPortrait(), qt.Equals, false)
+	c.Assert(square.IsSquare(), qt.Equals, true)
+}
+
+func TestImageToSRGB(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "displayp3.jpg")
+
+	plain, err := image.Resize("32x")
+	c.Assert(err, qt.IsNil)
+	converted, err := image.Resize("32x tosrgb")
+	c.Assert(err, qt.IsNil)
+
+	c.Assert(converted.RelPermalink(), qt.Not(qt.Equals), plain.RelPermalink())
+	c.Assert(converted.RelPermalink(), qt.Contains, "_tosrgb_")
+	c.Assert(converted.Width(), qt.Equals, 32)
+
+	// The right edge is saturated red, which gets even more red in sRGB.
+	pr, pg, _, _ := decodeImage(c, plain).At(30, 2).RGBA()
+	cr, cg, _, _ := decodeImage(c, converted).At(30, 2).RGBA()
+	c.Assert(cr >= pr, qt.Equals, true)
+	c.Assert(cg < pg, qt.Equals, true)
+}
+
+func TestImageTagSRGB(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+
+	profile := func(img resource.Image) []byte {
+		f, err := img.ReadSeekCloser()
+		c.Assert(err, qt.IsNil)
+		defer f.Close()
+		b, err := icc.Extract(f)
+		c.Assert(err, qt.IsNil)
+		return b
+	}
+
+	for _, name := range []string{"gohugoio.png", "xmpcrop.jpg"} {
+		image := fetchImageForSpec(spec, c, name)
+		c.Assert(profile(image), qt.IsNil)
+
+		plain, err := image.Resize("20x")
+		c.Assert(err, qt.IsNil)
+		c.Assert(profile(plain), qt.IsNil)
+
+		tagged, err := image.Resize("20x tagsrgb")
+		c.Assert(err, qt.IsNil)
+		c.Assert(tagged.RelPermalink(), qt.Contains, "_tagsrgb_")
+		c.Assert(tagged.Width(), qt.Equals, 20)
+		c.Assert(profile(tagged), qt.DeepEquals, icc.SRGB())
+
+		// Processing a tagged image again keeps the profile.
+		again, err := tagged.Resize("10x tagsrgb")
+		c.Assert(err, qt.IsNil)
+		c.Assert(profile(again), qt.DeepEquals, icc.SRGB())
+
+		// The same size and format, but the profile is a change.
+		same, err := image.Resize(fmt.Sprintf("%dx tagsrgb", image.Width()))
+		c.Assert(err, qt.IsNil)
+		c.Assert(same.RelPermalink(), qt.Not(qt.Equals), image.RelPermalink())
+	}
+
+	// The source has a profile, which the option does not replace.
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
+	tagged, err := image.Resize("20x tagsrgb")
+	c.Assert(err, qt.IsNil)
+	c.Assert(tagged.RelPermalink(), qt.Not(qt.Contains), "tagsrgb")
+	c.Assert(profile(tagged), qt.IsNil)
+
+	// Only supported for JPEG and PNG.
+	image = fetchImageForSpec(spec, c, "pages.tif")
+	tiff, err := image.Resize("20x tagsrgb")
+	c.Assert(err, qt.IsNil)
+	c.Assert(tiff.RelPermalink(), qt.Not(qt.Contains), "tagsrgb")
+}
+
+func TestImageDominant(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+
+	solid := func(img resource.Image) color.NRGBA {
+		decoded := decodeImage(c, img)
+		b := decoded.Bounds()
+		first := color.NRGBAModel.Convert(decoded.At(b.Min.X, b.Min.Y)).(color.NRGBA)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c.Assert(color.NRGBAModel.Convert(decoded.At(x, y)), qt.Equals, first)
+			}
+		}
+		return first
+	}
+
+	for _, name := range []string{"sunset.jpg", "gohugoio.png"} {
+		image := fetchImageForSpec(spec, c, name)
+		src, err := image.(*resourceAdapter).getImageOps().(*imageResource).decodeSource(0, 0)
+		c.Assert(err, qt.IsNil)
+		expect := images.AverageColor(src)
+
+		dot, err := image.Resize("dominant")
+		c.Assert(err, qt.IsNil)
+		c.Assert(dot.Width(), qt.Equals, 1)
+		c.Assert(dot.Height(), qt.Equals, 1)
+		c.Assert(dot.RelPermalink(), qt.Contains, "_dominant_")
+
+		block, err := image.Fill("dominant 16x8 smart")
+		c.Assert(err, qt.IsNil)
+		c.Assert(block.Width(), qt.Equals, 16)
+		c.Assert(block.Height(), qt.Equals, 8)
+
+		for _, img := range []resource.Image{dot, block} {
+			got := solid(img)
+			// Allow for JPEG rounding.
+			for _, d := range []int{int(got.R) - int(expect.R), int(got.G) - int(expect.G), int(got.B) - int(expect.B)} {
+				c.Assert(d >= -2 && d <= 2, qt.Equals, true, qt.Commentf("%s: got %v, expected %v", name, got, expect))
+			}
+		}
+	}
+
+	// The color is that of the image as processed, here converted to sRGB.
+	image := fetchImageForSpec(spec, c, "displayp3.jpg")
+	plain, err := image.Resize("dominant")
+	c.Assert(err, qt.IsNil)
+	converted, err := image.Resize("dominant tosrgb")
+	c.Assert(err, qt.IsNil)
+	c.Assert(solid(converted), qt.Not(qt.Equals), solid(plain))
+}
+
+func TestImageTIFFPages(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "pages.tif")
+
+	c.Assert(image.PageCount(), qt.Equals, 2)
+	// The count is read once, and shared with the processed images.
+	c.Assert(image.(*resourceAdapter).getImageOps().(*imageResource).pageCount, qt.Equals, 2)
+	c.Assert(image.Width(), qt.Equals, 40)
+	c.Assert(image.Height(), qt.Equals, 30)
+
+	first, err := image.Resize("10x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(first.Height(), qt.Equals, 8)
+
+	page1, err := image.Resize("10x page=1")
+	c.Assert(err, qt.IsNil)
+	c.Assert(page1.RelPermalink(), qt.Equals, first.RelPermalink())
+
+	page2, err := image.Resize("10x page=2")
+	c.Assert(err, qt.IsNil)
+	c.Assert(page2.RelPermalink(), qt.Contains, "_p2_")
+	c.Assert(page2.Width(), qt.Equals, 10)
+	c.Assert(page2.PageCount(), qt.Equals, 2)
+	c.Assert(page2.Height(), qt.Equals, 25)
+
+	decoded := decodeImage(c, page2)
+	r, _, _, _ := decoded.At(5, 12).RGBA()
+	c.Assert(r>>8, qt.Equals, uint32(220))
+
+	_, err = image.Resize("10x page=3")
+	c.Assert(err, qt.ErrorMatches, ".*out of range.*")
+
+	sunset := fetchImageForSpec(spec, c, "sunset.jpg")
+	c.Assert(sunset.PageCount(), qt.Equals, 1)
+	_, err = sunset.Resize("10x page=2")
+	c.Assert(err, qt.ErrorMatches, ".*only supported for TIFF.*")
+}
+
+func TestImageResizeDPR(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c)
+
+	seen := make(map[string]bool)
+	for _, test := range []struct {
+		dpr    string
+		width  int
+		suffix string
+	}{
+		{"1", 200, ""},
+		{"1.5", 300, "@1.5x"},
+		{"2", 400, "@2x"},
+	} {
+		resized, err := image.Resize("200x dpr=" + test.dpr)
+		c.Assert(err, qt.IsNil)
+		c.Assert(resized.Width(), qt.Equals, test.width)
+		c.Assert(resized.Height(), qt.Equals, int(math.Round(562*float64(test.width)/900)))
+		c.Assert(strings.HasSuffix(resized.RelPermalink(), test.suffix+".jpg"), qt.Equals, true, qt.Commentf(resized.RelPermalink()))
+		c.Assert(strings.Count(resized.RelPermalink(), "@"), qt.Equals, strings.Count(test.suffix, "@"))
+		c.Assert(seen[resized.RelPermalink()], qt.Equals, false)
+		seen[resized.RelPermalink()] = true
+	}
+
+	// The same dimensions without dpr are another image.
+	plain, err := image.Resize("400x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(seen[plain.RelPermalink()], qt.Equals, false)
+}
+
+func TestImageGIFFrame(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	// Three frames, red, green and a blue left half.
+	image := fetchImageForSpec(spec, c, "animated.gif")
+
+	colorAt := func(img resource.Image, x, y int) color.NRGBA {
+		decoded := decodeImage(c, img)
+		return color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+	}
+
+	first, err := image.Resize("10x")
+	c.Assert(err, qt.IsNil)
+	frame0, err := image.Resize("10x frame=0")
+	c.Assert(err, qt.IsNil)
+	c.Assert(frame0.RelPermalink(), qt.Equals, first.RelPermalink())
+	c.Assert(colorAt(first, 5, 2), qt.Equals, color.NRGBA{R: 255, A: 255})
+
+	frame2, err := image.Resize("10x frame=2")
+	c.Assert(err, qt.IsNil)
+	c.Assert(frame2.RelPermalink(), qt.Contains, "_f2_")
+	c.Assert(frame2.Width(), qt.Equals, 10)
+	c.Assert(frame2.Height(), qt.Equals, 5)
+	// The third frame only covers the left half, drawn over the second.
+	c.Assert(colorAt(frame2, 1, 2), qt.Equals, color.NRGBA{B: 255, A: 255})
+	c.Assert(colorAt(frame2, 8, 2), qt.Equals, color.NRGBA{G: 255, A: 255})
+
+	_, err = image.Resize("10x frame=3")
+	c.Assert(err, qt.ErrorMatches, ".*frame 3 out of range, the image has 3 frame.*")
+
+	_, err = fetchImageForSpec(spec, c, "sunset.jpg").Resize("10x frame=1")
+	c.Assert(err, qt.ErrorMatches, ".*only supported for GIF.*")
+}
+
+func TestImageOptimizeHuffman(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c)
+
+	size := func(img resource.Image) int {
+		f, err := img.ReadSeekCloser()
+		c.Assert(err, qt.IsNil)
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		c.Assert(err, qt.IsNil)
+		return len(b)
+	}
+
+	plain, err := image.Resize("300x q80")
+	c.Assert(err, qt.IsNil)
+	optimized, err := image.Resize("300x q80 optimize")
+	c.Assert(err, qt.IsNil)
+
+	c.Assert(optimized.RelPermalink(), qt.Equals, "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_300x0_resize_q80_optimize_linear.jpg")
+	c.Assert(optimized.Width(), qt.Equals, 300)
+	c.Assert(size(optimized) < size(plain), qt.Equals, true)
+}
+
+func TestImageDecodedImage(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c).(*resourceAdapter)
+
+	decoded, err := image.DecodedImage()
+	c.Assert(err, qt.IsNil)
+	c.Assert(decoded.Bounds().Dx(), qt.Equals, image.Width())
+	c.Assert(decoded.Bounds().Dy(), qt.Equals, image.Height())
+
+	// Modifying the returned image does not change the cached one.
+	ycc := decoded.(*stdimage.YCbCr)
+	ycc.Y[0] = ^ycc.Y[0]
+	decodedAgain, err := image.DecodedImage()
+	c.Assert(err, qt.IsNil)
+	c.Assert(decodedAgain.(*stdimage.YCbCr).Y[0], qt.Not(qt.Equals), ycc.Y[0])
+
+	resized, err := image.Resize("300x")
+	c.Assert(err, qt.IsNil)
+	decoded, err = resized.(*resourceAdapter).DecodedImage()
+	c.Assert(err, qt.IsNil)
+	c.Assert(decoded.Bounds().Dx(), qt.Equals, 300)
+	c.Assert(decoded.Bounds().Dy(), qt.Equals, resized.Height())
+}
+
+func TestImagePixelAt(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	// Dark, midtone and bright bands with a checker pattern of 4x4 cells.
+	image := fetchImageForSpec(spec, c, "highcontrast.png").(*resourceAdapter)
+
+	for _, test := range []struct {
+		x, y     int
+		expected string
+	}{
+		{0, 0, "#14161a"},
+		{5, 2, "#080a0e"},
+		{44, 10, "#786e64"},
+		{95, 63, "#f2f2f0"},
+	} {
+		hex, err := image.PixelAt(test.x, test.y)
+		c.Assert(err, qt.IsNil)
+		c.Assert(hex, qt.Equals, test.expected, qt.Commentf("%d,%d", test.x, test.y))
+	}
+
+	for _, p := range []stdimage.Point{{-1, 0}, {0, -1}, {96, 0}, {0, 64}} {
+		_, err := image.PixelAt(p.X, p.Y)
+		c.Assert(err, qt.ErrorMatches, `pixel .* is outside of the 96x64 image`)
+	}
+
+	transparent := fetchImageForSpec(spec, c, "transparent.png").(*resourceAdapter)
+	hex, err := transparent.PixelAt(0, 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(hex, qt.Matches, `#[0-9a-f]{6}00`)
+}
+
+func TestImageSrcSet(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
+
+	set, err := image.SrcSet(640, 320, 1200, 320)
+	c.Assert(err, qt.IsNil)
+	c.Assert(set.Images, qt.HasLen, 3)
+	c.Assert(set.Images[0].Width(), qt.Equals, 320)
+	c.Assert(set.Images[1].Width(), qt.Equals, 640)
+	c.Assert(set.Images[2].Width(), qt.Equals, 1200)
+	c.Assert(set.Attr, qt.Equals, "https://example.com/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_320x0_resize_q68_linear.jpg 320w, "+
+		"https://example.com/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_640x0_resize_q68_linear.jpg 640w, "+
+		"https://example.com/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_1200x0_resize_q68_linear.jpg 1200w")
+
+	// The same as a plain resize.
+	resized, err := image.Resize("640x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(set.Images[1].RelPermalink(), qt.Equals, resized.RelPermalink())
+
+	// The original width returns the original, which must be published.
+	set, err = image.SrcSet(320, 900)
+	c.Assert(err, qt.IsNil)
+	c.Assert(set.Images, qt.HasLen, 2)
+	c.Assert(set.Images[1], qt.Equals, image)
+	c.Assert(set.Attr, qt.Equals, "https://example.com/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_320x0_resize_q68_linear.jpg 320w, "+
+		"https://example.com/a/sunset.jpg 900w")
+	assertImageFile(c, spec.PublishFs, "a/sunset.jpg", 900, 562)
+
+	spec.imaging.Cfg.NoUpscale = true
+	set, err = image.SrcSet(320, 1200)
+	c.Assert(err, qt.IsNil)
+	c.Assert(set.Images, qt.HasLen, 1)
+	c.Assert(set.Attr, qt.Equals, "https://example.com/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_320x0_resize_q68_linear.jpg 320w")
+
+	_, err = image.SrcSet(0)
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestImageVariants(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c)
+
+	variants, err := image.(*resourceAdapter).Variants("1200x600", "300x300", "600x200")
+	c.Assert(err, qt.IsNil)
+	c.Assert(variants, qt.HasLen, 3)
+
+	for i, expect := range []struct {
+		spec          string
+		width, height int
+	}{
+		{"1200x600", 900, 562},
+		{"300x300", 300, 187},
+		{"600x200", 320, 200},
+	} {
+		v := variants[i]
+		c.Assert(v.Spec, qt.Equals, expect.spec)
+		c.Assert(v.Width, qt.Equals, expect.width)
+		c.Assert(v.Height, qt.Equals, expect.height)
+		c.Assert(v.Image.Width(), qt.Equals, expect.width)
+		c.Assert(v.Image.Height(), qt.Equals, expect.height)
+
+		// The same as a plain Fit, from the cache.
+		fitted, err := image.Fit(expect.spec)
+		c.Assert(err, qt.IsNil)
+		c.Assert(fitted.RelPermalink(), qt.Equals, v.Image.RelPermalink())
+	}
+
+	_, err = image.(*resourceAdapter).Variants("300x300", "foo")
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestImageDerivatives(t *testing.T) {
+	c := qt.New(t)
+
+	for _, flatDir := range []string{"", "images"} {
+		spec := newTestResourceSpec(specDescriptor{c: c})
+		spec.imaging.Cfg.FlatDir = flatDir
+		testImageDerivatives(c, spec)
+	}
+}
+
+func testImageDerivatives(c *qt.C, spec *Spec) {
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
+	derivatives := func(img resource.Image) []string {
+		d, err := img.(*resourceAdapter).Derivatives()
+		c.Assert(err, qt.IsNil)
+		var links []string
+		for _, v := range d {
+			links = append(links, fmt.Sprintf("%s %dx%d", v.RelPermalink(), v.Width(), v.Height()))
+		}
+		return links
+	}
+
+	c.Assert(derivatives(image), qt.HasLen, 0)
+
+	resized1, err := image.Resize("300x")
+	c.Assert(err, qt.IsNil)
+	resized2, err := image.Resize("100x")
+	c.Assert(err, qt.IsNil)
+	// From the cache, no new image.
+	_, err = image.Resize("100x")
+	c.Assert(err, qt.IsNil)
+	// Processed from one of the derivatives.
+	chained, err := resized1.Fill("50x50")
+	c.Assert(err, qt.IsNil)
+
+	expect := []string{
+		resized2.RelPermalink() + " 100x62",
+		resized1.RelPermalink() + " 300x187",
+		chained.RelPermalink() + " 50x50",
+	}
+	// Sorted by key.
+	sort.Strings(expect)
+	c.Assert(derivatives(image), qt.DeepEquals, expect)
+	// All are processed from the same source.
+	c.Assert(derivatives(resized1), qt.DeepEquals, expect)
+
+	h, err := image.(*resourceAdapter).getImageOps().(*imageResource).hash()
+	c.Assert(err, qt.IsNil)
+	c.Assert(spec.DeleteImageCacheBySourceHash(h), qt.IsNil)
+	c.Assert(derivatives(image), qt.HasLen, 0)
+
+	// The files are removed from the file cache, too.
+	var cached []string
+	c.Assert(afero.Walk(spec.imageCache.fileCache.Fs, "", func(name string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			cached = append(cached, name)
+		}
+		return err
+	}), qt.IsNil)
+	c.Assert(cached, qt.HasLen, 0, qt.Commentf("flatDir: %q", spec.imaging.Cfg.FlatDir))
+
+	// And they get processed again.
+	again, err := image.Resize("300x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(again.RelPermalink(), qt.Equals, resized1.RelPermalink())
+	c.Assert(derivatives(image), qt.HasLen, 1)
+}
+
+func TestImageSameSource(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
+	other := fetchImageForSpec(spec, c, "gohugoio24.png")
+
+	resized, err := image.Resize("300x")
+	c.Assert(err, qt.IsNil)
+	chained, err := resized.Fill("50x50")
+	c.Assert(err, qt.IsNil)
+
+	c.Assert(SameSource(image, image), qt.Equals, true)
+	c.Assert(SameSource(resized, image), qt.Equals, true)
+	c.Assert(SameSource(image, chained), qt.Equals, true)
+	c.Assert(SameSource(image, other), qt.Equals, false)
+	c.Assert(SameSource(resized, other), qt.Equals, false)
+}
+
+func TestImageSourceQuality(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+
+	sunset := fetchImageForSpec(spec, c, "sunset.jpg")
+	quality := sunset.(*resourceAdapter).SourceQuality()
+	c.Assert(quality > 50 && quality < 100, qt.Equals, true, qt.Commentf("quality %d", quality))
+
+	// Processed images report the quality of the original.
+	resized, err := sunset.Resize("100x q20")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.(*resourceAdapter).SourceQuality(), qt.Equals, quality)
+
+	c.Assert(fetchImageForSpec(spec, c, "gohugoio24.png").(*resourceAdapter).SourceQuality(), qt.Equals, 0)
+}
+
+func TestImageColorInfo(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+
+	colorInfo := func(img resource.Image) images.ColorInfo {
+		info, err := img.(*resourceAdapter).ColorInfo()
+		c.Assert(err, qt.IsNil)
+		return info
+	}
+
+	for _, test := range []struct {
+		name   string
+		expect images.ColorInfo
+	}{
+		{"gohugoio24.png", images.ColorInfo{BitDepth: 8, ColorModel: "NRGBA"}},
+		{"heightmap16.png", images.ColorInfo{BitDepth: 16, ColorModel: "Gray16", Grayscale: true}},
+		{"palette.gif", images.ColorInfo{BitDepth: 8, ColorModel: "Paletted", Indexed: true}},
+		{"sunset.jpg", images.ColorInfo{BitDepth: 8, ColorModel: "YCbCr"}},
+	} {
+		image := fetchImageForSpec(spec, c, test.name)
+		c.Assert(colorInfo(image), qt.Equals, test.expect, qt.Commentf(test.name))
+	}
+
+	// Processed images are read from the file written.
+	image := fetchImageForSpec(spec, c, "heightmap16.png")
+	resized, err := image.Resize("20x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(colorInfo(resized), qt.Equals, images.ColorInfo{BitDepth: 8, ColorModel: "RGBA"})
+	resized, err = image.Resize("20x depth=16")
+	c.Assert(err, qt.IsNil)
+	c.Assert(colorInfo(resized), qt.Equals, images.ColorInfo{BitDepth: 16, ColorModel: "Gray16", Grayscale: true})
+}
+
+func TestImageCorrupt(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+
+	b, err := ioutil.ReadFile(filepath.FromSlash("testdata/sunset.jpg"))
+	c.Assert(err, qt.IsNil)
+
+	truncated := newTestImageResourceFromBytes(c, spec, "truncated.jpg", b[:len(b)/2])
+	c.Assert(truncated.Width(), qt.Equals, 900)
+	_, err = truncated.Resize("100x")
+	c.Assert(err, qt.Not(qt.IsNil))
+	c.Assert(err.Error(), qt.Contains, "truncated.jpg")
+	c.Assert(err.Error(), qt.Contains, "the file is truncated")
+
+	corrupt := append([]byte(nil), b...)
+	for i := len(b) / 2; i < len(b)/2+2000; i++ {
+		corrupt[i] = 0xff
+	}
+	_, err = newTestImageResourceFromBytes(c, spec, "corrupt.jpg", corrupt).Resize("100x")
+	c.Assert(err, qt.Not(qt.IsNil))
+	c.Assert(err.Error(), qt.Contains, "corrupt.jpg")
+	c.Assert(err.Error(), qt.Contains, "the file is corrupt")
+}
+
+func TestImageWithName(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchSunset(c)
+	resized, err := image.Resize("300x")
+	c.Assert(err, qt.IsNil)
+
+	type namer interface {
+		WithName(name string) (resource.Image, error)
+	}
+
+	for _, img := range []resource.Image{image, resized} {
+		name := img.Name()
+		hero, err := img.(namer).WithName("hero")
+		c.Assert(err, qt.IsNil)
+		thumb, err := img.(namer).WithName("thumb")
+		c.Assert(err, qt.IsNil)
+
+		c.Assert(hero.Name(), qt.Equals, "hero")
+		c.Assert(thumb.Name(), qt.Equals, "thumb")
+		c.Assert(img.Name(), qt.Equals, name)
+		c.Assert(hero.RelPermalink(), qt.Equals, img.RelPermalink())
+		c.Assert(thumb.RelPermalink(), qt.Equals, img.RelPermalink())
+		c.Assert(hero.Width(), qt.Equals, img.Width())
+
+		resized, err := hero.Resize("100x")
+		c.Assert(err, qt.IsNil)
+		c.Assert(resized.Width(), qt.Equals, 100)
+		// A renamed image is processed as the image it was renamed from.
+		expect, err := img.Resize("100x")
+		c.Assert(err, qt.IsNil)
+		c.Assert(resized.RelPermalink(), qt.Equals, expect.RelPermalink())
+		c.Assert(hero.Width(), qt.Equals, img.Width())
+		c.Assert(thumb.Name(), qt.Equals, "thumb")
+		c.Assert(thumb.Width(), qt.Equals, img.Width())
+	}
+}
+
+func TestImageFileNameMode(t *testing.T) {
+	c := qt.New(t)
+
+	for _, this := range []struct {
+		mode   string
+		expect string
+		nested string
+	}{
+		{"auto", "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_300x0_resize_q68_linear.jpg", `/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_[0-9a-f]{32}\.jpg`},
+		{"readable", "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_300x0_resize_q68_linear.jpg", `/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_300x0_resize_q68_linear_100x0_resize_q68_linear\.jpg`},
+		{"hashed", "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_212cc88b9b4cb2e4e875919f5be87279.jpg", `/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_[0-9a-f]{32}\.jpg`},
+	} {
+		spec := newTestResourceSpec(specDescriptor{c: c})
+		spec.imaging.Cfg.FileNameMode = this.mode
+		image := fetchImageForSpec(spec, c, "sunset.jpg")
+
+		resized, err := image.Resize("300x")
+		c.Assert(err, qt.IsNil)
+		c.Assert(resized.RelPermalink(), qt.Equals, this.expect, qt.Commentf(this.mode))
+
+		// Stable.
+		resizedAgain, err := image.Resize("300x")
+		c.Assert(err, qt.IsNil)
+		c.Assert(resizedAgain.RelPermalink(), qt.Equals, resized.RelPermalink())
+
+		nested, err := resized.Resize("100x")
+		c.Assert(err, qt.IsNil)
+		c.Assert(nested.RelPermalink(), qt.Matches, this.nested, qt.Commentf(this.mode))
+	}
+}
+
+func TestImageHashAlgorithm(t *testing.T) {
+	c := qt.New(t)
+
+	for _, this := range []struct {
+		algo   string
+		expect string
+		hashed string
+	}{
+		{"md5", "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_300x0_resize_q68_linear.jpg", "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_212cc88b9b4cb2e4e875919f5be87279.jpg"},
+		{"sha256", "/a/sunset_huae43477a7a6bcaad567de11cb557463e_90587_300x0_resize_q68_linear.jpg", "/a/sunset_huae43477a7a6bcaad567de11cb557463e_90587_747117b136a7ce242862f03547dcae12.jpg"},
+		{"fnv", "/a/sunset_hu259b55b759cc155f_90587_300x0_resize_q68_linear.jpg", "/a/sunset_hu259b55b759cc155f_90587_3f9d7ad3ad5f4f5c.jpg"},
+	} {
+		for _, mode := range []string{"readable", "hashed"} {
+			expect := this.expect
+			if mode == "hashed" {
+				expect = this.hashed
+			}
+
+			// Stable across builds.
+			for i := 0; i < 2; i++ {
+				spec := newTestResourceSpec(specDescriptor{c: c})
+				spec.imaging.Cfg.HashAlgorithm = this.algo
+				spec.imaging.Cfg.FileNameMode = mode
+				image := fetchImageForSpec(spec, c, "sunset.jpg")
+
+				resized, err := image.Resize("300x")
+				c.Assert(err, qt.IsNil)
+				c.Assert(resized.RelPermalink(), qt.Equals, expect, qt.Commentf("%s %s", this.algo, mode))
+			}
+		}
+	}
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	spec.imaging.Cfg.HashAlgorithm = "fnv"
+	spec.imaging.Cfg.FlatDir = "images"
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
+	resized, err := image.Resize("300x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.RelPermalink(), qt.Matches, `/images/[0-9a-f]{16}\.jpg`)
+}
+
+func TestImageSalt(t *testing.T) {
+	c := qt.New(t)
+
+	resize := func(salt string) resource.Image {
+		spec := newTestResourceSpec(specDescriptor{c: c})
+		spec.imaging.Cfg.Salt = salt
+		image := fetchImageForSpec(spec, c, "sunset.jpg")
+
+		resized, err := image.Resize("300x")
+		c.Assert(err, qt.IsNil)
+		return resized
+	}
+
+	c.Assert(resize("").RelPermalink(), qt.Equals, "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_300x0_resize_q68_linear.jpg")
+	v1, v2 := resize("v1"), resize("v2")
+	c.Assert(v1.RelPermalink(), qt.Equals, "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_300x0_resize_q68_linear_v1.jpg")
+	c.Assert(v2.RelPermalink(), qt.Equals, "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_300x0_resize_q68_linear_v2.jpg")
+	c.Assert(v2.Width(), qt.Equals, 300)
+}
+
+func TestImageICO(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
 
-	resized, err := image.Resize("200x")
+	ico, err := image.ICO(48, 16, 32, 16)
 	c.Assert(err, qt.IsNil)
-	c.Assert(resized, qt.Not(qt.IsNil))
-	c.Assert(resized.Width(), qt.Equals, 200)
-	c.Assert(resized.RelPermalink(), qt.Equals, "/a/_hu59e56ffff1bc1d8d122b1403d34e039f_90587_65b757a6e14debeae720fe8831f0a9bc.jpg")
-	resized, err = resized.Resize("100x")
+	c.Assert(ico.MediaType(), eq, media.ICOType)
+	c.Assert(ico.Width(), qt.Equals, 48)
+	c.Assert(ico.Height(), qt.Equals, 48)
+	c.Assert(ico.RelPermalink(), qt.Equals, "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_48x48_ico_q68_linear_left_s16-32-48.ico")
+
+	f, err := spec.PublishFs.Open(filepath.Clean(ico.RelPermalink()))
+	c.Assert(err, qt.IsNil)
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
 	c.Assert(err, qt.IsNil)
-	c.Assert(resized, qt.Not(qt.IsNil))
-	c.Assert(resized.Width(), qt.Equals, 100)
-	c.Assert(resized.RelPermalink(), qt.Equals, "/a/_hu59e56ffff1bc1d8d122b1403d34e039f_90587_c876768085288f41211f768147ba2647.jpg")
-}
 
-// Issue 6137
-func TestImageTransformUppercaseExt(t *testing.T) {
-	c := qt.New(t)
-	image := fetchImage(c, "sunrise.JPG")
+	entries, err := images.DecodeICOEntries(bytes.NewReader(b))
+	c.Assert(err, qt.IsNil)
+	c.Assert(entries, qt.HasLen, 3)
+	for i, size := range []int{16, 32, 48} {
+		e := entries[i]
+		c.Assert(e.Width, qt.Equals, size)
+		c.Assert(e.Height, qt.Equals, size)
+		config, err := png.DecodeConfig(bytes.NewReader(b[e.Offset : e.Offset+e.Size]))
+		c.Assert(err, qt.IsNil)
+		c.Assert(config.Width, qt.Equals, size)
+	}
 
-	resized, err := image.Resize("200x")
+	// Cached.
+	icoAgain, err := image.ICO(16, 32, 48)
 	c.Assert(err, qt.IsNil)
-	c.Assert(resized, qt.Not(qt.IsNil))
-	c.Assert(resized.Width(), qt.Equals, 200)
-}
+	c.Assert(icoAgain, eq, ico)
 
-// https://github.com/gohugoio/hugo/issues/5730
-func TestImagePermalinkPublishOrder(t *testing.T) {
-	for _, checkOriginalFirst := range []bool{true, false} {
-		name := "OriginalFirst"
-		if !checkOriginalFirst {
-			name = "ResizedFirst"
-		}
+	// Process the ICO further. It can only hold square images in the ICO
+	// sizes, so this is published as a PNG.
+	small, err := ico.Resize("24x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(small.MediaType(), eq, media.PNGType)
+	c.Assert(small.Width(), qt.Equals, 24)
+	c.Assert(small.RelPermalink(), qt.Matches, `/a/sunset_hu.*\.png`)
+	icoAgain, err = ico.ICO(16)
+	c.Assert(err, qt.IsNil)
+	c.Assert(icoAgain.MediaType(), eq, media.ICOType)
+	c.Assert(icoAgain.Width(), qt.Equals, 16)
 
-		t.Run(name, func(t *testing.T) {
-			c := qt.New(t)
-			spec, workDir := newTestResourceOsFs(c)
-			defer func() {
-				os.Remove(workDir)
-			}()
+	// Use it as a source.
+	source := newTestImageResourceFromBytes(c, spec, "favicon.ico", b)
+	c.Assert(source.Width(), qt.Equals, 48)
+	resized, err := source.Resize("20x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.MediaType(), eq, media.PNGType)
+	c.Assert(resized.Width(), qt.Equals, 20)
 
-			check1 := func(img resource.Image) {
-				resizedLink := "/a/sunset_hu59e56ffff1bc1d8d122b1403d34e039f_90587_100x50_resize_q75_box.jpg"
-				c.Assert(img.RelPermalink(), qt.Equals, resizedLink)
-				assertImageFile(c, spec.PublishFs, resizedLink, 100, 50)
-			}
+	_, err = image.ICO()
+	c.Assert(err, qt.Not(qt.IsNil))
+	_, err = image.ICO(16, 512)
+	c.Assert(err, qt.Not(qt.IsNil))
+}
 
-			check2 := func(img resource.Image) {
-				c.Assert(img.RelPermalink(), qt.Equals, "/a/sunset.jpg")
-				assertImageFile(c, spec.PublishFs, "a/sunset.jpg", 900, 562)
-			}
+func TestImagePublishModTime(t *testing.T) {
+	c := qt.New(t)
 
-			orignal := fetchImageForSpec(spec, c, "sunset.jpg")
-			c.Assert(orignal, qt.Not(qt.IsNil))
+	for _, mode := range []string{"source", "2019-01-01"} {
+		spec := newTestResourceSpec(specDescriptor{c: c})
+		cfg, err := images.DecodeConfig(map[string]interface{}{"publishModTime": mode})
+		c.Assert(err, qt.IsNil)
+		spec.imaging.Cfg = cfg
 
-			if checkOriginalFirst {
-				check2(orignal)
-			}
+		image := fetchImageForSpec(spec, c, "sunset.jpg")
 
-			resized, err := orignal.Resize("100x50")
+		build := func() time.Time {
+			resized, err := image.Resize("300x")
 			c.Assert(err, qt.IsNil)
+			filename := filepath.Clean(resized.RelPermalink())
+			fi, err := spec.PublishFs.Stat(filename)
+			c.Assert(err, qt.IsNil)
+			return fi.ModTime()
+		}
 
-			check1(resized.(resource.Image))
+		mt1 := build()
 
-			if !checkOriginalFirst {
-				check2(orignal)
-			}
-		})
+		// Start over with the published file gone, the image is then
+		// published again from the file cache.
+		spec.ClearCaches()
+		c.Assert(spec.PublishFs.RemoveAll("a"), qt.IsNil)
+		mt2 := build()
+
+		c.Assert(mt1.Equal(mt2), qt.Equals, true, qt.Commentf(mode))
+
+		if mode == "source" {
+			fi, err := spec.Fs.Source.Stat(filepath.Join(spec.WorkingDir, "sunset.jpg"))
+			c.Assert(err, qt.IsNil)
+			c.Assert(mt1.Equal(fi.ModTime()), qt.Equals, true)
+		} else {
+			c.Assert(mt1.Equal(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)), qt.Equals, true)
+		}
 	}
 }
 
-func TestImageTransformConcurrent(t *testing.T) {
-	var wg sync.WaitGroup
+type testImageProgress struct {
+	mu     sync.Mutex
+	counts []int
+}
+
+func (p *testImageProgress) ImageProcessed(count int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counts = append(p.counts, count)
+}
 
+func TestImageProgress(t *testing.T) {
 	c := qt.New(t)
 
-	spec, workDir := newTestResourceOsFs(c)
-	defer func() {
-		os.Remove(workDir)
-	}()
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	progress := &testImageProgress{}
+	spec.ImageProgress = progress
 
 	image := fetchImageForSpec(spec, c, "sunset.jpg")
 
+	var wg sync.WaitGroup
 	for i := 0; i < 4; i++ {
-		wg.Add(1)
-		go func(id int) {
-			defer wg.Done()
-			for j := 0; j < 5; j++ {
-				img := image
-				for k := 0; k < 2; k++ {
-					r1, err := img.Resize(fmt.Sprintf("%dx", id-k))
-					if err != nil {
-						t.Error(err)
-					}
-
-					if r1.Width() != id-k {
-						t.Errorf("Width: %d:%d", r1.Width(), j)
-					}
+		for _, spec := range []string{"100x", "200x", "300x"} {
+			wg.Add(1)
+			go func(spec string) {
+				defer wg.Done()
+				_, err := image.Resize(spec)
+				c.Check(err, qt.IsNil)
+			}(spec)
+		}
+	}
+	wg.Wait()
 
-					r2, err := r1.Resize(fmt.Sprintf("%dx", id-k-1))
-					if err != nil {
-						t.Error(err)
-					}
+	sort.Ints(progress.counts)
+	c.Assert(progress.counts, qt.DeepEquals, []int{1, 2, 3})
 
-					img = r2
-				}
-			}
-		}(i + 20)
-	}
+	// Cache hits are not counted.
+	_, err := image.Resize("300x")
+	c.Assert(err, qt.IsNil)
+	_, err = image.Fill("100x100")
+	c.Assert(err, qt.IsNil)
+	c.Assert(progress.counts, qt.DeepEquals, []int{1, 2, 3, 4})
 
-	wg.Wait()
+	// No reporter set.
+	spec.ImageProgress = nil
+	_, err = image.Fit("50x50")
+	c.Assert(err, qt.IsNil)
 }
 
-func TestImageWithMetadata(t *testing.T) {
+func TestImageProcessedHook(t *testing.T) {
 	c := qt.New(t)
 
-	image := fetchSunset(c)
+	spec := newTestResourceSpec(specDescriptor{c: c})
 
-	meta := []map[string]interface{}{
-		{
-			"title": "My Sunset",
-			"name":  "Sunset #:counter",
-			"src":   "*.jpg",
-		},
+	var (
+		mu     sync.Mutex
+		events []ImageProcessedEvent
+	)
+	spec.ImageProcessedHook = func(e ImageProcessedEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
 	}
 
-	c.Assert(AssignMetadata(meta, image), qt.IsNil)
-	c.Assert(image.Name(), qt.Equals, "Sunset #1")
-
-	resized, err := image.Resize("200x")
-	c.Assert(err, qt.IsNil)
-	c.Assert(resized.Name(), qt.Equals, "Sunset #1")
-}
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
 
-func TestImageResize8BitPNG(t *testing.T) {
-	c := qt.New(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := image.Resize("300x")
+			c.Check(err, qt.IsNil)
+		}()
+	}
+	wg.Wait()
 
-	image := fetchImage(c, "gohugoio.png")
+	c.Assert(events, qt.HasLen, 1)
+	e := events[0]
+	c.Assert(e.Path, qt.Equals, "sunset.jpg")
+	c.Assert(e.Action, qt.Equals, "resize")
+	c.Assert(e.Width, qt.Equals, 300)
+	c.Assert(e.Height, qt.Equals, 187)
+	c.Assert(e.Elapsed > 0, qt.Equals, true)
 
-	c.Assert(image.MediaType().Type(), qt.Equals, "image/png")
-	c.Assert(image.RelPermalink(), qt.Equals, "/a/gohugoio.png")
-	c.Assert(image.ResourceType(), qt.Equals, "image")
+	// Cache hit.
+	_, err := image.Resize("300x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(events, qt.HasLen, 1)
 
-	resized, err := image.Resize("800x")
+	_, err = image.Fill("100x100")
 	c.Assert(err, qt.IsNil)
-	c.Assert(resized.MediaType().Type(), qt.Equals, "image/png")
-	c.Assert(resized.RelPermalink(), qt.Equals, "/a/gohugoio_hu0e1b9e4a4be4d6f86c7b37b9ccce3fbc_73886_800x0_resize_linear_2.png")
-	c.Assert(resized.Width(), qt.Equals, 800)
+	c.Assert(events, qt.HasLen, 2)
+	c.Assert(events[1].Action, qt.Equals, "fill")
+	c.Assert(events[1].Width, qt.Equals, 100)
 }
 
-func TestImageResizeInSubPath(t *testing.T) {
+func TestImageFromCache(t *testing.T) {
 	c := qt.New(t)
 
-	image := fetchImage(c, "sub/gohugoio2.png")
-	fileCache := image.(specProvider).getSpec().FileCaches.ImageCache().Fs
-
-	c.Assert(image.MediaType(), eq, media.PNGType)
-	c.Assert(image.RelPermalink(), qt.Equals, "/a/sub/gohugoio2.png")
-	c.Assert(image.ResourceType(), qt.Equals, "image")
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	image := fetchImageForSpec(spec, c, "sunset.jpg")
 
-	resized, err := image.Resize("101x101")
-	c.Assert(err, qt.IsNil)
-	c.Assert(resized.MediaType().Type(), qt.Equals, "image/png")
-	c.Assert(resized.RelPermalink(), qt.Equals, "/a/sub/gohugoio2_hu0e1b9e4a4be4d6f86c7b37b9ccce3fbc_73886_101x101_resize_linear_2.png")
-	c.Assert(resized.Width(), qt.Equals, 101)
+	fromCache := func(img resource.Image) bool {
+		return img.(*resourceAdapter).FromCache()
+	}
 
-	assertFileCache(c, fileCache, resized.RelPermalink(), 101, 101)
-	publishedImageFilename := filepath.Clean(resized.RelPermalink())
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resized, err := image.Resize("300x")
+			c.Check(err, qt.IsNil)
+			if !fromCache(resized) {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	c.Assert(created, qt.Equals, 1)
 
-	spec := image.(specProvider).getSpec()
+	resized, err := image.Resize("300x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(fromCache(resized), qt.Equals, true)
 
-	assertImageFile(c, spec.BaseFs.PublishFs, publishedImageFilename, 101, 101)
-	c.Assert(spec.BaseFs.PublishFs.Remove(publishedImageFilename), qt.IsNil)
+	filled, err := image.Fill("100x100")
+	c.Assert(err, qt.IsNil)
+	c.Assert(fromCache(filled), qt.Equals, false)
+	filledAgain, err := image.Fill("100x100")
+	c.Assert(err, qt.IsNil)
+	c.Assert(fromCache(filledAgain), qt.Equals, true)
+	c.Assert(filledAgain, eq, filled)
+	c.Assert(fromCache(filled), qt.Equals, false)
 
-	// Cleare mem cache to simulate reading from the file cache.
+	// A new build reads it from the file cache.
 	spec.imageCache.clear()
-
-	resizedAgain, err := image.Resize("101x101")
+	filled, err = image.Fill("100x100")
 	c.Assert(err, qt.IsNil)
-	c.Assert(resizedAgain.RelPermalink(), qt.Equals, "/a/sub/gohugoio2_hu0e1b9e4a4be4d6f86c7b37b9ccce3fbc_73886_101x101_resize_linear_2.png")
-	c.Assert(resizedAgain.Width(), qt.Equals, 101)
-	assertFileCache(c, fileCache, resizedAgain.RelPermalink(), 101, 101)
-	assertImageFile(c, image.(specProvider).getSpec().BaseFs.PublishFs, publishedImageFilename, 101, 101)
+	c.Assert(fromCache(filled), qt.Equals, true)
 }
 
 func TestSVGImage(t *testing.T) {
@@ -320,6 +3149,32 @@ func TestSVGImage(t *testing.T) {
 	spec := newTestResourceSpec(specDescriptor{c: c})
 	svg := fetchResourceForSpec(spec, c, "circle.svg")
 	c.Assert(svg, qt.Not(qt.IsNil))
+
+	img := svg.(resource.Image)
+	c.Assert(img.Width(), qt.Equals, 100)
+	c.Assert(img.Height(), qt.Equals, 100)
+	c.Assert(img.RelPermalink(), qt.Equals, "/a/circle.svg")
+}
+
+func TestSVGImageRasterMethods(t *testing.T) {
+	c := qt.New(t)
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	svg := fetchResourceForSpec(spec, c, "circle.svg").(*resourceAdapter)
+
+	_, err := svg.DecodedImage()
+	c.Assert(err, qt.ErrorMatches, ".* is not a raster image")
+	_, err = svg.FitBox("100x100")
+	c.Assert(err, qt.ErrorMatches, ".* is not a raster image")
+	_, err = svg.Variants("100x100")
+	c.Assert(err, qt.ErrorMatches, ".* is not a raster image")
+	_, err = svg.Derivatives()
+	c.Assert(err, qt.ErrorMatches, ".* is not a raster image")
+	_, err = svg.ColorInfo()
+	c.Assert(err, qt.ErrorMatches, ".* is not a raster image")
+	_, err = svg.PixelAt(0, 0)
+	c.Assert(err, qt.ErrorMatches, ".* is not a raster image")
+	_, err = svg.WithName("logo")
+	c.Assert(err, qt.ErrorMatches, ".* is not a raster image")
 }
 
 func TestSVGImageContent(t *testing.T) {
@@ -354,12 +3209,126 @@ func TestImageExif(t *testing.T) {
 	c.Assert(ok, qt.Equals, true)
 	c.Assert(lensModel, qt.Equals, "smc PENTAX-DA* 16-50mm F2.8 ED AL [IF] SDM")
 
+	c.Assert(x.LensModel, qt.Equals, lensModel)
+	c.Assert(x.FNumber, qt.Equals, 5.6)
+
 	resized, _ := image.Resize("300x200")
 	x2, _ := resized.Exif()
 	c.Assert(x2, qt.Equals, x)
 
 }
 
+func TestImageExifIgnoreErrors(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+	_, err := fetchImageForSpec(spec, c, "corruptexif.jpg").Exif()
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	spec = newTestResourceSpec(specDescriptor{c: c})
+	spec.imaging.Cfg.Exif.IgnoreErrors = true
+	image := fetchImageForSpec(spec, c, "corruptexif.jpg")
+	x, err := image.Exif()
+	c.Assert(err, qt.IsNil)
+	c.Assert(x, qt.IsNil)
+
+	// The image itself is fine.
+	resized, err := image.Resize("10x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.Width(), qt.Equals, 10)
+}
+
+func TestImageExifPNG(t *testing.T) {
+	c := qt.New(t)
+
+	image := fetchImage(c, "exif.png")
+	x, err := image.Exif()
+	c.Assert(err, qt.IsNil)
+	c.Assert(x, qt.Not(qt.IsNil))
+	c.Assert(x.Date.Format("2006-01-02"), qt.Equals, "2019-08-01")
+	c.Assert(x.Lat, qt.Equals, 59.9)
+
+	// No eXIf chunk.
+	image = fetchImage(c, "gohugoio.png")
+	x, err = image.Exif()
+	c.Assert(err, qt.IsNil)
+	c.Assert(x, qt.IsNil)
+}
+
+func TestImageExifJSON(t *testing.T) {
+	c := qt.New(t)
+	image := fetchImage(c, "sunset.jpg")
+
+	s, err := image.ExifJSON()
+	c.Assert(err, qt.IsNil)
+	c.Assert(s, qt.Contains, `"LensModel":"smc PENTAX-DA* 16-50mm F2.8 ED AL [IF] SDM"`)
+
+	var m map[string]interface{}
+	c.Assert(json.Unmarshal([]byte(s), &m), qt.IsNil)
+	c.Assert(m["FNumber"], qt.Equals, 5.6)
+
+	// Same as the original.
+	resized, err := image.Resize("300x200")
+	c.Assert(err, qt.IsNil)
+	s2, err := resized.ExifJSON()
+	c.Assert(err, qt.IsNil)
+	c.Assert(s2, qt.Equals, s)
+
+	png := fetchImage(c, "gohugoio.png")
+	s, err = png.ExifJSON()
+	c.Assert(err, qt.IsNil)
+	c.Assert(s, qt.Equals, "{}")
+}
+
+func TestImageDisplaySize(t *testing.T) {
+	c := qt.New(t)
+
+	spec := newTestResourceSpec(specDescriptor{c: c})
+
+	// The EXIF says 64x48, the image is 80x60.
+	image := fetchImageForSpec(spec, c, "exifdims.jpg")
+	x, err := image.Exif()
+	c.Assert(err, qt.IsNil)
+	c.Assert(x.PixelWidth, qt.Equals, 64)
+	c.Assert(x.PixelHeight, qt.Equals, 48)
+
+	c.Assert(image.Width(), qt.Equals, 80)
+	c.Assert(image.Height(), qt.Equals, 60)
+	c.Assert(image.DisplayWidth(), qt.Equals, 64)
+	c.Assert(image.DisplayHeight(), qt.Equals, 48)
+
+	// Processed images have no EXIF dimensions of their own.
+	resized, err := image.Resize("40x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.DisplayWidth(), qt.Equals, 40)
+	c.Assert(resized.DisplayHeight(), qt.Equals, 30)
+
+	png := fetchImageForSpec(spec, c, "sub/gohugoio2.png")
+	c.Assert(png.DisplayWidth(), qt.Equals, png.Width())
+	c.Assert(png.DisplayHeight(), qt.Equals, png.Height())
+}
+
+func TestImageOrientation(t *testing.T) {
+	c := qt.New(t)
+	spec := newTestResourceSpec(specDescriptor{c: c})
+
+	// A portrait photo taken with a phone held upright, stored as landscape.
+	phone := fetchImageForSpec(spec, c, "iphone.jpg")
+	c.Assert(phone.Orientation(), qt.Equals, 6)
+	c.Assert(phone.Width(), qt.Equals, 80)
+	c.Assert(phone.Height(), qt.Equals, 60)
+	x, err := phone.Exif()
+	c.Assert(err, qt.IsNil)
+	c.Assert(x.Orientation, qt.Equals, 6)
+
+	resized, err := phone.Resize("40x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.Orientation(), qt.Equals, 6)
+
+	c.Assert(fetchImageForSpec(spec, c, "sunset.jpg").Orientation(), qt.Equals, 1)
+	c.Assert(fetchImageForSpec(spec, c, "gohugoio.png").Orientation(), qt.Equals, 1)
+}
+
 func BenchmarkImageExif(b *testing.B) {
 
 	getImages := func(c *qt.C, b *testing.B, fs afero.Fs) []resource.Image {
@@ -485,9 +3454,22 @@ func TestImageOperationsGolden(t *testing.T) {
 			f.UnsharpMask(1, 1, 0),
 			f.Sigmoid(0.5, 7),
 			f.Pixelate(5),
+			f.Pixelate(8, "circle"),
+			f.GradientOverlay("bottom", "#00000000", "#000000cc"),
+			f.WhiteBalance(8000, 0),
+			f.Vibrance(60),
+			f.CLAHE(8, 2),
+			f.ReplaceColor("#e0a050", 15, "transparent"),
+			f.HueTo("#0000ff"),
 			f.Invert(),
 			f.Hue(22),
 			f.Contrast(32.5),
+			f.Border(5, "#ff0000"),
+			f.DropShadow(10, 10, 8, "#00000080"),
+			f.ColorBlind("protanopia"),
+			f.ColorBlind("deuteranopia"),
+			f.ColorBlind("tritanopia"),
+			f.GradientMap([]interface{}{0, "#000000"}, []interface{}{50, "#ff0000"}, []interface{}{100, "#ffffff"}),
 		}
 
 		resized, err := orig.Fill("400x200 center")
@@ -570,3 +3552,37 @@ func BenchmarkResizeParallel(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkResizeLowMemory(b *testing.B) {
+	c := qt.New(b)
+	spec := newTestResourceSpec(specDescriptor{c: c})
+
+	src := stdimage.NewRGBA(stdimage.Rect(0, 0, 3000, 2000))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i)
+	}
+	filename := filepath.Join(spec.WorkingDir, "large.tif")
+	f, err := helpers.OpenFileForWriting(spec.Fs.Source, filename)
+	c.Assert(err, qt.IsNil)
+	c.Assert(tiff.Encode(f, src, nil), qt.IsNil)
+	f.Close()
+
+	for _, lowMemory := range []bool{false, true} {
+		b.Run(fmt.Sprintf("lowMemory=%t", lowMemory), func(b *testing.B) {
+			spec.imaging.Cfg.LowMemory = lowMemory
+			r, err := spec.New(ResourceSourceDescriptor{Fs: spec.Fs.Source, TargetPaths: newTargetPaths("/a"), SourceFilename: filename})
+			c.Assert(err, qt.IsNil)
+			img := r.(resource.Image)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// A new salt for every image, so it is not cached.
+				spec.imaging.Cfg.Salt = fmt.Sprintf("%t%d", lowMemory, i)
+				if _, err := img.Resize("300x box"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
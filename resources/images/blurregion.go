@@ -0,0 +1,64 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+)
+
+var (
+	_ gift.Filter     = (*blurRegionFilter)(nil)
+	_ boundsValidator = (*blurRegionFilter)(nil)
+)
+
+// blurRegionFilter applies a gaussian blur to a rectangle of the image and
+// leaves the rest of the image as is.
+type blurRegionFilter struct {
+	rect  image.Rectangle
+	sigma float32
+}
+
+func (f blurRegionFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	srcBounds := src.Bounds()
+	dstBounds := dst.Bounds()
+	draw.Draw(dst, dstBounds, src, srcBounds.Min, draw.Src)
+
+	region := f.rect.Add(srcBounds.Min).Intersect(srcBounds)
+	if region.Empty() {
+		return
+	}
+
+	g := gift.New(gift.Crop(region), gift.GaussianBlur(f.sigma))
+	g.SetParallelization(options.Parallelization)
+	blurred := image.NewNRGBA(g.Bounds(srcBounds))
+	g.Draw(blurred, src)
+
+	pt := region.Min.Sub(srcBounds.Min).Add(dstBounds.Min)
+	draw.Draw(dst, image.Rectangle{Min: pt, Max: pt.Add(region.Size())}, blurred, blurred.Bounds().Min, draw.Src)
+}
+
+func (f blurRegionFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
+
+func (f blurRegionFilter) validateBounds(srcBounds image.Rectangle) error {
+	if !f.rect.In(image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())) {
+		return fmt.Errorf("blur region %v is outside the image of %dx%d", f.rect, srcBounds.Dx(), srcBounds.Dy())
+	}
+	return nil
+}
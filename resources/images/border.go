@@ -0,0 +1,42 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*borderFilter)(nil)
+
+// borderFilter draws a solid border around the image, expanding it with
+// width pixels on each side.
+type borderFilter struct {
+	width int
+	color color.Color
+}
+
+func (f borderFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	b := dst.Bounds()
+	draw.Draw(dst, b, image.NewUniform(f.color), image.ZP, draw.Src)
+	inner := image.Rect(b.Min.X+f.width, b.Min.Y+f.width, b.Max.X-f.width, b.Max.Y-f.width)
+	draw.Draw(dst, inner, src, src.Bounds().Min, draw.Src)
+}
+
+func (f borderFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx()+2*f.width, srcBounds.Dy()+2*f.width)
+}
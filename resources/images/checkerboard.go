@@ -0,0 +1,44 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// The colors of the checkerboard, as in most image editors.
+var (
+	checkerboardLight = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	checkerboardDark  = color.NRGBA{R: 0xcc, G: 0xcc, B: 0xcc, A: 0xff}
+)
+
+// Checkerboard returns src drawn over a checkerboard with square cells of
+// cellSize pixels, starting with a light cell in the top left corner, so
+// its transparent areas can be seen. The result is opaque.
+func Checkerboard(src image.Image, cellSize int) *image.NRGBA {
+	bounds := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c := checkerboardLight
+			if (x/cellSize+y/cellSize)%2 == 1 {
+				c = checkerboardDark
+			}
+			dst.SetNRGBA(x, y, c)
+		}
+	}
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Over)
+	return dst
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*claheFilter)(nil)
+
+const claheBins = 256
+
+// claheFilter applies Contrast-Limited Adaptive Histogram Equalization to the
+// luminance of the image. The image is divided into tileGrid x tileGrid
+// tiles, each with its own histogram clipped at clipLimit times the average
+// bin count. The pixels are mapped with bilinear interpolation between the
+// four nearest tiles, which hides the tile borders.
+type claheFilter struct {
+	tileGrid  int
+	clipLimit float64
+}
+
+func (f claheFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	srcBounds := src.Bounds()
+	w, h := srcBounds.Dx(), srcBounds.Dy()
+	if w == 0 || h == 0 {
+		return
+	}
+
+	type pixel struct {
+		y, cb, cr, a float64
+	}
+
+	pixels := make([]pixel, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, a := nrgbaFloats(src.At(srcBounds.Min.X+x, srcBounds.Min.Y+y))
+			yy := 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			pixels[y*w+x] = pixel{
+				y:  yy,
+				cb: float64(b) - yy,
+				cr: float64(r) - yy,
+				a:  float64(a),
+			}
+		}
+	}
+
+	bin := func(v float64) int {
+		return int(math.Max(0, math.Min(claheBins-1, math.Round(v*(claheBins-1)))))
+	}
+
+	gridX, gridY := f.tileGrid, f.tileGrid
+	if gridX > w {
+		gridX = w
+	}
+	if gridY > h {
+		gridY = h
+	}
+	tileW, tileH := float64(w)/float64(gridX), float64(h)/float64(gridY)
+
+	// Build the mapping for each tile.
+	mappings := make([][claheBins]float64, gridX*gridY)
+	for ty := 0; ty < gridY; ty++ {
+		for tx := 0; tx < gridX; tx++ {
+			x0, x1 := int(float64(tx)*tileW), int(float64(tx+1)*tileW)
+			y0, y1 := int(float64(ty)*tileH), int(float64(ty+1)*tileH)
+
+			var hist [claheBins]float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					hist[bin(pixels[y*w+x].y)]++
+				}
+			}
+
+			n := float64((x1 - x0) * (y1 - y0))
+
+			// Clip the histogram and spread the excess evenly over all bins.
+			limit := math.Max(1, f.clipLimit*n/claheBins)
+			var excess float64
+			for i, v := range hist {
+				if v > limit {
+					excess += v - limit
+					hist[i] = limit
+				}
+			}
+			spread := excess / claheBins
+
+			var sum float64
+			m := &mappings[ty*gridX+tx]
+			for i, v := range hist {
+				sum += v + spread
+				m[i] = sum / n
+			}
+		}
+	}
+
+	clamp := func(v float64) float64 {
+		return math.Max(0, math.Min(1, v))
+	}
+
+	dstBounds := dst.Bounds()
+	for y := 0; y < h; y++ {
+		// The tiles above and below the pixel, relative to the tile centers.
+		fy := (float64(y)+0.5)/tileH - 0.5
+		ty0 := int(math.Floor(fy))
+		wy := fy - float64(ty0)
+		ty1 := ty0 + 1
+		if ty0 < 0 {
+			ty0 = 0
+		}
+		if ty1 > gridY-1 {
+			ty1 = gridY - 1
+		}
+
+		for x := 0; x < w; x++ {
+			fx := (float64(x)+0.5)/tileW - 0.5
+			tx0 := int(math.Floor(fx))
+			wx := fx - float64(tx0)
+			tx1 := tx0 + 1
+			if tx0 < 0 {
+				tx0 = 0
+			}
+			if tx1 > gridX-1 {
+				tx1 = gridX - 1
+			}
+
+			p := pixels[y*w+x]
+			b := bin(p.y)
+			top := mappings[ty0*gridX+tx0][b]*(1-wx) + mappings[ty0*gridX+tx1][b]*wx
+			bottom := mappings[ty1*gridX+tx0][b]*(1-wx) + mappings[ty1*gridX+tx1][b]*wx
+			yy := top*(1-wy) + bottom*wy
+
+			r := clamp(yy + p.cr)
+			bl := clamp(yy + p.cb)
+			g := clamp((yy - 0.299*(yy+p.cr) - 0.114*(yy+p.cb)) / 0.587)
+
+			dst.Set(dstBounds.Min.X+x, dstBounds.Min.Y+y, color.NRGBA64{
+				R: uint16(r*0xffff + 0.5),
+				G: uint16(g*0xffff + 0.5),
+				B: uint16(bl*0xffff + 0.5),
+				A: uint16(p.a*0xffff + 0.5),
+			})
+		}
+	}
+}
+
+func (f claheFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/colornames"
+)
+
+// ParseColor parses s as a color. It accepts hex values on the form #rgb,
+// #rgba, #rrggbb and #rrggbbaa (the # is optional), the CSS color names
+// (e.g. "red") and "transparent".
+func ParseColor(s string) (color.Color, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	if s == "transparent" {
+		return color.Transparent, nil
+	}
+
+	if c, found := colornames.Map[s]; found {
+		return c, nil
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+
+	switch len(hex) {
+	case 3, 4:
+		// Expand the short form, e.g. f00 => ff0000.
+		var expanded strings.Builder
+		for _, r := range hex {
+			expanded.WriteRune(r)
+			expanded.WriteRune(r)
+		}
+		hex = expanded.String()
+	case 6, 8:
+	default:
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+
+	return color.NRGBA{
+		R: uint8(v >> 24),
+		G: uint8(v >> 16),
+		B: uint8(v >> 8),
+		A: uint8(v),
+	}, nil
+}
+
+// hexColor returns n on the form rrggbb, or rrggbbaa if not opaque.
+func hexColor(n color.NRGBA) string {
+	s := fmt.Sprintf("%02x%02x%02x", n.R, n.G, n.B)
+	if n.A != 0xff {
+		s += fmt.Sprintf("%02x", n.A)
+	}
+	return s
+}
+
+// HexColor returns c on the form #rrggbb, or #rrggbbaa if not opaque, as
+// accepted by ParseColor.
+func HexColor(c color.Color) string {
+	return "#" + hexColor(color.NRGBAModel.Convert(c).(color.NRGBA))
+}
+
+// AverageColor returns the average color of src, weighted by alpha so
+// transparent pixels count less. Large images are sampled.
+func AverageColor(src image.Image) color.NRGBA {
+	const maxSamples = 256
+
+	b := src.Bounds()
+	stepX, stepY := b.Dx()/maxSamples+1, b.Dy()/maxSamples+1
+
+	var sumR, sumG, sumB, sumA, n uint64
+	for y := b.Min.Y; y < b.Max.Y; y += stepY {
+		for x := b.Min.X; x < b.Max.X; x += stepX {
+			// These are alpha premultiplied.
+			r, g, b, a := src.At(x, y).RGBA()
+			sumR += uint64(r)
+			sumG += uint64(g)
+			sumB += uint64(b)
+			sumA += uint64(a)
+			n++
+		}
+	}
+
+	if n == 0 {
+		return color.NRGBA{}
+	}
+
+	avg := color.RGBA64{
+		R: uint16(sumR / n),
+		G: uint16(sumG / n),
+		B: uint16(sumB / n),
+		A: uint16(sumA / n),
+	}
+
+	return color.NRGBAModel.Convert(avg).(color.NRGBA)
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestParseColor(t *testing.T) {
+	c := qt.New(t)
+
+	for _, test := range []struct {
+		in     string
+		expect interface{}
+	}{
+		{"#ff0000", color.NRGBA{R: 255, A: 255}},
+		{"FF0000", color.NRGBA{R: 255, A: 255}},
+		{"#f00", color.NRGBA{R: 255, A: 255}},
+		{"#f008", color.NRGBA{R: 255, A: 136}},
+		{"#00000080", color.NRGBA{A: 128}},
+		{"Red", color.RGBA{R: 255, A: 255}},
+		{"transparent", color.Transparent},
+		{"", false},
+		{"#ff00", color.NRGBA{R: 255, G: 255, A: 0}},
+		{"#ff000", false},
+		{"#gg0000", false},
+		{"notacolor", false},
+	} {
+		result, err := ParseColor(test.in)
+		if b, ok := test.expect.(bool); ok && !b {
+			c.Assert(err, qt.Not(qt.IsNil), qt.Commentf(test.in))
+			continue
+		}
+		c.Assert(err, qt.IsNil, qt.Commentf(test.in))
+		c.Assert(result, qt.DeepEquals, test.expect, qt.Commentf(test.in))
+	}
+}
+
+func TestHexColor(t *testing.T) {
+	c := qt.New(t)
+
+	c.Assert(HexColor(color.NRGBA{R: 0x33, G: 0x66, B: 0x99, A: 0xff}), qt.Equals, "#336699")
+	c.Assert(HexColor(color.NRGBA{R: 0xff, A: 0x80}), qt.Equals, "#ff000080")
+	// Premultiplied colors are converted.
+	c.Assert(HexColor(color.RGBA{R: 0x80, A: 0x80}), qt.Equals, "#ff000080")
+
+	back, err := ParseColor(HexColor(color.NRGBA{R: 0x33, G: 0x66, B: 0x99, A: 0xff}))
+	c.Assert(err, qt.IsNil)
+	c.Assert(color.NRGBAModel.Convert(back), qt.Equals, color.NRGBA{R: 0x33, G: 0x66, B: 0x99, A: 0xff})
+}
+
+func TestAverageColor(t *testing.T) {
+	c := qt.New(t)
+
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		img.SetNRGBA(x, 0, color.NRGBA{R: 200, A: 255})
+		img.SetNRGBA(x, 1, color.NRGBA{B: 100, A: 255})
+	}
+	c.Assert(AverageColor(img), qt.Equals, color.NRGBA{R: 100, B: 50, A: 255})
+
+	// Transparent pixels do not add to the color.
+	img.SetNRGBA(0, 1, color.NRGBA{G: 255})
+	img.SetNRGBA(1, 1, color.NRGBA{G: 255})
+	img.SetNRGBA(2, 1, color.NRGBA{G: 255})
+	img.SetNRGBA(3, 1, color.NRGBA{G: 255})
+	c.Assert(AverageColor(img), qt.Equals, color.NRGBA{R: 200, A: 127})
+
+	c.Assert(AverageColor(image.NewNRGBA(image.Rectangle{})), qt.Equals, color.NRGBA{})
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*colorBlindFilter)(nil)
+
+// The simulation matrices for full severity from Machado, Oliveira and
+// Fernandes, "A Physiologically-based Model for Simulation of Color Vision
+// Deficiency", 2009. They are applied to linear RGB.
+var colorBlindMatrices = map[string][3][3]float32{
+	"protanopia": {
+		{0.152286, 1.052583, -0.204868},
+		{0.114503, 0.786281, 0.099216},
+		{-0.003882, -0.048116, 1.051998},
+	},
+	"deuteranopia": {
+		{0.367322, 0.860646, -0.227968},
+		{0.280085, 0.672501, 0.047413},
+		{-0.011820, 0.042940, 0.968881},
+	},
+	"tritanopia": {
+		{1.255528, -0.076749, -0.178779},
+		{-0.078411, 0.930809, 0.147602},
+		{0.004733, 0.691367, 0.303900},
+	},
+}
+
+// colorBlindFilter simulates how an image is seen with a color vision
+// deficiency.
+type colorBlindFilter struct {
+	m [3][3]float32
+}
+
+func (f colorBlindFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	// Lookup tables from 8 bit precision sRGB to linear light and back.
+	var toLinear [256]float32
+	for i := range toLinear {
+		toLinear[i] = float32(srgbToLinear(float64(i) / 255))
+	}
+	const lutSize = 4096
+	var fromLinear [lutSize]float32
+	for i := range fromLinear {
+		fromLinear[i] = float32(linearToSRGB(float64(i) / (lutSize - 1)))
+	}
+
+	linear := func(v float32) float32 {
+		return toLinear[int(v*255+0.5)]
+	}
+	encode := func(v float32) float32 {
+		if v <= 0 {
+			return 0
+		}
+		if v >= 1 {
+			return 1
+		}
+		return fromLinear[int(v*(lutSize-1)+0.5)]
+	}
+
+	m := f.m
+	gift.ColorFunc(func(r, g, b, a float32) (float32, float32, float32, float32) {
+		r, g, b = linear(r), linear(g), linear(b)
+		return encode(m[0][0]*r + m[0][1]*g + m[0][2]*b),
+			encode(m[1][0]*r + m[1][1]*g + m[1][2]*b),
+			encode(m[2][0]*r + m[2][1]*g + m[2][2]*b),
+			a
+	}).Draw(dst, src, options)
+}
+
+func (f colorBlindFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package images
+
+import (
+	"image/color"
+	"io"
+)
+
+// ColorInfo describes how the pixels of an image are stored, e.g. to decide
+// how to encode it.
+type ColorInfo struct {
+	// The number of bits per channel, 8 or 16.
+	BitDepth int
+
+	// The name of the Go color model, e.g. "RGBA", "NRGBA64", "Gray",
+	// "YCbCr", "CMYK" or "Paletted". This is "Unknown" for other models.
+	ColorModel string
+
+	// Whether the image is stored as grayscale or as indexes into a palette.
+	Grayscale bool
+	Indexed   bool
+}
+
+var colorModelNames = []struct {
+	model color.Model
+	name  string
+	depth int
+}{
+	{color.RGBAModel, "RGBA", 8},
+	{color.RGBA64Model, "RGBA64", 16},
+	{color.NRGBAModel, "NRGBA", 8},
+	{color.NRGBA64Model, "NRGBA64", 16},
+	{color.AlphaModel, "Alpha", 8},
+	{color.Alpha16Model, "Alpha16", 16},
+	{color.GrayModel, "Gray", 8},
+	{color.Gray16Model, "Gray16", 16},
+	{color.YCbCrModel, "YCbCr", 8},
+	{color.NYCbCrAModel, "NYCbCrA", 8},
+	{color.CMYKModel, "CMYK", 8},
+}
+
+// newColorInfo returns the ColorInfo of images with the color model m.
+func newColorInfo(m color.Model) ColorInfo {
+	if _, ok := m.(color.Palette); ok {
+		return ColorInfo{BitDepth: 8, ColorModel: "Paletted", Indexed: true}
+	}
+
+	for _, n := range colorModelNames {
+		if m == n.model {
+			return ColorInfo{
+				BitDepth:   n.depth,
+				ColorModel: n.name,
+				Grayscale:  m == color.GrayModel || m == color.Gray16Model,
+			}
+		}
+	}
+
+	return ColorInfo{BitDepth: 8, ColorModel: "Unknown"}
+}
+
+// DecodeColorInfo reads the ColorInfo from the header of the image in format f
+// read from r.
+func DecodeColorInfo(r io.Reader, f Format) (ColorInfo, error) {
+	config, err := decodeConfig(r, f)
+	if err != nil {
+		return ColorInfo{}, err
+	}
+	return newColorInfo(config.ColorModel), nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*composedFilter)(nil)
+
+// composedFilter applies a chain of filters as one.
+type composedFilter struct {
+	name    string
+	filters []gift.Filter
+}
+
+func newComposedFilter(name string, filters []gift.Filter) filter {
+	// The options of the filters, so the same chain gives the same key
+	// whatever its name.
+	opts := make([]interface{}, len(filters))
+	for i, f := range filters {
+		if ff, ok := f.(filter); ok {
+			opts[i] = ff.Options
+		} else {
+			opts[i] = f
+		}
+	}
+	return filter{
+		Options: newFilterOpts(opts),
+		Filter:  composedFilter{name: name, filters: filters},
+	}
+}
+
+func (f composedFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	gift.New(f.filters...).Draw(dst, src)
+}
+
+func (f composedFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return gift.New(f.filters...).Bounds(srcBounds)
+}
+
+func (f composedFilter) requiresTransparency() bool {
+	return RequiresTransparency(f.filters...)
+}
+
+func (f composedFilter) validateBounds(srcBounds image.Rectangle) error {
+	if err := validateBounds(srcBounds, f.filters...); err != nil {
+		return fmt.Errorf("%s: %s", f.name, err)
+	}
+	return nil
+}
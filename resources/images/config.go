@@ -14,14 +14,29 @@
 package images
 
 import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/disintegration/gift"
+	"github.com/gohugoio/hugo/helpers"
 
 	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cast"
 )
 
 const (
@@ -38,6 +53,13 @@ var (
 		".tiff": TIFF,
 		".bmp":  BMP,
 		".gif":  GIF,
+		".dng":  DNG,
+		".jp2":  JPEG2000,
+		".j2k":  JPEG2000,
+		".qoi":  QOI,
+		".ico":  ICO,
+		".ppm":  PPM,
+		".pgm":  PGM,
 	}
 
 	// Add or increment if changes to an image format's processing requires
@@ -49,8 +71,71 @@ var (
 	// Increment to mark all processed images as stale. Only use when absolutely needed.
 	// See the finer grained smartCropVersionNumber and imageFormatsVersions.
 	mainImageVersionNumber = 0
+
+	saltRe = regexp.MustCompile(`^[a-zA-Z0-9.-]+$`)
+)
+
+// The valid values for Imaging.FileNameMode.
+const (
+	FileNameModeAuto     = "auto"
+	FileNameModeReadable = "readable"
+	FileNameModeHashed   = "hashed"
+)
+
+// The valid values for Imaging.HashAlgorithm.
+const (
+	HashAlgorithmMD5    = "md5"
+	HashAlgorithmSHA256 = "sha256"
+	HashAlgorithmFNV    = "fnv"
+)
+
+// PublishModTimeSource is the Imaging.PublishModTime value to use the
+// modification time of the source image.
+const PublishModTimeSource = "source"
+
+const (
+	// The image option to convert to sRGB.
+	toSRGBIdentifier = "tosrgb"
+
+	// The image option to embed an sRGB profile in untagged images.
+	tagSRGBIdentifier = "tagsrgb"
+
+	// The image option to optimize the JPEG Huffman tables.
+	optimizeIdentifier = "optimize"
+
+	// The image option to fill the image with its average color.
+	dominantIdentifier = "dominant"
+
+	// The image option to encode the image to QOI.
+	qoiIdentifier = "qoi"
+
+	// The image options to encode the image to PPM or, in gray, PGM.
+	ppmIdentifier = "ppm"
+	pgmIdentifier = "pgm"
+
+	// The image option to always process the image as 8 bit NRGBA.
+	rgbaIdentifier = "rgba"
 )
 
+// The token in Imaging.FilenameTemplate replaced with the default file name.
+const filenameTemplateFilename = ":filename"
+
+// ExpandFilenameTemplate expands the date tokens in the filename template
+// using t and returns the parts before and after the file name.
+func (i Imaging) ExpandFilenameTemplate(t time.Time) (before, after string) {
+	r := strings.NewReplacer(
+		":year", t.Format("2006"),
+		":month", t.Format("01"),
+		":day", t.Format("02"),
+	)
+	parts := strings.SplitN(i.FilenameTemplate, filenameTemplateFilename, 2)
+	before = r.Replace(parts[0])
+	if len(parts) > 1 {
+		after = r.Replace(parts[1])
+	}
+	return
+}
+
 var anchorPositions = map[string]gift.Anchor{
 	strings.ToLower("Center"):      gift.CenterAnchor,
 	strings.ToLower("TopLeft"):     gift.TopLeftAnchor,
@@ -82,13 +167,28 @@ var imageFilters = map[string]gift.Resampling{
 	strings.ToLower("Cosine"):            cosineResampling,
 }
 
+// ResampleFilter returns the normalized name of the resample filter s, e.g.
+// "lanczos" for "Lanczos", and whether it was found.
+func ResampleFilter(s string) (string, bool) {
+	s = strings.ToLower(s)
+	_, found := imageFilters[s]
+	return s, found
+}
+
 func ImageFormatFromExt(ext string) (Format, bool) {
 	f, found := imageFormats[ext]
 	return f, found
 }
 
+// formatFromName returns the format with the file extension name, without
+// the dot, e.g. "jpg".
+func formatFromName(name string) (Format, bool) {
+	name = strings.ToLower(strings.TrimPrefix(name, "."))
+	return ImageFormatFromExt("." + name)
+}
+
 func DecodeConfig(m map[string]interface{}) (Imaging, error) {
-	var i Imaging
+	i := Imaging{PublishOriginals: true}
 	if err := mapstructure.WeakDecode(m, &i); err != nil {
 		return i, err
 	}
@@ -99,8 +199,14 @@ func DecodeConfig(m map[string]interface{}) (Imaging, error) {
 		return i, errors.New("JPEG quality must be a number between 1 and 100")
 	}
 
+	if i.JPEG.Quality < 0 || i.JPEG.Quality > 100 {
+		return i, errors.New("JPEG quality must be a number between 1 and 100")
+	}
+
 	if i.Anchor == "" || strings.EqualFold(i.Anchor, smartCropIdentifier) {
 		i.Anchor = smartCropIdentifier
+	} else if strings.EqualFold(i.Anchor, facesCropIdentifier) {
+		i.Anchor = facesCropIdentifier
 	} else {
 		i.Anchor = strings.ToLower(i.Anchor)
 		if _, found := anchorPositions[i.Anchor]; !found {
@@ -108,6 +214,19 @@ func DecodeConfig(m map[string]interface{}) (Imaging, error) {
 		}
 	}
 
+	if i.AutoSharpen < 0 {
+		return i, fmt.Errorf("invalid autoSharpen %v, must be a positive amount", i.AutoSharpen)
+	}
+
+	if i.SmartCropFallback == "" {
+		i.SmartCropFallback = "center"
+	} else {
+		i.SmartCropFallback = strings.ToLower(i.SmartCropFallback)
+		if _, found := anchorPositions[i.SmartCropFallback]; !found {
+			return i, fmt.Errorf("invalid smartCropFallback %q, must be an anchor position, e.g. center", i.SmartCropFallback)
+		}
+	}
+
 	if i.ResampleFilter == "" {
 		i.ResampleFilter = defaultResampleFilter
 	} else {
@@ -119,6 +238,97 @@ func DecodeConfig(m map[string]interface{}) (Imaging, error) {
 		i.ResampleFilter = filter
 	}
 
+	if i.FileNameMode == "" {
+		i.FileNameMode = FileNameModeAuto
+	} else {
+		i.FileNameMode = strings.ToLower(i.FileNameMode)
+		switch i.FileNameMode {
+		case FileNameModeAuto, FileNameModeReadable, FileNameModeHashed:
+		default:
+			return i, fmt.Errorf("invalid fileNameMode %q, must be one of auto, readable or hashed", i.FileNameMode)
+		}
+	}
+
+	if i.MaxMemory < 0 {
+		return i, fmt.Errorf("invalid maxMemory %d, must be 0 or more megabytes", i.MaxMemory)
+	}
+
+	if i.HashAlgorithm == "" {
+		i.HashAlgorithm = HashAlgorithmMD5
+	} else {
+		i.HashAlgorithm = strings.ToLower(i.HashAlgorithm)
+		switch i.HashAlgorithm {
+		case HashAlgorithmMD5, HashAlgorithmSHA256, HashAlgorithmFNV:
+		default:
+			return i, fmt.Errorf("invalid hashAlgorithm %q, must be one of md5, sha256 or fnv", i.HashAlgorithm)
+		}
+	}
+
+	if i.FlatDir != "" {
+		dir := strings.Trim(filepath.ToSlash(i.FlatDir), "/")
+		if dir == "" || strings.Contains(dir, "..") {
+			return i, fmt.Errorf("invalid flatDir %q, must be a directory below the publish directory", i.FlatDir)
+		}
+		i.FlatDir = dir
+	}
+
+	if len(i.FormatDirs) > 0 {
+		i.formatDirs = make(map[Format]string)
+		// Sorted, so the errors are the same in every build.
+		names := make([]string, 0, len(i.FormatDirs))
+		for name := range i.FormatDirs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		seen := make(map[string]Format)
+		formatNames := make(map[Format]string)
+		for _, name := range names {
+			f, ok := formatFromName(name)
+			if !ok {
+				return i, fmt.Errorf("invalid format %q in formatDirs", name)
+			}
+			dir := strings.Trim(filepath.ToSlash(i.FormatDirs[name]), "/")
+			if dir == "" || strings.Contains(dir, "..") {
+				return i, fmt.Errorf("invalid formatDirs directory %q, must be a directory below the publish directory", i.FormatDirs[name])
+			}
+			// Aliases, e.g. jpg and jpeg, may share a directory, other formats may not.
+			if other, found := i.formatDirs[f]; found && other != dir {
+				return i, fmt.Errorf("formatDirs %q and %q are the same format, but with different directories", formatNames[f], name)
+			}
+			if other, found := seen[dir]; found && other != f {
+				return i, fmt.Errorf("formatDirs directory %q is used for more than one format", dir)
+			}
+			seen[dir] = f
+			formatNames[f] = name
+			i.formatDirs[f] = dir
+		}
+	}
+
+	if i.Salt != "" && !saltRe.MatchString(i.Salt) {
+		return i, fmt.Errorf("invalid salt %q, it can only contain letters, digits, \"-\" and \".\"", i.Salt)
+	}
+
+	if i.PublishModTime != "" {
+		if strings.EqualFold(i.PublishModTime, PublishModTimeSource) {
+			i.PublishModTime = PublishModTimeSource
+		} else {
+			t, err := cast.ToTimeE(i.PublishModTime)
+			if err != nil {
+				return i, fmt.Errorf("invalid publishModTime %q, must be \"source\" or a date", i.PublishModTime)
+			}
+			i.publishModTime = t
+		}
+	}
+
+	if i.FilenameTemplate != "" {
+		if strings.Count(i.FilenameTemplate, filenameTemplateFilename) != 1 {
+			return i, fmt.Errorf("filenameTemplate %q must contain %s exactly once", i.FilenameTemplate, filenameTemplateFilename)
+		}
+		if strings.HasPrefix(i.FilenameTemplate, "/") || strings.Contains(i.FilenameTemplate, "..") {
+			return i, fmt.Errorf("filenameTemplate %q must be a relative path", i.FilenameTemplate)
+		}
+	}
+
 	if strings.TrimSpace(i.Exif.IncludeFields) == "" && strings.TrimSpace(i.Exif.ExcludeFields) == "" {
 		// Don't change this for no good reason. Please don't.
 		i.Exif.ExcludeFields = "GPS|Exif|Exposure[M|P|B]|Contrast|Resolution|Sharp|JPEG|Metering|Sensing|Saturation|ColorSpace|Flash|WhiteBalance"
@@ -143,14 +353,40 @@ func DecodeImageConfig(action, config string, defaults Imaging) (ImageConfig, er
 	for _, part := range parts {
 		part = strings.ToLower(part)
 
-		if part == smartCropIdentifier {
-			c.AnchorStr = smartCropIdentifier
+		if part == smartCropIdentifier || part == facesCropIdentifier {
+			c.AnchorStr = part
 		} else if pos, ok := anchorPositions[part]; ok {
 			c.Anchor = pos
 			c.AnchorStr = part
 		} else if filter, ok := imageFilters[part]; ok {
 			c.Filter = filter
 			c.FilterStr = part
+		} else if part == toSRGBIdentifier {
+			c.ToSRGB = true
+		} else if part == tagSRGBIdentifier {
+			c.TagSRGB = true
+		} else if part == optimizeIdentifier {
+			c.OptimizeHuffman = true
+		} else if part == dominantIdentifier {
+			c.Dominant = true
+		} else if part == qoiIdentifier {
+			c.TargetFormat = QOI
+		} else if part == ppmIdentifier {
+			c.TargetFormat = PPM
+		} else if part == pgmIdentifier {
+			c.TargetFormat = PGM
+		} else if part == rgbaIdentifier {
+			c.RGBA = true
+		} else if part[0] == '#' {
+			bg, err := ParseColor(part)
+			if err != nil {
+				return c, err
+			}
+			c.setBgColor(bg)
+		} else if strings.Contains(part, "=") {
+			if err := c.parseKeyValue(part); err != nil {
+				return c, err
+			}
 		} else if part[0] == 'q' {
 			c.Quality, err = strconv.Atoi(part[1:])
 			if err != nil {
@@ -191,10 +427,63 @@ func DecodeImageConfig(action, config string, defaults Imaging) (ImageConfig, er
 		}
 	}
 
-	if c.Width == 0 && c.Height == 0 {
-		return c, errors.New("must provide Width or Height")
+	if c.Megapixels > 0 {
+		if c.Width != 0 || c.Height != 0 || c.MaxWidth != 0 || c.MaxHeight != 0 {
+			return c, errors.New("mp cannot be combined with Width, Height, maxwidth or maxheight")
+		}
+		if !strings.EqualFold(c.Action, "resize") {
+			return c, fmt.Errorf("mp is not supported by %s", strings.ToLower(c.Action))
+		}
+	} else if c.MaxWidth > 0 || c.MaxHeight > 0 {
+		if c.Width != 0 || c.Height != 0 {
+			return c, errors.New("maxwidth and maxheight cannot be combined with Width or Height")
+		}
+		if strings.EqualFold(c.Action, "fill") || strings.EqualFold(c.Action, "pad") {
+			return c, fmt.Errorf("maxwidth and maxheight are not supported by %s", strings.ToLower(c.Action))
+		}
+	} else if c.Width == 0 && c.Height == 0 {
+		if !c.Dominant {
+			return c, errors.New("must provide Width or Height")
+		}
+		// A single pixel is all a browser needs to stretch, whatever the dpr.
+		c.Width, c.Height = 1, 1
+		c.DPR = 0
+	}
+
+	if c.DPR > 0 {
+		if c.Megapixels > 0 {
+			return c, errors.New("dpr cannot be combined with mp")
+		}
+		var err error
+		scale := func(v int) int {
+			scaled := int(math.Round(float64(v) * c.DPR))
+			if v > 0 && scaled == 0 && err == nil {
+				err = fmt.Errorf("dpr=%g scales %d to 0 pixels", c.DPR, v)
+			}
+			return scaled
+		}
+		c.Width, c.Height = scale(c.Width), scale(c.Height)
+		c.MaxWidth, c.MaxHeight = scale(c.MaxWidth), scale(c.MaxHeight)
+		if err != nil {
+			return c, err
+		}
+	}
+
+	if strings.EqualFold(c.Action, "pad") {
+		if c.Width == 0 || c.Height == 0 {
+			return c, errors.New("must provide both Width and Height for pad")
+		}
+		if c.BgColor == nil {
+			c.setBgColor(color.White)
+		}
+	} else if c.BgColor != nil {
+		// Only pad has any background to fill.
+		return c, fmt.Errorf("the background color %q is only supported by pad", "#"+c.BgColorStr)
 	}
 
+	c.NoUpscale = defaults.NoUpscale
+	c.Salt = defaults.Salt
+
 	if c.FilterStr == "" {
 		c.FilterStr = defaults.ResampleFilter
 		c.Filter = imageFilters[c.FilterStr]
@@ -202,14 +491,136 @@ func DecodeImageConfig(action, config string, defaults Imaging) (ImageConfig, er
 
 	if c.AnchorStr == "" {
 		c.AnchorStr = defaults.Anchor
-		if !strings.EqualFold(c.AnchorStr, smartCropIdentifier) {
+		if c.AnchorStr != smartCropIdentifier && c.AnchorStr != facesCropIdentifier {
 			c.Anchor = anchorPositions[c.AnchorStr]
 		}
 	}
 
+	switch c.Action {
+	case "resize", "fill", "fit":
+		c.Sharpen = defaults.AutoSharpen
+	}
+
+	if strings.EqualFold(c.Action, "pad") && (c.AnchorStr == smartCropIdentifier || c.AnchorStr == facesCropIdentifier) {
+		// Nothing to crop.
+		c.AnchorStr = "center"
+		c.Anchor = gift.CenterAnchor
+	}
+
+	if c.AnchorStr == smartCropIdentifier || c.AnchorStr == facesCropIdentifier {
+		// Used if the smart crop fails.
+		if defaults.SmartCropFallback != "" && defaults.SmartCropFallback != "center" {
+			c.SmartCropFallback = defaults.SmartCropFallback
+		}
+		c.Anchor = anchorPositions[defaults.SmartCropFallback]
+	}
+
 	return c, nil
 }
 
+// smartCropFallback returns the name of the anchor used when the smart crop fails.
+func (c ImageConfig) smartCropFallback() string {
+	if c.SmartCropFallback == "" {
+		return "center"
+	}
+	return c.SmartCropFallback
+}
+
+// setBgColor sets the background color and its normalized string used in the key.
+func (c *ImageConfig) setBgColor(bg color.Color) {
+	n := color.NRGBAModel.Convert(bg).(color.NRGBA)
+	c.BgColor = n
+	c.BgColorStr = hexColor(n)
+}
+
+// parseKeyValue parses an image option on the form key=value, e.g. maxwidth=1200.
+func (c *ImageConfig) parseKeyValue(part string) error {
+	kv := strings.SplitN(part, "=", 2)
+	key, value := kv[0], kv[1]
+
+	switch key {
+	case "page":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if v < 1 {
+			return errors.New("page must be a positive number")
+		}
+		if v > 1 {
+			c.Page = v
+		}
+	case "frame":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if v < 0 {
+			return errors.New("frame must be 0 or a positive number")
+		}
+		c.Frame = v
+	case "mult":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if v < 1 {
+			return errors.New("mult must be a positive number")
+		}
+		if v > 1 {
+			c.Multiple = v
+		}
+	case "depth":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if v != 8 && v != 16 {
+			return errors.New("depth must be 8 or 16")
+		}
+		if v == 16 {
+			c.Depth = v
+		}
+	case "dpr":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		if v <= 0 || v > 10 {
+			return errors.New("dpr must be a number in range (0, 10]")
+		}
+		if v != 1 {
+			c.DPR = v
+		}
+	case "mp":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		if v <= 0 {
+			return errors.New("mp must be a positive number")
+		}
+		c.Megapixels = v
+	case "maxwidth", "maxheight":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if v < 1 {
+			return fmt.Errorf("%s must be a positive number", key)
+		}
+		if key == "maxwidth" {
+			c.MaxWidth = v
+		} else {
+			c.MaxHeight = v
+		}
+	default:
+		return fmt.Errorf("invalid image option %q", part)
+	}
+
+	return nil
+}
+
 // ImageConfig holds configuration to create a new image from an existing one, resize etc.
 type ImageConfig struct {
 	Action string
@@ -222,6 +633,10 @@ type ImageConfig struct {
 	// Default is 75.
 	Quality int
 
+	// TargetFormat is the image format to encode the result to. If not set,
+	// the format of the source is used.
+	TargetFormat Format
+
 	// Rotate rotates an image by the given angle counter-clockwise.
 	// The rotation will be performed first.
 	Rotate int
@@ -229,16 +644,163 @@ type ImageConfig struct {
 	Width  int
 	Height int
 
+	// MaxWidth and MaxHeight constrain the image to the given bounds,
+	// leaving it untouched if it already fits. These are resolved against
+	// the source dimensions into Width and Height before processing.
+	MaxWidth  int
+	MaxHeight int
+
+	// Megapixels is the number of megapixels to resize to, keeping the
+	// aspect ratio. It is resolved against the source dimensions into Width
+	// and Height with ResolveMegapixels before processing.
+	Megapixels float64
+
+	// DPR is the device pixel ratio, e.g. 2 for @2x assets. The dimensions
+	// given are multiplied by it, and it is added to the file name, e.g.
+	// "@2x". 0 means 1.
+	DPR float64
+
+	// Page selects the page, starting at 1, of a multi-page TIFF to process.
+	// 0 means the first page.
+	Page int
+
+	// Frame selects the frame, starting at 0, of an animated GIF to process
+	// into a static image, e.g. a poster. 0 means the first frame.
+	Frame int
+
+	// Multiple rounds the target dimensions to the nearest multiple of it,
+	// e.g. 4 for GPU friendly texture sizes. 0 means no rounding.
+	Multiple int
+
+	// Depth is the number of bits per channel to keep when processing, 16
+	// or 0 for the default, 8. Only 16 bit source images are processed
+	// with 16 bits, and only PNG and TIFF can store them.
+	Depth int
+
+	// XMPCrop is the crop from the XMP of the source image, applied before
+	// any other processing. It is set for original images when the
+	// applyXMPCrop imaging option is enabled.
+	XMPCrop *XMPCrop
+
+	// OptimizeHuffman builds optimized Huffman tables for the image when
+	// encoding to JPEG. This gives smaller files with the same quality.
+	OptimizeHuffman bool
+
+	// ToSRGB converts the image from its embedded ICC profile to sRGB
+	// on decode. This is a no-op for images without a profile.
+	ToSRGB bool
+
+	// TagSRGB embeds an sRGB ICC profile in JPEG and PNG images when the
+	// source image has no profile. It is cleared when it does not apply.
+	TagSRGB bool
+
+	// RGBA processes the image as an *image.NRGBA with 8 bits per channel,
+	// whatever the color model of the source, e.g. grayscale or paletted.
+	// It takes precedence over Depth.
+	RGBA bool
+
+	// Dominant fills the image with the average color of the source, e.g.
+	// for a tiny placeholder. The dimensions default to 1x1.
+	Dominant bool
+
+	// Sharpen is the amount of the unsharp mask applied after resize, fill
+	// and fit, set from the autoSharpen imaging option. It must be cleared
+	// before processing if the image is not downscaled, see IsDownscale.
+	Sharpen float64
+
+	// NoUpscale is set from the imaging config. When set, the dimensions are
+	// clamped to the source dimensions with ClampToSize before processing.
+	NoUpscale bool
+
+	// Salt is set from the imaging config and is added to the key.
+	Salt string
+
 	Filter    gift.Resampling
 	FilterStr string
 
 	Anchor    gift.Anchor
 	AnchorStr string
+
+	// BgColor is the background color used by pad, set with a hex
+	// value, e.g. "#ff0000". Default is white.
+	BgColor    color.Color
+	BgColorStr string
+
+	// ICOSizes are the sizes of the square images in an ICO file.
+	ICOSizes []int
+
+	// SourceHash identifies the source image, e.g. to cache the face
+	// detection for the faces anchor. It is not part of the key.
+	SourceHash string
+
+	// SourceFilename is the file name of the original image, used in
+	// warnings. It is not part of the key.
+	SourceFilename string
+
+	// SmartCropFallback is the anchor used when the smart crop fails, if
+	// not center. Anchor is set to this for the smart and faces anchors.
+	SmartCropFallback string
+}
+
+// ResolveMegapixels sets Width and Height to the largest dimensions with the
+// aspect ratio of a source with the given dimensions within Megapixels.
+func (i *ImageConfig) ResolveMegapixels(width, height int) {
+	if i.Megapixels <= 0 || width <= 0 || height <= 0 {
+		return
+	}
+	if r := i.Rotate % 180; r == 90 || r == -90 {
+		// The rotation is applied first.
+		width, height = height, width
+	}
+
+	scale := math.Sqrt(i.Megapixels * 1e6 / float64(width*height))
+	i.Width = int(math.Max(1, math.Floor(float64(width)*scale)))
+	i.Height = int(math.Max(1, math.Floor(float64(height)*scale)))
+	i.Megapixels = 0
+}
+
+// ClampToSize scales down the target dimensions, keeping their aspect ratio,
+// so the result is no larger than the given source dimensions.
+// It returns whether the config was changed. Fit never scales up, and pad
+// always gives the requested canvas size, so these are left alone.
+func (i *ImageConfig) ClampToSize(width, height int) bool {
+	if i.Action == "fit" || i.Action == "pad" {
+		return false
+	}
+
+	scale := 1.0
+	if i.Width > width {
+		scale = math.Min(scale, float64(width)/float64(i.Width))
+	}
+	if i.Height > height {
+		scale = math.Min(scale, float64(height)/float64(i.Height))
+	}
+	if scale >= 1 {
+		return false
+	}
+
+	clamp := func(v int) int {
+		if v == 0 {
+			return 0
+		}
+		return int(math.Max(1, math.Round(float64(v)*scale)))
+	}
+
+	i.Width, i.Height = clamp(i.Width), clamp(i.Height)
+
+	return true
 }
 
 func (i ImageConfig) GetKey(format Format) string {
 	if i.Key != "" {
-		return i.Action + "_" + i.Key
+		k := i.Action + "_" + i.Key
+		if i.XMPCrop != nil {
+			k += "_xmp" + i.XMPCrop.hash()
+		}
+		if i.Salt != "" {
+			k += "_" + i.Salt
+		}
+		return k
 	}
 
 	k := strconv.Itoa(i.Width) + "x" + strconv.Itoa(i.Height)
@@ -252,16 +814,69 @@ func (i ImageConfig) GetKey(format Format) string {
 		k += "_r" + strconv.Itoa(i.Rotate)
 	}
 	anchor := i.AnchorStr
-	if anchor == smartCropIdentifier {
+	switch anchor {
+	case smartCropIdentifier:
 		anchor = anchor + strconv.Itoa(smartCropVersionNumber)
+	case facesCropIdentifier:
+		anchor = anchor + strconv.Itoa(facesCropVersionNumber)
+	}
+	if i.SmartCropFallback != "" {
+		anchor += "-" + i.SmartCropFallback
+	}
+
+	if i.Page > 1 {
+		k += "_p" + strconv.Itoa(i.Page)
+	}
+	if i.Frame > 0 {
+		k += "_f" + strconv.Itoa(i.Frame)
+	}
+	if i.Multiple > 1 {
+		k += "_m" + strconv.Itoa(i.Multiple)
+	}
+	if i.Depth > 0 {
+		k += "_d" + strconv.Itoa(i.Depth)
+	}
+	if i.XMPCrop != nil {
+		k += "_xmp" + i.XMPCrop.hash()
+	}
+	if i.ToSRGB {
+		k += "_" + toSRGBIdentifier
+	}
+	if i.TagSRGB {
+		k += "_" + tagSRGBIdentifier
+	}
+	if i.OptimizeHuffman {
+		k += "_" + optimizeIdentifier
+	}
+	if i.RGBA {
+		k += "_" + rgbaIdentifier
+	}
+	if i.Dominant {
+		k += "_" + dominantIdentifier
+	}
+	if i.Sharpen > 0 {
+		k += "_sh" + strconv.FormatFloat(i.Sharpen, 'f', -1, 64)
 	}
 
 	k += "_" + i.FilterStr
 
-	if strings.EqualFold(i.Action, "fill") {
+	switch strings.ToLower(i.Action) {
+	case "fill", "pad", "avatar", "ico":
 		k += "_" + anchor
 	}
 
+	if i.BgColorStr != "" {
+		k += "_bg" + i.BgColorStr
+	}
+
+	if len(i.ICOSizes) > 0 {
+		sizes := make([]string, len(i.ICOSizes))
+		for j, size := range i.ICOSizes {
+			sizes[j] = strconv.Itoa(size)
+		}
+		k += "_s" + strings.Join(sizes, "-")
+	}
+
 	if v, ok := imageFormatsVersions[format]; ok {
 		k += "_" + strconv.Itoa(v)
 	}
@@ -270,6 +885,15 @@ func (i ImageConfig) GetKey(format Format) string {
 		k += "_" + strconv.Itoa(mainImageVersionNumber)
 	}
 
+	if i.Salt != "" {
+		k += "_" + i.Salt
+	}
+
+	if i.DPR > 0 {
+		// Last, so it ends up at the end of the file name.
+		k += "@" + strconv.FormatFloat(i.DPR, 'f', -1, 64) + "x"
+	}
+
 	return k
 }
 
@@ -285,9 +909,188 @@ type Imaging struct {
 	// The anchor to use in Fill. Default is "smart", i.e. Smart Crop.
 	Anchor string
 
+	// How to name processed images. Valid values are "auto" (default), which
+	// uses the readable image options in the file name unless it gets too
+	// long, "readable", which always uses them, and "hashed", which always
+	// uses a short hash.
+	FileNameMode string
+
+	// Optional directory, e.g. "images", to publish all processed images in,
+	// named by a hash of the original image and the image options, e.g.
+	// "/images/3c4f...e1.jpg", instead of next to their originals. The
+	// FileNameMode and FilenameTemplate options are not used.
+	FlatDir string
+
+	// Optional directories, e.g. {jpg = "img/jpg", png = "img/png"}, to
+	// publish the processed images of each output format in, e.g. for CDN
+	// routing rules. The keys are file extensions. The images keep their
+	// names and page paths below these. FlatDir is used for the formats not
+	// listed.
+	FormatDirs map[string]string
+
+	formatDirs map[Format]string
+
+	// The hash used in the file names of processed images. Valid values are
+	// "md5" (default), "sha256", truncated to the length of a MD5 hash, e.g.
+	// where MD5 is not allowed, and "fnv", a 64 bit FNV-1a hash, for shorter
+	// names. Changing it changes the file names of all processed images.
+	HashAlgorithm string
+
+	// When set, images are never scaled up beyond their original dimensions.
+	NoUpscale bool
+
+	// When set, the ExifCaption filter draws an empty caption strip on
+	// images without EXIF data, so they look the same as the others.
+	ExifCaptionBlank bool
+
+	// The anchor to use in Fill when the smart crop fails, or finds nothing
+	// to crop around, e.g. in a blank image. Default is "center".
+	SmartCropFallback string
+
+	// Optional template for the file names of processed images, e.g.
+	// ":year/:month/:filename". The :year, :month and :day tokens are taken
+	// from the EXIF capture date, :filename is the default file name without
+	// the extension. Images without an EXIF date use the default name.
+	FilenameTemplate string
+
+	// Salt is added to the key of every processed image. Changing it gives
+	// all processed images new file names, so they are all regenerated.
+	// It can only contain letters, digits, "-" and ".".
+	Salt string
+
+	// The modification time to set on published processed images. The
+	// default, "", keeps the time the file was written. Set it to "source" to
+	// use the modification time of the source image, or to a date, e.g.
+	// "2019-01-01", to use a fixed time. This makes the published files
+	// identical between builds, which helps tools that sync by modification time.
+	PublishModTime string
+
+	publishModTime time.Time
+
+	// Whether to publish the original images when used, e.g. with
+	// .RelPermalink. Default is true. Set it to false when only the
+	// processed images are served, the originals then keep their URLs,
+	// but are not copied to the publish dir.
+	PublishOriginals bool
+
+	// When set, images are published at the end of the build, and only
+	// the images whose .Permalink or .RelPermalink were used in the
+	// templates. By default images are published when first used, and the
+	// images in page bundles are all published.
+	DeferPublish bool
+
+	// When set, the crop and straighten from Lightroom or Camera Raw, stored
+	// in the XMP of JPEG images, is applied to the original images before
+	// they are processed, so the result looks as in the editor.
+	ApplyXMPCrop bool
+
+	// When set, plain downscales of TIFF images with the box filter are done
+	// reading the source image in strips, which uses a lot less memory for
+	// huge images, e.g. scans. Other images and operations are not affected.
+	LowMemory bool
+
+	// The maximum memory in megabytes, e.g. 2048, for the images processed
+	// at the same time, estimated from their dimensions. Images wait for
+	// memory to be available before they are decoded. An image estimated
+	// to need more is processed alone. Default is 0, no limit.
+	MaxMemory int
+
+	// The amount of a mild unsharp mask applied to images made smaller by
+	// resize, fill and fit, e.g. 0.5. Upscaled images are not sharpened.
+	// Default is 0, no sharpening.
+	AutoSharpen float64
+
+	// When set, processed images are named by the MD5 hash of their content,
+	// so identical results from different sources in the same directory,
+	// e.g. sprites, are published once.
+	Deduplicate bool
+
+	// Settings for JPEG images, set in [imaging.jpeg]. They take precedence
+	// over the general settings above.
+	JPEG FormatConfig
+
 	Exif ExifConfig
 }
 
+// FormatConfig holds the settings for one image format.
+type FormatConfig struct {
+	// Default image quality setting (1-100) for the format. Zero means that
+	// the general Quality setting is used.
+	Quality int
+}
+
+// DefaultQuality returns the quality to use for images encoded to f when
+// no quality is set in the image options. It returns 0 for formats without
+// a quality setting.
+func (i Imaging) DefaultQuality(f Format) int {
+	switch f {
+	case JPEG:
+		if i.JPEG.Quality > 0 {
+			return i.JPEG.Quality
+		}
+		return i.Quality
+	default:
+		return 0
+	}
+}
+
+// FormatDir returns the formatDirs directory for images in format f, "" if
+// none.
+func (i Imaging) FormatDir(f Format) string {
+	return i.formatDirs[f]
+}
+
+// HashString returns the hash of s with the configured HashAlgorithm, in hex.
+func (i Imaging) HashString(s string) string {
+	h := i.newHash()
+	h.Write([]byte(s))
+	return i.truncateHash(hex.EncodeToString(h.Sum(nil)))
+}
+
+// HashFileFast returns the hash of the file r with the configured
+// HashAlgorithm, in hex. Like helpers.MD5FromFileFast, it only reads
+// parts of the file.
+func (i Imaging) HashFileFast(r io.ReadSeeker) (string, error) {
+	s, err := helpers.HashFromFileFast(r, i.newHash())
+	if err != nil {
+		return "", err
+	}
+	return i.truncateHash(s), nil
+}
+
+func (i Imaging) newHash() hash.Hash {
+	switch i.HashAlgorithm {
+	case HashAlgorithmSHA256:
+		return sha256.New()
+	case HashAlgorithmFNV:
+		return fnv.New64a()
+	default:
+		return md5.New()
+	}
+}
+
+func (i Imaging) truncateHash(s string) string {
+	if i.HashAlgorithm == HashAlgorithmSHA256 {
+		// The same length as a MD5 hash.
+		return s[:md5.Size*2]
+	}
+	return s
+}
+
+// PublishModTimeFor returns the modification time to set on the published
+// files of an image processed from a source image modified at sourceModTime.
+// It returns false if the time the file was written should be kept.
+func (i Imaging) PublishModTimeFor(sourceModTime time.Time) (time.Time, bool) {
+	switch i.PublishModTime {
+	case "":
+		return time.Time{}, false
+	case PublishModTimeSource:
+		return sourceModTime, !sourceModTime.IsZero()
+	default:
+		return i.publishModTime, true
+	}
+}
+
 type ExifConfig struct {
 
 	// Regexp matching the Exif fields you want from the (massive) set of Exif info
@@ -309,4 +1112,72 @@ type ExifConfig struct {
 	// Hugo extracts the "photo taken where" (GPS latitude and longitude) into
 	// .Long and .Lat. Set this to true to turn it off.
 	DisableLatLong bool
+
+	// The MakerNote holds the camera maker's proprietary data, which can be
+	// large and is mostly binary. Set this to true to leave it out of .Values.
+	DisableMakerNote bool
+
+	// By default a malformed Exif block makes .Exif fail. Set this to true to
+	// log a warning and treat the image as having no Exif instead.
+	IgnoreErrors bool
+}
+
+// IsDownscale reports whether the action makes a source image with the
+// given dimensions smaller.
+func (c ImageConfig) IsDownscale(srcWidth, srcHeight int) bool {
+	if r := c.Rotate % 180; r == 90 || r == -90 {
+		srcWidth, srcHeight = srcHeight, srcWidth
+	}
+
+	switch c.Action {
+	case "resize":
+		if c.Width == 0 {
+			return c.Height < srcHeight
+		}
+		if c.Height == 0 {
+			return c.Width < srcWidth
+		}
+		return c.Width <= srcWidth && c.Height <= srcHeight && (c.Width < srcWidth || c.Height < srcHeight)
+	case "fill":
+		// Scaled to cover the target, then cropped.
+		return c.Width < srcWidth && c.Height < srcHeight
+	case "fit":
+		return c.Width < srcWidth || c.Height < srcHeight
+	default:
+		return false
+	}
+}
+
+// roundToMultiple resolves the target dimensions of the action for a source
+// with the given bounds and rounds them to the nearest multiple of
+// c.Multiple. Resize and fit then get the exact dimensions to resize to.
+func (c ImageConfig) roundToMultiple(srcBounds image.Rectangle) ImageConfig {
+	srcW, srcH := float64(srcBounds.Dx()), float64(srcBounds.Dy())
+	if r := c.Rotate % 180; r == 90 || r == -90 {
+		srcW, srcH = srcH, srcW
+	}
+
+	w, h := float64(c.Width), float64(c.Height)
+
+	switch c.Action {
+	case "resize":
+		if w == 0 {
+			w = srcW * h / srcH
+		} else if h == 0 {
+			h = srcH * w / srcW
+		}
+	case "fit":
+		ratio := math.Min(w/srcW, h/srcH)
+		w, h = srcW*ratio, srcH*ratio
+		c.Action = "resize"
+	}
+
+	round := func(v float64) int {
+		m := float64(c.Multiple)
+		return int(math.Max(1, math.Round(v/m)) * m)
+	}
+
+	c.Width, c.Height = round(w), round(h)
+
+	return c
 }
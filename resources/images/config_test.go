@@ -15,10 +15,15 @@ package images
 
 import (
 	"fmt"
+	"image"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/disintegration/gift"
 
 	qt "github.com/frankban/quicktest"
+	"github.com/gohugoio/hugo/helpers"
 )
 
 func TestDecodeConfig(t *testing.T) {
@@ -41,9 +46,19 @@ func TestDecodeConfig(t *testing.T) {
 	imaging, err = DecodeConfig(m)
 	c.Assert(err, qt.IsNil)
 	c.Assert(imaging.Quality, qt.Equals, defaultJPEGQuality)
+	c.Assert(imaging.PublishOriginals, qt.Equals, true)
+	c.Assert(imaging.DeferPublish, qt.Equals, false)
 	c.Assert(imaging.ResampleFilter, qt.Equals, "box")
 	c.Assert(imaging.Anchor, qt.Equals, "smart")
 
+	imaging, err = DecodeConfig(map[string]interface{}{
+		"publishOriginals": false,
+		"deferPublish":     true,
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.PublishOriginals, qt.Equals, false)
+	c.Assert(imaging.DeferPublish, qt.Equals, true)
+
 	_, err = DecodeConfig(map[string]interface{}{
 		"quality": 123,
 	})
@@ -74,6 +89,182 @@ func TestDecodeConfig(t *testing.T) {
 	c.Assert(imaging.Exif.DisableLatLong, qt.Equals, true)
 	c.Assert(imaging.Exif.ExcludeFields, qt.Equals, "GPS|Exif|Exposure[M|P|B]|Contrast|Resolution|Sharp|JPEG|Metering|Sensing|Saturation|ColorSpace|Flash|WhiteBalance")
 
+	imaging, err = DecodeConfig(map[string]interface{}{
+		"filenameTemplate": ":year/:month/:day-:filename",
+	})
+	c.Assert(err, qt.IsNil)
+	before, after := imaging.ExpandFilenameTemplate(time.Date(2017, 10, 27, 0, 0, 0, 0, time.UTC))
+	c.Assert(before, qt.Equals, "2017/10/27-")
+	c.Assert(after, qt.Equals, "")
+
+	for _, tmpl := range []string{":year/:month", ":filename:filename", "/:year/:filename", "../:filename"} {
+		_, err = DecodeConfig(map[string]interface{}{
+			"filenameTemplate": tmpl,
+		})
+		c.Assert(err, qt.Not(qt.IsNil), qt.Commentf(tmpl))
+	}
+
+	imaging, err = DecodeConfig(map[string]interface{}{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.FileNameMode, qt.Equals, FileNameModeAuto)
+
+	imaging, err = DecodeConfig(map[string]interface{}{
+		"fileNameMode": "Hashed",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.FileNameMode, qt.Equals, FileNameModeHashed)
+
+	_, err = DecodeConfig(map[string]interface{}{
+		"fileNameMode": "short",
+	})
+	c.Assert(err, qt.Not(qt.IsNil))
+
+}
+
+func TestImagingDefaultQuality(t *testing.T) {
+	c := qt.New(t)
+
+	imaging, err := DecodeConfig(map[string]interface{}{
+		"quality": 60,
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.DefaultQuality(JPEG), qt.Equals, 60)
+	c.Assert(imaging.DefaultQuality(PNG), qt.Equals, 0)
+
+	imaging, err = DecodeConfig(map[string]interface{}{
+		"quality": 60,
+		"jpeg": map[string]interface{}{
+			"quality": 85,
+		},
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.Quality, qt.Equals, 60)
+	c.Assert(imaging.DefaultQuality(JPEG), qt.Equals, 85)
+	c.Assert(imaging.DefaultQuality(PNG), qt.Equals, 0)
+	c.Assert(imaging.DefaultQuality(GIF), qt.Equals, 0)
+
+	_, err = DecodeConfig(map[string]interface{}{
+		"jpeg": map[string]interface{}{
+			"quality": 101,
+		},
+	})
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestImageConfigClampToSize(t *testing.T) {
+	c := qt.New(t)
+
+	for _, this := range []struct {
+		action        string
+		width, height int
+		expectChanged bool
+		expectWidth   int
+		expectHeight  int
+	}{
+		{"resize", 300, 0, false, 300, 0},
+		{"resize", 900, 0, false, 900, 0},
+		{"resize", 2000, 0, true, 900, 0},
+		{"resize", 0, 1200, true, 0, 600},
+		{"resize", 1800, 1800, true, 600, 600},
+		{"fill", 1800, 900, true, 900, 450},
+		{"fill", 300, 700, true, 257, 600},
+		{"fit", 2000, 2000, false, 2000, 2000},
+	} {
+		conf := ImageConfig{Action: this.action, Width: this.width, Height: this.height}
+		changed := conf.ClampToSize(900, 600)
+		comment := qt.Commentf("%s %dx%d", this.action, this.width, this.height)
+		c.Assert(changed, qt.Equals, this.expectChanged, comment)
+		c.Assert(conf.Width, qt.Equals, this.expectWidth, comment)
+		c.Assert(conf.Height, qt.Equals, this.expectHeight, comment)
+	}
+
+	conf, err := DecodeImageConfig("resize", "2000x", Imaging{NoUpscale: true})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.NoUpscale, qt.Equals, true)
+}
+
+func TestDecodeConfigFlatDir(t *testing.T) {
+	c := qt.New(t)
+
+	imaging, err := DecodeConfig(map[string]interface{}{"flatDir": "/images/"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.FlatDir, qt.Equals, "images")
+
+	imaging, err = DecodeConfig(map[string]interface{}{"flatDir": "assets/img"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.FlatDir, qt.Equals, "assets/img")
+
+	for _, dir := range []string{"/", "../images"} {
+		_, err = DecodeConfig(map[string]interface{}{"flatDir": dir})
+		c.Assert(err, qt.Not(qt.IsNil), qt.Commentf(dir))
+	}
+}
+
+func TestDecodeConfigFormatDirs(t *testing.T) {
+	c := qt.New(t)
+
+	imaging, err := DecodeConfig(map[string]interface{}{
+		"formatDirs": map[string]interface{}{"jpeg": "/img/jpg/", "PNG": "img/png", "ico": "icons"},
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.FormatDir(JPEG), qt.Equals, "img/jpg")
+	c.Assert(imaging.FormatDir(PNG), qt.Equals, "img/png")
+	c.Assert(imaging.FormatDir(ICO), qt.Equals, "icons")
+	c.Assert(imaging.FormatDir(GIF), qt.Equals, "")
+
+	// The same format with the same directory.
+	imaging, err = DecodeConfig(map[string]interface{}{
+		"formatDirs": map[string]interface{}{"jpg": "img", "jpeg": "/img"},
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.FormatDir(JPEG), qt.Equals, "img")
+
+	_, err = DecodeConfig(map[string]interface{}{
+		"formatDirs": map[string]interface{}{"jpg": "img/a", "jpeg": "img/b"},
+	})
+	c.Assert(err, qt.ErrorMatches, `formatDirs "jpeg" and "jpg" are the same format, but with different directories`)
+
+	for _, dirs := range []map[string]interface{}{
+		{"foo": "img"},
+		{"png": "/"},
+		{"png": "../img"},
+		{"png": "img", "gif": "img/"},
+	} {
+		_, err = DecodeConfig(map[string]interface{}{"formatDirs": dirs})
+		c.Assert(err, qt.Not(qt.IsNil), qt.Commentf("%v", dirs))
+	}
+}
+
+func TestDecodeConfigMaxMemory(t *testing.T) {
+	c := qt.New(t)
+
+	imaging, err := DecodeConfig(map[string]interface{}{"maxMemory": 2048})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.MaxMemory, qt.Equals, 2048)
+
+	_, err = DecodeConfig(map[string]interface{}{"maxMemory": -1})
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestDecodeConfigHashAlgorithm(t *testing.T) {
+	c := qt.New(t)
+
+	imaging, err := DecodeConfig(map[string]interface{}{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.HashAlgorithm, qt.Equals, HashAlgorithmMD5)
+	c.Assert(imaging.HashString("hugo"), qt.Equals, helpers.MD5String("hugo"))
+
+	imaging, err = DecodeConfig(map[string]interface{}{"hashAlgorithm": "SHA256"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.HashAlgorithm, qt.Equals, HashAlgorithmSHA256)
+	c.Assert(imaging.HashString("hugo"), qt.Equals, "0478721f1106c2a631a90181bac7efc7")
+
+	imaging, err = DecodeConfig(map[string]interface{}{"hashAlgorithm": "fnv"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.HashString("hugo"), qt.Equals, "80bc8bcc11c1aeb4")
+
+	_, err = DecodeConfig(map[string]interface{}{"hashAlgorithm": "xxhash"})
+	c.Assert(err, qt.Not(qt.IsNil))
 }
 
 func TestDecodeImageConfig(t *testing.T) {
@@ -89,6 +280,12 @@ func TestDecodeImageConfig(t *testing.T) {
 
 		{"", false},
 		{"foo", false},
+		{"300x maxwidth=200", false},
+		{"maxwidth=0", false},
+		{"maxwidth=abc", false},
+		{"foo=bar", false},
+		{"300x page=0", false},
+		{"300x frame=-1", false},
 	} {
 
 		result, err := DecodeImageConfig("resize", this.in, Imaging{})
@@ -107,6 +304,333 @@ func TestDecodeImageConfig(t *testing.T) {
 	}
 }
 
+func TestDecodeImageConfigMaxDimensions(t *testing.T) {
+	c := qt.New(t)
+
+	conf, err := DecodeImageConfig("resize", "maxwidth=1200 Lanczos", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.MaxWidth, qt.Equals, 1200)
+	c.Assert(conf.MaxHeight, qt.Equals, 0)
+	c.Assert(conf.Width, qt.Equals, 0)
+	c.Assert(conf.FilterStr, qt.Equals, "lanczos")
+
+	conf, err = DecodeImageConfig("fit", "maxWidth=1200 maxHeight=800", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.MaxWidth, qt.Equals, 1200)
+	c.Assert(conf.MaxHeight, qt.Equals, 800)
+
+	_, err = DecodeImageConfig("fill", "maxwidth=1200", Imaging{})
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestDecodeImageConfigMegapixels(t *testing.T) {
+	c := qt.New(t)
+
+	conf, err := DecodeImageConfig("resize", "mp=2 q80", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Megapixels, qt.Equals, 2.0)
+	c.Assert(conf.Width, qt.Equals, 0)
+
+	conf.ResolveMegapixels(900, 562)
+	c.Assert(conf.Width, qt.Equals, 1789)
+	c.Assert(conf.Height, qt.Equals, 1117)
+	c.Assert(conf.Width*conf.Height <= 2e6, qt.Equals, true)
+	c.Assert(conf.Megapixels, qt.Equals, 0.0)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "1789x1117_resize_q80_")
+
+	// The dimensions are swapped when rotated by 90 degrees.
+	conf, err = DecodeImageConfig("resize", "mp=0.5 r90", Imaging{})
+	c.Assert(err, qt.IsNil)
+	conf.ResolveMegapixels(900, 562)
+	c.Assert(conf.Width, qt.Equals, 558)
+	c.Assert(conf.Height, qt.Equals, 894)
+
+	for _, spec := range []string{"mp=0", "mp=-1", "mp=abc", "300x mp=2", "mp=2 maxwidth=300"} {
+		_, err = DecodeImageConfig("resize", spec, Imaging{})
+		c.Assert(err, qt.Not(qt.IsNil), qt.Commentf(spec))
+	}
+
+	_, err = DecodeImageConfig("fill", "mp=2", Imaging{})
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestDecodeImageConfigPage(t *testing.T) {
+	c := qt.New(t)
+
+	conf, err := DecodeImageConfig("resize", "300x page=2", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Page, qt.Equals, 2)
+	c.Assert(conf.GetKey(TIFF), qt.Equals, "300x0_resize_p2_")
+
+	// The first page is the default.
+	conf, err = DecodeImageConfig("resize", "300x page=1", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Page, qt.Equals, 0)
+	c.Assert(conf.GetKey(TIFF), qt.Equals, "300x0_resize_")
+}
+
+func TestDecodeImageConfigFrame(t *testing.T) {
+	c := qt.New(t)
+
+	conf, err := DecodeImageConfig("resize", "300x frame=2", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Frame, qt.Equals, 2)
+	c.Assert(conf.GetKey(GIF), qt.Equals, "300x0_resize_f2_")
+
+	// The first frame is the default.
+	conf, err = DecodeImageConfig("resize", "300x frame=0", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.GetKey(GIF), qt.Equals, "300x0_resize_")
+}
+
+func TestDecodeImageConfigDPR(t *testing.T) {
+	c := qt.New(t)
+
+	conf, err := DecodeImageConfig("resize", "400x dpr=2", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Width, qt.Equals, 800)
+	c.Assert(conf.Height, qt.Equals, 0)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "800x0_resize_@2x")
+
+	conf, err = DecodeImageConfig("fill", "400x300 dpr=1.5", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Width, qt.Equals, 600)
+	c.Assert(conf.Height, qt.Equals, 450)
+	c.Assert(strings.HasSuffix(conf.GetKey(JPEG), "@1.5x"), qt.Equals, true)
+
+	conf, err = DecodeImageConfig("resize", "400x dpr=1", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Width, qt.Equals, 400)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "400x0_resize_")
+
+	for _, spec := range []string{"400x dpr=0", "400x dpr=abc", "400x dpr=11", "dpr=2 mp=1"} {
+		_, err = DecodeImageConfig("resize", spec, Imaging{})
+		c.Assert(err, qt.Not(qt.IsNil), qt.Commentf(spec))
+	}
+
+	_, err = DecodeImageConfig("resize", "4x dpr=0.1", Imaging{})
+	c.Assert(err, qt.ErrorMatches, "dpr=0.1 scales 4 to 0 pixels")
+	_, err = DecodeImageConfig("fit", "maxwidth=4 dpr=0.1", Imaging{})
+	c.Assert(err, qt.ErrorMatches, "dpr=0.1 scales 4 to 0 pixels")
+
+	// The dominant color placeholder is always a single pixel.
+	conf, err = DecodeImageConfig("resize", "dominant dpr=2", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Width, qt.Equals, 1)
+	c.Assert(conf.Height, qt.Equals, 1)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "1x1_resize_dominant_")
+	conf, err = DecodeImageConfig("resize", "dominant 8x4 dpr=2", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Width, qt.Equals, 16)
+}
+
+func TestDecodeImageConfigPad(t *testing.T) {
+	c := qt.New(t)
+
+	conf, err := DecodeImageConfig("pad", "300x200", Imaging{Anchor: smartCropIdentifier})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.BgColorStr, qt.Equals, "ffffff")
+	c.Assert(conf.AnchorStr, qt.Equals, "center")
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "300x200_pad__center_bgffffff")
+
+	conf, err = DecodeImageConfig("pad", "300x200 #F00 bottom", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.BgColorStr, qt.Equals, "ff0000")
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "300x200_pad__bottom_bgff0000")
+
+	conf, err = DecodeImageConfig("pad", "300x200 #ff000080", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.BgColorStr, qt.Equals, "ff000080")
+
+	_, err = DecodeImageConfig("pad", "300x", Imaging{})
+	c.Assert(err, qt.Not(qt.IsNil))
+	_, err = DecodeImageConfig("pad", "maxwidth=300", Imaging{})
+	c.Assert(err, qt.Not(qt.IsNil))
+	_, err = DecodeImageConfig("pad", "300x200 #ff", Imaging{})
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	for _, action := range []string{"resize", "fill", "fit"} {
+		_, err = DecodeImageConfig(action, "300x200 #ff0000", Imaging{})
+		c.Assert(err, qt.ErrorMatches, `the background color "#ff0000" is only supported by pad`)
+	}
+}
+
+func TestDecodeImageConfigDefaultAnchor(t *testing.T) {
+	c := qt.New(t)
+
+	imaging, err := DecodeConfig(map[string]interface{}{
+		"anchor": "Top",
+	})
+	c.Assert(err, qt.IsNil)
+
+	// The anchor from the imaging config is used when the spec has none.
+	conf, err := DecodeImageConfig("fill", "300x200", imaging)
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Anchor, qt.Equals, gift.TopAnchor)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "300x200_fill_box_top")
+
+	// And it's the same image as with an explicit anchor.
+	explicit, err := DecodeImageConfig("fill", "300x200 top", imaging)
+	c.Assert(err, qt.IsNil)
+	c.Assert(explicit.GetKey(JPEG), qt.Equals, conf.GetKey(JPEG))
+
+	conf, err = DecodeImageConfig("fill", "300x200 BottomLeft", imaging)
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Anchor, qt.Equals, gift.BottomLeftAnchor)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "300x200_fill_box_bottomleft")
+}
+
+func TestDecodeImageConfigMultiple(t *testing.T) {
+	c := qt.New(t)
+
+	conf, err := DecodeImageConfig("resize", "601x mult=4", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Multiple, qt.Equals, 4)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "601x0_resize_m4_")
+
+	conf, err = DecodeImageConfig("resize", "601x mult=1", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Multiple, qt.Equals, 0)
+
+	_, err = DecodeImageConfig("resize", "601x mult=0", Imaging{})
+	c.Assert(err, qt.Not(qt.IsNil))
+	_, err = DecodeImageConfig("resize", "601x mult=a", Imaging{})
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	src := image.Rect(0, 0, 900, 562)
+	for _, test := range []struct {
+		action, spec string
+		w, h         int
+	}{
+		{"resize", "601x mult=4", 600, 376},
+		{"resize", "x101 mult=2", 162, 102},
+		{"resize", "601x r90 mult=4", 600, 964},
+		{"fit", "301x301 mult=10", 300, 190},
+		{"fill", "101x50 mult=8", 104, 48},
+		{"fill", "3x3 mult=8", 8, 8},
+	} {
+		conf, err := DecodeImageConfig(test.action, test.spec, Imaging{})
+		c.Assert(err, qt.IsNil)
+		conf = conf.roundToMultiple(src)
+		c.Assert([]int{conf.Width, conf.Height}, qt.DeepEquals, []int{test.w, test.h}, qt.Commentf(test.spec))
+	}
+}
+
+func TestDecodeImageConfigDepth(t *testing.T) {
+	c := qt.New(t)
+
+	conf, err := DecodeImageConfig("resize", "300x depth=16", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Depth, qt.Equals, 16)
+	c.Assert(conf.GetKey(PNG), qt.Equals, "300x0_resize_d16__2")
+
+	conf, err = DecodeImageConfig("resize", "300x depth=8", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Depth, qt.Equals, 0)
+
+	_, err = DecodeImageConfig("resize", "300x depth=12", Imaging{})
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestDecodeImageConfigToSRGB(t *testing.T) {
+	c := qt.New(t)
+
+	conf, err := DecodeImageConfig("resize", "300x ToSRGB", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.ToSRGB, qt.Equals, true)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "300x0_resize_tosrgb_")
+
+	conf, err = DecodeImageConfig("resize", "300x tagsrgb", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.TagSRGB, qt.Equals, true)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "300x0_resize_tagsrgb_")
+
+	conf, err = DecodeImageConfig("resize", "300x optimize", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.OptimizeHuffman, qt.Equals, true)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "300x0_resize_optimize_")
+
+	conf, err = DecodeImageConfig("resize", "300x", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.ToSRGB, qt.Equals, false)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "300x0_resize_")
+}
+
+func TestDecodeImageConfigDominant(t *testing.T) {
+	c := qt.New(t)
+
+	conf, err := DecodeImageConfig("resize", "dominant", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Dominant, qt.Equals, true)
+	c.Assert(conf.Width, qt.Equals, 1)
+	c.Assert(conf.Height, qt.Equals, 1)
+
+	// The color is found when processing, the file name has the source hash.
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "1x1_resize_dominant_")
+
+	conf, err = DecodeImageConfig("fill", "dominant 8x4", Imaging{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Width, qt.Equals, 8)
+	c.Assert(conf.Height, qt.Equals, 4)
+}
+
+func TestImageConfigSalt(t *testing.T) {
+	c := qt.New(t)
+
+	imaging, err := DecodeConfig(map[string]interface{}{
+		"salt": "v2",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.Salt, qt.Equals, "v2")
+
+	_, err = DecodeConfig(map[string]interface{}{
+		"salt": "../v2",
+	})
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	conf, err := DecodeImageConfig("resize", "300x", imaging)
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "300x0_resize_box_v2")
+
+	conf = ImageConfig{Action: "filter", Key: "abc", Salt: "v2"}
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "filter_abc_v2")
+}
+
+func TestImagingPublishModTime(t *testing.T) {
+	c := qt.New(t)
+
+	sourceModTime := time.Date(2018, 5, 3, 10, 20, 0, 0, time.UTC)
+
+	imaging, err := DecodeConfig(map[string]interface{}{})
+	c.Assert(err, qt.IsNil)
+	_, ok := imaging.PublishModTimeFor(sourceModTime)
+	c.Assert(ok, qt.Equals, false)
+
+	imaging, err = DecodeConfig(map[string]interface{}{
+		"publishModTime": "Source",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.PublishModTime, qt.Equals, PublishModTimeSource)
+	mt, ok := imaging.PublishModTimeFor(sourceModTime)
+	c.Assert(ok, qt.Equals, true)
+	c.Assert(mt, qt.Equals, sourceModTime)
+	_, ok = imaging.PublishModTimeFor(time.Time{})
+	c.Assert(ok, qt.Equals, false)
+
+	imaging, err = DecodeConfig(map[string]interface{}{
+		"publishModTime": "2019-01-01",
+	})
+	c.Assert(err, qt.IsNil)
+	mt, ok = imaging.PublishModTimeFor(sourceModTime)
+	c.Assert(ok, qt.Equals, true)
+	c.Assert(mt.Equal(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)), qt.Equals, true)
+
+	_, err = DecodeConfig(map[string]interface{}{
+		"publishModTime": "yesterday",
+	})
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
 func newImageConfig(width, height, quality, rotate int, filter, anchor string) ImageConfig {
 	var c ImageConfig
 	c.Action = "resize"
@@ -133,3 +657,83 @@ func newImageConfig(width, height, quality, rotate int, filter, anchor string) I
 
 	return c
 }
+
+func TestDecodeImageConfigSmartCropFallback(t *testing.T) {
+	c := qt.New(t)
+
+	imaging, err := DecodeConfig(map[string]interface{}{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.SmartCropFallback, qt.Equals, "center")
+
+	conf, err := DecodeImageConfig("fill", "300x200 smart", imaging)
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Anchor, qt.Equals, gift.CenterAnchor)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "300x200_fill_box_smart2")
+
+	imaging, err = DecodeConfig(map[string]interface{}{
+		"smartCropFallback": "TopLeft",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(imaging.SmartCropFallback, qt.Equals, "topleft")
+
+	conf, err = DecodeImageConfig("fill", "300x200 smart", imaging)
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Anchor, qt.Equals, gift.TopLeftAnchor)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "300x200_fill_box_smart2-topleft")
+
+	// Only used for smart cropping.
+	conf, err = DecodeImageConfig("fill", "300x200 bottom", imaging)
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Anchor, qt.Equals, gift.BottomAnchor)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "300x200_fill_box_bottom")
+
+	_, err = DecodeConfig(map[string]interface{}{
+		"smartCropFallback": "smart",
+	})
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestDecodeImageConfigAutoSharpen(t *testing.T) {
+	c := qt.New(t)
+
+	imaging, err := DecodeConfig(map[string]interface{}{
+		"autoSharpen": 0.5,
+	})
+	c.Assert(err, qt.IsNil)
+
+	conf, err := DecodeImageConfig("resize", "300x", imaging)
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Sharpen, qt.Equals, 0.5)
+	c.Assert(conf.GetKey(JPEG), qt.Equals, "300x0_resize_sh0.5_box")
+
+	conf, err = DecodeImageConfig("pad", "300x200", imaging)
+	c.Assert(err, qt.IsNil)
+	c.Assert(conf.Sharpen, qt.Equals, 0.0)
+
+	for _, test := range []struct {
+		action string
+		spec   string
+		expect bool
+	}{
+		{"resize", "300x", true},
+		{"resize", "x200", true},
+		{"resize", "500x", false},
+		{"resize", "300x500", false},
+		{"fill", "300x200", true},
+		{"fill", "300x300", false},
+		{"fill", "500x300", false},
+		{"fit", "500x200", true},
+		{"fit", "500x500", false},
+		{"resize", "250x r90", true},
+		{"resize", "350x r90", false},
+	} {
+		conf, err := DecodeImageConfig(test.action, test.spec, imaging)
+		c.Assert(err, qt.IsNil)
+		c.Assert(conf.IsDownscale(400, 400*3/4), qt.Equals, test.expect, qt.Commentf("%s %s", test.action, test.spec))
+	}
+
+	_, err = DecodeConfig(map[string]interface{}{
+		"autoSharpen": -1,
+	})
+	c.Assert(err, qt.Not(qt.IsNil))
+}
@@ -0,0 +1,211 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+)
+
+// TIFF tags used to find the preview in a DNG.
+const (
+	tiffTagNewSubfileType        = 254
+	tiffTagCompression           = 259
+	tiffTagPhotometric           = 262
+	tiffTagStripOffsets          = 273
+	tiffTagStripByteCounts       = 279
+	tiffTagSubIFDs               = 330
+	tiffTagJPEGInterchange       = 513
+	tiffTagJPEGInterchangeLength = 514
+)
+
+// ErrNoDNGPreview is returned when a DNG file has no embedded JPEG preview.
+var ErrNoDNGPreview = errors.New("no JPEG preview found in DNG")
+
+// DecodeDNGPreview decodes the largest JPEG preview embedded in the DNG read
+// from r. We do not develop the raw image data, but the preview is usually
+// in full resolution, which is more than good enough for the web.
+func DecodeDNGPreview(r io.Reader) (image.Image, error) {
+	b, err := dngPreview(r)
+	if err != nil {
+		return nil, err
+	}
+	return jpeg.Decode(bytes.NewReader(b))
+}
+
+// DecodeDNGPreviewConfig returns the dimensions of the preview decoded by
+// DecodeDNGPreview.
+func DecodeDNGPreviewConfig(r io.Reader) (image.Config, error) {
+	b, err := dngPreview(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return jpeg.DecodeConfig(bytes.NewReader(b))
+}
+
+// dngPreview returns the bytes of the largest JPEG preview in the DNG read
+// from r, looking in all the image file directories and their sub IFDs.
+func dngPreview(r io.Reader) ([]byte, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	offsets, order, err := tiffPageOffsets(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var preview []byte
+	seen := make(map[uint32]bool)
+
+	var walk func(offset uint32, depth int) error
+	walk = func(offset uint32, depth int) error {
+		if seen[offset] || depth > 4 {
+			return nil
+		}
+		seen[offset] = true
+
+		tags, err := tiffTags(b, order, offset)
+		if err != nil {
+			return err
+		}
+
+		if p := jpegPreview(b, tags); len(p) > len(preview) {
+			preview = p
+		}
+
+		for _, sub := range tags[tiffTagSubIFDs] {
+			if err := walk(sub, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, offset := range offsets {
+		if err := walk(offset, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	if preview == nil {
+		return nil, ErrNoDNGPreview
+	}
+
+	return preview, nil
+}
+
+// jpegPreview returns the JPEG data described by tags, if it is a preview.
+func jpegPreview(b []byte, tags map[uint16][]uint32) []byte {
+	first := func(tag uint16) uint32 {
+		if v := tags[tag]; len(v) > 0 {
+			return v[0]
+		}
+		return 0
+	}
+
+	// Skip the main raw image.
+	if first(tiffTagNewSubfileType)&1 == 0 {
+		return nil
+	}
+
+	var offset, length uint32
+	switch {
+	case first(tiffTagJPEGInterchange) != 0:
+		offset, length = first(tiffTagJPEGInterchange), first(tiffTagJPEGInterchangeLength)
+	case len(tags[tiffTagStripOffsets]) == 1:
+		// JPEG (7) or old-style JPEG (6) compressed, in one strip.
+		if c := first(tiffTagCompression); c != 6 && c != 7 {
+			return nil
+		}
+		// Only YCbCr and RGB previews, not raw sensor data.
+		if p := first(tiffTagPhotometric); p != 6 && p != 2 {
+			return nil
+		}
+		offset, length = first(tiffTagStripOffsets), first(tiffTagStripByteCounts)
+	default:
+		return nil
+	}
+
+	end := uint64(offset) + uint64(length)
+	if length < 2 || end > uint64(len(b)) {
+		return nil
+	}
+
+	data := b[offset:end]
+	if data[0] != 0xff || data[1] != 0xd8 {
+		// Not a JPEG.
+		return nil
+	}
+
+	return data
+}
+
+// tiffTags reads the SHORT and LONG valued tags in the IFD at offset.
+func tiffTags(b []byte, order binary.ByteOrder, offset uint32) (map[uint16][]uint32, error) {
+	if uint64(offset)+2 > uint64(len(b)) {
+		return nil, errors.New("invalid TIFF: IFD offset out of range")
+	}
+	numEntries := int(order.Uint16(b[offset:]))
+	if int(offset)+2+numEntries*12 > len(b) {
+		return nil, errors.New("invalid TIFF: IFD out of range")
+	}
+
+	tags := make(map[uint16][]uint32)
+
+	for i := 0; i < numEntries; i++ {
+		e := b[int(offset)+2+i*12:]
+		tag, typ, count := order.Uint16(e), order.Uint16(e[2:]), order.Uint32(e[4:])
+
+		var size uint32
+		switch typ {
+		case 3: // SHORT
+			size = 2
+		case 4, 13: // LONG, IFD
+			size = 4
+		default:
+			continue
+		}
+
+		if count == 0 || count > 1024 {
+			continue
+		}
+
+		data := e[8:12]
+		if count*size > 4 {
+			valOffset := order.Uint32(e[8:])
+			if uint64(valOffset)+uint64(count*size) > uint64(len(b)) {
+				continue
+			}
+			data = b[valOffset : valOffset+count*size]
+		}
+
+		vals := make([]uint32, count)
+		for j := range vals {
+			if size == 2 {
+				vals[j] = uint32(order.Uint16(data[j*2:]))
+			} else {
+				vals[j] = order.Uint32(data[j*4:])
+			}
+		}
+		tags[tag] = vals
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"bytes"
+	"image"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDecodeDNGPreview(t *testing.T) {
+	c := qt.New(t)
+
+	b, err := ioutil.ReadFile(filepath.FromSlash("../testdata/sample.dng"))
+	c.Assert(err, qt.IsNil)
+
+	// IFD0 holds a 8x6 thumbnail, the JPEG preview is in a sub IFD.
+	config, err := DecodeDNGPreviewConfig(bytes.NewReader(b))
+	c.Assert(err, qt.IsNil)
+	c.Assert(config.Width, qt.Equals, 64)
+	c.Assert(config.Height, qt.Equals, 48)
+
+	img, err := DecodeDNGPreview(bytes.NewReader(b))
+	c.Assert(err, qt.IsNil)
+	c.Assert(img.Bounds(), qt.Equals, image.Rect(0, 0, 64, 48))
+
+	// The pages are TIFF without a preview.
+	tif, err := ioutil.ReadFile(filepath.FromSlash("../testdata/pages.tif"))
+	c.Assert(err, qt.IsNil)
+	_, err = DecodeDNGPreview(bytes.NewReader(tif))
+	c.Assert(err, qt.Equals, ErrNoDNGPreview)
+
+	_, err = DecodeDNGPreview(bytes.NewReader([]byte("not a DNG")))
+	c.Assert(err, qt.Not(qt.IsNil))
+}
@@ -14,11 +14,16 @@
 package exif
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
@@ -31,17 +36,109 @@ import (
 const exifTimeLayout = "2006:01:02 15:04:05"
 
 type Exif struct {
-	Lat    float64
-	Long   float64
-	Date   time.Time
+	// The GPS position in decimal degrees, negative in the southern and
+	// western hemispheres, e.g. -33.856159 and 151.215256.
+	Lat  float64
+	Long float64
+	Date time.Time
+
+	// The EXIF orientation (1-8). This will be 0 if not set.
+	Orientation int
+
+	// The fields below are the ones most commonly shown in photo galleries.
+	// They are set independent of the include and exclude filters, and are
+	// zero if not found.
+
+	// The camera and lens, e.g. "RICOH IMAGING COMPANY, LTD.", "PENTAX K-3 II"
+	// and "smc PENTAX-DA* 16-50mm F2.8 ED AL [IF] SDM".
+	Make      string
+	Model     string
+	LensModel string
+
+	// The focal length in mm, the f-number and the exposure time in
+	// seconds, e.g. 21, 5.6 and 0.005.
+	FocalLength  float64
+	FNumber      float64
+	ExposureTime float64
+
+	// The ISO speed rating, e.g. 100.
+	ISO int
+
+	// The image dimensions declared in PixelXDimension and PixelYDimension.
+	// These may differ from the actual dimensions of the image, e.g. for
+	// cameras that crop on export.
+	PixelWidth  int
+	PixelHeight int
+
+	// The number of the image in the camera, e.g. the shutter count, and
+	// the fraction of the second the photo was taken in as digits, e.g.
+	// "042". Both help to order photos taken in the same second, as in a
+	// burst. The fraction is included in Date.
+	ImageNumber        int
+	SubSecTimeOriginal string
+
 	Values map[string]interface{}
 }
 
+// GPSString returns the GPS position as decimal degrees separated by a comma,
+// e.g. "36.597440, -4.508460", or an empty string if not set.
+func (e *Exif) GPSString() string {
+	if e.Lat == 0 && e.Long == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.6f, %.6f", e.Lat, e.Long)
+}
+
+// ValuesJSON returns Values marshaled to JSON, e.g. for fields that have no
+// typed accessor. Rationals are written as strings, e.g. "1/200", and dates
+// in RFC 3339 format. Values that cannot be represented in JSON, e.g. NaN,
+// are written as null.
+func (e *Exif) ValuesJSON() ([]byte, error) {
+	vals := make(map[string]interface{}, len(e.Values))
+	for k, v := range e.Values {
+		vals[k] = jsonValue(v)
+	}
+	return json.Marshal(vals)
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case nil, string, int, bool:
+		return v
+	case float64:
+		if math.IsNaN(vv) || math.IsInf(vv, 0) {
+			return nil
+		}
+		return v
+	case *big.Rat:
+		if vv == nil {
+			return nil
+		}
+		return vv.RatString()
+	case time.Time:
+		if _, err := vv.MarshalJSON(); err != nil {
+			return vv.String()
+		}
+		return v
+	case []interface{}:
+		vals := make([]interface{}, len(vv))
+		for i, v := range vv {
+			vals[i] = jsonValue(v)
+		}
+		return vals
+	}
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return v
+}
+
 type Decoder struct {
 	includeFieldsRe  *regexp.Regexp
 	excludeFieldsrRe *regexp.Regexp
 	noDate           bool
 	noLatLong        bool
+	noMakerNote      bool
 }
 
 func IncludeFields(expression string) func(*Decoder) error {
@@ -73,6 +170,15 @@ func WithLatLongDisabled(disabled bool) func(*Decoder) error {
 	}
 }
 
+// WithMakerNoteDisabled excludes the MakerNote, the camera maker's
+// proprietary data, from the Values. It can be large and is mostly binary.
+func WithMakerNoteDisabled(disabled bool) func(*Decoder) error {
+	return func(d *Decoder) error {
+		d.noMakerNote = disabled
+		return nil
+	}
+}
+
 func WithDateDisabled(disabled bool) func(*Decoder) error {
 	return func(d *Decoder) error {
 		d.noDate = disabled
@@ -112,6 +218,18 @@ func (d *Decoder) Decode(r io.Reader) (ex *Exif, err error) {
 		}
 	}()
 
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(pngMagic)); string(magic) == pngMagic {
+		var b []byte
+		b, err = pngExif(br)
+		if err != nil || b == nil {
+			return
+		}
+		r = bytes.NewReader(b)
+	} else {
+		r = br
+	}
+
 	var x *_exif.Exif
 	x, err = _exif.Decode(r)
 	if err != nil {
@@ -123,33 +241,201 @@ func (d *Decoder) Decode(r io.Reader) (ex *Exif, err error) {
 		return
 	}
 
+	loadExtraTags(x)
+
 	var tm time.Time
 	var lat, long float64
 
 	if !d.noDate {
 		tm, _ = x.DateTime()
+		if loc := originalLocation(x); loc != nil {
+			if t, err := time.ParseInLocation(exifTimeLayout, getString(x, _exif.DateTimeOriginal), loc); err == nil {
+				tm = t
+			}
+		}
+		if !tm.IsZero() {
+			if _, err := x.Get(_exif.DateTimeOriginal); err == nil {
+				tm = tm.Add(subSeconds(x, _exif.SubSecTimeOriginal))
+			} else {
+				tm = tm.Add(subSeconds(x, _exif.SubSecTime))
+			}
+		}
 	}
 
 	if !d.noLatLong {
-		lat, long, _ = x.LatLong()
+		lat, long, _ = latLong(x)
+	}
+
+	var orientation int
+	if tag, err := x.Get(_exif.Orientation); err == nil {
+		orientation, _ = tag.Int(0)
+	}
+
+	ex = &Exif{
+		Make:         getString(x, _exif.Make),
+		Model:        getString(x, _exif.Model),
+		LensModel:    getString(x, _exif.LensModel),
+		FocalLength:  getFloat(x, _exif.FocalLength),
+		FNumber:      getFloat(x, _exif.FNumber),
+		ExposureTime: getFloat(x, _exif.ExposureTime),
+		ISO:          getInt(x, _exif.ISOSpeedRatings),
+		PixelWidth:   getInt(x, _exif.PixelXDimension),
+		PixelHeight:  getInt(x, _exif.PixelYDimension),
+
+		ImageNumber:        getInt(x, imageNumber),
+		SubSecTimeOriginal: getString(x, _exif.SubSecTimeOriginal),
 	}
 
-	walker := &exifWalker{x: x, vals: make(map[string]interface{}), includeMatcher: d.includeFieldsRe, excludeMatcher: d.excludeFieldsrRe}
+	walker := &exifWalker{x: x, vals: make(map[string]interface{}), includeMatcher: d.includeFieldsRe, excludeMatcher: d.excludeFieldsrRe, noMakerNote: d.noMakerNote}
 	if err = x.Walk(walker); err != nil {
 		return
 	}
 
-	ex = &Exif{Lat: lat, Long: long, Date: tm, Values: walker.vals}
+	ex.Lat, ex.Long, ex.Date, ex.Orientation, ex.Values = lat, long, tm, orientation, walker.vals
 
 	return
 }
 
+const pngMagic = "\x89PNG\r\n\x1a\n"
+
+// pngExif returns the content of the eXIf chunk in the PNG image read from
+// r, nil if none found.
+func pngExif(r *bufio.Reader) ([]byte, error) {
+	if _, err := r.Discard(len(pngMagic)); err != nil {
+		return nil, err
+	}
+
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, err
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+
+		switch string(header[4:]) {
+		case "eXIf":
+			data := make([]byte, length)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, err
+			}
+			return data, nil
+		case "IEND":
+			return nil, nil
+		}
+
+		// Skip the data and the CRC.
+		if _, err := r.Discard(int(length) + 4); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// latLong returns the GPS position in x in decimal degrees, signed by the
+// hemisphere references. Unlike x.LatLong, it accepts references that are
+// missing, in lower case or stored as bytes, as written by some software.
+func latLong(x *_exif.Exif) (lat, long float64, err error) {
+	if lat, err = gpsCoordinate(x, _exif.GPSLatitude, _exif.GPSLatitudeRef, "S"); err != nil {
+		return 0, 0, err
+	}
+	if long, err = gpsCoordinate(x, _exif.GPSLongitude, _exif.GPSLongitudeRef, "W"); err != nil {
+		return 0, 0, err
+	}
+	return lat, long, nil
+}
+
+// gpsCoordinate returns the degrees, minutes and seconds in the field as
+// decimal degrees, negative if the reference in refField is negativeRef.
+func gpsCoordinate(x *_exif.Exif, field, refField _exif.FieldName, negativeRef string) (float64, error) {
+	tag, err := x.Get(field)
+	if err != nil {
+		return 0, err
+	}
+	if tag.Format() != tiff.RatVal {
+		return 0, fmt.Errorf("invalid %s", field)
+	}
+
+	var v float64
+	for i, div := range []float64{1, 60, 3600} {
+		if i >= int(tag.Count) {
+			break
+		}
+		n, d, err := tag.Rat2(i)
+		if err != nil || d == 0 {
+			return 0, fmt.Errorf("invalid %s", field)
+		}
+		v += float64(n) / float64(d) / div
+	}
+
+	var ref string
+	if tag, err := x.Get(refField); err == nil {
+		switch tag.Format() {
+		case tiff.StringVal:
+			ref, _ = tag.StringVal()
+		case tiff.IntVal:
+			if i, err := tag.Int(0); err == nil {
+				ref = string(rune(i))
+			}
+		}
+	}
+	if strings.EqualFold(strings.TrimSpace(ref), negativeRef) {
+		v = -math.Abs(v)
+	}
+
+	return v, nil
+}
+
+func getString(x *_exif.Exif, f _exif.FieldName) string {
+	t, err := x.Get(f)
+	if err != nil {
+		return ""
+	}
+	s, err := t.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(s, "\x00"))
+}
+
+func getFloat(x *_exif.Exif, f _exif.FieldName) float64 {
+	t, err := x.Get(f)
+	if err != nil {
+		return 0
+	}
+	switch t.Format() {
+	case tiff.RatVal:
+		n, d, err := t.Rat2(0)
+		if err != nil || d == 0 {
+			return 0
+		}
+		return float64(n) / float64(d)
+	case tiff.FloatVal:
+		v, _ := t.Float(0)
+		return v
+	case tiff.IntVal:
+		v, _ := t.Int(0)
+		return float64(v)
+	}
+	return 0
+}
+
+func getInt(x *_exif.Exif, f _exif.FieldName) int {
+	t, err := x.Get(f)
+	if err != nil || t.Format() != tiff.IntVal {
+		return 0
+	}
+	v, _ := t.Int(0)
+	return v
+}
+
 func decodeTag(x *_exif.Exif, f _exif.FieldName, t *tiff.Tag) (interface{}, error) {
 	switch t.Format() {
 	case tiff.StringVal, tiff.UndefVal:
 		s := nullString(t.Val)
 		if strings.Contains(string(f), "DateTime") {
-			if d, err := tryParseDate(x, s); err == nil {
+			if d, err := tryParseDate(x, f, s); err == nil {
 				return d, nil
 			}
 		}
@@ -192,15 +478,89 @@ func decodeTag(x *_exif.Exif, f _exif.FieldName, t *tiff.Tag) (interface{}, erro
 }
 
 // Code borrowed from exif.DateTime and adjusted.
-func tryParseDate(x *_exif.Exif, s string) (time.Time, error) {
+func tryParseDate(x *_exif.Exif, f _exif.FieldName, s string) (time.Time, error) {
 	dateStr := strings.TrimRight(s, "\x00")
-	// TODO(bep): look for timezone offset, GPS time, etc.
+	// TODO(bep): look for GPS time, etc.
 	timeZone := time.Local
 	if tz, _ := x.TimeZone(); tz != nil {
 		timeZone = tz
 	}
-	return time.ParseInLocation(exifTimeLayout, dateStr, timeZone)
+	var subsec time.Duration
+	if f == _exif.DateTimeOriginal {
+		if loc := originalLocation(x); loc != nil {
+			timeZone = loc
+		}
+		subsec = subSeconds(x, _exif.SubSecTimeOriginal)
+	}
+	t, err := time.ParseInLocation(exifTimeLayout, dateStr, timeZone)
+	if err != nil {
+		return t, err
+	}
+	return t.Add(subsec), nil
+
+}
+
+// Fields in the Exif sub-IFD not known by goexif.
+const (
+	// The UTC offset of DateTimeOriginal, e.g. "+02:00", added in EXIF 2.31.
+	offsetTimeOriginal _exif.FieldName = "OffsetTimeOriginal"
+
+	// The number of the image, from TIFF/EP, e.g. the shutter count.
+	imageNumber _exif.FieldName = "ImageNumber"
+)
+
+var extraFields = map[uint16]_exif.FieldName{
+	0x9011: offsetTimeOriginal,
+	0x9211: imageNumber,
+}
+
+// loadExtraTags loads the tags in extraFields from the Exif sub-IFD into x.
+func loadExtraTags(x *_exif.Exif) {
+	tag, err := x.Get(_exif.ExifIFDPointer)
+	if err != nil {
+		return
+	}
+	offset, err := tag.Int64(0)
+	if err != nil {
+		return
+	}
+
+	r := bytes.NewReader(x.Raw)
+	if _, err := r.Seek(offset, 0); err != nil {
+		return
+	}
+	dir, _, err := tiff.DecodeDir(r, x.Tiff.Order)
+	if err != nil {
+		return
+	}
 
+	x.LoadTags(dir, extraFields, false)
+}
+
+// subSeconds returns the fraction of a second in the sub-second field f,
+// which holds the leading decimal digits, e.g. "042" for 42 milliseconds.
+func subSeconds(x *_exif.Exif, f _exif.FieldName) time.Duration {
+	s := getString(x, f)
+	if s == "" || len(s) > 9 {
+		return 0
+	}
+	n, err := strconv.Atoi(s + strings.Repeat("0", 9-len(s)))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n)
+}
+
+// originalLocation returns the time zone given in OffsetTimeOriginal, nil if
+// not set or invalid.
+func originalLocation(x *_exif.Exif) *time.Location {
+	t, err := time.Parse("-07:00", getString(x, offsetTimeOriginal))
+	if err != nil {
+		return nil
+	}
+	// The location of t may be Local if the offset matches.
+	_, offset := t.Zone()
+	return time.FixedZone("", offset)
 }
 
 type exifWalker struct {
@@ -208,9 +568,13 @@ type exifWalker struct {
 	vals           map[string]interface{}
 	includeMatcher *regexp.Regexp
 	excludeMatcher *regexp.Regexp
+	noMakerNote    bool
 }
 
 func (e *exifWalker) Walk(f _exif.FieldName, tag *tiff.Tag) error {
+	if e.noMakerNote && f == _exif.MakerNote {
+		return nil
+	}
 	name := string(f)
 	if e.excludeMatcher != nil && e.excludeMatcher.MatchString(name) {
 		return nil
@@ -14,6 +14,9 @@
 package exif
 
 import (
+	"encoding/json"
+	"math"
+	"math/big"
 	"os"
 	"path/filepath"
 	"testing"
@@ -39,6 +42,7 @@ func TestExif(t *testing.T) {
 	// Malaga: https://goo.gl/taazZy
 	c.Assert(x.Lat, qt.Equals, float64(36.59744166666667))
 	c.Assert(x.Long, qt.Equals, float64(-4.50846))
+	c.Assert(x.GPSString(), qt.Equals, "36.597442, -4.508460")
 
 	v, found := x.Values["LensModel"]
 	c.Assert(found, qt.Equals, true)
@@ -50,19 +54,194 @@ func TestExif(t *testing.T) {
 	c.Assert(found, qt.Equals, true)
 	c.Assert(v, hqt.IsSameType, time.Time{})
 
+	// Not affected by the include filter.
+	c.Assert(x.Make, qt.Equals, "RICOH IMAGING COMPANY, LTD.")
+	c.Assert(x.Model, qt.Equals, "PENTAX K-3 II")
+	c.Assert(x.LensModel, qt.Equals, "smc PENTAX-DA* 16-50mm F2.8 ED AL [IF] SDM")
+	c.Assert(x.FocalLength, qt.Equals, float64(21))
+	c.Assert(x.FNumber, qt.Equals, 5.6)
+	c.Assert(x.ExposureTime, qt.Equals, 0.005)
+	c.Assert(x.ISO, qt.Equals, 100)
+
+}
+
+func TestExifValuesJSON(t *testing.T) {
+	c := qt.New(t)
+
+	x := &Exif{Values: map[string]interface{}{
+		"LensModel":    "smc PENTAX-DA*",
+		"ExposureTime": big.NewRat(1, 200),
+		"FNumber":      5.6,
+		"ISO":          100,
+		"BadFloat":     math.NaN(),
+		"DateTime":     time.Date(2017, 10, 27, 19, 59, 0, 0, time.UTC),
+		"Ratings":      []interface{}{1, math.Inf(1), big.NewRat(1, 3)},
+		"Channel":      make(chan int),
+	}}
+
+	b, err := x.ValuesJSON()
+	c.Assert(err, qt.IsNil)
+
+	var m map[string]interface{}
+	c.Assert(json.Unmarshal(b, &m), qt.IsNil)
+	c.Assert(m["LensModel"], qt.Equals, "smc PENTAX-DA*")
+	c.Assert(m["ExposureTime"], qt.Equals, "1/200")
+	c.Assert(m["FNumber"], qt.Equals, 5.6)
+	c.Assert(m["ISO"], qt.Equals, float64(100))
+	c.Assert(m["BadFloat"], qt.IsNil)
+	c.Assert(m["DateTime"], qt.Equals, "2017-10-27T19:59:00Z")
+	c.Assert(m["Ratings"], qt.DeepEquals, []interface{}{float64(1), nil, "1/3"})
+	c.Assert(m["Channel"], qt.Matches, "0x.*")
+
+	b, err = (&Exif{}).ValuesJSON()
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(b), qt.Equals, "{}")
 }
 
 func TestExifPNG(t *testing.T) {
 	c := qt.New(t)
 
-	f, err := os.Open(filepath.FromSlash("../../testdata/gohugoio.png"))
+	d, err := NewDecoder()
 	c.Assert(err, qt.IsNil)
-	defer f.Close()
+
+	decode := func(filename string) *Exif {
+		f, err := os.Open(filepath.FromSlash("../../testdata/" + filename))
+		c.Assert(err, qt.IsNil)
+		defer f.Close()
+		x, err := d.Decode(f)
+		c.Assert(err, qt.IsNil)
+		return x
+	}
+
+	x := decode("exif.png")
+	c.Assert(x, qt.Not(qt.IsNil))
+	c.Assert(x.Make, qt.Equals, "Hugo")
+	c.Assert(x.Date.Format("2006-01-02 15:04:05"), qt.Equals, "2019-08-01 10:20:30")
+	c.Assert(x.Lat, qt.Equals, 59.9)
+	c.Assert(x.Long, qt.Equals, 10.75)
+
+	// No eXIf chunk.
+	c.Assert(decode("gohugoio.png"), qt.IsNil)
+}
+
+func TestExifGPS(t *testing.T) {
+	c := qt.New(t)
 
 	d, err := NewDecoder()
 	c.Assert(err, qt.IsNil)
-	_, err = d.Decode(f)
-	c.Assert(err, qt.Not(qt.IsNil))
+
+	decode := func(filename string) *Exif {
+		f, err := os.Open(filepath.FromSlash("../../testdata/" + filename))
+		c.Assert(err, qt.IsNil)
+		defer f.Close()
+		x, err := d.Decode(f)
+		c.Assert(err, qt.IsNil)
+		return x
+	}
+
+	// 34° 36' 12" S, 58° 22' 54" W.
+	x := decode("southwest.jpg")
+	c.Assert(math.Abs(x.Lat-(-(34+36.0/60+12.0/3600))) < 1e-9, qt.Equals, true)
+	c.Assert(math.Abs(x.Long-(-(58+22.0/60+54.0/3600))) < 1e-9, qt.Equals, true)
+	c.Assert(x.GPSString(), qt.Equals, "-34.603333, -58.381667")
+
+	x = decode("exif.png")
+	c.Assert(x.GPSString(), qt.Equals, "59.900000, 10.750000")
+
+	// No GPS.
+	x = decode("exifoffset.jpg")
+	c.Assert(x.Lat, qt.Equals, 0.0)
+	c.Assert(x.GPSString(), qt.Equals, "")
+}
+
+func TestExifOffsetTime(t *testing.T) {
+	c := qt.New(t)
+
+	d, err := NewDecoder()
+	c.Assert(err, qt.IsNil)
+
+	decode := func(filename string) *Exif {
+		f, err := os.Open(filepath.FromSlash("../../testdata/" + filename))
+		c.Assert(err, qt.IsNil)
+		defer f.Close()
+		x, err := d.Decode(f)
+		c.Assert(err, qt.IsNil)
+		return x
+	}
+
+	// DateTimeOriginal is 2019:06:21 18:30:12 with OffsetTimeOriginal +02:00.
+	x := decode("exifoffset.jpg")
+	c.Assert(x.Date.UTC(), qt.Equals, time.Date(2019, 6, 21, 16, 30, 12, 0, time.UTC))
+	_, offset := x.Date.Zone()
+	c.Assert(offset, qt.Equals, 2*60*60)
+	c.Assert(x.Values["OffsetTimeOriginal"], qt.Equals, "+02:00")
+	c.Assert(x.Values["DateTimeOriginal"].(time.Time).Equal(x.Date), qt.Equals, true)
+
+	// No offset, same as before.
+	x = decode("iphone.jpg")
+	c.Assert(x.Date.Location(), qt.Equals, time.Local)
+	c.Assert(x.Date.Format("2006-01-02 15:04:05"), qt.Equals, "2019-06-21 18:30:12")
+}
+
+func TestExifSubSecTime(t *testing.T) {
+	c := qt.New(t)
+
+	d, err := NewDecoder()
+	c.Assert(err, qt.IsNil)
+
+	decode := func(filename string) *Exif {
+		f, err := os.Open(filepath.FromSlash("../../testdata/" + filename))
+		c.Assert(err, qt.IsNil)
+		defer f.Close()
+		x, err := d.Decode(f)
+		c.Assert(err, qt.IsNil)
+		return x
+	}
+
+	// DateTimeOriginal is 2019:06:21 18:30:12 +02:00 with SubSecTimeOriginal 042.
+	x := decode("burst.jpg")
+	c.Assert(x.ImageNumber, qt.Equals, 4711)
+	c.Assert(x.SubSecTimeOriginal, qt.Equals, "042")
+	c.Assert(x.Date.UTC(), qt.Equals, time.Date(2019, 6, 21, 16, 30, 12, 42*int(time.Millisecond), time.UTC))
+	c.Assert(x.Values["ImageNumber"], qt.Equals, 4711)
+	c.Assert(x.Values["DateTimeOriginal"].(time.Time).Equal(x.Date), qt.Equals, true)
+
+	// No sub-second time.
+	x = decode("exifoffset.jpg")
+	c.Assert(x.ImageNumber, qt.Equals, 0)
+	c.Assert(x.SubSecTimeOriginal, qt.Equals, "")
+	c.Assert(x.Date.Nanosecond(), qt.Equals, 0)
+}
+
+func TestExifMakerNote(t *testing.T) {
+	c := qt.New(t)
+
+	decode := func(d *Decoder) *Exif {
+		f, err := os.Open(filepath.FromSlash("../../testdata/makernote.jpg"))
+		c.Assert(err, qt.IsNil)
+		defer f.Close()
+		x, err := d.Decode(f)
+		c.Assert(err, qt.IsNil)
+		return x
+	}
+
+	d, err := NewDecoder()
+	c.Assert(err, qt.IsNil)
+	x := decode(d)
+	c.Assert(x.Values["MakerNote"], qt.Not(qt.IsNil))
+
+	d, err = NewDecoder(WithMakerNoteDisabled(true))
+	c.Assert(err, qt.IsNil)
+	x = decode(d)
+	_, found := x.Values["MakerNote"]
+	c.Assert(found, qt.Equals, false)
+
+	// The standard tags are still there.
+	c.Assert(x.Make, qt.Equals, "NIKON CORPORATION")
+	c.Assert(x.FNumber, qt.Equals, 2.8)
+	c.Assert(x.Values["Model"], qt.Equals, "NIKON D750")
+	c.Assert(x.Values["FNumber"], qt.Equals, 2.8)
+	c.Assert(x.Date.Format("2006-01-02 15:04:05"), qt.Equals, "2019-06-21 18:30:12")
 }
 
 func BenchmarkDecodeExif(b *testing.B) {
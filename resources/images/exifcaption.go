@@ -0,0 +1,155 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"text/template"
+
+	"github.com/disintegration/gift"
+	"github.com/pkg/errors"
+
+	"github.com/gohugoio/hugo/resources/images/exif"
+)
+
+var _ gift.Filter = (*exifCaptionFilter)(nil)
+
+// exifCaptionFilter draws a caption strip at the bottom of the image with
+// text from the image's EXIF data. The text is set by ResolveExifFilters,
+// before that the filter does nothing.
+type exifCaptionFilter struct {
+	tmpl *template.Template
+
+	resolved bool
+	text     string
+}
+
+// newExifCaptionFilter parses the caption template. The template is
+// executed with the *exif.Exif as data, e.g. "{{ .Model }} f/{{ .FNumber }}".
+func newExifCaptionFilter(tmpl string) (exifCaptionFilter, error) {
+	if strings.TrimSpace(tmpl) == "" {
+		return exifCaptionFilter{}, errors.New("EXIF caption template must be set")
+	}
+	t, err := template.New("caption").Parse(tmpl)
+	if err != nil {
+		return exifCaptionFilter{}, errors.Wrap(err, "failed to parse EXIF caption template")
+	}
+	return exifCaptionFilter{tmpl: t}, nil
+}
+
+// resolve returns a copy of f with the caption text from x. If x is nil
+// and blank is set, the copy draws an empty strip.
+func (f exifCaptionFilter) resolve(x *exif.Exif, blank bool) (exifCaptionFilter, error) {
+	if x == nil {
+		f.resolved = blank
+		return f, nil
+	}
+
+	var b strings.Builder
+	if err := f.tmpl.Execute(&b, x); err != nil {
+		return f, errors.Wrap(err, "failed to execute EXIF caption template")
+	}
+
+	f.resolved = true
+	f.text = strings.TrimSpace(b.String())
+
+	return f, nil
+}
+
+func (f exifCaptionFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	b := dst.Bounds()
+	draw.Draw(dst, b, src, src.Bounds().Min, draw.Src)
+
+	if !f.resolved {
+		return
+	}
+
+	h := b.Dy() / 12
+	if h < minTextSize*2 {
+		h = minTextSize * 2
+	}
+	strip := image.Rect(b.Min.X, b.Max.Y-h, b.Max.X, b.Max.Y).Intersect(b)
+	draw.Draw(dst, strip, image.NewUniform(color.NRGBA{A: 0xa0}), image.ZP, draw.Over)
+
+	if f.text == "" {
+		return
+	}
+
+	pad := h / 4
+	r := image.Rect(strip.Min.X+pad, strip.Min.Y+pad, strip.Max.X-pad, strip.Max.Y-pad)
+	// Any error is from the embedded font, checked in ExifCaption.
+	_ = drawText(dst, r, f.text, float64(r.Dy()), color.White)
+}
+
+func (f exifCaptionFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
+
+// RequiresExif reports whether any of the given filters needs the EXIF
+// data of the image, see ResolveExifFilters.
+func RequiresExif(filters ...gift.Filter) bool {
+	for _, f := range filters {
+		if ff, ok := f.(filter); ok {
+			f = ff.Filter
+		}
+		switch ff := f.(type) {
+		case exifCaptionFilter:
+			return true
+		case composedFilter:
+			if RequiresExif(ff.filters...) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ResolveExifFilters returns a copy of filters with the filters that need
+// EXIF data, e.g. ExifCaption, set up with x, which may be nil if the image
+// has none. blank is the ExifCaptionBlank option. The EXIF values used are
+// added to the filter options, and so to the cache key.
+func ResolveExifFilters(x *exif.Exif, blank bool, filters ...gift.Filter) ([]gift.Filter, error) {
+	resolved := make([]gift.Filter, len(filters))
+	for i, f := range filters {
+		resolved[i] = f
+		ff, ok := f.(filter)
+		if !ok {
+			continue
+		}
+		if composed, ok := ff.Filter.(composedFilter); ok {
+			inner, err := ResolveExifFilters(x, blank, composed.filters...)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = newComposedFilter(composed.name, inner)
+			continue
+		}
+		cf, ok := ff.Filter.(exifCaptionFilter)
+		if !ok {
+			continue
+		}
+		cf, err := cf.resolve(x, blank)
+		if err != nil {
+			return nil, err
+		}
+		resolved[i] = filter{
+			Options: newFilterOpts(ff.Options.Vals, cf.resolved, cf.text),
+			Filter:  cf,
+		}
+	}
+	return resolved, nil
+}
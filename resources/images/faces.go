@@ -0,0 +1,253 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+	"sync"
+
+	"github.com/disintegration/gift"
+)
+
+const (
+	// Do not change.
+	facesCropIdentifier = "faces"
+
+	// Increment this when the face detection changes, to trigger a
+	// re-generation of the crops in the wild.
+	facesCropVersionNumber = 1
+
+	// The face detection runs on a copy of the image scaled down to fit
+	// within this size.
+	facesDetectSize = 128
+
+	// The smallest face region, as a fraction of the scaled down image.
+	facesMinArea = 0.005
+
+	// The maximum number of regions to keep.
+	facesMaxRegions = 5
+)
+
+// faceCache holds the face regions detected per source image raster, see
+// ImageConfig.facesKey.
+type faceCache struct {
+	mu      sync.Mutex
+	regions map[string][]image.Rectangle
+}
+
+func (c *faceCache) get(key string) ([]image.Rectangle, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, found := c.regions[key]
+	return r, found
+}
+
+func (c *faceCache) set(key string, regions []image.Rectangle) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.regions == nil {
+		c.regions = make(map[string][]image.Rectangle)
+	}
+	c.regions[key] = regions
+}
+
+// detectFaces is DetectFaces with the result cached by key, if set.
+func (p *ImageProcessor) detectFaces(img image.Image, key string) []image.Rectangle {
+	if key == "" {
+		return DetectFaces(img)
+	}
+	if regions, found := p.faces.get(key); found {
+		return regions
+	}
+	regions := DetectFaces(img)
+	p.faces.set(key, regions)
+	return regions
+}
+
+// facesKey returns the key of the face regions detected in the image
+// decoded for c with the given bounds, or "" if not known. The same source
+// gives different rasters for other pages, frames, crops, rotations and
+// colour conversions.
+func (c ImageConfig) facesKey(bounds image.Rectangle) string {
+	if c.SourceHash == "" {
+		return ""
+	}
+	key := fmt.Sprintf("%s_p%d_f%d_r%d_%dx%d%+d%+d", c.SourceHash, c.Page, c.Frame, c.Rotate, bounds.Dx(), bounds.Dy(), bounds.Min.X, bounds.Min.Y)
+	if c.ToSRGB {
+		key += "_srgb"
+	}
+	return key
+}
+
+// facesCrop finds the crop with the aspect ratio of width and height that
+// keeps the faces in img in frame. It returns false if no faces were found.
+func (p *ImageProcessor) facesCrop(img image.Image, width, height int, key string) (image.Rectangle, bool) {
+	if width <= 0 || height <= 0 {
+		return image.Rectangle{}, false
+	}
+
+	regions := p.detectFaces(img, key)
+	if len(regions) == 0 {
+		return image.Rectangle{}, false
+	}
+
+	return cropAround(img.Bounds(), regions, width, height), true
+}
+
+// cropAround returns the largest rectangle inside bounds with the aspect ratio
+// of width and height, centered on the union of the regions as far as bounds
+// allows.
+func cropAround(bounds image.Rectangle, regions []image.Rectangle, width, height int) image.Rectangle {
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	cropW, cropH := srcW, srcW*height/width
+	if cropH > srcH {
+		cropW, cropH = srcH*width/height, srcH
+	}
+
+	var union image.Rectangle
+	for _, r := range regions {
+		union = union.Union(r)
+	}
+	center := image.Pt((union.Min.X+union.Max.X)/2, (union.Min.Y+union.Max.Y)/2)
+
+	clamp := func(v, min, max int) int {
+		if v < min {
+			return min
+		}
+		if v > max {
+			return max
+		}
+		return v
+	}
+
+	x := clamp(center.X-cropW/2, bounds.Min.X, bounds.Max.X-cropW)
+	y := clamp(center.Y-cropH/2, bounds.Min.Y, bounds.Max.Y-cropH)
+
+	return image.Rect(x, y, x+cropW, y+cropH)
+}
+
+// DetectFaces returns the regions of img that likely hold faces, largest
+// first. This is a lightweight detector that looks for connected regions of
+// skin tones, which is good enough to keep people in frame when cropping,
+// but it will also find other skin colored objects.
+func DetectFaces(img image.Image) []image.Rectangle {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil
+	}
+
+	g := gift.New(gift.ResizeToFit(facesDetectSize, facesDetectSize, gift.BoxResampling))
+	small := image.NewNRGBA(g.Bounds(bounds))
+	g.Draw(small, img)
+
+	w, h := small.Bounds().Dx(), small.Bounds().Dy()
+	skin := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			skin[y*w+x] = isSkinTone(small.NRGBAAt(x, y))
+		}
+	}
+
+	// Find the connected skin regions with a flood fill.
+	type region struct {
+		r    image.Rectangle
+		area int
+	}
+
+	var (
+		found []region
+		seen  = make([]bool, w*h)
+		stack []int
+	)
+
+	for i := range skin {
+		if !skin[i] || seen[i] {
+			continue
+		}
+
+		seen[i] = true
+		stack = append(stack[:0], i)
+		r := image.Rect(i%w, i/w, i%w+1, i/w+1)
+		area := 0
+
+		for len(stack) > 0 {
+			j := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			area++
+
+			x, y := j%w, j/w
+			r = r.Union(image.Rect(x, y, x+1, y+1))
+
+			for _, n := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				nx, ny := n[0], n[1]
+				if nx < 0 || ny < 0 || nx >= w || ny >= h {
+					continue
+				}
+				k := ny*w + nx
+				if skin[k] && !seen[k] {
+					seen[k] = true
+					stack = append(stack, k)
+				}
+			}
+		}
+
+		if float64(area) < facesMinArea*float64(w*h) {
+			continue
+		}
+
+		// Faces are roughly oval and fill a good part of their bounding box.
+		// This weeds out long stripes, e.g. of sand or wood.
+		aspect := float64(r.Dy()) / float64(r.Dx())
+		if aspect < 0.5 || aspect > 2.5 || float64(area) < 0.4*float64(r.Dx()*r.Dy()) {
+			continue
+		}
+
+		found = append(found, region{r: r, area: area})
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].area > found[j].area
+	})
+	if len(found) > facesMaxRegions {
+		found = found[:facesMaxRegions]
+	}
+
+	// Scale back to the source dimensions.
+	var regions []image.Rectangle
+	for _, f := range found {
+		r := f.r
+		regions = append(regions, image.Rect(
+			bounds.Min.X+r.Min.X*bounds.Dx()/w,
+			bounds.Min.Y+r.Min.Y*bounds.Dy()/h,
+			bounds.Min.X+r.Max.X*bounds.Dx()/w,
+			bounds.Min.Y+r.Max.Y*bounds.Dy()/h,
+		))
+	}
+
+	return regions
+}
+
+// isSkinTone reports whether c is a skin tone, using the YCbCr skin color
+// ranges from Chai and Ngan.
+func isSkinTone(c color.NRGBA) bool {
+	if c.A < 0x80 {
+		return false
+	}
+	y, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+	return y > 40 && cb >= 77 && cb <= 127 && cr >= 133 && cr <= 173
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDetectFaces(t *testing.T) {
+	c := qt.New(t)
+
+	f, err := os.Open(filepath.FromSlash("../testdata/portrait.png"))
+	c.Assert(err, qt.IsNil)
+	defer f.Close()
+	img, err := png.Decode(f)
+	c.Assert(err, qt.IsNil)
+
+	// The face is an ellipse centered at (120, 390).
+	regions := DetectFaces(img)
+	c.Assert(regions, qt.HasLen, 1)
+	face := regions[0]
+	c.Assert(face.Min.X >= 70 && face.Max.X <= 170, qt.Equals, true, qt.Commentf("%v", face))
+	c.Assert(face.Min.Y >= 330 && face.Max.Y <= 450, qt.Equals, true, qt.Commentf("%v", face))
+
+	p := &ImageProcessor{}
+	key := ImageConfig{SourceHash: "abc"}.facesKey(img.Bounds())
+	crop, ok := p.facesCrop(img, 100, 100, key)
+	c.Assert(ok, qt.Equals, true)
+	c.Assert(crop, qt.Equals, image.Rect(0, 240, 240, 480))
+	_, found := p.faces.get(key)
+	c.Assert(found, qt.Equals, true)
+
+	blue := newTestImage(50, 50, color.NRGBA{R: 20, G: 40, B: 200, A: 255})
+	c.Assert(DetectFaces(blue), qt.HasLen, 0)
+	_, ok = p.facesCrop(blue, 10, 10, "")
+	c.Assert(ok, qt.Equals, false)
+}
+
+func TestFacesKey(t *testing.T) {
+	c := qt.New(t)
+
+	bounds := image.Rect(0, 0, 40, 30)
+	conf := ImageConfig{SourceHash: "abc"}
+	key := conf.facesKey(bounds)
+	c.Assert(key, qt.Equals, "abc_p0_f0_r0_40x30+0+0")
+
+	// Other rasters of the same source.
+	keys := map[string]bool{key: true}
+	for _, k := range []string{
+		ImageConfig{SourceHash: "abc", Page: 2}.facesKey(bounds),
+		ImageConfig{SourceHash: "abc", Frame: 1}.facesKey(bounds),
+		ImageConfig{SourceHash: "abc", Rotate: 90}.facesKey(image.Rect(0, 0, 30, 40)),
+		conf.facesKey(image.Rect(5, 5, 25, 25)),
+		ImageConfig{SourceHash: "abc", ToSRGB: true}.facesKey(bounds),
+	} {
+		c.Assert(keys[k], qt.Equals, false, qt.Commentf(k))
+		keys[k] = true
+	}
+
+	c.Assert(ImageConfig{}.facesKey(bounds), qt.Equals, "")
+}
+
+func TestCropAround(t *testing.T) {
+	c := qt.New(t)
+
+	bounds := image.Rect(0, 0, 400, 200)
+	face := []image.Rectangle{image.Rect(300, 20, 340, 80)}
+
+	c.Assert(cropAround(bounds, face, 100, 100), qt.Equals, image.Rect(200, 0, 400, 200))
+	c.Assert(cropAround(bounds, []image.Rectangle{image.Rect(180, 20, 220, 80)}, 100, 100), qt.Equals, image.Rect(100, 0, 300, 200))
+	c.Assert(cropAround(bounds, face, 400, 100), qt.Equals, image.Rect(0, 0, 400, 100))
+
+	// The union of the regions is kept in frame.
+	faces := []image.Rectangle{image.Rect(10, 10, 50, 50), image.Rect(150, 10, 190, 50)}
+	c.Assert(cropAround(bounds, faces, 200, 100), qt.Equals, image.Rect(0, 0, 400, 200))
+	c.Assert(cropAround(bounds, faces, 100, 100), qt.Equals, image.Rect(0, 0, 200, 200))
+}
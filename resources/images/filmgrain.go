@@ -0,0 +1,154 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*filmGrainFilter)(nil)
+
+// filmGrainFilter adds film grain noise to an image.
+//
+// The noise is seeded from the options and the image dimensions, and is
+// made with its own random number generator, so the same image gets the
+// same grain in every build and with every Go version, e.g. for golden
+// tests.
+type filmGrainFilter struct {
+	// The strength of the grain (0-100).
+	intensity float64
+
+	// The size of the grains in pixels (1 or more). Grains larger than a
+	// pixel are made by scaling up smaller noise.
+	grainSize float64
+
+	// Whether to use the same noise for all channels.
+	monochrome bool
+}
+
+// The largest change of a channel value, at intensity 100.
+const filmGrainMaxAmplitude = 64
+
+// grainRand is a xorshift64* random number generator.
+type grainRand uint64
+
+// float returns a number in range [-1, 1), triangularly distributed, which
+// looks more like grain than uniform noise.
+func (r *grainRand) float() float64 {
+	return r.uniform() + r.uniform() - 1
+}
+
+// uniform returns a number in range [0, 1).
+func (r *grainRand) uniform() float64 {
+	x := uint64(*r)
+	x ^= x >> 12
+	x ^= x << 25
+	x ^= x >> 27
+	*r = grainRand(x)
+	return float64((x*2685821657736338717)>>11) / (1 << 53)
+}
+
+func (f filmGrainFilter) seed(width, height int) grainRand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%v_%v_%t_%d_%d", f.intensity, f.grainSize, f.monochrome, width, height)
+	s := h.Sum64()
+	if s == 0 {
+		// xorshift gets stuck on 0.
+		s = 1
+	}
+	return grainRand(s)
+}
+
+// noise returns a noise field of w x h values in range [-1, 1) for each of
+// the channels.
+func (f filmGrainFilter) noise(r *grainRand, w, h, channels int) [][]float64 {
+	n := make([][]float64, channels)
+	for c := range n {
+		n[c] = make([]float64, w*h)
+		for i := range n[c] {
+			n[c][i] = r.float()
+		}
+	}
+	return n
+}
+
+func (f filmGrainFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	b := dst.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return
+	}
+
+	channels := 3
+	if f.monochrome {
+		channels = 1
+	}
+
+	// The noise is made at a lower resolution for large grains and
+	// sampled with bilinear interpolation, which gives soft clumps.
+	nw := int(math.Ceil(float64(w)/f.grainSize)) + 1
+	nh := int(math.Ceil(float64(h)/f.grainSize)) + 1
+	r := f.seed(w, h)
+	noise := f.noise(&r, nw, nh, channels)
+
+	sample := func(c int, x, y float64) float64 {
+		x0, y0 := int(x), int(y)
+		fx, fy := x-float64(x0), y-float64(y0)
+		n := noise[c]
+		top := n[y0*nw+x0]*(1-fx) + n[y0*nw+x0+1]*fx
+		bottom := n[(y0+1)*nw+x0]*(1-fx) + n[(y0+1)*nw+x0+1]*fx
+		return top*(1-fy) + bottom*fy
+	}
+
+	amplitude := f.intensity / 100 * filmGrainMaxAmplitude
+	if f.grainSize > 1 {
+		// Interpolation evens out the noise, make up for it.
+		amplitude *= 1.5
+	}
+
+	sb := src.Bounds()
+	for y := 0; y < h; y++ {
+		ny := float64(y) / f.grainSize
+		for x := 0; x < w; x++ {
+			nx := float64(x) / f.grainSize
+			px := color.NRGBAModel.Convert(src.At(sb.Min.X+x, sb.Min.Y+y)).(color.NRGBA)
+
+			var d [3]float64
+			for c := 0; c < channels; c++ {
+				d[c] = sample(c, nx, ny) * amplitude
+			}
+			if f.monochrome {
+				d[1], d[2] = d[0], d[0]
+			}
+
+			dst.Set(b.Min.X+x, b.Min.Y+y, color.NRGBA{
+				R: clampUint8(float64(px.R) + d[0]),
+				G: clampUint8(float64(px.G) + d[1]),
+				B: clampUint8(float64(px.B) + d[2]),
+				A: px.A,
+			})
+		}
+	}
+}
+
+func (f filmGrainFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
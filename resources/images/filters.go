@@ -15,6 +15,13 @@
 package images
 
 import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strings"
+
+	"github.com/gohugoio/hugo/resources/resource"
+
 	"github.com/disintegration/gift"
 	"github.com/spf13/cast"
 )
@@ -34,6 +41,76 @@ func (*Filters) Brightness(percentage interface{}) gift.Filter {
 	}
 }
 
+// BlurRegion creates a filter that applies a gaussian blur to the rectangle
+// with its top left corner at x,y of the given width and height, e.g. to
+// redact faces or license plates, and leaves the rest of the image sharp.
+// The rectangle must be within the image.
+func (*Filters) BlurRegion(x, y, width, height, sigma interface{}) gift.Filter {
+	f := blurRegionFilter{
+		rect:  image.Rect(cast.ToInt(x), cast.ToInt(y), cast.ToInt(x)+cast.ToInt(width), cast.ToInt(y)+cast.ToInt(height)),
+		sigma: cast.ToFloat32(sigma),
+	}
+	if cast.ToInt(x) < 0 || cast.ToInt(y) < 0 || f.rect.Empty() {
+		return newInvalidFilter("blur region position and size must be positive numbers")
+	}
+	if f.sigma <= 0 {
+		return newInvalidFilter("blur sigma must be a positive number")
+	}
+	return filter{
+		Options: newFilterOpts(f.rect.Min.X, f.rect.Min.Y, f.rect.Dx(), f.rect.Dy(), f.sigma),
+		Filter:  f,
+	}
+}
+
+// Border creates a filter that draws a solid border with the given width and color
+// around an image, expanding its dimensions with 2*width in each direction.
+// The color can be a hex value (e.g. "#ff0000"), a CSS color name or "transparent".
+func (*Filters) Border(width, color interface{}) gift.Filter {
+	w := cast.ToInt(width)
+	if w < 0 {
+		return newInvalidFilter("border width must be a non-negative number")
+	}
+	colorStr := cast.ToString(color)
+	c, err := ParseColor(colorStr)
+	if err != nil {
+		return invalidFilter{err: err}
+	}
+	return filter{
+		Options: newFilterOpts(w, colorStr),
+		Filter:  borderFilter{width: w, color: c},
+	}
+}
+
+// CLAHE creates a filter that applies Contrast-Limited Adaptive Histogram
+// Equalization to an image, which enhances local contrast, e.g. in medical or
+// scientific images. The image is divided into tileGrid x tileGrid tiles, in
+// range (1, 64), typically 8. The clipLimit limits the contrast enhancement and
+// must be at least 1, typically 2 to 4. Note that this is much more expensive
+// than Contrast, as it builds a histogram per tile and interpolates between
+// them for every pixel.
+func (*Filters) CLAHE(tileGrid, clipLimit interface{}) gift.Filter {
+	g, l := cast.ToInt(tileGrid), cast.ToFloat64(clipLimit)
+	if g < 1 || g > 64 {
+		return newInvalidFilter("CLAHE tile grid must be in range 1 to 64")
+	}
+	if l < 1 {
+		return newInvalidFilter("CLAHE clip limit must be at least 1")
+	}
+	return filter{
+		Options: newFilterOpts(g, l),
+		Filter:  claheFilter{tileGrid: g, clipLimit: l},
+	}
+}
+
+// CircleMask creates a filter that makes everything outside the largest circle
+// that fits in the image transparent, e.g. for round avatars. For JPEG images
+// the result will be a PNG.
+func (*Filters) CircleMask() gift.Filter {
+	return filter{
+		Filter: circleMaskFilter{},
+	}
+}
+
 // ColorBalance creates a filter that changes the color balance of an image.
 // The percentage parameters for each color channel (red, green, blue) must be in range (-100, 500).
 func (*Filters) ColorBalance(percentageRed, percentageGreen, percentageBlue interface{}) gift.Filter {
@@ -43,6 +120,21 @@ func (*Filters) ColorBalance(percentageRed, percentageGreen, percentageBlue inte
 	}
 }
 
+// ColorBlind creates a filter that simulates how an image is seen with a color
+// vision deficiency, e.g. to check the accessibility of a design. The mode is
+// one of "protanopia", "deuteranopia" or "tritanopia".
+func (*Filters) ColorBlind(mode interface{}) gift.Filter {
+	m := strings.ToLower(cast.ToString(mode))
+	matrix, found := colorBlindMatrices[m]
+	if !found {
+		return newInvalidFilter("invalid color blindness mode %q, must be one of protanopia, deuteranopia or tritanopia", m)
+	}
+	return filter{
+		Options: newFilterOpts(m),
+		Filter:  colorBlindFilter{m: matrix},
+	}
+}
+
 // Colorize creates a filter that produces a colorized version of an image.
 // The hue parameter is the angle on the color wheel, typically in range (0, 360).
 // The saturation parameter must be in range (0, 100).
@@ -54,6 +146,20 @@ func (*Filters) Colorize(hue, saturation, percentage interface{}) gift.Filter {
 	}
 }
 
+// Compose creates a filter that applies the given filters in turn, e.g. to
+// reuse a look made of several filters. The name is used in error messages,
+// the processed images are cached by the filters only, so renaming the
+// composed filter keeps the permalinks.
+func (*Filters) Compose(name interface{}, filters ...gift.Filter) gift.Filter {
+	if len(filters) == 0 {
+		return newInvalidFilter("compose needs at least one filter")
+	}
+	if err := FilterError(filters...); err != nil {
+		return newInvalidFilter("%s: %s", cast.ToString(name), err)
+	}
+	return newComposedFilter(cast.ToString(name), filters)
+}
+
 // Contrast creates a filter that changes the contrast of an image.
 // The percentage parameter must be in range (-100, 100).
 func (*Filters) Contrast(percentage interface{}) gift.Filter {
@@ -63,6 +169,64 @@ func (*Filters) Contrast(percentage interface{}) gift.Filter {
 	}
 }
 
+// DropShadow creates a filter that draws a shadow behind an image, offset by offsetX and
+// offsetY pixels and blurred with the given blur radius in pixels. The image is expanded with a
+// transparent area big enough to hold the shadow, so for JPEG images the result will be a PNG.
+// The color can be a hex value (e.g. "#00000080"), a CSS color name or "transparent".
+func (*Filters) DropShadow(offsetX, offsetY, blur, color interface{}) gift.Filter {
+	x, y, b := cast.ToInt(offsetX), cast.ToInt(offsetY), cast.ToInt(blur)
+	if b < 0 {
+		return newInvalidFilter("drop shadow blur must be a non-negative number")
+	}
+	colorStr := cast.ToString(color)
+	c, err := ParseColor(colorStr)
+	if err != nil {
+		return invalidFilter{err: err}
+	}
+	return filter{
+		Options: newFilterOpts(x, y, b, colorStr),
+		Filter:  dropShadowFilter{offsetX: x, offsetY: y, blur: b, color: c},
+	}
+}
+
+// ExifCaption creates a filter that draws a caption strip at the bottom of
+// an image with text from its EXIF data, e.g. the camera and exposure. The
+// template is a Go template executed with the EXIF data, e.g.
+// "{{ .Model }}, f/{{ .FNumber }}, ISO {{ .ISO }}". Images without EXIF
+// data are left as they are, unless the exifCaptionBlank option is set.
+func (*Filters) ExifCaption(tmpl interface{}) gift.Filter {
+	if _, err := getTextFont(); err != nil {
+		return invalidFilter{err: err}
+	}
+	s := cast.ToString(tmpl)
+	f, err := newExifCaptionFilter(s)
+	if err != nil {
+		return invalidFilter{err: err}
+	}
+	return filter{
+		Options: newFilterOpts(s),
+		Filter:  f,
+	}
+}
+
+// FilmGrain creates a filter that adds film grain to an image. The intensity
+// is in range (0, 100]. The grainSize is the size of the grains in pixels,
+// 1 or more, and monochrome grain changes the brightness only. The grain is
+// the same in every build for the same image and options.
+func (*Filters) FilmGrain(intensity, grainSize, monochrome interface{}) gift.Filter {
+	i, size, mono := cast.ToFloat64(intensity), cast.ToFloat64(grainSize), cast.ToBool(monochrome)
+	if i <= 0 || i > 100 {
+		return newInvalidFilter("invalid film grain intensity %v, must be in range (0, 100]", intensity)
+	}
+	if size < 1 || size > 100 {
+		return newInvalidFilter("invalid film grain size %v, must be in range [1, 100]", grainSize)
+	}
+	return filter{
+		Options: newFilterOpts(i, size, mono),
+		Filter:  filmGrainFilter{intensity: i, grainSize: size, monochrome: mono},
+	}
+}
+
 // Gamma creates a filter that performs a gamma correction on an image.
 // The gamma parameter must be positive. Gamma = 1 gives the original image.
 // Gamma less than 1 darkens the image and gamma greater than 1 lightens it.
@@ -81,6 +245,85 @@ func (*Filters) GaussianBlur(sigma interface{}) gift.Filter {
 	}
 }
 
+// Frame creates a filter that places the image in a rectangle of the frame
+// image, e.g. the screen of a device mockup, with its top left corner at x,y.
+// The optional width and height scale the image to fill the rectangle, with
+// one of them set the aspect ratio is kept. frame is an image resource.
+func (*Filters) Frame(frame, x, y interface{}, size ...interface{}) gift.Filter {
+	r, ok := frame.(resource.ReadSeekCloserResource)
+	if !ok {
+		return newInvalidFilter("frame must be a resource, got %T", frame)
+	}
+	img, hash, err := loadImageResource(r)
+	if err != nil {
+		return newInvalidFilter("failed to load frame: %s", err)
+	}
+
+	f := frameFilter{frame: img, x: cast.ToInt(x), y: cast.ToInt(y)}
+	if len(size) > 0 {
+		f.width = cast.ToInt(size[0])
+	}
+	if len(size) > 1 {
+		f.height = cast.ToInt(size[1])
+	}
+	if f.x < 0 || f.y < 0 || f.width < 0 || f.height < 0 {
+		return newInvalidFilter("frame position and size must be positive numbers")
+	}
+
+	return filter{
+		Options: newFilterOpts(hash, f.x, f.y, f.width, f.height),
+		Filter:  f,
+	}
+}
+
+// GradientMap creates a filter that maps the luminance of an image to a color
+// gradient, like Photoshop's Gradient Map. Each stop is a position in range
+// 0 to 100 and a color, e.g. (slice 0 "#000") (slice 100 "#fff") gives a
+// grayscale image. There must be at least two stops, sorted by position.
+// The transparency of the image is kept, the alpha of the colors is ignored.
+func (*Filters) GradientMap(stops ...interface{}) gift.Filter {
+	parsed, err := parseGradientStops(stops)
+	if err != nil {
+		return invalidFilter{err: err}
+	}
+	opts := make([]interface{}, 0, len(parsed)*2)
+	for _, s := range parsed {
+		opts = append(opts, s.pos, hexColor(s.color))
+	}
+	return filter{
+		Options: newFilterOpts(opts...),
+		Filter:  newGradientMapFilter(parsed),
+	}
+}
+
+// GradientOverlay creates a filter that composites a linear gradient over an
+// image, e.g. to make text placed on it more legible. The gradient fades from
+// startColor to endColor in the given direction, one of "top", "bottom",
+// "left" or "right". The colors can be hex values with alpha (e.g. "#00000099").
+func (*Filters) GradientOverlay(direction, startColor, endColor interface{}) gift.Filter {
+	dir := strings.ToLower(cast.ToString(direction))
+	if !gradientDirections[dir] {
+		return newInvalidFilter("invalid gradient direction %q, must be one of top, bottom, left or right", dir)
+	}
+	startStr, endStr := cast.ToString(startColor), cast.ToString(endColor)
+	start, err := ParseColor(startStr)
+	if err != nil {
+		return invalidFilter{err: err}
+	}
+	end, err := ParseColor(endStr)
+	if err != nil {
+		return invalidFilter{err: err}
+	}
+	return filter{
+		Options: newFilterOpts(dir, startStr, endStr),
+		Filter: gradientOverlayFilter{
+			direction:  dir,
+			startColor: start,
+			endColor:   end,
+		},
+	}
+}
+
 // Grayscale creates a filter that produces a grayscale version of an image.
 func (*Filters) Grayscale() gift.Filter {
 	return filter{
@@ -97,6 +340,26 @@ func (*Filters) Hue(shift interface{}) gift.Filter {
 	}
 }
 
+// HueTo creates a filter that rotates the hue of an image so its dominant hue
+// moves to the hue of the given color, e.g. to match a brand color. The color
+// can be a hex value (e.g. "#0000ff") or a CSS color name, but not a gray.
+func (*Filters) HueTo(target interface{}) gift.Filter {
+	targetStr := cast.ToString(target)
+	c, err := ParseColor(targetStr)
+	if err != nil {
+		return invalidFilter{err: err}
+	}
+	r, g, b, _ := nrgbaFloats(c)
+	hue, chroma := hueAndChroma(float64(r), float64(g), float64(b))
+	if chroma == 0 {
+		return newInvalidFilter("hue target color must not be a gray")
+	}
+	return filter{
+		Options: newFilterOpts(targetStr),
+		Filter:  newHueToFilter(hue),
+	}
+}
+
 // Invert creates a filter that negates the colors of an image.
 func (*Filters) Invert() gift.Filter {
 	return filter{
@@ -104,11 +367,130 @@ func (*Filters) Invert() gift.Filter {
 	}
 }
 
+// LUT creates a filter that maps the colors of an image through a 3D lookup
+// table, e.g. a color grade. The lut is a resource holding either a HALD CLUT
+// image or a .cube file.
+func (*Filters) LUT(lut interface{}) gift.Filter {
+	r, ok := lut.(resource.ReadSeekCloserResource)
+	if !ok {
+		return newInvalidFilter("LUT must be a resource, got %T", lut)
+	}
+	l, hash, err := loadLUT(r)
+	if err != nil {
+		return newInvalidFilter("failed to load LUT: %s", err)
+	}
+	return filter{
+		Options: newFilterOpts(hash),
+		Filter:  lutFilter{lut: l},
+	}
+}
+
+// Palette creates a filter that maps the colors of an image to a fixed
+// palette, e.g. for retro looks. The name is one of "websafe" (216 colors),
+// "cga" (16 colors) or "grayscale-N" with N gray levels, e.g. "grayscale-16".
+// The optional dither is one of "floydsteinberg" (default), "ordered" or "none".
+func (*Filters) Palette(name interface{}, dither ...interface{}) gift.Filter {
+	n := strings.ToLower(cast.ToString(name))
+	p, spread, err := namedPalette(n)
+	if err != nil {
+		return invalidFilter{err: err}
+	}
+
+	d := ditherFloydSteinberg
+	if len(dither) > 0 {
+		d = strings.ToLower(cast.ToString(dither[0]))
+	}
+	switch d {
+	case ditherFloydSteinberg, ditherOrdered, ditherNone:
+	default:
+		return newInvalidFilter("invalid dither %q, must be one of floydsteinberg, ordered or none", d)
+	}
+
+	return filter{
+		Options: newFilterOpts(n, d),
+		Filter:  paletteFilter{palette: p, spread: spread, dither: d},
+	}
+}
+
+// Pattern creates a filter that tiles an image across the image at the
+// given opacity in range 0 to 1, e.g. for a repeating watermark or a texture.
+// tile is an image resource, a tile larger than the image is cropped.
+func (*Filters) Pattern(tile, opacity interface{}) gift.Filter {
+	r, ok := tile.(resource.ReadSeekCloserResource)
+	if !ok {
+		return newInvalidFilter("tile must be a resource, got %T", tile)
+	}
+	img, hash, err := loadImageResource(r)
+	if err != nil {
+		return newInvalidFilter("failed to load tile: %s", err)
+	}
+
+	o := cast.ToFloat64(opacity)
+	if o < 0 || o > 1 {
+		return newInvalidFilter("pattern opacity must be in range 0 to 1")
+	}
+
+	return filter{
+		Options: newFilterOpts(hash, o),
+		Filter:  patternFilter{tile: img, opacity: o},
+	}
+}
+
 // Pixelate creates a filter that applies a pixelation effect to an image.
-func (*Filters) Pixelate(size interface{}) gift.Filter {
+// The optional shape of the cells can be one of "square" (default), "circle"
+// or "hex". Circles leave transparent gaps between the cells.
+func (*Filters) Pixelate(size interface{}, shape ...interface{}) gift.Filter {
+	s := pixelateSquare
+	if len(shape) > 0 {
+		s = strings.ToLower(cast.ToString(shape[0]))
+	}
+
+	switch s {
+	case pixelateSquare:
+		return filter{
+			Options: newFilterOpts(size),
+			Filter:  gift.Pixelate(cast.ToInt(size)),
+		}
+	case pixelateCircle, pixelateHex:
+		sz := cast.ToInt(size)
+		if sz < 1 {
+			return newInvalidFilter("pixelate size must be a positive number")
+		}
+		return filter{
+			Options: newFilterOpts(size, s),
+			Filter:  pixelateFilter{size: sz, shape: s},
+		}
+	default:
+		return newInvalidFilter("invalid pixelate shape %q, must be one of square, circle or hex", s)
+	}
+}
+
+// ReplaceColor creates a filter that replaces the colors near the target color
+// with the replacement color, e.g. to key out a green screen background.
+// The tolerance is in range (0, 100), where 0 only matches the exact target
+// color. The colors can be hex values (e.g. "#00ff00"), CSS color names or
+// "transparent". A replacement with transparency makes JPEG images a PNG.
+func (*Filters) ReplaceColor(target, tolerance, replacement interface{}) gift.Filter {
+	tol := cast.ToFloat64(tolerance)
+	if tol < 0 || tol > 100 {
+		return newInvalidFilter("replace color tolerance must be in range 0 to 100")
+	}
+	targetStr, replacementStr := cast.ToString(target), cast.ToString(replacement)
+	targetColor, err := ParseColor(targetStr)
+	if err != nil {
+		return invalidFilter{err: err}
+	}
+	replacementColor, err := ParseColor(replacementStr)
+	if err != nil {
+		return invalidFilter{err: err}
+	}
 	return filter{
-		Options: newFilterOpts(size),
-		Filter:  gift.Pixelate(cast.ToInt(size)),
+		Options: newFilterOpts(targetStr, tol, replacementStr),
+		Filter: replaceColorFilter{
+			target:      targetColor,
+			tolerance:   tol,
+			replacement: replacementColor,
+		},
 	}
 }
 
@@ -128,6 +510,24 @@ func (*Filters) Sepia(percentage interface{}) gift.Filter {
 	}
 }
 
+// ShadowHighlight creates a filter that lifts the shadows and recovers the
+// highlights of an image, e.g. a backlit photo, by tone mapping the dark and
+// bright regions of the image while leaving the midtones as is. Both shadows
+// and highlights must be in range 0 to 100, where 0 leaves them unchanged.
+func (*Filters) ShadowHighlight(shadows, highlights interface{}) gift.Filter {
+	s, h := cast.ToFloat64(shadows), cast.ToFloat64(highlights)
+	if s < 0 || s > 100 {
+		return newInvalidFilter("shadow highlight shadows must be in range 0 to 100")
+	}
+	if h < 0 || h > 100 {
+		return newInvalidFilter("shadow highlight highlights must be in range 0 to 100")
+	}
+	return filter{
+		Options: newFilterOpts(s, h),
+		Filter:  newShadowHighlightFilter(s, h),
+	}
+}
+
 // Sigmoid creates a filter that changes the contrast of an image using a sigmoidal function and returns the adjusted image.
 // It's a non-linear contrast change useful for photo adjustments as it preserves highlight and shadow detail.
 func (*Filters) Sigmoid(midpoint, factor interface{}) gift.Filter {
@@ -137,6 +537,21 @@ func (*Filters) Sigmoid(midpoint, factor interface{}) gift.Filter {
 	}
 }
 
+// SmartCrop creates a filter that crops an image to its most interesting
+// region with the aspect ratio of width and height, as the smart anchor in
+// Fill does, and resizes it to width x height. Unlike Fill, this works on
+// the image as filtered so far in the chain.
+func (*Filters) SmartCrop(width, height interface{}) gift.Filter {
+	w, h := cast.ToInt(width), cast.ToInt(height)
+	if w <= 0 || h <= 0 {
+		return newInvalidFilter("invalid smart crop size %vx%v, must be positive", width, height)
+	}
+	return filter{
+		Options: newFilterOpts(w, h),
+		Filter:  smartCropFilter{width: w, height: h},
+	}
+}
+
 // UnsharpMask creates a filter that sharpens an image.
 // The sigma parameter is used in a gaussian function and affects the radius of effect.
 // Sigma must be positive. Sharpen radius roughly equals 3 * sigma.
@@ -149,11 +564,121 @@ func (*Filters) UnsharpMask(sigma, amount, threshold interface{}) gift.Filter {
 	}
 }
 
+// Vibrance creates a filter that changes the saturation of an image, like
+// Saturation, but boosts the muted colors more than the already saturated
+// ones, which keeps skin tones from looking unnatural.
+// The percentage parameter must be in range (-100, 100).
+func (*Filters) Vibrance(percentage interface{}) gift.Filter {
+	p := cast.ToFloat32(percentage)
+	if p < -100 || p > 100 {
+		return newInvalidFilter("vibrance percentage must be in range -100 to 100")
+	}
+	return filter{
+		Options: newFilterOpts(percentage),
+		Filter:  vibranceFilter{amount: p / 100},
+	}
+}
+
+// WhiteBalance creates a filter that corrects the color temperature and tint
+// of an image. The temperature is in Kelvin, in range (1000, 40000), where
+// 6500 is neutral, and higher values give a warmer image. The tint must be in
+// range (-100, 100), positive values shift towards magenta, negative towards green.
+func (*Filters) WhiteBalance(temperature, tint interface{}) gift.Filter {
+	t, ti := cast.ToFloat64(temperature), cast.ToFloat64(tint)
+	if t < 1000 || t > 40000 {
+		return newInvalidFilter("white balance temperature must be in range 1000 to 40000")
+	}
+	if ti < -100 || ti > 100 {
+		return newInvalidFilter("white balance tint must be in range -100 to 100")
+	}
+	return filter{
+		Options: newFilterOpts(t, ti),
+		Filter:  newWhiteBalanceFilter(t, ti),
+	}
+}
+
 type filter struct {
 	Options filterOpts
 	gift.Filter
 }
 
+// invalidFilter is returned by the filter constructors when the arguments
+// are invalid. Applying it fails with err, see FilterError.
+type invalidFilter struct {
+	err error
+}
+
+func newInvalidFilter(format string, args ...interface{}) gift.Filter {
+	return invalidFilter{err: fmt.Errorf(format, args...)}
+}
+
+func (f invalidFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+}
+
+func (f invalidFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return srcBounds
+}
+
+func (f invalidFilter) validateBounds(srcBounds image.Rectangle) error {
+	return f.err
+}
+
+// FilterError returns the error of the first of the given filters that was
+// created with invalid arguments, or nil if there is none.
+func FilterError(filters ...gift.Filter) error {
+	for _, f := range filters {
+		if f, ok := f.(invalidFilter); ok {
+			return f.err
+		}
+	}
+	return nil
+}
+
+// transparencyRequirer is implemented by filters that adds transparent
+// areas to the image.
+type transparencyRequirer interface {
+	requiresTransparency() bool
+}
+
+// RequiresTransparency reports whether any of the given filters needs
+// an image format that supports transparency.
+func RequiresTransparency(filters ...gift.Filter) bool {
+	for _, f := range filters {
+		if ff, ok := f.(filter); ok {
+			f = ff.Filter
+		}
+		if t, ok := f.(transparencyRequirer); ok && t.requiresTransparency() {
+			return true
+		}
+	}
+	return false
+}
+
+// boundsValidator is implemented by filters that can't be applied to images
+// of all sizes.
+type boundsValidator interface {
+	validateBounds(srcBounds image.Rectangle) error
+}
+
+// validateBounds checks that the filters can be applied in turn to an
+// image with the given bounds.
+func validateBounds(srcBounds image.Rectangle, filters ...gift.Filter) error {
+	for _, f := range filters {
+		inner := f
+		if ff, ok := f.(filter); ok {
+			inner = ff.Filter
+		}
+		if v, ok := inner.(boundsValidator); ok {
+			if err := v.validateBounds(srcBounds); err != nil {
+				return err
+			}
+		}
+		srcBounds = f.Bounds(srcBounds)
+	}
+	return nil
+}
+
 // For cache-busting.
 type filterOpts struct {
 	Version int
@@ -0,0 +1,927 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/gohugoio/hugo/common/hugio"
+	"github.com/gohugoio/hugo/media"
+
+	"github.com/disintegration/gift"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func newTestImage(w, h int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func applyTestFilter(c *qt.C, src image.Image, filters ...gift.Filter) image.Image {
+	c.Helper()
+	p := &ImageProcessor{}
+	dst, err := p.Filter(src, filters...)
+	c.Assert(err, qt.IsNil)
+	return dst
+}
+
+func rgba(c color.Color) color.RGBA {
+	return color.RGBAModel.Convert(c).(color.RGBA)
+}
+
+func TestFilterBorder(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	blue := color.RGBA{B: 255, A: 255}
+	src := newTestImage(20, 10, blue)
+
+	dst := applyTestFilter(c, src, f.Border(5, "#ff0000"))
+	c.Assert(dst.Bounds(), qt.Equals, image.Rect(0, 0, 30, 20))
+	c.Assert(rgba(dst.At(0, 0)), qt.Equals, color.RGBA{R: 255, A: 255})
+	c.Assert(rgba(dst.At(4, 10)), qt.Equals, color.RGBA{R: 255, A: 255})
+	c.Assert(rgba(dst.At(5, 5)), qt.Equals, blue)
+	c.Assert(rgba(dst.At(24, 14)), qt.Equals, blue)
+	c.Assert(rgba(dst.At(25, 15)), qt.Equals, color.RGBA{R: 255, A: 255})
+
+	dst = applyTestFilter(c, src, f.Border(2, "transparent"))
+	c.Assert(dst.Bounds(), qt.Equals, image.Rect(0, 0, 24, 14))
+	c.Assert(rgba(dst.At(0, 0)), qt.Equals, color.RGBA{})
+
+	dst = applyTestFilter(c, src, f.Border(0, "red"))
+	c.Assert(dst.Bounds(), qt.Equals, src.Bounds())
+
+	c.Assert(FilterError(f.Border(-1, "red")), qt.ErrorMatches, ".*non-negative.*")
+	c.Assert(FilterError(f.Border(1, "foo")), qt.ErrorMatches, `invalid color "foo"`)
+}
+
+func TestFilterDropShadow(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	blue := color.RGBA{B: 255, A: 255}
+	src := newTestImage(20, 10, blue)
+
+	shadow := f.DropShadow(4, 4, 2, "#000000")
+	c.Assert(RequiresTransparency(shadow), qt.Equals, true)
+	c.Assert(RequiresTransparency(f.Grayscale()), qt.Equals, false)
+
+	dst := applyTestFilter(c, src, shadow)
+	c.Assert(dst.Bounds(), qt.Equals, image.Rect(0, 0, 26, 16))
+
+	// The image itself.
+	c.Assert(rgba(dst.At(0, 0)), qt.Equals, blue)
+	c.Assert(rgba(dst.At(19, 9)), qt.Equals, blue)
+
+	// Outside the image, inside the shadow.
+	r, g, b, a := dst.At(21, 11).RGBA()
+	c.Assert(r+g+b, qt.Equals, uint32(0))
+	c.Assert(a > 0xf000, qt.Equals, true)
+
+	// Outside both.
+	c.Assert(rgba(dst.At(25, 0)), qt.Equals, color.RGBA{})
+	c.Assert(rgba(dst.At(0, 15)), qt.Equals, color.RGBA{})
+
+	// Negative offsets moves the image.
+	dst = applyTestFilter(c, src, f.DropShadow(-3, 0, 0, "red"))
+	c.Assert(dst.Bounds(), qt.Equals, image.Rect(0, 0, 23, 10))
+	c.Assert(rgba(dst.At(0, 5)), qt.Equals, color.RGBA{R: 255, A: 255})
+	c.Assert(rgba(dst.At(3, 5)), qt.Equals, blue)
+
+	c.Assert(FilterError(f.DropShadow(1, 1, -1, "red")), qt.ErrorMatches, ".*non-negative.*")
+}
+
+func TestFilterBlurRegion(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	black, white := color.RGBA{A: 255}, color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	src := newTestImage(20, 20, white)
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			if (x+y)%2 == 0 {
+				src.Set(x, y, black)
+			}
+		}
+	}
+
+	dst := applyTestFilter(c, src, f.BlurRegion(5, 4, 10, 8, 2))
+	c.Assert(dst.Bounds(), qt.Equals, src.Bounds())
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			got, orig := rgba(dst.At(x, y)), rgba(src.At(x, y))
+			if image.Pt(x, y).In(image.Rect(5, 4, 15, 12)) {
+				// The checkerboard is blurred to gray.
+				c.Assert(got.R > 64 && got.R < 192, qt.Equals, true, qt.Commentf("%d,%d: %v", x, y, got))
+			} else {
+				c.Assert(got, qt.Equals, orig, qt.Commentf("%d,%d", x, y))
+			}
+		}
+	}
+
+	opts := func(f gift.Filter) filterOpts { return f.(filter).Options }
+	c.Assert(opts(f.BlurRegion(5, 4, 10, 8, 2)), qt.Not(qt.DeepEquals), opts(f.BlurRegion(5, 4, 10, 8, 3)))
+	c.Assert(opts(f.BlurRegion(5, 4, 10, 8, 2)), qt.Not(qt.DeepEquals), opts(f.BlurRegion(4, 5, 10, 8, 2)))
+
+	// The region must be within the image, also after the previous filters.
+	p := &ImageProcessor{}
+	_, err := p.Filter(src, f.BlurRegion(15, 0, 10, 10, 2))
+	c.Assert(err, qt.ErrorMatches, ".*outside the image of 20x20")
+	_, err = p.Filter(src, gift.Resize(10, 10, gift.LinearResampling), f.BlurRegion(5, 5, 10, 10, 2))
+	c.Assert(err, qt.ErrorMatches, ".*outside the image of 10x10")
+	_, err = p.Filter(src, f.BlurRegion(10, 10, 10, 10, 2))
+	c.Assert(err, qt.IsNil)
+
+	c.Assert(FilterError(f.BlurRegion(-1, 0, 10, 10, 2)), qt.ErrorMatches, ".*positive.*")
+	c.Assert(FilterError(f.BlurRegion(0, 0, 0, 10, 2)), qt.ErrorMatches, ".*positive.*")
+	c.Assert(FilterError(f.BlurRegion(0, 0, 10, 10, 0)), qt.ErrorMatches, ".*sigma.*")
+}
+
+func TestFilterPixelateShape(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	red := color.RGBA{R: 255, A: 255}
+	src := newTestImage(8, 8, red)
+	for y := 0; y < 8; y++ {
+		// A blue column in the first cell.
+		src.Set(0, y, color.RGBA{B: 255, A: 255})
+	}
+
+	// Square is the default and keeps the old options.
+	opts := func(f gift.Filter) filterOpts { return f.(filter).Options }
+	c.Assert(opts(f.Pixelate(4, "square")), qt.DeepEquals, opts(f.Pixelate(4)))
+	c.Assert(opts(f.Pixelate(4, "circle")), qt.Not(qt.DeepEquals), opts(f.Pixelate(4, "hex")))
+
+	dst := applyTestFilter(c, src, f.Pixelate(4, "circle"))
+	c.Assert(dst.Bounds(), qt.Equals, image.Rect(0, 0, 8, 8))
+	// Corners are outside the circle.
+	c.Assert(rgba(dst.At(0, 0)), qt.Equals, color.RGBA{})
+	c.Assert(rgba(dst.At(7, 7)), qt.Equals, color.RGBA{})
+	// The first cell is the average of 1/4 blue and 3/4 red.
+	avg := rgba(dst.At(2, 2))
+	c.Assert(avg.R > 180 && avg.R < 200, qt.Equals, true)
+	c.Assert(avg.B > 55 && avg.B < 75, qt.Equals, true)
+	c.Assert(rgba(dst.At(1, 2)), qt.Equals, avg)
+	c.Assert(rgba(dst.At(6, 6)), qt.Equals, red)
+	c.Assert(RequiresTransparency(f.Pixelate(4, "circle")), qt.Equals, true)
+
+	// Hexagons cover the whole image.
+	dst = applyTestFilter(c, src, f.Pixelate(4, "hex"))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			_, _, _, a := dst.At(x, y).RGBA()
+			c.Assert(a, qt.Equals, uint32(0xffff))
+		}
+	}
+	c.Assert(RequiresTransparency(f.Pixelate(4, "hex")), qt.Equals, false)
+
+	c.Assert(FilterError(f.Pixelate(4, "triangle")), qt.ErrorMatches, ".*invalid pixelate shape.*")
+	c.Assert(FilterError(f.Pixelate(0, "hex")), qt.ErrorMatches, ".*positive.*")
+}
+
+func TestFilterGradientOverlay(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	src := newTestImage(4, 11, white)
+
+	dst := applyTestFilter(c, src, f.GradientOverlay("bottom", "#00000000", "#000000"))
+	c.Assert(dst.Bounds(), qt.Equals, src.Bounds())
+	c.Assert(rgba(dst.At(0, 0)), qt.Equals, white)
+	c.Assert(rgba(dst.At(3, 10)), qt.Equals, color.RGBA{A: 255})
+	mid := rgba(dst.At(2, 5))
+	c.Assert(mid.R > 120 && mid.R < 135, qt.Equals, true)
+	c.Assert(mid.A, qt.Equals, uint8(255))
+
+	dst = applyTestFilter(c, src, f.GradientOverlay("Left", "#00000000", "#000000"))
+	c.Assert(rgba(dst.At(0, 0)), qt.Equals, color.RGBA{A: 255})
+	c.Assert(rgba(dst.At(3, 0)), qt.Equals, white)
+
+	opts := func(f gift.Filter) filterOpts { return f.(filter).Options }
+	c.Assert(opts(f.GradientOverlay("top", "#000", "#fff")), qt.Not(qt.DeepEquals), opts(f.GradientOverlay("top", "#000", "#ffe")))
+
+	c.Assert(FilterError(f.GradientOverlay("diagonal", "#000", "#fff")), qt.ErrorMatches, ".*invalid gradient direction.*")
+}
+
+func TestFilterGradientMap(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	gm := f.GradientMap([]interface{}{0, "#000000"}, []interface{}{50, "#ff0000"}, [2]string{"100", "#ffffff"})
+
+	for _, test := range []struct {
+		in     color.Color
+		expect color.RGBA
+	}{
+		{color.RGBA{A: 255}, color.RGBA{A: 255}},
+		{color.RGBA{R: 255, G: 255, B: 255, A: 255}, color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+		{color.RGBA{R: 127, G: 127, B: 127, A: 255}, color.RGBA{R: 254, A: 255}},
+		{color.RGBA{R: 64, G: 64, B: 64, A: 255}, color.RGBA{R: 128, A: 255}},
+		// Only the luminance counts.
+		{color.RGBA{B: 255, A: 255}, color.RGBA{R: 58, A: 255}},
+	} {
+		dst := applyTestFilter(c, newTestImage(2, 2, test.in), gm)
+		c.Assert(rgba(dst.At(1, 1)), qt.Equals, test.expect, qt.Commentf("%v", test.in))
+	}
+
+	// Transparency is kept.
+	dst := applyTestFilter(c, newTestImage(2, 2, color.NRGBA{R: 255, G: 255, B: 255, A: 128}), gm)
+	c.Assert(color.NRGBAModel.Convert(dst.At(0, 0)), qt.Equals, color.NRGBA{R: 255, G: 255, B: 255, A: 128})
+
+	// Outside the stops.
+	dst = applyTestFilter(c, newTestImage(2, 2, color.RGBA{A: 255}), f.GradientMap([]interface{}{20, "#ff0000"}, []interface{}{80, "#0000ff"}))
+	c.Assert(rgba(dst.At(0, 0)), qt.Equals, color.RGBA{R: 255, A: 255})
+
+	opts := func(f gift.Filter) filterOpts { return f.(filter).Options }
+	c.Assert(opts(gm), qt.DeepEquals, opts(f.GradientMap([]string{"0", "#000"}, []interface{}{50.0, "red"}, []interface{}{100, "#fff"})))
+	c.Assert(opts(gm), qt.Not(qt.DeepEquals), opts(f.GradientMap([]interface{}{0, "#000"}, []interface{}{100, "#fff"})))
+
+	c.Assert(FilterError(f.GradientMap([]interface{}{0, "#000"})), qt.ErrorMatches, ".*at least two stops.*")
+	c.Assert(FilterError(f.GradientMap([]interface{}{50, "#000"}, []interface{}{20, "#fff"})), qt.ErrorMatches, ".*sorted.*")
+	c.Assert(FilterError(f.GradientMap([]interface{}{0, "#000"}, []interface{}{120, "#fff"})), qt.ErrorMatches, ".*range 0 to 100.*")
+	c.Assert(FilterError(f.GradientMap([]interface{}{0, "#000"}, []interface{}{100})), qt.ErrorMatches, ".*position and a color.*")
+	c.Assert(FilterError(f.GradientMap([]interface{}{0, "#000"}, []interface{}{100, "foo"})), qt.ErrorMatches, `invalid color "foo"`)
+}
+
+func TestFilterWhiteBalance(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	gray := color.RGBA{R: 128, G: 128, B: 128, A: 255}
+	src := newTestImage(4, 4, gray)
+
+	// Neutral.
+	dst := applyTestFilter(c, src, f.WhiteBalance(6500, 0))
+	got := rgba(dst.At(1, 1))
+	c.Assert(int(got.R)-int(got.B) < 3 && int(got.B)-int(got.R) < 3, qt.Equals, true, qt.Commentf("%v", got))
+
+	warm := rgba(applyTestFilter(c, src, f.WhiteBalance(9000, 0)).At(1, 1))
+	c.Assert(warm.R > gray.R, qt.Equals, true, qt.Commentf("%v", warm))
+	c.Assert(warm.B < gray.B, qt.Equals, true, qt.Commentf("%v", warm))
+
+	cool := rgba(applyTestFilter(c, src, f.WhiteBalance(4000, 0)).At(1, 1))
+	c.Assert(cool.R < gray.R, qt.Equals, true, qt.Commentf("%v", cool))
+	c.Assert(cool.B > gray.B, qt.Equals, true, qt.Commentf("%v", cool))
+
+	magenta := rgba(applyTestFilter(c, src, f.WhiteBalance(6500, 50)).At(1, 1))
+	c.Assert(magenta.G < magenta.R, qt.Equals, true, qt.Commentf("%v", magenta))
+
+	opts := func(f gift.Filter) filterOpts { return f.(filter).Options }
+	c.Assert(opts(f.WhiteBalance(6500, 10)), qt.Not(qt.DeepEquals), opts(f.WhiteBalance(6500, 20)))
+
+	c.Assert(FilterError(f.WhiteBalance(100, 0)), qt.ErrorMatches, ".*temperature.*")
+	c.Assert(FilterError(f.WhiteBalance(6500, 200)), qt.ErrorMatches, ".*tint.*")
+}
+
+func TestFilterReplaceColor(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	// A red square on a green screen background.
+	green := color.NRGBA{R: 0, G: 250, B: 10, A: 255}
+	red := color.NRGBA{R: 255, G: 0, B: 0, A: 255}
+	src := newTestImage(10, 10, green)
+	for y := 3; y < 7; y++ {
+		for x := 3; x < 7; x++ {
+			src.Set(x, y, red)
+		}
+	}
+
+	keyed := f.ReplaceColor("#00ff00", 10, "transparent")
+	c.Assert(RequiresTransparency(keyed), qt.Equals, true)
+
+	dst := applyTestFilter(c, src, keyed)
+	c.Assert(rgba(dst.At(0, 0)).A, qt.Equals, uint8(0))
+	c.Assert(rgba(dst.At(9, 9)).A, qt.Equals, uint8(0))
+	c.Assert(rgba(dst.At(5, 5)), qt.Equals, color.RGBA{R: 255, A: 255})
+
+	// Outside of the tolerance.
+	dst = applyTestFilter(c, src, f.ReplaceColor("#00ff00", 0, "transparent"))
+	c.Assert(rgba(dst.At(0, 0)), qt.Equals, rgba(green))
+
+	replaced := f.ReplaceColor("#00ff00", 10, "blue")
+	c.Assert(RequiresTransparency(replaced), qt.Equals, false)
+	dst = applyTestFilter(c, src, replaced)
+	c.Assert(rgba(dst.At(0, 0)), qt.Equals, color.RGBA{B: 255, A: 255})
+	c.Assert(rgba(dst.At(5, 5)), qt.Equals, color.RGBA{R: 255, A: 255})
+
+	opts := func(f gift.Filter) filterOpts { return f.(filter).Options }
+	c.Assert(opts(f.ReplaceColor("#00ff00", 10, "blue")), qt.Not(qt.DeepEquals), opts(f.ReplaceColor("#00ff00", 20, "blue")))
+	c.Assert(opts(f.ReplaceColor("#00ff00", 10, "blue")), qt.Not(qt.DeepEquals), opts(f.ReplaceColor("#00ff00", 10, "red")))
+	c.Assert(opts(f.ReplaceColor("#00ff00", 10, "blue")), qt.Not(qt.DeepEquals), opts(f.ReplaceColor("#0000ff", 10, "blue")))
+
+	c.Assert(FilterError(f.ReplaceColor("#00ff00", 200, "blue")), qt.ErrorMatches, ".*tolerance.*")
+	c.Assert(FilterError(f.ReplaceColor("#00ff00", 10, "nocolor")), qt.ErrorMatches, ".*invalid color.*")
+}
+
+func TestFilterVibrance(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	saturation := func(cl color.Color) int {
+		v := rgba(cl)
+		max, min := v.R, v.R
+		for _, ch := range []uint8{v.G, v.B} {
+			if ch > max {
+				max = ch
+			}
+			if ch < min {
+				min = ch
+			}
+		}
+		return int(max) - int(min)
+	}
+
+	muted := newTestImage(4, 4, color.NRGBA{R: 140, G: 120, B: 110, A: 255})
+	saturated := newTestImage(4, 4, color.NRGBA{R: 230, G: 60, B: 30, A: 255})
+
+	mutedBefore, saturatedBefore := saturation(muted.At(1, 1)), saturation(saturated.At(1, 1))
+	mutedAfter := saturation(applyTestFilter(c, muted, f.Vibrance(50)).At(1, 1))
+	saturatedAfter := saturation(applyTestFilter(c, saturated, f.Vibrance(50)).At(1, 1))
+
+	c.Assert(mutedAfter > mutedBefore, qt.Equals, true)
+	// The muted colors get a relatively bigger boost.
+	c.Assert(float64(mutedAfter)/float64(mutedBefore) > float64(saturatedAfter)/float64(saturatedBefore), qt.Equals, true)
+
+	less := saturation(applyTestFilter(c, muted, f.Vibrance(-50)).At(1, 1))
+	c.Assert(less < mutedBefore, qt.Equals, true)
+
+	gray := newTestImage(4, 4, color.NRGBA{R: 128, G: 128, B: 128, A: 255})
+	c.Assert(rgba(applyTestFilter(c, gray, f.Vibrance(50)).At(1, 1)), qt.Equals, rgba(gray.At(1, 1)))
+
+	opts := func(f gift.Filter) filterOpts { return f.(filter).Options }
+	c.Assert(opts(f.Vibrance(10)), qt.Not(qt.DeepEquals), opts(f.Vibrance(20)))
+
+	c.Assert(FilterError(f.Vibrance(200)), qt.ErrorMatches, ".*vibrance.*")
+}
+
+func TestFilterColorBlind(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	red := newTestImage(4, 4, color.NRGBA{R: 255, A: 255})
+	green := newTestImage(4, 4, color.NRGBA{G: 255, A: 255})
+	gray := newTestImage(4, 4, color.NRGBA{R: 128, G: 128, B: 128, A: 128})
+
+	for _, mode := range []string{"protanopia", "deuteranopia", "tritanopia"} {
+		// Neutral colors are seen the same, and the alpha is kept.
+		got := rgba(applyTestFilter(c, gray, f.ColorBlind(mode)).At(1, 1))
+		want := rgba(gray.At(1, 1))
+		for _, d := range []int{int(got.R) - int(want.R), int(got.G) - int(want.G), int(got.B) - int(want.B)} {
+			c.Assert(d >= -2 && d <= 2, qt.Equals, true, qt.Commentf("%s: %v", mode, got))
+		}
+		c.Assert(got.A, qt.Equals, want.A)
+	}
+
+	// Red and green are hard to tell apart with protanopia and deuteranopia.
+	for _, mode := range []string{"protanopia", "deuteranopia"} {
+		r := rgba(applyTestFilter(c, red, f.ColorBlind(mode)).At(1, 1))
+		g := rgba(applyTestFilter(c, green, f.ColorBlind(mode)).At(1, 1))
+		c.Assert(r.R < 255 && r.G > 0, qt.Equals, true, qt.Commentf("%s: %v", mode, r))
+		c.Assert(g.R > 0, qt.Equals, true, qt.Commentf("%s: %v", mode, g))
+	}
+
+	// But not with tritanopia.
+	r := rgba(applyTestFilter(c, red, f.ColorBlind("tritanopia")).At(1, 1))
+	c.Assert(r.R > 240 && r.G < 30, qt.Equals, true, qt.Commentf("%v", r))
+
+	opts := func(f gift.Filter) filterOpts { return f.(filter).Options }
+	c.Assert(opts(f.ColorBlind("Protanopia")), qt.DeepEquals, opts(f.ColorBlind("protanopia")))
+	c.Assert(opts(f.ColorBlind("protanopia")), qt.Not(qt.DeepEquals), opts(f.ColorBlind("deuteranopia")))
+
+	c.Assert(FilterError(f.ColorBlind("foo")), qt.ErrorMatches, `invalid color blindness mode "foo".*`)
+}
+
+func TestFilterCircleMask(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	mask := f.CircleMask()
+	c.Assert(RequiresTransparency(mask), qt.Equals, true)
+
+	blue := color.NRGBA{B: 255, A: 255}
+	dst := applyTestFilter(c, newTestImage(20, 10, blue), mask)
+	c.Assert(dst.Bounds(), qt.Equals, image.Rect(0, 0, 20, 10))
+
+	// The circle is centered, with the radius of the shortest side.
+	c.Assert(rgba(dst.At(10, 5)), qt.Equals, rgba(blue))
+	c.Assert(rgba(dst.At(10, 0)).A, qt.Not(qt.Equals), uint8(0))
+	c.Assert(rgba(dst.At(0, 0)).A, qt.Equals, uint8(0))
+	c.Assert(rgba(dst.At(3, 5)).A, qt.Equals, uint8(0))
+	c.Assert(rgba(dst.At(19, 9)).A, qt.Equals, uint8(0))
+}
+
+func TestAlphaMask(t *testing.T) {
+	c := qt.New(t)
+
+	src := newTestImage(4, 2, color.NRGBA{R: 255, A: 255})
+	src.Set(1, 0, color.NRGBA{R: 255, A: 0})
+	src.Set(2, 1, color.NRGBA{G: 255, A: 128})
+
+	mask := AlphaMask(src.SubImage(image.Rect(1, 0, 4, 2)))
+	c.Assert(mask.Bounds(), qt.Equals, image.Rect(0, 0, 3, 2))
+	c.Assert(mask.GrayAt(0, 0).Y, qt.Equals, uint8(0))
+	c.Assert(mask.GrayAt(1, 1).Y, qt.Equals, uint8(128))
+	c.Assert(mask.GrayAt(2, 0).Y, qt.Equals, uint8(255))
+
+	opaque := AlphaMask(image.NewGray(image.Rect(0, 0, 2, 2)))
+	c.Assert(opaque.GrayAt(1, 1).Y, qt.Equals, uint8(255))
+}
+
+func TestFilter16(t *testing.T) {
+	c := qt.New(t)
+	p := &ImageProcessor{}
+
+	src := image.NewNRGBA64(image.Rect(0, 0, 4, 4))
+	for i := range src.Pix {
+		src.Pix[i] = 0xff
+	}
+	src.SetNRGBA64(1, 1, color.NRGBA64{R: 0x1234, G: 0x5678, B: 0x9abc, A: 0xffff})
+
+	dst, err := p.filter16(src, gift.Crop(image.Rect(1, 1, 3, 3)))
+	c.Assert(err, qt.IsNil)
+	rgba64, ok := dst.(*image.RGBA64)
+	c.Assert(ok, qt.Equals, true)
+	c.Assert(rgba64.RGBA64At(0, 0), qt.Equals, color.RGBA64{R: 0x1234, G: 0x5678, B: 0x9abc, A: 0xffff})
+
+	dst, err = p.filter16(image.NewGray16(image.Rect(0, 0, 4, 4)), gift.Resize(2, 0, gift.BoxResampling))
+	c.Assert(err, qt.IsNil)
+	_, ok = dst.(*image.Gray16)
+	c.Assert(ok, qt.Equals, true)
+
+	// 8 bit images are processed as usual.
+	dst, err = p.filter16(newTestImage(4, 4, color.White), gift.Resize(2, 0, gift.BoxResampling))
+	c.Assert(err, qt.IsNil)
+	_, ok = dst.(*image.RGBA)
+	c.Assert(ok, qt.Equals, true)
+}
+
+func TestFilterCLAHE(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	// A low contrast image with gray values in range 100 to 130.
+	src := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			v := uint8(100 + (x+y)*30/62)
+			src.Set(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+
+	grayRange := func(img image.Image) (min, max uint8) {
+		min = 255
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 32; x++ {
+				v := rgba(img.At(x, y))
+				c.Assert(v.R, qt.Equals, v.G)
+				c.Assert(v.G, qt.Equals, v.B)
+				if v.R < min {
+					min = v.R
+				}
+				if v.R > max {
+					max = v.R
+				}
+			}
+		}
+		return
+	}
+
+	dst := applyTestFilter(c, src, f.CLAHE(2, 4))
+	c.Assert(dst.Bounds(), qt.Equals, src.Bounds())
+	srcMin, srcMax := grayRange(src)
+	dstMin, dstMax := grayRange(dst)
+	c.Assert(int(dstMax)-int(dstMin) > 2*(int(srcMax)-int(srcMin)), qt.Equals, true, qt.Commentf("%d-%d", dstMin, dstMax))
+
+	// A lower clip limit gives less contrast.
+	limitedMin, limitedMax := grayRange(applyTestFilter(c, src, f.CLAHE(2, 1)))
+	c.Assert(int(limitedMax)-int(limitedMin) < int(dstMax)-int(dstMin), qt.Equals, true)
+
+	// Deterministic.
+	c.Assert(applyTestFilter(c, src, f.CLAHE(2, 4)), qt.DeepEquals, dst)
+
+	opts := func(f gift.Filter) filterOpts { return f.(filter).Options }
+	c.Assert(opts(f.CLAHE(4, 2)), qt.Not(qt.DeepEquals), opts(f.CLAHE(8, 2)))
+	c.Assert(opts(f.CLAHE(4, 2)), qt.Not(qt.DeepEquals), opts(f.CLAHE(4, 3)))
+
+	c.Assert(FilterError(f.CLAHE(0, 2)), qt.ErrorMatches, ".*tile grid.*")
+	c.Assert(FilterError(f.CLAHE(8, 0.5)), qt.ErrorMatches, ".*clip limit.*")
+}
+
+func TestFilterHueTo(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	red := newTestImage(4, 4, color.NRGBA{R: 200, G: 40, B: 40, A: 255})
+	v := rgba(applyTestFilter(c, red, f.HueTo("#0000ff")).At(1, 1))
+	c.Assert(v.B > v.R && v.B > v.G, qt.Equals, true)
+
+	hue, ok := estimateMeanHue(applyTestFilter(c, red, f.HueTo("#00ff00")))
+	c.Assert(ok, qt.Equals, true)
+	c.Assert(math.Abs(hue-120) < 2, qt.Equals, true)
+
+	// Grays have no hue to rotate.
+	gray := newTestImage(4, 4, color.NRGBA{R: 128, G: 128, B: 128, A: 255})
+	c.Assert(rgba(applyTestFilter(c, gray, f.HueTo("#0000ff")).At(1, 1)), qt.Equals, rgba(gray.At(1, 1)))
+
+	opts := func(f gift.Filter) filterOpts { return f.(filter).Options }
+	c.Assert(opts(f.HueTo("#0000ff")), qt.Not(qt.DeepEquals), opts(f.HueTo("#00ff00")))
+
+	c.Assert(FilterError(f.HueTo("#808080")), qt.ErrorMatches, ".*gray.*")
+}
+
+type testResource struct {
+	content string
+}
+
+func (r testResource) MediaType() media.Type {
+	return media.OctetType
+}
+
+func (r testResource) ReadSeekCloser() (hugio.ReadSeekCloser, error) {
+	return hugio.NewReadSeekerNoOpCloserFromString(r.content), nil
+}
+
+func TestFilterFrame(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	green := color.NRGBA{G: 255, A: 255}
+	var buf bytes.Buffer
+	c.Assert(png.Encode(&buf, newTestImage(40, 60, green)), qt.IsNil)
+	frame := testResource{content: buf.String()}
+
+	screenshot := newTestImage(10, 20, color.NRGBA{R: 255, A: 255})
+
+	dst := applyTestFilter(c, screenshot, f.Frame(frame, 5, 8))
+	c.Assert(dst.Bounds(), qt.Equals, image.Rect(0, 0, 40, 60))
+	c.Assert(rgba(dst.At(5, 8)), qt.Equals, rgba(color.NRGBA{R: 255, A: 255}))
+	c.Assert(rgba(dst.At(14, 27)), qt.Equals, rgba(color.NRGBA{R: 255, A: 255}))
+	c.Assert(rgba(dst.At(15, 27)), qt.Equals, rgba(green))
+	c.Assert(rgba(dst.At(14, 28)), qt.Equals, rgba(green))
+	c.Assert(rgba(dst.At(4, 8)), qt.Equals, rgba(green))
+
+	// Scaled to fill the rectangle.
+	dst = applyTestFilter(c, screenshot, f.Frame(frame, 5, 8, 30, 40))
+	c.Assert(rgba(dst.At(5, 8)), qt.Equals, rgba(color.NRGBA{R: 255, A: 255}))
+	c.Assert(rgba(dst.At(34, 47)), qt.Equals, rgba(color.NRGBA{R: 255, A: 255}))
+	c.Assert(rgba(dst.At(35, 47)), qt.Equals, rgba(green))
+	c.Assert(rgba(dst.At(34, 48)), qt.Equals, rgba(green))
+
+	// Only the height, keeping the aspect ratio.
+	dst = applyTestFilter(c, screenshot, f.Frame(frame, 0, 0, 0, 40))
+	c.Assert(rgba(dst.At(19, 39)), qt.Equals, rgba(color.NRGBA{R: 255, A: 255}))
+	c.Assert(rgba(dst.At(20, 39)), qt.Equals, rgba(green))
+
+	c.Assert(RequiresTransparency(f.Frame(frame, 0, 0)), qt.Equals, false)
+	buf.Reset()
+	c.Assert(png.Encode(&buf, newTestImage(40, 60, color.Transparent)), qt.IsNil)
+	c.Assert(RequiresTransparency(f.Frame(testResource{content: buf.String()}, 0, 0)), qt.Equals, true)
+
+	c.Assert(FilterError(f.Frame("foo", 0, 0)), qt.ErrorMatches, "frame must be a resource.*")
+	c.Assert(FilterError(f.Frame(frame, -1, 0)), qt.ErrorMatches, ".*positive.*")
+}
+
+func TestFilterFilmGrain(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	gray := color.RGBA{R: 0x80, G: 0x80, B: 0x80, A: 255}
+	src := newTestImage(32, 32, gray)
+
+	stats := func(img image.Image) (changed int, mono bool, maxDiff int) {
+		mono = true
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 32; x++ {
+				p := rgba(img.At(x, y))
+				if p != gray {
+					changed++
+				}
+				if p.R != p.G || p.G != p.B {
+					mono = false
+				}
+				if d := int(p.R) - 0x80; d > maxDiff {
+					maxDiff = d
+				} else if -d > maxDiff {
+					maxDiff = -d
+				}
+			}
+		}
+		return
+	}
+
+	grain := applyTestFilter(c, src, f.FilmGrain(50, 1, false))
+	changed, mono, maxDiff := stats(grain)
+	c.Assert(changed > 32*32/2, qt.Equals, true)
+	c.Assert(mono, qt.Equals, false)
+	c.Assert(maxDiff <= filmGrainMaxAmplitude/2, qt.Equals, true)
+
+	_, mono, _ = stats(applyTestFilter(c, src, f.FilmGrain(50, 1, true)))
+	c.Assert(mono, qt.Equals, true)
+
+	// Stronger grain changes more.
+	_, _, weak := stats(applyTestFilter(c, src, f.FilmGrain(10, 1, false)))
+	c.Assert(weak < maxDiff, qt.Equals, true)
+
+	// Deterministic.
+	c.Assert(applyTestFilter(c, src, f.FilmGrain(50, 1, false)), qt.DeepEquals, grain)
+	c.Assert(applyTestFilter(c, src, f.FilmGrain(50, 4, false)), qt.Not(qt.DeepEquals), grain)
+
+	// Large grains: neighbour pixels are closer.
+	smoothness := func(img image.Image) int {
+		var sum int
+		for y := 0; y < 32; y++ {
+			for x := 1; x < 32; x++ {
+				d := int(rgba(img.At(x, y)).R) - int(rgba(img.At(x-1, y)).R)
+				if d < 0 {
+					d = -d
+				}
+				sum += d
+			}
+		}
+		return sum
+	}
+	c.Assert(smoothness(applyTestFilter(c, src, f.FilmGrain(50, 8, false))) < smoothness(grain), qt.Equals, true)
+
+	// Alpha is kept.
+	transparent := applyTestFilter(c, newTestImage(4, 4, color.RGBA{}), f.FilmGrain(50, 1, false))
+	c.Assert(rgba(transparent.At(1, 1)).A, qt.Equals, uint8(0))
+
+	opts := func(f gift.Filter) filterOpts { return f.(filter).Options }
+	c.Assert(opts(f.FilmGrain(50, 1, false)), qt.DeepEquals, opts(f.FilmGrain("50", 1.0, "false")))
+	c.Assert(opts(f.FilmGrain(50, 1, false)), qt.Not(qt.DeepEquals), opts(f.FilmGrain(50, 1, true)))
+
+	c.Assert(FilterError(f.FilmGrain(0, 1, false)), qt.ErrorMatches, ".*intensity.*")
+	c.Assert(FilterError(f.FilmGrain(101, 1, false)), qt.ErrorMatches, ".*intensity.*")
+	c.Assert(FilterError(f.FilmGrain(50, 0.5, false)), qt.ErrorMatches, ".*size.*")
+}
+
+func TestFilterShadowHighlight(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	// Dark, midtone and bright bands with a checker pattern as detail.
+	src := image.NewNRGBA(image.Rect(0, 0, 48, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 48; x++ {
+			v := uint8(10 + (x/16)*110)
+			if (x/2+y/2)%2 == 0 {
+				v += 12
+			}
+			src.Set(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+
+	// The difference between the checker cells at y 8.
+	detail := func(img image.Image, x int) int {
+		return int(rgba(img.At(x+2, 8)).R) - int(rgba(img.At(x, 8)).R)
+	}
+
+	unchanged := applyTestFilter(c, src, f.ShadowHighlight(0, 0))
+	for _, x := range []int{6, 22, 38} {
+		c.Assert(rgba(unchanged.At(x, 8)), qt.Equals, rgba(src.At(x, 8)))
+	}
+
+	dst := applyTestFilter(c, src, f.ShadowHighlight(60, 60))
+	// Shadows are lifted with more detail.
+	c.Assert(rgba(dst.At(6, 8)).R > rgba(src.At(6, 8)).R, qt.Equals, true)
+	c.Assert(detail(dst, 6) > detail(src, 6), qt.Equals, true)
+	// Highlights are recovered.
+	c.Assert(rgba(dst.At(38, 8)).R < rgba(src.At(38, 8)).R, qt.Equals, true)
+	// The midtones change much less than the shadows.
+	mid := int(rgba(dst.At(22, 8)).R) - int(rgba(src.At(22, 8)).R)
+	shadow := int(rgba(dst.At(6, 8)).R) - int(rgba(src.At(6, 8)).R)
+	c.Assert(mid < shadow, qt.Equals, true)
+
+	// Only the shadows.
+	dst = applyTestFilter(c, src, f.ShadowHighlight(60, 0))
+	c.Assert(rgba(dst.At(38, 8)).R >= rgba(src.At(38, 8)).R, qt.Equals, true)
+
+	c.Assert(f.ShadowHighlight(60, 0).(filter).Options, qt.Not(qt.DeepEquals), f.ShadowHighlight(0, 60).(filter).Options)
+	c.Assert(FilterError(f.ShadowHighlight(101, 0)), qt.ErrorMatches, ".*must be in range 0 to 100")
+	c.Assert(FilterError(f.ShadowHighlight(0, -1)), qt.ErrorMatches, ".*must be in range 0 to 100")
+}
+
+func TestFilterSmartCrop(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	// A flat image with a colorful checkerboard to the right.
+	src := newTestImage(300, 100, color.RGBA{R: 0x80, G: 0x80, B: 0x80, A: 255})
+	detail := image.Rect(220, 20, 280, 80)
+	for y := detail.Min.Y; y < detail.Max.Y; y++ {
+		for x := detail.Min.X; x < detail.Max.X; x++ {
+			if (x/4+y/4)%2 == 0 {
+				src.Set(x, y, color.RGBA{R: 255, G: 40, B: 20, A: 255})
+			} else {
+				src.Set(x, y, color.RGBA{R: 10, G: 200, B: 255, A: 255})
+			}
+		}
+	}
+
+	box := smartCropFilter{width: 50, height: 50}.cropBox(src)
+	c.Assert(box.Dx(), qt.Equals, box.Dy())
+	center := box.Min.Add(box.Max).Div(2)
+	c.Assert(center.In(detail), qt.Equals, true, qt.Commentf("box %s", box))
+
+	dst := applyTestFilter(c, src, f.SmartCrop(50, 50))
+	c.Assert(dst.Bounds(), qt.Equals, image.Rect(0, 0, 50, 50))
+	c.Assert(rgba(dst.At(25, 25)), qt.Not(qt.Equals), rgba(src.At(0, 0)))
+
+	// Flat images are cropped in the center.
+	flat := newTestImage(300, 100, color.RGBA{B: 255, A: 255})
+	c.Assert(smartCropFilter{width: 50, height: 50}.cropBox(flat), qt.Equals, image.Rect(100, 0, 200, 100))
+	c.Assert(smartCropFilter{width: 300, height: 50}.cropBox(flat), qt.Equals, image.Rect(0, 25, 300, 75))
+
+	opts := func(f gift.Filter) filterOpts { return f.(filter).Options }
+	c.Assert(opts(f.SmartCrop(50, 50)), qt.DeepEquals, opts(f.SmartCrop("50", 50.0)))
+	c.Assert(opts(f.SmartCrop(50, 50)), qt.Not(qt.DeepEquals), opts(f.SmartCrop(50, 60)))
+
+	c.Assert(FilterError(f.SmartCrop(0, 50)), qt.ErrorMatches, ".*size.*")
+}
+
+func TestFilterCompose(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	src := newTestImage(20, 10, color.RGBA{R: 0x80, G: 0x40, B: 0x20, A: 255})
+	chain := []gift.Filter{f.Brightness(10), f.Contrast(20), f.Border(2, "#ff0000")}
+
+	look := f.Compose("look", chain...)
+	c.Assert(look.Bounds(src.Bounds()), qt.Equals, image.Rect(0, 0, 24, 14))
+	c.Assert(applyTestFilter(c, src, look), qt.DeepEquals, applyTestFilter(c, src, chain...))
+	c.Assert(RequiresTransparency(look), qt.Equals, false)
+
+	opts := func(f gift.Filter) filterOpts { return f.(filter).Options }
+	c.Assert(opts(look), qt.DeepEquals, opts(f.Compose("look", f.Brightness(10), f.Contrast(20), f.Border(2, "#ff0000"))))
+	c.Assert(opts(look), qt.DeepEquals, opts(f.Compose("renamed", chain...)))
+	c.Assert(opts(look), qt.Not(qt.DeepEquals), opts(f.Compose("look", chain[1], chain[0], chain[2])))
+
+	c.Assert(RequiresTransparency(f.Compose("shadow", f.Brightness(10), f.DropShadow(5, 5, 2, "#000"))), qt.Equals, true)
+	c.Assert(RequiresExif(f.Compose("caption", f.Brightness(10), f.ExifCaption("{{ .Make }}"))), qt.Equals, true)
+
+	c.Assert(FilterError(f.Compose("empty")), qt.ErrorMatches, ".*at least one filter.*")
+	c.Assert(FilterError(f.Compose("look", f.Brightness(10), f.Vibrance(200))), qt.ErrorMatches, "look: vibrance.*")
+}
+
+func TestFilterPalette(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	// Mid gray is between two of the 16 levels, 0x77 and 0x88.
+	src := newTestImage(8, 8, color.RGBA{R: 0x80, G: 0x80, B: 0x80, A: 255})
+
+	count := func(img image.Image) map[color.RGBA]int {
+		m := make(map[color.RGBA]int)
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				m[rgba(img.At(x, y))]++
+			}
+		}
+		return m
+	}
+
+	dark, light := color.RGBA{R: 0x77, G: 0x77, B: 0x77, A: 255}, color.RGBA{R: 0x88, G: 0x88, B: 0x88, A: 255}
+
+	c.Assert(count(applyTestFilter(c, src, f.Palette("grayscale-16", "none"))), qt.DeepEquals, map[color.RGBA]int{light: 64})
+	for _, dither := range []string{"floydsteinberg", "ordered"} {
+		counts := count(applyTestFilter(c, src, f.Palette("Grayscale-16", dither)))
+		c.Assert(len(counts), qt.Equals, 2, qt.Commentf(dither))
+		c.Assert(counts[dark] > 0 && counts[light] > 0, qt.Equals, true, qt.Commentf(dither))
+	}
+
+	// All colors are in the palette.
+	for _, name := range []string{"websafe", "cga", "grayscale-2"} {
+		p, _, err := namedPalette(name)
+		c.Assert(err, qt.IsNil)
+		dst := applyTestFilter(c, newTestImage(4, 4, color.RGBA{R: 200, G: 30, B: 90, A: 255}), f.Palette(name))
+		c.Assert(rgba(p.Convert(dst.At(1, 1))), qt.Equals, rgba(dst.At(1, 1)), qt.Commentf(name))
+	}
+
+	opts := func(f gift.Filter) filterOpts { return f.(filter).Options }
+	c.Assert(opts(f.Palette("websafe")), qt.DeepEquals, opts(f.Palette("websafe", "floydsteinberg")))
+	c.Assert(opts(f.Palette("websafe")), qt.Not(qt.DeepEquals), opts(f.Palette("websafe", "ordered")))
+	c.Assert(opts(f.Palette("websafe")), qt.Not(qt.DeepEquals), opts(f.Palette("cga")))
+
+	c.Assert(FilterError(f.Palette("ega")), qt.ErrorMatches, ".*invalid palette.*")
+	c.Assert(FilterError(f.Palette("grayscale-1")), qt.ErrorMatches, ".*gray levels.*")
+	c.Assert(FilterError(f.Palette("websafe", "random")), qt.ErrorMatches, ".*invalid dither.*")
+}
+
+func TestFilterPattern(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	white := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	red := color.NRGBA{R: 255, A: 255}
+
+	// A transparent tile with one red pixel.
+	tileImg := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	tileImg.SetNRGBA(1, 2, red)
+	var buf bytes.Buffer
+	c.Assert(png.Encode(&buf, tileImg), qt.IsNil)
+	tile := testResource{content: buf.String()}
+
+	src := newTestImage(21, 13, white)
+
+	dst := applyTestFilter(c, src, f.Pattern(tile, 1))
+	c.Assert(dst.Bounds(), qt.Equals, src.Bounds())
+	for y := 0; y < 13; y++ {
+		for x := 0; x < 21; x++ {
+			expect := white
+			if x%4 == 1 && y%3 == 2 {
+				expect = red
+			}
+			c.Assert(rgba(dst.At(x, y)), qt.Equals, rgba(expect), qt.Commentf("%d,%d", x, y))
+		}
+	}
+
+	dst = applyTestFilter(c, src, f.Pattern(tile, 0.5))
+	c.Assert(rgba(dst.At(5, 5)), qt.Equals, color.RGBA{R: 255, G: 127, B: 127, A: 255})
+	c.Assert(rgba(dst.At(6, 5)), qt.Equals, rgba(white))
+
+	// A tile larger than the image is cropped.
+	buf.Reset()
+	c.Assert(png.Encode(&buf, newTestImage(40, 30, red)), qt.IsNil)
+	dst = applyTestFilter(c, src, f.Pattern(testResource{content: buf.String()}, 1))
+	c.Assert(dst.Bounds(), qt.Equals, src.Bounds())
+	c.Assert(rgba(dst.At(20, 12)), qt.Equals, rgba(red))
+
+	c.Assert(f.Pattern(tile, 0.5).(filter).Options, qt.Not(qt.DeepEquals), f.Pattern(tile, 0.6).(filter).Options)
+	c.Assert(FilterError(f.Pattern("foo", 1)), qt.ErrorMatches, "tile must be a resource.*")
+	c.Assert(FilterError(f.Pattern(tile, 1.5)), qt.ErrorMatches, ".*opacity.*")
+}
+
+func TestFilterLUT(t *testing.T) {
+	c := qt.New(t)
+	f := &Filters{}
+
+	// An identity HALD CLUT of level 2, i.e. 4 entries per channel.
+	hald := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := 0; i < 64; i++ {
+		r, g, b := i%4, (i/4)%4, i/16
+		hald.Set(i%8, i/8, color.NRGBA{R: uint8(r * 85), G: uint8(g * 85), B: uint8(b * 85), A: 255})
+	}
+	var buf bytes.Buffer
+	c.Assert(png.Encode(&buf, hald), qt.IsNil)
+	identity := testResource{content: buf.String()}
+
+	near := func(a, b uint8) bool {
+		return math.Abs(float64(a)-float64(b)) <= 1
+	}
+
+	for _, cl := range []color.NRGBA{{200, 30, 100, 255}, {0, 255, 17, 128}, {128, 128, 128, 255}} {
+		src := newTestImage(2, 2, cl)
+		v, expect := rgba(applyTestFilter(c, src, f.LUT(identity)).At(1, 1)), rgba(cl)
+		c.Assert(near(v.R, expect.R) && near(v.G, expect.G) && near(v.B, expect.B), qt.Equals, true, qt.Commentf("%v => %v", cl, v))
+		c.Assert(v.A, qt.Equals, expect.A)
+	}
+
+	invert := testResource{content: `# An inverting LUT.
+TITLE "Invert"
+LUT_3D_SIZE 2
+
+1 1 1
+0 1 1
+1 0 1
+0 0 1
+1 1 0
+0 1 0
+1 0 0
+0 0 0
+`}
+
+	v := rgba(applyTestFilter(c, newTestImage(2, 2, color.NRGBA{R: 200, G: 30, B: 100, A: 255}), f.LUT(invert)).At(1, 1))
+	c.Assert(near(v.R, 55) && near(v.G, 225) && near(v.B, 155), qt.Equals, true, qt.Commentf("%v", v))
+
+	opts := func(f gift.Filter) filterOpts { return f.(filter).Options }
+	c.Assert(opts(f.LUT(identity)), qt.Not(qt.DeepEquals), opts(f.LUT(invert)))
+
+	c.Assert(FilterError(f.LUT("foo")), qt.ErrorMatches, ".*must be a resource.*")
+	c.Assert(FilterError(f.LUT(testResource{content: "LUT_3D_SIZE 2\n0 0 0\n"})), qt.ErrorMatches, ".*expected 8 LUT entries.*")
+	c.Assert(FilterError(f.LUT(testResource{content: "LUT_1D_SIZE 16"})), qt.ErrorMatches, ".*not supported.*")
+}
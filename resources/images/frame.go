@@ -0,0 +1,88 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+
+	"github.com/gohugoio/hugo/resources/resource"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*frameFilter)(nil)
+
+// frameFilter places the image in a rectangle of a frame image, e.g. the
+// screen of a device mockup. The result has the size of the frame.
+type frameFilter struct {
+	frame image.Image
+
+	// The top left corner of the rectangle in the frame.
+	x, y int
+
+	// The size to scale the image to, 0 keeps its size, or its aspect ratio
+	// if only one of them is set.
+	width, height int
+}
+
+func (f frameFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	fb := f.frame.Bounds()
+	draw.Draw(dst, dst.Bounds(), f.frame, fb.Min, draw.Src)
+
+	var resize gift.Filter
+	switch {
+	case f.width > 0 && f.height > 0:
+		resize = gift.ResizeToFill(f.width, f.height, gift.LinearResampling, gift.CenterAnchor)
+	case f.width > 0 || f.height > 0:
+		resize = gift.Resize(f.width, f.height, gift.LinearResampling)
+	}
+	if resize != nil {
+		g := gift.New(resize)
+		tmp := image.NewNRGBA(g.Bounds(src.Bounds()))
+		g.Draw(tmp, src)
+		src = tmp
+	}
+
+	sb := src.Bounds()
+	r := image.Rect(f.x, f.y, f.x+sb.Dx(), f.y+sb.Dy()).Add(dst.Bounds().Min)
+	draw.Draw(dst, r, src, sb.Min, draw.Over)
+}
+
+func (f frameFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	b := f.frame.Bounds()
+	return image.Rect(0, 0, b.Dx(), b.Dy())
+}
+
+func (f frameFilter) requiresTransparency() bool {
+	if o, ok := f.frame.(interface{ Opaque() bool }); ok {
+		return !o.Opaque()
+	}
+	return false
+}
+
+// loadImageResource decodes the image in r, e.g. a frame or a pattern tile.
+// It also returns a hash of the image file, used in the key.
+func loadImageResource(r resource.ReadSeekCloserResource) (image.Image, string, error) {
+	b, hash, err := readResource(r)
+	if err != nil {
+		return nil, "", err
+	}
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", err
+	}
+	return img, hash, nil
+}
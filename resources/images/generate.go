@@ -0,0 +1,97 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/pkg/errors"
+)
+
+// maxGeneratedSize is the largest width and height of a generated image.
+const maxGeneratedSize = 8192
+
+func checkGeneratedSize(width, height int) error {
+	if width < 1 || height < 1 {
+		return errors.New("image width and height must be positive numbers")
+	}
+	if width > maxGeneratedSize || height > maxGeneratedSize {
+		return errors.Errorf("image width and height must be at most %d", maxGeneratedSize)
+	}
+	return nil
+}
+
+// NewSolid creates a width x height image filled with the color c, e.g. for
+// a placeholder or a background.
+func NewSolid(width, height int, c color.Color) (image.Image, error) {
+	if err := checkGeneratedSize(width, height); err != nil {
+		return nil, err
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.ZP, draw.Src)
+
+	return img, nil
+}
+
+// NewGradient creates a width x height image with a linear gradient from
+// left to right through the colors in stops, which are spread evenly.
+func NewGradient(width, height int, stops ...color.Color) (image.Image, error) {
+	if err := checkGeneratedSize(width, height); err != nil {
+		return nil, err
+	}
+	if len(stops) < 2 {
+		return nil, errors.New("gradient needs at least two colors")
+	}
+
+	nstops := make([]color.NRGBA, len(stops))
+	for i, c := range stops {
+		nstops[i] = color.NRGBAModel.Convert(c).(color.NRGBA)
+	}
+
+	lerp := func(a, b uint8, t float64) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*t + 0.5)
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	row := make([]color.NRGBA, width)
+	for x := 0; x < width; x++ {
+		var pos float64
+		if width > 1 {
+			pos = float64(x) / float64(width-1) * float64(len(nstops)-1)
+		}
+		i := int(pos)
+		if i >= len(nstops)-1 {
+			i = len(nstops) - 2
+		}
+		t := pos - float64(i)
+		start, end := nstops[i], nstops[i+1]
+		row[x] = color.NRGBA{
+			R: lerp(start.R, end.R, t),
+			G: lerp(start.G, end.G, t),
+			B: lerp(start.B, end.B, t),
+			A: lerp(start.A, end.A, t),
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x, c := range row {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return img, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*gradientOverlayFilter)(nil)
+
+// gradientOverlayFilter composites a linear gradient over the image. The
+// gradient goes from startColor at the opposite edge to endColor at the
+// edge given by direction.
+type gradientOverlayFilter struct {
+	direction  string
+	startColor color.Color
+	endColor   color.Color
+}
+
+var gradientDirections = map[string]bool{
+	"top":    true,
+	"bottom": true,
+	"left":   true,
+	"right":  true,
+}
+
+func (f gradientOverlayFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	b := dst.Bounds()
+	draw.Draw(dst, b, src, src.Bounds().Min, draw.Src)
+
+	start := color.NRGBAModel.Convert(f.startColor).(color.NRGBA)
+	end := color.NRGBAModel.Convert(f.endColor).(color.NRGBA)
+
+	lerp := func(a, b uint8, t float64) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*t + 0.5)
+	}
+
+	w, h := b.Dx(), b.Dy()
+	overlay := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var pos, length int
+			switch f.direction {
+			case "top":
+				pos, length = h-1-y, h
+			case "bottom":
+				pos, length = y, h
+			case "left":
+				pos, length = w-1-x, w
+			case "right":
+				pos, length = x, w
+			}
+			var t float64
+			if length > 1 {
+				t = float64(pos) / float64(length-1)
+			}
+			overlay.SetNRGBA(x, y, color.NRGBA{
+				R: lerp(start.R, end.R, t),
+				G: lerp(start.G, end.G, t),
+				B: lerp(start.B, end.B, t),
+				A: lerp(start.A, end.A, t),
+			})
+		}
+	}
+
+	draw.Draw(dst, b, overlay, image.ZP, draw.Over)
+}
+
+func (f gradientOverlayFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package images
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+
+	"github.com/disintegration/gift"
+	"github.com/spf13/cast"
+)
+
+var _ gift.Filter = (*gradientMapFilter)(nil)
+
+// gradientStop is a color at a position, in range 0-100, in a gradient map.
+type gradientStop struct {
+	pos   float64
+	color color.NRGBA
+}
+
+// gradientMapFilter maps the luminance of each pixel to a color in a
+// gradient, using a lookup table with an entry per 8 bit luminance value.
+type gradientMapFilter struct {
+	lut [256][3]float32
+}
+
+// newGradientMapFilter creates the lookup table from the stops, which must
+// be sorted by position. Luminance values outside the stops get the color of
+// the closest one.
+func newGradientMapFilter(stops []gradientStop) gradientMapFilter {
+	var f gradientMapFilter
+	j := 0
+	for i := range f.lut {
+		pos := float64(i) / 255 * 100
+		for j < len(stops)-2 && pos > stops[j+1].pos {
+			j++
+		}
+		a, b := stops[j], stops[j+1]
+		var t float64
+		if b.pos > a.pos {
+			t = (pos - a.pos) / (b.pos - a.pos)
+		}
+		if t < 0 {
+			t = 0
+		} else if t > 1 {
+			t = 1
+		}
+		lerp := func(x, y uint8) float32 {
+			return float32((float64(x) + (float64(y)-float64(x))*t) / 255)
+		}
+		f.lut[i] = [3]float32{lerp(a.color.R, b.color.R), lerp(a.color.G, b.color.G), lerp(a.color.B, b.color.B)}
+	}
+	return f
+}
+
+func (f gradientMapFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	gift.ColorFunc(func(r, g, b, a float32) (float32, float32, float32, float32) {
+		// The same weights as the grayscale filter.
+		l := 0.299*r + 0.587*g + 0.114*b
+		i := int(l*255 + 0.5)
+		if i < 0 {
+			i = 0
+		} else if i > 255 {
+			i = 255
+		}
+		c := f.lut[i]
+		return c[0], c[1], c[2], a
+	}).Draw(dst, src, options)
+}
+
+func (f gradientMapFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
+
+// parseGradientStops parses the stops of a gradient map, each a position in
+// range 0-100 and a color, e.g. []interface{}{50, "#ff0000"}.
+func parseGradientStops(stops []interface{}) ([]gradientStop, error) {
+	if len(stops) < 2 {
+		return nil, errors.New("a gradient map needs at least two stops")
+	}
+
+	parsed := make([]gradientStop, len(stops))
+	for i, stop := range stops {
+		v := reflect.ValueOf(stop)
+		if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Len() != 2 {
+			return nil, fmt.Errorf("invalid gradient stop %v, must be a position and a color", stop)
+		}
+
+		pos, err := cast.ToFloat64E(v.Index(0).Interface())
+		if err != nil || pos < 0 || pos > 100 {
+			return nil, fmt.Errorf("invalid gradient stop position %v, must be in range 0 to 100", v.Index(0).Interface())
+		}
+		if i > 0 && pos < parsed[i-1].pos {
+			return nil, errors.New("the gradient stops must be sorted by position")
+		}
+
+		c, err := ParseColor(cast.ToString(v.Index(1).Interface()))
+		if err != nil {
+			return nil, err
+		}
+
+		parsed[i] = gradientStop{pos: pos, color: color.NRGBAModel.Convert(c).(color.NRGBA)}
+	}
+
+	return parsed, nil
+}
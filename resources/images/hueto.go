@@ -0,0 +1,98 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*hueToFilter)(nil)
+
+// hueToFilter rotates the hue of an image so its dominant hue ends up at the
+// hue of the target color.
+type hueToFilter struct {
+	// The target hue in degrees.
+	hue float64
+}
+
+func newHueToFilter(hue float64) hueToFilter {
+	return hueToFilter{hue: hue}
+}
+
+func (f hueToFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	var shift float64
+	// The estimate is sampled, so this is cheap even for large images.
+	if mean, ok := estimateMeanHue(src); ok {
+		shift = math.Mod(f.hue-mean+540, 360) - 180
+	}
+	gift.Hue(float32(shift)).Draw(dst, src, options)
+}
+
+func (f hueToFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
+
+// estimateMeanHue returns the circular mean of the hues in src in degrees,
+// weighted by chroma and alpha so grays and transparent pixels don't count.
+// Large images are sampled. It returns false if src has no color.
+func estimateMeanHue(src image.Image) (float64, bool) {
+	const maxSamples = 256
+
+	b := src.Bounds()
+	stepX, stepY := b.Dx()/maxSamples+1, b.Dy()/maxSamples+1
+
+	var sumX, sumY float64
+	for y := b.Min.Y; y < b.Max.Y; y += stepY {
+		for x := b.Min.X; x < b.Max.X; x += stepX {
+			r, g, b, a := nrgbaFloats(src.At(x, y))
+			h, chroma := hueAndChroma(float64(r), float64(g), float64(b))
+			w := chroma * float64(a)
+			sumX += w * math.Cos(h*math.Pi/180)
+			sumY += w * math.Sin(h*math.Pi/180)
+		}
+	}
+
+	if math.Hypot(sumX, sumY) < 1e-6 {
+		return 0, false
+	}
+
+	return math.Mod(math.Atan2(sumY, sumX)*180/math.Pi+360, 360), true
+}
+
+// hueAndChroma returns the HSL hue in degrees (0-360) and the chroma of the
+// given color with components in range 0-1.
+func hueAndChroma(r, g, b float64) (float64, float64) {
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	chroma := max - min
+	if chroma == 0 {
+		return 0, 0
+	}
+
+	var h float64
+	switch max {
+	case r:
+		h = math.Mod((g-b)/chroma+6, 6)
+	case g:
+		h = (b-r)/chroma + 2
+	default:
+		h = (r-g)/chroma + 4
+	}
+
+	return h * 60, chroma
+}
@@ -0,0 +1,542 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// This file implements a lossless rewrite of baseline JPEG files with
+// Huffman tables optimized for the image at hand, the equivalent of
+// libjpeg's -optimize. The standard library's encoder always uses the
+// example tables from the JPEG specification.
+
+const (
+	jpegSOF0 = 0xc0
+	jpegDHT  = 0xc4
+	jpegSOI  = 0xd8
+	jpegEOI  = 0xd9
+	jpegSOS  = 0xda
+	jpegDRI  = 0xdd
+)
+
+type jpegSegment struct {
+	marker byte
+	data   []byte
+}
+
+type jpegComponent struct {
+	id   byte
+	h, v int
+}
+
+// huffmanTable is a JPEG Huffman table as stored in a DHT segment.
+type huffmanTable struct {
+	// counts[i] is the number of codes of length i+1.
+	counts [16]int
+	values []byte
+}
+
+type huffmanCode struct {
+	code uint32
+	size uint8
+}
+
+func (t huffmanTable) codes() map[byte]huffmanCode {
+	m := make(map[byte]huffmanCode)
+	code, k := uint32(0), 0
+	for i, n := range t.counts {
+		for j := 0; j < n; j++ {
+			m[t.values[k]] = huffmanCode{code: code, size: uint8(i + 1)}
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return m
+}
+
+// huffmanSymbol is a decoded Huffman symbol with its trailing extra bits.
+type huffmanSymbol struct {
+	table int // class<<4 | id, as in DHT.
+	value byte
+	bits  uint16
+	nbits uint8
+}
+
+// optimizeJPEGHuffman rewrites the baseline JPEG in b using Huffman tables
+// built from its own symbol statistics. Images it does not know how to
+// handle (progressive, restart intervals etc.) are returned unchanged.
+func optimizeJPEGHuffman(b []byte) ([]byte, error) {
+	segments, scan, err := parseJPEGSegments(b)
+	if err != nil {
+		return nil, err
+	}
+	if scan == nil {
+		return b, nil
+	}
+
+	var (
+		width, height int
+		components    []jpegComponent
+		tables        = make(map[int]huffmanTable)
+		sos           []byte
+	)
+
+	for _, s := range segments {
+		switch {
+		case s.marker == jpegSOF0:
+			if len(s.data) < 6 {
+				return nil, errors.New("invalid SOF0 segment")
+			}
+			height = int(binary.BigEndian.Uint16(s.data[1:]))
+			width = int(binary.BigEndian.Uint16(s.data[3:]))
+			n := int(s.data[5])
+			if len(s.data) < 6+n*3 {
+				return nil, errors.New("invalid SOF0 segment")
+			}
+			for i := 0; i < n; i++ {
+				c := s.data[6+i*3:]
+				components = append(components, jpegComponent{id: c[0], h: int(c[1] >> 4), v: int(c[1] & 0x0f)})
+			}
+		case s.marker == jpegDHT:
+			if err := parseDHT(s.data, tables); err != nil {
+				return nil, err
+			}
+		case s.marker == jpegSOS:
+			if sos != nil {
+				// More than one scan.
+				return b, nil
+			}
+			sos = s.data
+		case s.marker == jpegDRI, s.marker >= 0xc1 && s.marker <= 0xcf && s.marker != jpegDHT && s.marker != 0xc8 && s.marker != 0xcc:
+			// Restart intervals or not baseline.
+			return b, nil
+		}
+	}
+
+	if sos == nil || len(components) == 0 || width == 0 || height == 0 {
+		return b, nil
+	}
+
+	// The scan's components with their DC and AC tables.
+	type scanComponent struct {
+		jpegComponent
+		dc, ac int
+	}
+	var scanComponents []scanComponent
+	ns := int(sos[0])
+	if len(sos) < 1+ns*2 {
+		return nil, errors.New("invalid SOS segment")
+	}
+	for i := 0; i < ns; i++ {
+		id, sel := sos[1+i*2], sos[2+i*2]
+		var comp *jpegComponent
+		for j := range components {
+			if components[j].id == id {
+				comp = &components[j]
+			}
+		}
+		if comp == nil {
+			return nil, errors.New("invalid SOS component")
+		}
+		scanComponents = append(scanComponents, scanComponent{jpegComponent: *comp, dc: int(sel >> 4), ac: 0x10 | int(sel&0x0f)})
+	}
+
+	if ns != len(components) {
+		// Not interleaved; the stdlib always writes all components in one scan.
+		return b, nil
+	}
+
+	hmax, vmax := 1, 1
+	for _, c := range components {
+		if c.h > hmax {
+			hmax = c.h
+		}
+		if c.v > vmax {
+			vmax = c.v
+		}
+	}
+	mcusX := (width + 8*hmax - 1) / (8 * hmax)
+	mcusY := (height + 8*vmax - 1) / (8 * vmax)
+	if ns == 1 {
+		// A single component scan is not interleaved and has one block per MCU.
+		mcusX, mcusY = (width+7)/8, (height+7)/8
+		scanComponents[0].h, scanComponents[0].v = 1, 1
+	}
+
+	decoders := make(map[int]map[huffmanCode]byte)
+	for id, t := range tables {
+		m := make(map[huffmanCode]byte)
+		for v, c := range t.codes() {
+			m[c] = v
+		}
+		decoders[id] = m
+	}
+
+	r := &jpegBitReader{data: scan}
+	var symbols []huffmanSymbol
+
+	decodeSymbol := func(table int) (huffmanSymbol, error) {
+		dec, found := decoders[table]
+		if !found {
+			return huffmanSymbol{}, errors.New("missing Huffman table")
+		}
+		var code uint32
+		for size := uint8(1); size <= 16; size++ {
+			bit, err := r.readBit()
+			if err != nil {
+				return huffmanSymbol{}, err
+			}
+			code = code<<1 | bit
+			if v, found := dec[huffmanCode{code: code, size: size}]; found {
+				s := huffmanSymbol{table: table, value: v}
+				if table < 0x10 {
+					s.nbits = v
+				} else {
+					s.nbits = v & 0x0f
+				}
+				if s.nbits > 0 {
+					bits, err := r.readBits(s.nbits)
+					if err != nil {
+						return huffmanSymbol{}, err
+					}
+					s.bits = uint16(bits)
+				}
+				return s, nil
+			}
+		}
+		return huffmanSymbol{}, errors.New("invalid Huffman code")
+	}
+
+	for mcu := 0; mcu < mcusX*mcusY; mcu++ {
+		for _, c := range scanComponents {
+			for blk := 0; blk < c.h*c.v; blk++ {
+				s, err := decodeSymbol(c.dc)
+				if err != nil {
+					return nil, err
+				}
+				symbols = append(symbols, s)
+				for k := 1; k < 64; {
+					s, err := decodeSymbol(c.ac)
+					if err != nil {
+						return nil, err
+					}
+					symbols = append(symbols, s)
+					run, size := int(s.value>>4), s.value&0x0f
+					if size == 0 {
+						if run != 15 {
+							// End of block.
+							break
+						}
+						k += 16
+						continue
+					}
+					k += run + 1
+				}
+			}
+		}
+	}
+
+	// Build the new tables from the symbol frequencies.
+	freqs := make(map[int]*[257]int)
+	for _, s := range symbols {
+		f, found := freqs[s.table]
+		if !found {
+			f = &[257]int{}
+			freqs[s.table] = f
+		}
+		f[s.value]++
+	}
+
+	var ids []int
+	for id := range freqs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var dht bytes.Buffer
+	encoders := make(map[int]map[byte]huffmanCode)
+	for _, id := range ids {
+		t := buildHuffmanTable(freqs[id])
+		encoders[id] = t.codes()
+		dht.WriteByte(byte(id))
+		for _, n := range t.counts {
+			dht.WriteByte(byte(n))
+		}
+		dht.Write(t.values)
+	}
+
+	w := &jpegBitWriter{}
+	for _, s := range symbols {
+		c := encoders[s.table][s.value]
+		w.writeBits(c.code, c.size)
+		if s.nbits > 0 {
+			w.writeBits(uint32(s.bits), s.nbits)
+		}
+	}
+	w.flush()
+
+	var out bytes.Buffer
+	out.Write([]byte{0xff, jpegSOI})
+	for _, s := range segments {
+		if s.marker == jpegDHT {
+			continue
+		}
+		if s.marker == jpegSOS {
+			writeJPEGSegment(&out, jpegDHT, dht.Bytes())
+		}
+		writeJPEGSegment(&out, s.marker, s.data)
+	}
+	out.Write(w.buf.Bytes())
+	out.Write([]byte{0xff, jpegEOI})
+
+	return out.Bytes(), nil
+}
+
+// parseJPEGSegments returns the segments up to and including the (first)
+// SOS and the entropy coded data following it.
+func parseJPEGSegments(b []byte) ([]jpegSegment, []byte, error) {
+	if len(b) < 4 || b[0] != 0xff || b[1] != jpegSOI {
+		return nil, nil, errors.New("invalid JPEG")
+	}
+	var segments []jpegSegment
+	pos := 2
+	for {
+		if pos+4 > len(b) || b[pos] != 0xff {
+			return nil, nil, errors.New("invalid JPEG marker")
+		}
+		marker := b[pos+1]
+		length := int(binary.BigEndian.Uint16(b[pos+2:]))
+		if length < 2 || pos+2+length > len(b) {
+			return nil, nil, errors.New("invalid JPEG segment")
+		}
+		segments = append(segments, jpegSegment{marker: marker, data: b[pos+4 : pos+2+length]})
+		pos += 2 + length
+		if marker == jpegSOS {
+			break
+		}
+	}
+
+	// The entropy coded data ends at the first marker that is not a
+	// stuffed 0x00 (or a restart marker, which we do not support).
+	end := pos
+	for ; end+1 < len(b); end++ {
+		if b[end] == 0xff && b[end+1] != 0 {
+			break
+		}
+	}
+	if end+1 >= len(b) || b[end+1] != jpegEOI || end+2 != len(b) {
+		// More scans or trailing data.
+		return segments, nil, nil
+	}
+
+	return segments, b[pos:end], nil
+}
+
+func parseDHT(data []byte, tables map[int]huffmanTable) error {
+	for len(data) > 0 {
+		if len(data) < 17 {
+			return errors.New("invalid DHT segment")
+		}
+		var t huffmanTable
+		total := 0
+		for i := 0; i < 16; i++ {
+			t.counts[i] = int(data[1+i])
+			total += t.counts[i]
+		}
+		if len(data) < 17+total {
+			return errors.New("invalid DHT segment")
+		}
+		t.values = data[17 : 17+total]
+		tables[int(data[0])] = t
+		data = data[17+total:]
+	}
+	return nil
+}
+
+func writeJPEGSegment(buf *bytes.Buffer, marker byte, data []byte) {
+	buf.Write([]byte{0xff, marker})
+	binary.Write(buf, binary.BigEndian, uint16(len(data)+2))
+	buf.Write(data)
+}
+
+// buildHuffmanTable builds an optimal table limited to 16 bit codes from
+// the symbol frequencies, using the procedure in Annex K.2 of the JPEG
+// specification. freq[256] is reserved to make sure that no symbol gets
+// a code with all ones.
+func buildHuffmanTable(freq *[257]int) huffmanTable {
+	var f [257]int
+	copy(f[:], freq[:])
+	f[256] = 1
+
+	var codesize [257]int
+	var others [257]int
+	for i := range others {
+		others[i] = -1
+	}
+
+	for {
+		// Find the two least frequent, with the larger index winning ties.
+		c1, c2 := -1, -1
+		for i := range f {
+			if f[i] == 0 {
+				continue
+			}
+			if c1 == -1 || f[i] <= f[c1] {
+				c1 = i
+			}
+		}
+		for i := range f {
+			if f[i] == 0 || i == c1 {
+				continue
+			}
+			if c2 == -1 || f[i] <= f[c2] {
+				c2 = i
+			}
+		}
+		if c2 == -1 {
+			break
+		}
+
+		f[c1] += f[c2]
+		f[c2] = 0
+
+		codesize[c1]++
+		for others[c1] != -1 {
+			c1 = others[c1]
+			codesize[c1]++
+		}
+		others[c1] = c2
+
+		codesize[c2]++
+		for others[c2] != -1 {
+			c2 = others[c2]
+			codesize[c2]++
+		}
+	}
+
+	var bits [33]int
+	for i := range codesize {
+		if codesize[i] > 0 {
+			bits[codesize[i]]++
+		}
+	}
+
+	// Limit the code lengths to 16 bits.
+	for i := 32; i > 16; i-- {
+		for bits[i] > 0 {
+			j := i - 2
+			for bits[j] == 0 {
+				j--
+			}
+			bits[i] -= 2
+			bits[i-1]++
+			bits[j+1] += 2
+			bits[j]--
+		}
+	}
+
+	// Remove the reserved code.
+	i := 16
+	for bits[i] == 0 {
+		i--
+	}
+	bits[i]--
+
+	var t huffmanTable
+	for i := 0; i < 16; i++ {
+		t.counts[i] = bits[i+1]
+	}
+	for size := 1; size <= 32; size++ {
+		for sym := 0; sym < 256; sym++ {
+			if codesize[sym] == size {
+				t.values = append(t.values, byte(sym))
+			}
+		}
+	}
+
+	return t
+}
+
+type jpegBitReader struct {
+	data  []byte
+	pos   int
+	cur   byte
+	nbits uint8
+}
+
+func (r *jpegBitReader) readBit() (uint32, error) {
+	if r.nbits == 0 {
+		if r.pos >= len(r.data) {
+			return 0, errors.New("unexpected end of JPEG data")
+		}
+		r.cur = r.data[r.pos]
+		r.pos++
+		if r.cur == 0xff {
+			// Skip the stuffed zero.
+			r.pos++
+		}
+		r.nbits = 8
+	}
+	r.nbits--
+	return uint32(r.cur>>r.nbits) & 1, nil
+}
+
+func (r *jpegBitReader) readBits(n uint8) (uint32, error) {
+	var v uint32
+	for i := uint8(0); i < n; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | bit
+	}
+	return v, nil
+}
+
+type jpegBitWriter struct {
+	buf   bytes.Buffer
+	cur   uint32
+	nbits uint8
+}
+
+func (w *jpegBitWriter) writeBits(v uint32, n uint8) {
+	for i := int(n) - 1; i >= 0; i-- {
+		w.cur = w.cur<<1 | (v>>uint(i))&1
+		w.nbits++
+		if w.nbits == 8 {
+			w.emit()
+		}
+	}
+}
+
+func (w *jpegBitWriter) emit() {
+	b := byte(w.cur)
+	w.buf.WriteByte(b)
+	if b == 0xff {
+		w.buf.WriteByte(0)
+	}
+	w.cur, w.nbits = 0, 0
+}
+
+// flush pads the last byte with 1 bits.
+func (w *jpegBitWriter) flush() {
+	for w.nbits > 0 {
+		w.writeBits(1, 1)
+	}
+}
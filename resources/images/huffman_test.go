@@ -0,0 +1,61 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestOptimizeJPEGHuffman(t *testing.T) {
+	c := qt.New(t)
+
+	rgba := image.NewRGBA(image.Rect(0, 0, 67, 43))
+	gray := image.NewGray(rgba.Bounds())
+	for y := 0; y < 43; y++ {
+		for x := 0; x < 67; x++ {
+			rgba.Set(x, y, color.RGBA{uint8(x * 3), uint8(y * 5), uint8((x * y) % 256), 255})
+			gray.Set(x, y, color.Gray{uint8((x*7 + y*3) % 256)})
+		}
+	}
+
+	for _, src := range []image.Image{rgba, gray} {
+		var buf bytes.Buffer
+		c.Assert(jpeg.Encode(&buf, src, &jpeg.Options{Quality: 80}), qt.IsNil)
+
+		optimized, err := optimizeJPEGHuffman(buf.Bytes())
+		c.Assert(err, qt.IsNil)
+		c.Assert(len(optimized) < buf.Len(), qt.Equals, true, qt.Commentf("%d => %d", buf.Len(), len(optimized)))
+
+		// This is a lossless operation.
+		img1, err := jpeg.Decode(bytes.NewReader(buf.Bytes()))
+		c.Assert(err, qt.IsNil)
+		img2, err := jpeg.Decode(bytes.NewReader(optimized))
+		c.Assert(err, qt.IsNil)
+		c.Assert(img2.Bounds(), qt.Equals, img1.Bounds())
+		for y := 0; y < 43; y++ {
+			for x := 0; x < 67; x++ {
+				c.Assert(img2.At(x, y), qt.Equals, img1.At(x, y))
+			}
+		}
+	}
+
+	_, err := optimizeJPEGHuffman([]byte("foo"))
+	c.Assert(err, qt.Not(qt.IsNil))
+}
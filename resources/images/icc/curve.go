@@ -0,0 +1,119 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// curve is a tone reproduction curve mapping encoded values to linear light,
+// both in the range [0, 1].
+type curve struct {
+	// A sampled curve.
+	table []float64
+
+	// A parametric curve, see the parametricCurveType in the ICC spec.
+	funcType int
+	params   [7]float64
+}
+
+// The number of parameters for each of the parametric function types.
+var parametricParams = []int{1, 3, 4, 5, 7}
+
+func parseCurve(b []byte) (curve, error) {
+	if len(b) < 12 {
+		return curve{}, errors.New("too short")
+	}
+
+	switch string(b[:4]) {
+	case "curv":
+		count := int(binary.BigEndian.Uint32(b[8:]))
+		if len(b) < 12+count*2 {
+			return curve{}, errors.New("too short")
+		}
+		switch count {
+		case 0:
+			// Identity.
+			return curve{params: [7]float64{1}}, nil
+		case 1:
+			// A gamma value in u8Fixed8Number.
+			gamma := float64(binary.BigEndian.Uint16(b[12:])) / 256
+			return curve{params: [7]float64{gamma}}, nil
+		default:
+			table := make([]float64, count)
+			for i := range table {
+				table[i] = float64(binary.BigEndian.Uint16(b[12+i*2:])) / 0xffff
+			}
+			return curve{table: table}, nil
+		}
+	case "para":
+		funcType := int(binary.BigEndian.Uint16(b[8:]))
+		if funcType >= len(parametricParams) {
+			return curve{}, fmt.Errorf("unknown function type %d", funcType)
+		}
+		n := parametricParams[funcType]
+		if len(b) < 12+n*4 {
+			return curve{}, errors.New("too short")
+		}
+		c := curve{funcType: funcType}
+		for i := 0; i < n; i++ {
+			c.params[i] = s15Fixed16(b[12+i*4:])
+		}
+		return c, nil
+	}
+
+	return curve{}, fmt.Errorf("unsupported curve type %q", b[:4])
+}
+
+func (c curve) apply(x float64) float64 {
+	if c.table != nil {
+		pos := x * float64(len(c.table)-1)
+		i := int(pos)
+		if i >= len(c.table)-1 {
+			return c.table[len(c.table)-1]
+		}
+		frac := pos - float64(i)
+		return c.table[i]*(1-frac) + c.table[i+1]*frac
+	}
+
+	g, a, b, cc, d, e, f := c.params[0], c.params[1], c.params[2], c.params[3], c.params[4], c.params[5], c.params[6]
+
+	switch c.funcType {
+	case 1:
+		if x >= -b/a {
+			return math.Pow(a*x+b, g)
+		}
+		return 0
+	case 2:
+		if x >= -b/a {
+			return math.Pow(a*x+b, g) + cc
+		}
+		return cc
+	case 3:
+		if x >= d {
+			return math.Pow(a*x+b, g)
+		}
+		return cc * x
+	case 4:
+		if x >= d {
+			return math.Pow(a*x+b, g) + e
+		}
+		return cc*x + f
+	default:
+		return math.Pow(x, g)
+	}
+}
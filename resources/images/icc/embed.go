@@ -0,0 +1,93 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// EmbedJPEG returns the JPEG image b with the given ICC profile embedded
+// in APP2 segments, split in chunks if needed.
+func EmbedJPEG(b, profile []byte) ([]byte, error) {
+	const (
+		iccMarker = "ICC_PROFILE\x00"
+		maxChunk  = 0xffff - 2 - len(iccMarker) - 2
+	)
+
+	if len(b) < 2 || b[0] != 0xff || b[1] != 0xd8 {
+		return nil, errors.New("icc: invalid JPEG")
+	}
+
+	count := (len(profile) + maxChunk - 1) / maxChunk
+	if count > 255 {
+		return nil, errors.New("icc: profile too large")
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(b) + len(profile) + count*18)
+	buf.Write(b[:2])
+	for i := 0; i < count; i++ {
+		chunk := profile[i*maxChunk:]
+		if len(chunk) > maxChunk {
+			chunk = chunk[:maxChunk]
+		}
+		buf.Write([]byte{0xff, 0xe2})
+		binary.Write(&buf, binary.BigEndian, uint16(2+len(iccMarker)+2+len(chunk)))
+		buf.WriteString(iccMarker)
+		buf.Write([]byte{byte(i + 1), byte(count)})
+		buf.Write(chunk)
+	}
+	buf.Write(b[2:])
+
+	return buf.Bytes(), nil
+}
+
+// EmbedPNG returns the PNG image b with the given ICC profile embedded
+// in an iCCP chunk.
+func EmbedPNG(b, profile []byte) ([]byte, error) {
+	const (
+		magic = "\x89PNG\r\n\x1a\n"
+		// The signature and the IHDR chunk, which must come first.
+		ihdrEnd = 8 + 8 + 13 + 4
+	)
+
+	if len(b) < ihdrEnd || string(b[:8]) != magic || string(b[12:16]) != "IHDR" {
+		return nil, errors.New("icc: invalid PNG")
+	}
+
+	var data bytes.Buffer
+	data.WriteString("iCCP")
+	data.WriteString("sRGB\x00\x00")
+	zw := zlib.NewWriter(&data)
+	if _, err := zw.Write(profile); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(b) + data.Len() + 8)
+	buf.Write(b[:ihdrEnd])
+	binary.Write(&buf, binary.BigEndian, uint32(data.Len()-4))
+	buf.Write(data.Bytes())
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(data.Bytes()))
+	buf.Write(b[ihdrEnd:])
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,349 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package icc provides a minimal reader for ICC color profiles embedded in
+// JPEG and PNG images and conversion of matrix/TRC based RGB profiles
+// (e.g. Display P3 or Adobe RGB) to sRGB.
+package icc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+)
+
+// Profile is a matrix/TRC RGB color profile.
+type Profile struct {
+	// The columns are the red, green and blue colorants in PCS XYZ (D50).
+	matrix [3][3]float64
+	curves [3]curve
+}
+
+// ErrUnsupportedProfile is returned for profiles that are not an RGB
+// matrix/TRC profile.
+var ErrUnsupportedProfile = errors.New("icc: unsupported profile")
+
+// The sRGB colorants adapted to D50, as found in the sRGB IEC61966-2.1 profile.
+var srgbMatrix = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+var srgbInverse = invert(srgbMatrix)
+
+// Extract returns the raw ICC profile embedded in the JPEG or PNG image
+// read from r, nil if none found.
+func Extract(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(8)
+	if err != nil {
+		return nil, nil
+	}
+
+	switch {
+	case magic[0] == 0xff && magic[1] == 0xd8:
+		return extractJPEG(br)
+	case string(magic) == "\x89PNG\r\n\x1a\n":
+		return extractPNG(br)
+	}
+
+	return nil, nil
+}
+
+func extractJPEG(r *bufio.Reader) ([]byte, error) {
+	const iccMarker = "ICC_PROFILE\x00"
+
+	if _, err := r.Discard(2); err != nil {
+		return nil, err
+	}
+
+	chunks := make(map[int][]byte)
+
+	for {
+		var marker [2]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			return nil, err
+		}
+		if marker[0] != 0xff {
+			return nil, errors.New("icc: invalid JPEG marker")
+		}
+		if marker[1] == 0xda || marker[1] == 0xd9 {
+			// Start of scan or end of image, the profile must come before that.
+			break
+		}
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		if length < 2 {
+			return nil, errors.New("icc: invalid JPEG segment length")
+		}
+		data := make([]byte, length-2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		if marker[1] == 0xe2 && len(data) > len(iccMarker)+2 && string(data[:len(iccMarker)]) == iccMarker {
+			seq := int(data[len(iccMarker)])
+			chunks[seq] = data[len(iccMarker)+2:]
+		}
+	}
+
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+
+	var seqs []int
+	for seq := range chunks {
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+
+	var b []byte
+	for _, seq := range seqs {
+		b = append(b, chunks[seq]...)
+	}
+
+	return b, nil
+}
+
+func extractPNG(r *bufio.Reader) ([]byte, error) {
+	if _, err := r.Discard(8); err != nil {
+		return nil, err
+	}
+
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+		typ := string(header[4:])
+
+		if typ == "IDAT" || typ == "IEND" {
+			// The profile must come before the image data.
+			return nil, nil
+		}
+
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		// Skip the CRC.
+		if _, err := r.Discard(4); err != nil {
+			return nil, err
+		}
+
+		if typ != "iCCP" {
+			continue
+		}
+
+		// Profile name, null separator, compression method, compressed profile.
+		idx := bytes.IndexByte(data, 0)
+		if idx == -1 || idx+2 > len(data) {
+			return nil, errors.New("icc: invalid iCCP chunk")
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(data[idx+2:]))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return ioutil.ReadAll(zr)
+	}
+}
+
+// Parse parses the given ICC profile.
+func Parse(b []byte) (*Profile, error) {
+	if len(b) < 132 || string(b[36:40]) != "acsp" {
+		return nil, errors.New("icc: invalid profile")
+	}
+	if string(b[16:20]) != "RGB " || string(b[20:24]) != "XYZ " {
+		return nil, ErrUnsupportedProfile
+	}
+
+	tags := make(map[string][]byte)
+	count := int(binary.BigEndian.Uint32(b[128:]))
+	for i := 0; i < count; i++ {
+		pos := 132 + i*12
+		if pos+12 > len(b) {
+			return nil, errors.New("icc: invalid tag table")
+		}
+		sig := string(b[pos : pos+4])
+		offset := int(binary.BigEndian.Uint32(b[pos+4:]))
+		size := int(binary.BigEndian.Uint32(b[pos+8:]))
+		if offset < 0 || size < 0 || offset+size > len(b) {
+			return nil, fmt.Errorf("icc: invalid tag %q", sig)
+		}
+		tags[sig] = b[offset : offset+size]
+	}
+
+	var p Profile
+
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		data, found := tags[sig]
+		if !found {
+			return nil, ErrUnsupportedProfile
+		}
+		if len(data) < 20 || string(data[:4]) != "XYZ " {
+			return nil, fmt.Errorf("icc: invalid %s tag", sig)
+		}
+		for j := 0; j < 3; j++ {
+			p.matrix[j][i] = s15Fixed16(data[8+j*4:])
+		}
+	}
+
+	for i, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		data, found := tags[sig]
+		if !found {
+			return nil, ErrUnsupportedProfile
+		}
+		c, err := parseCurve(data)
+		if err != nil {
+			return nil, fmt.Errorf("icc: invalid %s tag: %s", sig, err)
+		}
+		p.curves[i] = c
+	}
+
+	return &p, nil
+}
+
+// IsSRGB reports whether this profile is, for all practical purposes, sRGB.
+func (p *Profile) IsSRGB() bool {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if math.Abs(p.matrix[i][j]-srgbMatrix[i][j]) > 0.002 {
+				return false
+			}
+		}
+	}
+	for _, c := range p.curves {
+		for _, v := range []float64{0.02, 0.2, 0.5, 0.8} {
+			if math.Abs(c.apply(v)-srgbToLinear(v)) > 0.002 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ToSRGB converts img from this profile to sRGB.
+func (p *Profile) ToSRGB(img image.Image) *image.NRGBA64 {
+	const lutSize = 4096
+
+	// Lookup tables from 16 bit values (with 12 bits precision) to linear
+	// light and from linear light back to sRGB encoded 16 bit values.
+	var toLinear [3][lutSize]float64
+	for i := range toLinear {
+		for j := 0; j < lutSize; j++ {
+			toLinear[i][j] = p.curves[i].apply(float64(j) / (lutSize - 1))
+		}
+	}
+	var fromLinear [lutSize]uint16
+	for j := 0; j < lutSize; j++ {
+		fromLinear[j] = uint16(math.Round(linearToSRGB(float64(j)/(lutSize-1)) * 0xffff))
+	}
+
+	m := multiply(srgbInverse, p.matrix)
+
+	encode := func(v float64) uint16 {
+		if v <= 0 {
+			return 0
+		}
+		if v >= 1 {
+			return 0xffff
+		}
+		return fromLinear[int(math.Round(v*(lutSize-1)))]
+	}
+
+	b := img.Bounds()
+	dst := image.NewNRGBA64(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			r := toLinear[0][int(c.R)>>4]
+			g := toLinear[1][int(c.G)>>4]
+			bl := toLinear[2][int(c.B)>>4]
+			dst.SetNRGBA64(x-b.Min.X, y-b.Min.Y, color.NRGBA64{
+				R: encode(m[0][0]*r + m[0][1]*g + m[0][2]*bl),
+				G: encode(m[1][0]*r + m[1][1]*g + m[1][2]*bl),
+				B: encode(m[2][0]*r + m[2][1]*g + m[2][2]*bl),
+				A: c.A,
+			})
+		}
+	}
+
+	return dst
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+func multiply(a, b [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+func invert(m [3][3]float64) [3][3]float64 {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+
+	return [3][3]float64{
+		{
+			(m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det,
+			(m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det,
+			(m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det,
+		},
+		{
+			(m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det,
+			(m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det,
+			(m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det,
+		},
+		{
+			(m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det,
+			(m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det,
+			(m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det,
+		},
+	}
+}
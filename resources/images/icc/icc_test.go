@@ -0,0 +1,159 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestExtractAndParse(t *testing.T) {
+	c := qt.New(t)
+
+	f, err := os.Open(filepath.FromSlash("../../testdata/displayp3.jpg"))
+	c.Assert(err, qt.IsNil)
+	b, err := Extract(f)
+	f.Close()
+	c.Assert(err, qt.IsNil)
+	c.Assert(b, qt.Not(qt.IsNil))
+
+	p, err := Parse(b)
+	c.Assert(err, qt.IsNil)
+	c.Assert(p.IsSRGB(), qt.Equals, false)
+	c.Assert(p.matrix[1][0], qt.Equals, 0.2411804199218750)
+	c.Assert(p.curves[0].funcType, qt.Equals, 3)
+
+	extract := func(filename string) []byte {
+		f, err := os.Open(filepath.FromSlash("../../testdata/" + filename))
+		c.Assert(err, qt.IsNil)
+		defer f.Close()
+		b, err := Extract(f)
+		c.Assert(err, qt.IsNil)
+		return b
+	}
+
+	// This has the common sRGB IEC61966-2.1 profile with sampled curves.
+	p, err = Parse(extract("sunset.jpg"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(p.curves[0].table, qt.HasLen, 1024)
+	c.Assert(p.IsSRGB(), qt.Equals, true)
+
+	c.Assert(extract("gohugoio.png"), qt.IsNil)
+
+	_, err = Parse([]byte("foo"))
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestToSRGB(t *testing.T) {
+	c := qt.New(t)
+
+	srgbCurve := curve{funcType: 3, params: [7]float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045}}
+	srgb := &Profile{matrix: srgbMatrix, curves: [3]curve{srgbCurve, srgbCurve, srgbCurve}}
+	c.Assert(srgb.IsSRGB(), qt.Equals, true)
+
+	p3 := &Profile{
+		matrix: [3][3]float64{
+			{0.515102, 0.291965, 0.157153},
+			{0.241182, 0.692236, 0.0665819},
+			{-0.00104941, 0.0418844, 0.784378},
+		},
+		curves: srgb.curves,
+	}
+
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{R: 200, G: 80, B: 40, A: 255})
+	src.SetNRGBA(1, 0, color.NRGBA{R: 128, G: 128, B: 128, A: 100})
+
+	toRGBA := func(c color.Color) color.NRGBA {
+		return color.NRGBAModel.Convert(c).(color.NRGBA)
+	}
+
+	// sRGB to sRGB is a no-op, give or take rounding.
+	dst := srgb.ToSRGB(src)
+	got := toRGBA(dst.At(0, 0))
+	c.Assert(got.R >= 199 && got.R <= 201 && got.G >= 79 && got.G <= 81 && got.B >= 39 && got.B <= 41, qt.Equals, true, qt.Commentf("%v", got))
+
+	// The P3 red is more saturated than sRGB allows.
+	dst = p3.ToSRGB(src)
+	got = toRGBA(dst.At(0, 0))
+	c.Assert(got.R > 200, qt.Equals, true, qt.Commentf("%v", got))
+	c.Assert(got.G < 80, qt.Equals, true, qt.Commentf("%v", got))
+
+	// Gray stays gray and the alpha is preserved.
+	got = toRGBA(dst.At(1, 0))
+	c.Assert(got.A, qt.Equals, uint8(100))
+	c.Assert(int(got.R)-int(got.B) < 2 && int(got.B)-int(got.R) < 2, qt.Equals, true, qt.Commentf("%v", got))
+}
+
+func TestSRGB(t *testing.T) {
+	c := qt.New(t)
+
+	b := SRGB()
+	c.Assert(len(b)%4, qt.Equals, 0)
+	c.Assert(int(binary.BigEndian.Uint32(b)), qt.Equals, len(b))
+	c.Assert(len(b) < 1024, qt.Equals, true)
+
+	p, err := Parse(b)
+	c.Assert(err, qt.IsNil)
+	c.Assert(p.IsSRGB(), qt.Equals, true)
+	c.Assert(p.curves[0].funcType, qt.Equals, 3)
+}
+
+func TestEmbed(t *testing.T) {
+	c := qt.New(t)
+
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+
+	var buf bytes.Buffer
+	c.Assert(jpeg.Encode(&buf, img, nil), qt.IsNil)
+	b, err := EmbedJPEG(buf.Bytes(), SRGB())
+	c.Assert(err, qt.IsNil)
+	extracted, err := Extract(bytes.NewReader(b))
+	c.Assert(err, qt.IsNil)
+	c.Assert(extracted, qt.DeepEquals, SRGB())
+	_, err = jpeg.Decode(bytes.NewReader(b))
+	c.Assert(err, qt.IsNil)
+
+	// A profile in more than one chunk.
+	large := bytes.Repeat([]byte("abcd"), 40000)
+	b, err = EmbedJPEG(buf.Bytes(), large)
+	c.Assert(err, qt.IsNil)
+	extracted, err = Extract(bytes.NewReader(b))
+	c.Assert(err, qt.IsNil)
+	c.Assert(extracted, qt.DeepEquals, large)
+
+	buf.Reset()
+	c.Assert(png.Encode(&buf, img), qt.IsNil)
+	b, err = EmbedPNG(buf.Bytes(), SRGB())
+	c.Assert(err, qt.IsNil)
+	extracted, err = Extract(bytes.NewReader(b))
+	c.Assert(err, qt.IsNil)
+	c.Assert(extracted, qt.DeepEquals, SRGB())
+	_, err = png.Decode(bytes.NewReader(b))
+	c.Assert(err, qt.IsNil)
+
+	_, err = EmbedJPEG(buf.Bytes(), SRGB())
+	c.Assert(err, qt.Not(qt.IsNil))
+	_, err = EmbedPNG([]byte("foo"), SRGB())
+	c.Assert(err, qt.Not(qt.IsNil))
+}
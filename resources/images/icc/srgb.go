@@ -0,0 +1,132 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package icc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sync"
+	"unicode/utf16"
+)
+
+var (
+	srgbProfileInit sync.Once
+	srgbProfile     []byte
+)
+
+// SRGB returns a compact ICC v4 sRGB profile, for embedding in images
+// without a profile. The returned slice must not be modified.
+func SRGB() []byte {
+	srgbProfileInit.Do(func() {
+		srgbProfile = buildSRGB()
+	})
+	return srgbProfile
+}
+
+func buildSRGB() []byte {
+	type tag struct {
+		sig  string
+		data []byte
+	}
+
+	xyz := func(x, y, z float64) []byte {
+		b := []byte("XYZ \x00\x00\x00\x00")
+		return append(b, fixed(x, y, z)...)
+	}
+
+	// The sRGB curve as a parametric function of type 3.
+	trc := []byte("para\x00\x00\x00\x00\x00\x03\x00\x00")
+	trc = append(trc, fixed(2.4, 1/1.055, 0.055/1.055, 1/12.92, 0.04045)...)
+
+	tags := []tag{
+		{"desc", mluc("sRGB")},
+		{"cprt", mluc("No copyright, use freely")},
+		{"wtpt", xyz(0.9642, 1, 0.8249)},
+		// Bradford adaptation from D65 to D50.
+		{"chad", append([]byte("sf32\x00\x00\x00\x00"), fixed(
+			1.0478112, 0.0228866, -0.0501270,
+			0.0295424, 0.9904844, -0.0170491,
+			-0.0092345, 0.0150436, 0.7521316)...)},
+		{"rXYZ", xyz(srgbMatrix[0][0], srgbMatrix[1][0], srgbMatrix[2][0])},
+		{"gXYZ", xyz(srgbMatrix[0][1], srgbMatrix[1][1], srgbMatrix[2][1])},
+		{"bXYZ", xyz(srgbMatrix[0][2], srgbMatrix[1][2], srgbMatrix[2][2])},
+		{"rTRC", trc},
+		{"gTRC", trc},
+		{"bTRC", trc},
+	}
+
+	// Tags with the same data, i.e. the TRC tags, share it.
+	offsets := make(map[string]int)
+
+	var table, data bytes.Buffer
+	start := 128 + 4 + len(tags)*12
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	for _, t := range tags {
+		offset, found := offsets[string(t.data)]
+		if !found {
+			offset = start + data.Len()
+			offsets[string(t.data)] = offset
+			data.Write(t.data)
+			data.Write(make([]byte, pad(len(t.data))))
+		}
+		table.WriteString(t.sig)
+		binary.Write(&table, binary.BigEndian, uint32(offset))
+		binary.Write(&table, binary.BigEndian, uint32(len(t.data)))
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(128+table.Len()+data.Len()))
+	binary.BigEndian.PutUint32(header[8:], 0x04300000)
+	copy(header[12:], "mntrRGB XYZ ")
+	// The creation date, 2019-01-01.
+	binary.BigEndian.PutUint16(header[24:], 2019)
+	binary.BigEndian.PutUint16(header[26:], 1)
+	binary.BigEndian.PutUint16(header[28:], 1)
+	copy(header[36:], "acsp")
+	// The D50 illuminant.
+	copy(header[68:], fixed(0.9642, 1, 0.8249))
+
+	return append(append(header, table.Bytes()...), data.Bytes()...)
+}
+
+// mluc returns a multiLocalizedUnicodeType tag with s in English.
+func mluc(s string) []byte {
+	text := utf16.Encode([]rune(s))
+	b := make([]byte, 28, 28+len(text)*2)
+	copy(b, "mluc")
+	binary.BigEndian.PutUint32(b[8:], 1)
+	binary.BigEndian.PutUint32(b[12:], 12)
+	copy(b[16:], "enUS")
+	binary.BigEndian.PutUint32(b[20:], uint32(len(text)*2))
+	binary.BigEndian.PutUint32(b[24:], 28)
+	for _, r := range text {
+		b = append(b, byte(r>>8), byte(r))
+	}
+	return b
+}
+
+// fixed encodes the values as s15Fixed16Number.
+func fixed(v ...float64) []byte {
+	b := make([]byte, len(v)*4)
+	for i, f := range v {
+		binary.BigEndian.PutUint32(b[i*4:], uint32(int32(math.Round(f*65536))))
+	}
+	return b
+}
+
+// pad returns the padding needed to align n to 4 bytes.
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
@@ -0,0 +1,176 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+
+	"github.com/disintegration/gift"
+)
+
+// The largest icon size an ICO file can hold.
+const maxICOSize = 256
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// ICOEntry is an image in the directory of an ICO file.
+type ICOEntry struct {
+	Width  int
+	Height int
+
+	// The data size and offset of the image in the file.
+	Size   int
+	Offset int
+}
+
+// encodeICO writes an ICO file with img resized to each of the given sizes.
+// The images are stored as PNG, which is supported by all current browsers
+// and by Windows since Vista.
+func encodeICO(w io.Writer, img image.Image, sizes []int, resampling gift.Resampling) error {
+	if len(sizes) == 0 {
+		return errors.New("no ICO sizes provided")
+	}
+	if resampling == nil {
+		resampling = gift.LanczosResampling
+	}
+
+	entries := make([][]byte, len(sizes))
+	for i, size := range sizes {
+		if size < 1 || size > maxICOSize {
+			return fmt.Errorf("ICO size must be in range 1 to %d, got %d", maxICOSize, size)
+		}
+		g := gift.New(gift.Resize(size, size, resampling))
+		dst := image.NewNRGBA(g.Bounds(img.Bounds()))
+		g.Draw(dst, img)
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, dst); err != nil {
+			return err
+		}
+		entries[i] = buf.Bytes()
+	}
+
+	// The header, followed by the directory and the image data.
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	binary.Write(&buf, le, [3]uint16{0, 1, uint16(len(entries))})
+
+	offset := 6 + 16*len(entries)
+	for i, size := range sizes {
+		// 0 means 256 pixels.
+		dim := uint8(size % maxICOSize)
+		buf.Write([]byte{dim, dim, 0, 0})
+		binary.Write(&buf, le, [2]uint16{1, 32})
+		binary.Write(&buf, le, [2]uint32{uint32(len(entries[i])), uint32(offset)})
+		offset += len(entries[i])
+	}
+
+	for _, e := range entries {
+		buf.Write(e)
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// DecodeICOEntries reads the directory of the ICO file in r.
+func DecodeICOEntries(r io.Reader) ([]ICOEntry, error) {
+	le := binary.LittleEndian
+
+	var header [3]uint16
+	if err := binary.Read(r, le, &header); err != nil {
+		return nil, err
+	}
+	if header[0] != 0 || header[1] != 1 || header[2] == 0 {
+		return nil, errors.New("not an ICO file")
+	}
+
+	entries := make([]ICOEntry, header[2])
+	for i := range entries {
+		var e struct {
+			Width, Height, Colors, Reserved uint8
+			Planes, BitCount                uint16
+			Size, Offset                    uint32
+		}
+		if err := binary.Read(r, le, &e); err != nil {
+			return nil, err
+		}
+		entries[i] = ICOEntry{
+			Width:  icoDimension(e.Width),
+			Height: icoDimension(e.Height),
+			Size:   int(e.Size),
+			Offset: int(e.Offset),
+		}
+	}
+
+	return entries, nil
+}
+
+// DecodeICOConfig returns the config of the largest image in the ICO file in r.
+func DecodeICOConfig(r io.Reader) (image.Config, error) {
+	entries, err := DecodeICOEntries(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	e := largestICOEntry(entries)
+	return image.Config{ColorModel: color.NRGBAModel, Width: e.Width, Height: e.Height}, nil
+}
+
+// DecodeICO decodes the largest image in the ICO file in r. Only PNG encoded
+// images are supported.
+func DecodeICO(r io.Reader) (image.Image, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := DecodeICOEntries(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	e := largestICOEntry(entries)
+	if e.Offset+e.Size > len(b) {
+		return nil, errors.New("invalid ICO image offset")
+	}
+	data := b[e.Offset : e.Offset+e.Size]
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("only PNG encoded ICO images are supported")
+	}
+
+	return png.Decode(bytes.NewReader(data))
+}
+
+func largestICOEntry(entries []ICOEntry) ICOEntry {
+	e := entries[0]
+	for _, ee := range entries[1:] {
+		if ee.Width*ee.Height > e.Width*e.Height {
+			e = ee
+		}
+	}
+	return e
+}
+
+func icoDimension(v uint8) int {
+	if v == 0 {
+		return maxICOSize
+	}
+	return int(v)
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/gift"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestEncodeICO(t *testing.T) {
+	c := qt.New(t)
+
+	src := image.NewNRGBA(image.Rect(0, 0, 300, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 300; x++ {
+			src.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	c.Assert(encodeICO(&buf, src, []int{16, 256}, gift.LinearResampling), qt.IsNil)
+	b := buf.Bytes()
+
+	// A width of 256 is stored as 0 in the directory.
+	c.Assert(b[6+16], qt.Equals, uint8(0))
+
+	entries, err := DecodeICOEntries(bytes.NewReader(b))
+	c.Assert(err, qt.IsNil)
+	c.Assert(entries, qt.HasLen, 2)
+	c.Assert(entries[0].Width, qt.Equals, 16)
+	c.Assert(entries[1].Width, qt.Equals, 256)
+	c.Assert(entries[1].Height, qt.Equals, 256)
+	c.Assert(entries[0].Offset, qt.Equals, 6+2*16)
+	c.Assert(entries[1].Offset, qt.Equals, entries[0].Offset+entries[0].Size)
+	c.Assert(entries[1].Offset+entries[1].Size, qt.Equals, len(b))
+
+	config, err := DecodeICOConfig(bytes.NewReader(b))
+	c.Assert(err, qt.IsNil)
+	c.Assert(config.Width, qt.Equals, 256)
+
+	img, err := DecodeICO(bytes.NewReader(b))
+	c.Assert(err, qt.IsNil)
+	c.Assert(img.Bounds(), qt.Equals, image.Rect(0, 0, 256, 256))
+
+	c.Assert(encodeICO(&buf, src, []int{512}, nil), qt.Not(qt.IsNil))
+	c.Assert(encodeICO(&buf, src, nil, nil), qt.Not(qt.IsNil))
+
+	_, err = DecodeICOEntries(bytes.NewReader([]byte("not an ICO")))
+	c.Assert(err, qt.Not(qt.IsNil))
+}
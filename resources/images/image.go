@@ -14,15 +14,23 @@
 package images
 
 import (
+	"bytes"
+	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"io"
+	"log"
 	"sync"
 
 	"github.com/gohugoio/hugo/resources/images/exif"
+	"github.com/gohugoio/hugo/resources/images/icc"
+	"github.com/gohugoio/hugo/resources/images/jpeg2000"
+	"github.com/gohugoio/hugo/resources/images/pnm"
+	"github.com/gohugoio/hugo/resources/images/qoi"
 
 	"github.com/disintegration/gift"
 	"golang.org/x/image/bmp"
@@ -57,7 +65,12 @@ type Image struct {
 	*imageConfig
 }
 
+// EncodeTo encodes img to w using i's format.
 func (i *Image) EncodeTo(conf ImageConfig, img image.Image, w io.Writer) error {
+	if conf.TagSRGB && (i.Format == JPEG || i.Format == PNG) {
+		return i.encodeTaggedSRGB(conf, img, w)
+	}
+
 	switch i.Format {
 	case JPEG:
 
@@ -74,9 +87,23 @@ func (i *Image) EncodeTo(conf ImageConfig, img image.Image, w io.Writer) error {
 			}
 		}
 		if rgba != nil {
-			return jpeg.Encode(w, rgba, &jpeg.Options{Quality: quality})
+			img = rgba
+		}
+
+		if !conf.OptimizeHuffman {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+		}
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return err
+		}
+		b, err := optimizeJPEGHuffman(buf.Bytes())
+		if err != nil {
+			return err
 		}
-		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+		_, err = w.Write(b)
+		return err
 	case PNG:
 		encoder := png.Encoder{CompressionLevel: png.DefaultCompression}
 		return encoder.Encode(w, img)
@@ -90,12 +117,46 @@ func (i *Image) EncodeTo(conf ImageConfig, img image.Image, w io.Writer) error {
 
 	case BMP:
 		return bmp.Encode(w, img)
+	case ICO:
+		return encodeICO(w, img, conf.ICOSizes, conf.Filter)
+	case QOI:
+		return qoi.Encode(w, img)
+	case PPM:
+		return pnm.Encode(w, img)
+	case PGM:
+		return pnm.EncodeGray(w, img)
 	default:
 		return errors.New("format not supported")
 	}
 
 }
 
+// encodeTaggedSRGB encodes img with an sRGB ICC profile embedded.
+func (i *Image) encodeTaggedSRGB(conf ImageConfig, img image.Image, w io.Writer) error {
+	conf.TagSRGB = false
+
+	var buf bytes.Buffer
+	if err := i.EncodeTo(conf, img, &buf); err != nil {
+		return err
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+	if i.Format == JPEG {
+		b, err = icc.EmbedJPEG(buf.Bytes(), icc.SRGB())
+	} else {
+		b, err = icc.EmbedPNG(buf.Bytes(), icc.SRGB())
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
 // Height returns i's height.
 func (i *Image) Height() int {
 	i.initConfig()
@@ -142,7 +203,7 @@ func (i *Image) initConfig() error {
 		}
 		defer f.Close()
 
-		config, _, err = image.DecodeConfig(f)
+		config, err = decodeConfig(f, i.Format)
 		if err != nil {
 			return
 		}
@@ -156,11 +217,39 @@ func (i *Image) initConfig() error {
 	return nil
 }
 
+// ColorInfo returns how the pixels of i are stored, read from the header
+// of the image file.
+func (i *Image) ColorInfo() (ColorInfo, error) {
+	if err := i.initConfig(); err != nil {
+		return ColorInfo{}, err
+	}
+	return newColorInfo(i.config.ColorModel), nil
+}
+
+// decodeConfig decodes the header of the image in format f read from r.
+func decodeConfig(r io.Reader, f Format) (image.Config, error) {
+	switch f {
+	case DNG:
+		return DecodeDNGPreviewConfig(r)
+	case ICO:
+		return DecodeICOConfig(r)
+	case JPEG2000:
+		return jpeg2000.DecodeConfig(r)
+	}
+	config, _, err := image.DecodeConfig(r)
+	return config, err
+}
+
+// autoSharpenSigma is the radius of the unsharp mask applied by the
+// autoSharpen option.
+const autoSharpenSigma = 0.8
+
 func NewImageProcessor(cfg Imaging) (*ImageProcessor, error) {
 	e := cfg.Exif
 	exifDecoder, err := exif.NewDecoder(
 		exif.WithDateDisabled(e.DisableDate),
 		exif.WithLatLongDisabled(e.DisableLatLong),
+		exif.WithMakerNoteDisabled(e.DisableMakerNote),
 		exif.ExcludeFields(e.ExcludeFields),
 		exif.IncludeFields(e.IncludeFields),
 	)
@@ -179,6 +268,18 @@ func NewImageProcessor(cfg Imaging) (*ImageProcessor, error) {
 type ImageProcessor struct {
 	Cfg         Imaging
 	exifDecoder *exif.Decoder
+
+	// Warn, if set, is used to log warnings, e.g. when a smart crop fails.
+	Warn *log.Logger
+
+	// Face regions detected for the faces anchor.
+	faces faceCache
+}
+
+func (p *ImageProcessor) warnf(format string, v ...interface{}) {
+	if p.Warn != nil {
+		p.Warn.Printf(format, v...)
+	}
 }
 
 func (p *ImageProcessor) DecodeExif(r io.Reader) (*exif.Exif, error) {
@@ -193,33 +294,116 @@ func (p *ImageProcessor) ApplyFiltersFromConfig(src image.Image, conf ImageConfi
 		filters = append(filters, gift.Rotate(float32(conf.Rotate), color.Transparent, gift.NearestNeighborInterpolation))
 	}
 
+	if conf.Multiple > 1 {
+		conf = conf.roundToMultiple(src.Bounds())
+	}
+
+	if conf.Dominant && conf.Action == "fill" {
+		// Only the dimensions matter, there is nothing to crop to.
+		conf.AnchorStr = ""
+	}
+
 	switch conf.Action {
 	case "resize":
 		filters = append(filters, gift.Resize(conf.Width, conf.Height, conf.Filter))
 	case "fill":
+		if conf.AnchorStr == facesCropIdentifier {
+			// The crop is applied after the rotation, so look for the
+			// faces in the rotated image.
+			faceSrc := src
+			if conf.Rotate != 0 {
+				g := gift.New(filters...)
+				rotated := image.NewNRGBA(g.Bounds(src.Bounds()))
+				g.Draw(rotated, src)
+				faceSrc = rotated
+			}
+			if bounds, ok := p.facesCrop(faceSrc, conf.Width, conf.Height, conf.facesKey(faceSrc.Bounds())); ok {
+				filters = append(filters, gift.Crop(bounds))
+				filters = append(filters, gift.Resize(conf.Width, conf.Height, conf.Filter))
+				break
+			}
+			// No faces found, fall back to smart cropping.
+			conf.AnchorStr = smartCropIdentifier
+		}
+
 		if conf.AnchorStr == smartCropIdentifier {
 			bounds, err := p.smartCrop(src, conf.Width, conf.Height, conf.Filter)
-			if err != nil {
-				return nil, err
+			if err == nil && bounds.Empty() {
+				err = errors.New("nothing to crop around")
+			}
+			if err == nil {
+				// First crop it, then resize it.
+				filters = append(filters, gift.Crop(bounds))
+				filters = append(filters, gift.Resize(conf.Width, conf.Height, conf.Filter))
+				break
 			}
 
-			// First crop it, then resize it.
-			filters = append(filters, gift.Crop(bounds))
-			filters = append(filters, gift.Resize(conf.Width, conf.Height, conf.Filter))
-
+			// Anchor is set to the smart crop fallback.
+			p.warnf("smart crop of %q failed, falling back to anchor %q: %s", conf.SourceFilename, conf.smartCropFallback(), err)
+			filters = append(filters, gift.ResizeToFill(conf.Width, conf.Height, conf.Filter, conf.Anchor))
 		} else {
 			filters = append(filters, gift.ResizeToFill(conf.Width, conf.Height, conf.Filter, conf.Anchor))
 		}
 	case "fit":
 		filters = append(filters, gift.ResizeToFit(conf.Width, conf.Height, conf.Filter))
+	case "pad":
+		filters = append(filters, padFilter{
+			width:      conf.Width,
+			height:     conf.Height,
+			anchor:     conf.Anchor,
+			color:      conf.BgColor,
+			resampling: conf.Filter,
+			noUpscale:  conf.NoUpscale,
+		})
 	default:
 		return nil, errors.Errorf("unsupported action: %q", conf.Action)
 	}
 
+	if conf.Sharpen > 0 {
+		filters = append(filters, gift.UnsharpMask(autoSharpenSigma, float32(conf.Sharpen), 0))
+	}
+
+	if conf.Dominant {
+		dst := image.NewNRGBA(gift.New(filters...).Bounds(src.Bounds()))
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(AverageColor(src)), image.Point{}, draw.Src)
+		return dst, nil
+	}
+
+	if conf.RGBA {
+		g := gift.New(filters...)
+		dst := image.NewNRGBA(g.Bounds(src.Bounds()))
+		g.Draw(dst, src)
+		return dst, nil
+	}
+
+	if conf.Depth == 16 {
+		return p.filter16(src, filters...)
+	}
+
 	return p.Filter(src, filters...)
 }
 
+// filter16 is like Filter, but keeps 16 bits per channel for 16 bit source
+// images, e.g. heightmaps. Other images are passed on to Filter.
+func (p *ImageProcessor) filter16(src image.Image, filters ...gift.Filter) (image.Image, error) {
+	g := gift.New(filters...)
+	var dst draw.Image
+	switch src.(type) {
+	case *image.Gray16:
+		dst = image.NewGray16(g.Bounds(src.Bounds()))
+	case *image.RGBA64, *image.NRGBA64:
+		dst = image.NewRGBA64(g.Bounds(src.Bounds()))
+	default:
+		return p.Filter(src, filters...)
+	}
+	g.Draw(dst, src)
+	return dst, nil
+}
+
 func (p *ImageProcessor) Filter(src image.Image, filters ...gift.Filter) (image.Image, error) {
+	if err := validateBounds(src.Bounds(), filters...); err != nil {
+		return nil, err
+	}
 	g := gift.New(filters...)
 	dst := image.NewRGBA(g.Bounds(src.Bounds()))
 	g.Draw(dst, src)
@@ -230,6 +414,7 @@ func (p *ImageProcessor) GetDefaultImageConfig(action string) ImageConfig {
 	return ImageConfig{
 		Action:  action,
 		Quality: p.Cfg.Quality,
+		Salt:    p.Cfg.Salt,
 	}
 }
 
@@ -247,8 +432,113 @@ const (
 	GIF
 	TIFF
 	BMP
+
+	// DNG can only be decoded, using its embedded JPEG preview.
+	DNG
+
+	// ICO holds the image in one or more sizes, see ImageConfig.ICOSizes.
+	ICO
+
+	// JPEG2000 can only be decoded, both JP2 files and raw codestreams.
+	JPEG2000
+
+	// QOI is lossless and fast to decode and encode, e.g. for intermediate
+	// images.
+	QOI
+
+	// PPM and PGM are the uncompressed color and gray Netpbm formats,
+	// e.g. to exchange images with scientific tools.
+	PPM
+	PGM
 )
 
+// DefaultExtension returns the default file extension of this format,
+// starting with a dot.
+func (f Format) DefaultExtension() string {
+	switch f {
+	case JPEG:
+		return ".jpg"
+	case PNG:
+		return ".png"
+	case GIF:
+		return ".gif"
+	case TIFF:
+		return ".tif"
+	case BMP:
+		return ".bmp"
+	case DNG:
+		return ".dng"
+	case ICO:
+		return ".ico"
+	case JPEG2000:
+		return ".jp2"
+	case QOI:
+		return ".qoi"
+	case PPM:
+		return ".ppm"
+	case PGM:
+		return ".pgm"
+	default:
+		panic(fmt.Sprintf("%d is not a valid image format", f))
+	}
+}
+
+// SupportsTransparency reports whether it supports transparency in any form.
+func (f Format) SupportsTransparency() bool {
+	return f != JPEG && f != DNG && f != PPM && f != PGM
+}
+
+// CloneImage returns a deep copy of img. The common image types keep their
+// type, all others are copied into an *image.RGBA64.
+func CloneImage(img image.Image) image.Image {
+	switch v := img.(type) {
+	case *image.RGBA:
+		c := *v
+		c.Pix = append([]uint8(nil), v.Pix...)
+		return &c
+	case *image.NRGBA:
+		c := *v
+		c.Pix = append([]uint8(nil), v.Pix...)
+		return &c
+	case *image.RGBA64:
+		c := *v
+		c.Pix = append([]uint8(nil), v.Pix...)
+		return &c
+	case *image.NRGBA64:
+		c := *v
+		c.Pix = append([]uint8(nil), v.Pix...)
+		return &c
+	case *image.Gray:
+		c := *v
+		c.Pix = append([]uint8(nil), v.Pix...)
+		return &c
+	case *image.Gray16:
+		c := *v
+		c.Pix = append([]uint8(nil), v.Pix...)
+		return &c
+	case *image.CMYK:
+		c := *v
+		c.Pix = append([]uint8(nil), v.Pix...)
+		return &c
+	case *image.Paletted:
+		c := *v
+		c.Pix = append([]uint8(nil), v.Pix...)
+		c.Palette = append(color.Palette(nil), v.Palette...)
+		return &c
+	case *image.YCbCr:
+		c := *v
+		c.Y = append([]uint8(nil), v.Y...)
+		c.Cb = append([]uint8(nil), v.Cb...)
+		c.Cr = append([]uint8(nil), v.Cr...)
+		return &c
+	}
+
+	b := img.Bounds()
+	c := image.NewRGBA64(b)
+	draw.Draw(c, b, img, b.Min, draw.Src)
+	return c
+}
+
 type imageConfig struct {
 	config       image.Config
 	configInit   sync.Once
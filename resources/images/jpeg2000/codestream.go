@@ -0,0 +1,511 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jpeg2000
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Codestream markers, see Table A.2 in the spec.
+const (
+	markerSOC = 0xff4f
+	markerCAP = 0xff50
+	markerSIZ = 0xff51
+	markerCOD = 0xff52
+	markerCOC = 0xff53
+	markerTLM = 0xff55
+	markerPLM = 0xff57
+	markerPLT = 0xff58
+	markerQCD = 0xff5c
+	markerQCC = 0xff5d
+	markerRGN = 0xff5e
+	markerPOC = 0xff5f
+	markerPPM = 0xff60
+	markerPPT = 0xff61
+	markerCRG = 0xff63
+	markerCOM = 0xff64
+	markerSOT = 0xff90
+	markerSOP = 0xff91
+	markerEPH = 0xff92
+	markerSOD = 0xff93
+	markerEOC = 0xffd9
+)
+
+// Progression orders.
+const (
+	orderLRCP = iota
+	orderRLCP
+	orderRPCL
+	orderPCRL
+	orderCPRL
+)
+
+// Code-block style flags.
+const (
+	cblkBypass    = 0x01
+	cblkReset     = 0x02
+	cblkTermAll   = 0x04
+	cblkCausal    = 0x08
+	cblkSegSymbol = 0x20
+	cblkHT        = 0x40
+)
+
+// Quantization styles.
+const (
+	quantNone = iota
+	quantDerived
+	quantExpounded
+)
+
+// component is an image component as described in the SIZ marker.
+type component struct {
+	signed    bool
+	precision int
+	dx, dy    int
+}
+
+// siz holds the image and tile size.
+type siz struct {
+	x0, y0, x1, y1   int
+	tw, th, tx0, ty0 int
+	ntx, nty         int
+	comps            []component
+}
+
+// codingStyle is the part of COD that applies to all components.
+type codingStyle struct {
+	sop, eph bool
+	order    int
+	layers   int
+	mct      bool
+	comp     componentStyle
+}
+
+// componentStyle is the part of COD that can be overridden per component
+// by COC.
+type componentStyle struct {
+	levels     int
+	cbw, cbh   int
+	cblkStyle  int
+	reversible bool
+
+	// Precinct size exponents per resolution level.
+	ppx, ppy []int
+}
+
+// quantization is a QCD or QCC marker.
+type quantization struct {
+	style int
+	guard int
+	expns []int
+	mants []int
+}
+
+// header holds the coding parameters in the main header or in a tile
+// header, where nil means not set.
+type header struct {
+	cod *codingStyle
+	coc []*componentStyle
+	qcd *quantization
+	qcc []*quantization
+	roi []int
+}
+
+func newHeader(ncomps int) header {
+	h := header{
+		coc: make([]*componentStyle, ncomps),
+		qcc: make([]*quantization, ncomps),
+		roi: make([]int, ncomps),
+	}
+	for i := range h.roi {
+		h.roi[i] = -1
+	}
+	return h
+}
+
+// tileData holds the tile header and the concatenated packet data of all
+// the tile-parts of a tile.
+type tileData struct {
+	header
+	data []byte
+	seen bool
+}
+
+// codestream is a parsed JPEG 2000 codestream.
+type codestream struct {
+	siz
+	main  header
+	tiles []tileData
+}
+
+// parseCodestream parses the main header and, unless headerOnly is set,
+// the tile-parts in b.
+func parseCodestream(b []byte, headerOnly bool) (*codestream, error) {
+	if len(b) < 4 || binary.BigEndian.Uint16(b) != markerSOC {
+		return nil, FormatError("missing SOC marker")
+	}
+	if binary.BigEndian.Uint16(b[2:]) != markerSIZ {
+		return nil, FormatError("missing SIZ marker")
+	}
+	cs := &codestream{}
+	pos := 2
+	var tile *tileData
+
+	for {
+		if pos+2 > len(b) {
+			if tile == nil {
+				return nil, FormatError("unexpected end of main header")
+			}
+			// A missing EOC is common enough in the wild.
+			return cs, nil
+		}
+		marker := int(binary.BigEndian.Uint16(b[pos:]))
+		pos += 2
+		if marker == markerEOC {
+			if tile == nil {
+				return nil, FormatError("no tiles")
+			}
+			return cs, nil
+		}
+		if pos+2 > len(b) {
+			return nil, FormatError("unexpected end of marker segment")
+		}
+		n := int(binary.BigEndian.Uint16(b[pos:]))
+		if n < 2 || pos+n > len(b) {
+			return nil, FormatError(fmt.Sprintf("invalid length of marker %04X", marker))
+		}
+		seg := b[pos+2 : pos+n]
+		start := pos - 2
+		pos += n
+
+		var err error
+		switch marker {
+		case markerSIZ:
+			if cs.comps != nil {
+				return nil, FormatError("unexpected SIZ marker")
+			}
+			if err = cs.parseSIZ(seg); err == nil {
+				cs.main = newHeader(len(cs.comps))
+			}
+		case markerPPM:
+			return nil, UnsupportedError("packed packet headers")
+		case markerSOT:
+			if cs.main.cod == nil || cs.main.qcd == nil {
+				return nil, FormatError("missing COD or QCD marker")
+			}
+			if headerOnly {
+				return cs, nil
+			}
+			if len(seg) < 8 {
+				return nil, FormatError("SOT marker too short")
+			}
+			idx := int(binary.BigEndian.Uint16(seg))
+			if idx >= len(cs.tiles) {
+				return nil, FormatError("invalid tile index")
+			}
+			tile = &cs.tiles[idx]
+			if !tile.seen {
+				tile.header = newHeader(len(cs.comps))
+				tile.seen = true
+			}
+			psot := int(binary.BigEndian.Uint32(seg[2:]))
+			end := len(b)
+			if psot != 0 {
+				end = start + psot
+				if end > len(b) {
+					end = len(b)
+				}
+			}
+			// Read the tile-part header up to SOD, then the data up to
+			// the end of the tile-part.
+			for {
+				if pos+2 > end {
+					return nil, FormatError("missing SOD marker")
+				}
+				if binary.BigEndian.Uint16(b[pos:]) == markerSOD {
+					pos += 2
+					break
+				}
+				m := int(binary.BigEndian.Uint16(b[pos:]))
+				if pos+4 > end {
+					return nil, FormatError("unexpected end of tile-part header")
+				}
+				n := int(binary.BigEndian.Uint16(b[pos+2:]))
+				if n < 2 || pos+2+n > end {
+					return nil, FormatError(fmt.Sprintf("invalid length of marker %04X", m))
+				}
+				if err := cs.parseHeaderMarker(&tile.header, m, b[pos+4:pos+2+n]); err != nil {
+					return nil, err
+				}
+				pos += 2 + n
+			}
+			if psot == 0 && end >= pos+2 && binary.BigEndian.Uint16(b[end-2:]) == markerEOC {
+				end -= 2
+			}
+			tile.data = append(tile.data, b[pos:end]...)
+			pos = end
+			continue
+		default:
+			err = cs.parseHeaderMarker(&cs.main, marker, seg)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseHeaderMarker parses a marker segment in the main header or in a
+// tile-part header. Markers not needed for decoding, e.g. COM, TLM and PLT,
+// are skipped.
+func (cs *codestream) parseHeaderMarker(h *header, marker int, seg []byte) error {
+	var err error
+	switch marker {
+	case markerCOD:
+		h.cod, err = parseCOD(seg)
+	case markerCOC:
+		var c int
+		if c, seg, err = cs.componentIndex(seg); err == nil {
+			if len(seg) < 1 {
+				return FormatError("COC marker too short")
+			}
+			h.coc[c], err = parseComponentStyle(seg[1:], seg[0]&1 != 0)
+		}
+	case markerQCD:
+		h.qcd, err = parseQuantization(seg)
+	case markerQCC:
+		var c int
+		if c, seg, err = cs.componentIndex(seg); err == nil {
+			h.qcc[c], err = parseQuantization(seg)
+		}
+	case markerRGN:
+		var c int
+		if c, seg, err = cs.componentIndex(seg); err == nil {
+			if len(seg) < 2 {
+				return FormatError("RGN marker too short")
+			}
+			if seg[0] != 0 {
+				return UnsupportedError("region of interest style")
+			}
+			h.roi[c] = int(seg[1])
+		}
+	case markerPOC:
+		return UnsupportedError("progression order change")
+	case markerPPM, markerPPT:
+		return UnsupportedError("packed packet headers")
+	}
+	return err
+}
+
+func (cs *codestream) parseSIZ(b []byte) error {
+	if len(b) < 36 {
+		return FormatError("SIZ marker too short")
+	}
+	u32 := func(i int) int { return int(binary.BigEndian.Uint32(b[i:])) }
+	s := &cs.siz
+	s.x1, s.y1 = u32(2), u32(6)
+	s.x0, s.y0 = u32(10), u32(14)
+	s.tw, s.th = u32(18), u32(22)
+	s.tx0, s.ty0 = u32(26), u32(30)
+	n := int(binary.BigEndian.Uint16(b[34:]))
+
+	if s.x0 >= s.x1 || s.y0 >= s.y1 || s.tw == 0 || s.th == 0 ||
+		s.tx0 > s.x0 || s.ty0 > s.y0 || s.tx0+s.tw <= s.x0 || s.ty0+s.th <= s.y0 {
+		return FormatError("invalid image or tile size")
+	}
+	if n == 0 || len(b) < 36+3*n {
+		return FormatError("invalid number of components")
+	}
+	for i := 0; i < n; i++ {
+		c := component{
+			signed:    b[36+3*i]&0x80 != 0,
+			precision: int(b[36+3*i]&0x7f) + 1,
+			dx:        int(b[37+3*i]),
+			dy:        int(b[38+3*i]),
+		}
+		if c.precision > 31 || c.dx == 0 || c.dy == 0 {
+			return FormatError("invalid component")
+		}
+		s.comps = append(s.comps, c)
+	}
+
+	s.ntx = ceilDiv(s.x1-s.tx0, s.tw)
+	s.nty = ceilDiv(s.y1-s.ty0, s.th)
+	if s.ntx*s.nty > 65535 {
+		return FormatError("too many tiles")
+	}
+	cs.tiles = make([]tileData, s.ntx*s.nty)
+	return nil
+}
+
+// componentIndex reads the component index at the start of a COC, QCC or
+// RGN marker, which is 2 bytes wide when there are more than 256 components.
+func (cs *codestream) componentIndex(b []byte) (int, []byte, error) {
+	n := 1
+	if len(cs.comps) > 256 {
+		n = 2
+	}
+	if len(b) < n {
+		return 0, nil, FormatError("marker too short")
+	}
+	c := int(b[0])
+	if n == 2 {
+		c = int(binary.BigEndian.Uint16(b))
+	}
+	if c >= len(cs.comps) {
+		return 0, nil, FormatError("invalid component index")
+	}
+	return c, b[n:], nil
+}
+
+func parseCOD(b []byte) (*codingStyle, error) {
+	if len(b) < 5 {
+		return nil, FormatError("COD marker too short")
+	}
+	s := &codingStyle{
+		sop:    b[0]&0x02 != 0,
+		eph:    b[0]&0x04 != 0,
+		order:  int(b[1]),
+		layers: int(binary.BigEndian.Uint16(b[2:])),
+		mct:    b[4] != 0,
+	}
+	if s.order > orderCPRL {
+		return nil, FormatError("invalid progression order")
+	}
+	if s.layers == 0 {
+		return nil, FormatError("invalid number of layers")
+	}
+	c, err := parseComponentStyle(b[5:], b[0]&0x01 != 0)
+	if err != nil {
+		return nil, err
+	}
+	s.comp = *c
+	return s, nil
+}
+
+func parseComponentStyle(b []byte, precincts bool) (*componentStyle, error) {
+	if len(b) < 5 {
+		return nil, FormatError("COD or COC marker too short")
+	}
+	s := &componentStyle{
+		levels:     int(b[0]),
+		cbw:        int(b[1]) + 2,
+		cbh:        int(b[2]) + 2,
+		cblkStyle:  int(b[3]),
+		reversible: b[4] == 1,
+	}
+	if s.levels > 32 || s.cbw > 10 || s.cbh > 10 || s.cbw+s.cbh > 12 {
+		return nil, FormatError("invalid coding style")
+	}
+	if s.cblkStyle&cblkHT != 0 {
+		return nil, UnsupportedError("high throughput code-blocks")
+	}
+	if b[4] > 1 {
+		return nil, UnsupportedError("wavelet transform")
+	}
+	s.ppx = make([]int, s.levels+1)
+	s.ppy = make([]int, s.levels+1)
+	for r := range s.ppx {
+		if precincts {
+			if len(b) < 6+r {
+				return nil, FormatError("COD or COC marker too short")
+			}
+			s.ppx[r], s.ppy[r] = int(b[5+r]&0x0f), int(b[5+r]>>4)
+			if r > 0 && (s.ppx[r] == 0 || s.ppy[r] == 0) {
+				return nil, FormatError("invalid precinct size")
+			}
+		} else {
+			s.ppx[r], s.ppy[r] = 15, 15
+		}
+	}
+	return s, nil
+}
+
+func parseQuantization(b []byte) (*quantization, error) {
+	if len(b) < 1 {
+		return nil, FormatError("QCD or QCC marker too short")
+	}
+	q := &quantization{style: int(b[0] & 0x1f), guard: int(b[0] >> 5)}
+	b = b[1:]
+	switch q.style {
+	case quantNone:
+		for _, v := range b {
+			q.expns = append(q.expns, int(v>>3))
+			q.mants = append(q.mants, 0)
+		}
+	case quantDerived, quantExpounded:
+		for i := 0; i+1 < len(b); i += 2 {
+			v := int(binary.BigEndian.Uint16(b[i:]))
+			q.expns = append(q.expns, v>>11)
+			q.mants = append(q.mants, v&0x7ff)
+		}
+	default:
+		return nil, FormatError("invalid quantization style")
+	}
+	if len(q.expns) == 0 {
+		return nil, FormatError("QCD or QCC marker too short")
+	}
+	return q, nil
+}
+
+// componentStyle returns the coding style for component c in tile t,
+// honouring the precedence tile COC, tile COD, main COC and then main COD.
+func (cs *codestream) componentStyle(t *tileData, c int) *componentStyle {
+	switch {
+	case t.coc[c] != nil:
+		return t.coc[c]
+	case t.cod != nil:
+		return &t.cod.comp
+	case cs.main.coc[c] != nil:
+		return cs.main.coc[c]
+	}
+	return &cs.main.cod.comp
+}
+
+// codingStyle returns the coding style for tile t.
+func (cs *codestream) codingStyle(t *tileData) *codingStyle {
+	if t.cod != nil {
+		return t.cod
+	}
+	return cs.main.cod
+}
+
+// quantization returns the quantization for component c in tile t, with
+// the same precedence as for the coding style.
+func (cs *codestream) quantization(t *tileData, c int) *quantization {
+	switch {
+	case t.qcc[c] != nil:
+		return t.qcc[c]
+	case t.qcd != nil:
+		return t.qcd
+	case cs.main.qcc[c] != nil:
+		return cs.main.qcc[c]
+	}
+	return cs.main.qcd
+}
+
+// roiShift returns the region of interest shift for component c in tile t.
+func (cs *codestream) roiShift(t *tileData, c int) int {
+	if t.roi[c] >= 0 {
+		return t.roi[c]
+	}
+	if cs.main.roi[c] >= 0 {
+		return cs.main.roi[c]
+	}
+	return 0
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
@@ -0,0 +1,212 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jpeg2000
+
+// The lifting parameters of the irreversible 9/7 wavelet, see Table F.4 in
+// the spec.
+const (
+	alpha97 = -1.586134342059924
+	beta97  = -0.052980118572961
+	gamma97 = 0.882911075530934
+	delta97 = 0.443506852043971
+	k97     = 1.230174104914001
+)
+
+// inverseTransform reconstructs the samples of tc from its sub-bands, see
+// Annex F in the spec.
+func (tc *tileComponent) inverseTransform() {
+	prev := tc.resolutions[0]
+	if tc.style.reversible {
+		a := prev.bands[0].ints
+		for _, res := range tc.resolutions[1:] {
+			a = res.inverse53(prev, a)
+			prev = res
+		}
+		tc.ints = a
+		return
+	}
+	a := prev.bands[0].floats
+	for _, res := range tc.resolutions[1:] {
+		a = res.inverse97(prev, a)
+		prev = res
+	}
+	tc.floats = a
+}
+
+// interleave places the samples of a sub-band in the interleaved samples
+// of resolution res, see F.3.3 in the spec.
+func (res *resolution) interleave(x0, y0, x1, y1, xo, yo int, place func(dst, src int)) {
+	w := res.x1 - res.x0
+	bw := x1 - x0
+	for y := y0; y < y1; y++ {
+		v := 2*y + yo - res.y0
+		for x := x0; x < x1; x++ {
+			u := 2*x + xo - res.x0
+			place(v*w+u, (y-y0)*bw+x-x0)
+		}
+	}
+}
+
+// inverse53 reconstructs resolution res from the lower resolution prev with
+// samples low using the reversible 5/3 wavelet.
+func (res *resolution) inverse53(prev *resolution, low []int32) []int32 {
+	w, h := res.x1-res.x0, res.y1-res.y0
+	out := make([]int32, w*h)
+	if len(out) == 0 {
+		return out
+	}
+	res.interleave(prev.x0, prev.y0, prev.x1, prev.y1, 0, 0, func(dst, src int) { out[dst] = low[src] })
+	for _, b := range res.bands {
+		src := b.ints
+		res.interleave(b.x0, b.y0, b.x1, b.y1, b.orient&1, b.orient>>1, func(dst, i int) { out[dst] = src[i] })
+	}
+
+	buf := make([]int32, max(w, h)+4)
+	for y := 0; y < h; y++ {
+		inverse53(out[y*w:], w, 1, res.x0, buf)
+	}
+	for x := 0; x < w; x++ {
+		inverse53(out[x:], h, w, res.y0, buf)
+	}
+	return out
+}
+
+// inverse97 is the irreversible 9/7 counterpart of inverse53.
+func (res *resolution) inverse97(prev *resolution, low []float32) []float32 {
+	w, h := res.x1-res.x0, res.y1-res.y0
+	out := make([]float32, w*h)
+	if len(out) == 0 {
+		return out
+	}
+	res.interleave(prev.x0, prev.y0, prev.x1, prev.y1, 0, 0, func(dst, src int) { out[dst] = low[src] })
+	for _, b := range res.bands {
+		src := b.floats
+		res.interleave(b.x0, b.y0, b.x1, b.y1, b.orient&1, b.orient>>1, func(dst, i int) { out[dst] = src[i] })
+	}
+
+	buf := make([]float32, max(w, h)+8)
+	for y := 0; y < h; y++ {
+		inverse97(out[y*w:], w, 1, res.x0, buf)
+	}
+	for x := 0; x < w; x++ {
+		inverse97(out[x:], h, w, res.y0, buf)
+	}
+	return out
+}
+
+// reflect returns the index of sample i in the periodic symmetric
+// extension of a signal of length n > 1, see F.3.7 in the spec.
+func reflect(i, n int) int {
+	p := 2 * (n - 1)
+	i %= p
+	if i < 0 {
+		i += p
+	}
+	if i >= n {
+		i = p - i
+	}
+	return i
+}
+
+// inverse53 performs the 1D inverse 5/3 transform of the n samples in a
+// with the given stride, starting at coordinate i0 in the resolution. The
+// low-pass samples are at the even coordinates.
+func inverse53(a []int32, n, stride, i0 int, buf []int32) {
+	if n < 2 {
+		if n == 1 && i0&1 == 1 {
+			a[0] /= 2
+		}
+		return
+	}
+	const ext = 2
+	x := buf[:n+2*ext]
+	for k := range x {
+		x[k] = a[reflect(k-ext, n)*stride]
+	}
+	// x[k] is a low-pass sample when k&1 == p.
+	p := (i0 - ext) & 1
+	for k := 2 - p; k < len(x)-1; k += 2 {
+		x[k] -= (x[k-1] + x[k+1] + 2) >> 2
+	}
+	for k := 1 + p; k < len(x)-1; k += 2 {
+		x[k] += (x[k-1] + x[k+1]) >> 1
+	}
+	for k := 0; k < n; k++ {
+		a[k*stride] = x[k+ext]
+	}
+}
+
+// inverse97 performs the 1D inverse 9/7 transform, see inverse53.
+func inverse97(a []float32, n, stride, i0 int, buf []float32) {
+	if n < 2 {
+		if n == 1 && i0&1 == 1 {
+			a[0] /= 2
+		}
+		return
+	}
+	const ext = 4
+	x := buf[:n+2*ext]
+	for k := range x {
+		x[k] = a[reflect(k-ext, n)*stride]
+	}
+	p := (i0 - ext) & 1
+	for k := p; k < len(x); k += 2 {
+		x[k] *= k97
+	}
+	for k := 1 - p; k < len(x); k += 2 {
+		x[k] *= 1 / k97
+	}
+	lift := func(start int, c float32) {
+		for k := start; k < len(x)-1; k += 2 {
+			x[k] -= c * (x[k-1] + x[k+1])
+		}
+	}
+	lift(2-p, delta97)
+	lift(1+p, gamma97)
+	lift(2-p, beta97)
+	lift(1+p, alpha97)
+	for k := 0; k < n; k++ {
+		a[k*stride] = x[k+ext]
+	}
+}
+
+// inverseMCT applies the inverse multiple component transform to the first
+// three components, see Annex G in the spec.
+func inverseMCT(tcs []*tileComponent) error {
+	c0, c1, c2 := tcs[0], tcs[1], tcs[2]
+	switch {
+	case c0.style.reversible && c1.style.reversible && c2.style.reversible:
+		if len(c1.ints) != len(c0.ints) || len(c2.ints) != len(c0.ints) {
+			return FormatError("component transform on components of different size")
+		}
+		for i, y := range c0.ints {
+			u, v := c1.ints[i], c2.ints[i]
+			g := y - (u+v)>>2
+			c0.ints[i], c1.ints[i], c2.ints[i] = v+g, g, u+g
+		}
+	case !c0.style.reversible && !c1.style.reversible && !c2.style.reversible:
+		if len(c1.floats) != len(c0.floats) || len(c2.floats) != len(c0.floats) {
+			return FormatError("component transform on components of different size")
+		}
+		for i, y := range c0.floats {
+			cb, cr := c1.floats[i], c2.floats[i]
+			c0.floats[i] = y + 1.402*cr
+			c1.floats[i] = y - 0.344136*cb - 0.714136*cr
+			c2.floats[i] = y + 1.772*cb
+		}
+	default:
+		return UnsupportedError("component transform with mixed wavelets")
+	}
+	return nil
+}
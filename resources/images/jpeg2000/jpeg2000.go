@@ -0,0 +1,460 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jpeg2000 implements a decoder for JPEG 2000 images as specified
+// in ITU-T T.800, both JP2 files and raw codestreams.
+//
+// All of Part 1 used in practice is supported: tiles, precincts, quality
+// layers, all progression orders, the reversible 5/3 and the irreversible
+// 9/7 wavelets, the component transforms, all code-block styles and regions
+// of interest. Progression order changes, packed packet headers, palettes
+// and the Part 2 and Part 15 (High Throughput) extensions are not.
+package jpeg2000
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// A FormatError reports that the input is not a valid JPEG 2000 image.
+type FormatError string
+
+func (e FormatError) Error() string { return "jpeg2000: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented
+// JPEG 2000 feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "jpeg2000: unsupported feature: " + string(e) }
+
+var jp2Signature = []byte{0, 0, 0, 12, 'j', 'P', ' ', ' ', 0x0d, 0x0a, 0x87, 0x0a}
+
+// Enumerated color spaces in the colr box.
+const (
+	colorSpaceSRGB = 16
+	colorSpaceGray = 17
+	colorSpaceSYCC = 18
+)
+
+// Channel types in the cdef box.
+const (
+	channelColor         = 0
+	channelOpacity       = 1
+	channelPremultiplied = 2
+	channelUnspecified   = 0xffff
+)
+
+// file holds what we need from a JP2 file.
+type file struct {
+	codestream []byte
+	colorSpace int
+	channels   []channelDef
+}
+
+type channelDef struct {
+	index, typ, assoc int
+}
+
+// Decode reads a JPEG 2000 image from r.
+func Decode(r io.Reader) (image.Image, error) {
+	f, err := readFile(r)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := parseCodestream(f.codestream, false)
+	if err != nil {
+		return nil, err
+	}
+	l, err := cs.layout(f)
+	if err != nil {
+		return nil, err
+	}
+	return cs.decode(l)
+}
+
+// DecodeConfig returns the color model and dimensions of a JPEG 2000 image
+// without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	f, err := readFile(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	cs, err := parseCodestream(f.codestream, true)
+	if err != nil {
+		return image.Config{}, err
+	}
+	l, err := cs.layout(f)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: l.model(),
+		Width:      cs.x1 - cs.x0,
+		Height:     cs.y1 - cs.y0,
+	}, nil
+}
+
+func readFile(r io.Reader) (*file, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) >= 4 && binary.BigEndian.Uint32(b) == markerSOC<<16|markerSIZ {
+		return &file{codestream: b}, nil
+	}
+	if !bytes.HasPrefix(b, jp2Signature) {
+		return nil, FormatError("missing JP2 signature or SOC marker")
+	}
+
+	f := &file{}
+	err = readBoxes(b, func(typ string, b []byte) error {
+		switch typ {
+		case "jp2h":
+			return readBoxes(b, f.readHeaderBox)
+		case "jp2c":
+			if f.codestream == nil {
+				f.codestream = b
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if f.codestream == nil {
+		return nil, FormatError("missing codestream box")
+	}
+	return f, nil
+}
+
+// readHeaderBox reads a box in the JP2 header box, see I.5.3 in the spec.
+func (f *file) readHeaderBox(typ string, b []byte) error {
+	switch typ {
+	case "colr":
+		// Only the first colr box is used.
+		if f.colorSpace == 0 && len(b) >= 7 && b[0] == 1 {
+			f.colorSpace = int(binary.BigEndian.Uint32(b[3:]))
+		}
+	case "pclr":
+		return UnsupportedError("palette")
+	case "cdef":
+		if len(b) < 2 {
+			return FormatError("cdef box too short")
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		if len(b) < 2+6*n {
+			return FormatError("cdef box too short")
+		}
+		for i := 0; i < n; i++ {
+			c := b[2+6*i:]
+			f.channels = append(f.channels, channelDef{
+				index: int(binary.BigEndian.Uint16(c)),
+				typ:   int(binary.BigEndian.Uint16(c[2:])),
+				assoc: int(binary.BigEndian.Uint16(c[4:])),
+			})
+		}
+	}
+	return nil
+}
+
+// readBoxes calls fn with the type and contents of each box in b, see I.4
+// in the spec.
+func readBoxes(b []byte, fn func(typ string, b []byte) error) error {
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return FormatError("invalid box")
+		}
+		n, hdr := uint64(binary.BigEndian.Uint32(b)), uint64(8)
+		switch n {
+		case 0:
+			n = uint64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return FormatError("invalid box")
+			}
+			n, hdr = binary.BigEndian.Uint64(b[8:]), 16
+		}
+		if n < hdr || n > uint64(len(b)) {
+			return FormatError("invalid box length")
+		}
+		if err := fn(string(b[4:8]), b[hdr:n]); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// layout describes how the components map to the output image.
+type layout struct {
+	// The components of the gray or red, green and blue channels.
+	color []int
+	// The component of the alpha channel, or -1.
+	alpha         int
+	premultiplied bool
+	ycc           bool
+	// Whether to use 16 bits per channel.
+	deep bool
+}
+
+func (cs *codestream) layout(f *file) (layout, error) {
+	l := layout{alpha: -1, ycc: f.colorSpace == colorSpaceSYCC}
+	n := len(cs.comps)
+
+	if f.channels != nil {
+		var color [3]int
+		ncolor := 0
+		for _, c := range f.channels {
+			if c.index >= n {
+				return l, FormatError("invalid channel definition")
+			}
+			switch c.typ {
+			case channelColor:
+				if c.assoc >= 1 && c.assoc <= 3 {
+					color[c.assoc-1] = c.index
+					ncolor = max(ncolor, c.assoc)
+				}
+			case channelOpacity, channelPremultiplied:
+				if l.alpha < 0 {
+					l.alpha = c.index
+					l.premultiplied = c.typ == channelPremultiplied
+				}
+			}
+		}
+		if ncolor == 2 {
+			return l, UnsupportedError("color space")
+		}
+		l.color = color[:ncolor]
+	}
+
+	if l.color == nil {
+		// Without channel definitions, guess from the color space and the
+		// number of components.
+		switch {
+		case f.colorSpace == colorSpaceGray || n < 3:
+			l.color = []int{0}
+			if n == 2 && l.alpha < 0 {
+				l.alpha = 1
+			}
+		default:
+			l.color = []int{0, 1, 2}
+			if n == 4 && l.alpha < 0 {
+				l.alpha = 3
+			}
+		}
+	}
+
+	for _, c := range l.channels() {
+		if cs.comps[c].precision > 8 {
+			l.deep = true
+		}
+	}
+	return l, nil
+}
+
+func (l layout) channels() []int {
+	if l.alpha >= 0 {
+		return append(l.color[:len(l.color):len(l.color)], l.alpha)
+	}
+	return l.color
+}
+
+func (l layout) model() color.Model {
+	switch {
+	case len(l.color) == 1 && l.alpha < 0 && l.deep:
+		return color.Gray16Model
+	case len(l.color) == 1 && l.alpha < 0:
+		return color.GrayModel
+	case (l.alpha < 0 || l.premultiplied) && l.deep:
+		return color.RGBA64Model
+	case l.alpha < 0 || l.premultiplied:
+		return color.RGBAModel
+	case l.deep:
+		return color.NRGBA64Model
+	}
+	return color.NRGBAModel
+}
+
+// plane holds the samples of a component in the range [0, max].
+type plane struct {
+	x0, y0, w, h int
+	dx, dy       int
+	max          int64
+	samples      []int32
+}
+
+// decode decodes all the tiles and converts the components to an image.
+func (cs *codestream) decode(l layout) (image.Image, error) {
+	planes := make([]*plane, len(cs.comps))
+	for _, c := range l.channels() {
+		comp := cs.comps[c]
+		x0, y0 := ceilDiv(cs.x0, comp.dx), ceilDiv(cs.y0, comp.dy)
+		p := &plane{
+			x0: x0, y0: y0,
+			w:  ceilDiv(cs.x1, comp.dx) - x0,
+			h:  ceilDiv(cs.y1, comp.dy) - y0,
+			dx: comp.dx, dy: comp.dy,
+			max: 1<<uint(comp.precision) - 1,
+		}
+		p.samples = make([]int32, p.w*p.h)
+		planes[c] = p
+	}
+
+	for i := range cs.tiles {
+		tcs, err := cs.decodeTile(i)
+		if err != nil {
+			return nil, err
+		}
+		for c, tc := range tcs {
+			if p := planes[c]; p != nil {
+				p.set(tc, cs.comps[c])
+			}
+		}
+	}
+
+	w, h := cs.x1-cs.x0, cs.y1-cs.y0
+	r := image.Rect(0, 0, w, h)
+	var out uint32 = 0xff
+	if l.deep {
+		out = 0xffff
+	}
+
+	var img interface {
+		image.Image
+		Set(x, y int, c color.Color)
+	}
+	switch l.model() {
+	case color.GrayModel:
+		img = image.NewGray(r)
+	case color.Gray16Model:
+		img = image.NewGray16(r)
+	case color.RGBAModel:
+		img = image.NewRGBA(r)
+	case color.RGBA64Model:
+		img = image.NewRGBA64(r)
+	case color.NRGBAModel:
+		img = image.NewNRGBA(r)
+	default:
+		img = image.NewNRGBA64(r)
+	}
+
+	var v [4]uint32
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			gx, gy := cs.x0+x, cs.y0+y
+			for i, c := range l.color {
+				v[i] = planes[c].at(gx, gy, out)
+			}
+			if len(l.color) == 1 {
+				v[1], v[2] = v[0], v[0]
+			} else if l.ycc {
+				v[0], v[1], v[2] = yccToRGB(v[0], v[1], v[2], out)
+			}
+			v[3] = out
+			if l.alpha >= 0 {
+				v[3] = planes[l.alpha].at(gx, gy, out)
+			}
+			img.Set(x, y, sample(l, v, out))
+		}
+	}
+	return img, nil
+}
+
+func sample(l layout, v [4]uint32, out uint32) color.Color {
+	if out == 0xff {
+		switch {
+		case len(l.color) == 1 && l.alpha < 0:
+			return color.Gray{Y: uint8(v[0])}
+		case l.alpha < 0 || l.premultiplied:
+			return color.RGBA{R: uint8(v[0]), G: uint8(v[1]), B: uint8(v[2]), A: uint8(v[3])}
+		}
+		return color.NRGBA{R: uint8(v[0]), G: uint8(v[1]), B: uint8(v[2]), A: uint8(v[3])}
+	}
+	switch {
+	case len(l.color) == 1 && l.alpha < 0:
+		return color.Gray16{Y: uint16(v[0])}
+	case l.alpha < 0 || l.premultiplied:
+		return color.RGBA64{R: uint16(v[0]), G: uint16(v[1]), B: uint16(v[2]), A: uint16(v[3])}
+	}
+	return color.NRGBA64{R: uint16(v[0]), G: uint16(v[1]), B: uint16(v[2]), A: uint16(v[3])}
+}
+
+// set copies the samples of tc to p, applying the DC level shift and
+// clamping to the component precision, see G.1.2 in the spec.
+func (p *plane) set(tc *tileComponent, comp component) {
+	w := tc.x1 - tc.x0
+	shift := int32(1) << uint(comp.precision-1)
+	for y := tc.y0; y < tc.y1; y++ {
+		dst := p.samples[(y-p.y0)*p.w+tc.x0-p.x0:]
+		for x := 0; x < w; x++ {
+			i := (y-tc.y0)*w + x
+			var v int32
+			if tc.ints != nil {
+				v = tc.ints[i]
+			} else {
+				v = int32(math.Floor(float64(tc.floats[i]) + 0.5))
+			}
+			// Signed components are shifted to be stored as unsigned.
+			v += shift
+			if v < 0 {
+				v = 0
+			} else if int64(v) > p.max {
+				v = int32(p.max)
+			}
+			dst[x] = v
+		}
+	}
+}
+
+// at returns the sample at x, y on the reference grid scaled to [0, out].
+func (p *plane) at(x, y int, out uint32) uint32 {
+	cx, cy := x/p.dx-p.x0, y/p.dy-p.y0
+	if cx >= p.w {
+		cx = p.w - 1
+	}
+	if cy >= p.h {
+		cy = p.h - 1
+	}
+	if cx < 0 {
+		cx = 0
+	}
+	if cy < 0 {
+		cy = 0
+	}
+	v := int64(p.samples[cy*p.w+cx])
+	if p.max == int64(out) {
+		return uint32(v)
+	}
+	return uint32((v*int64(out) + p.max/2) / p.max)
+}
+
+// yccToRGB converts from sYCC to sRGB, see Annex F in IEC 61966-2-1.
+func yccToRGB(y, cb, cr, out uint32) (uint32, uint32, uint32) {
+	mid := float64(out+1) / 2
+	yy, u, v := float64(y), float64(cb)-mid, float64(cr)-mid
+	clamp := func(f float64) uint32 {
+		if f < 0 {
+			return 0
+		}
+		if f > float64(out) {
+			return out
+		}
+		return uint32(f + 0.5)
+	}
+	return clamp(yy + 1.402*v), clamp(yy - 0.344136*u - 0.714136*v), clamp(yy + 1.772*u)
+}
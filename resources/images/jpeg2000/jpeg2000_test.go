@@ -0,0 +1,194 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jpeg2000
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// The test images are encoded from a 97x71 crop of sunset.jpg and from
+// synthetic images, see the functions below.
+func sunsetCrop(c *qt.C) *image.NRGBA {
+	f, err := os.Open(filepath.FromSlash("../../testdata/sunset.jpg"))
+	c.Assert(err, qt.IsNil)
+	defer f.Close()
+	src, _, err := image.Decode(f)
+	c.Assert(err, qt.IsNil)
+	img := image.NewNRGBA(image.Rect(0, 0, 97, 71))
+	draw.Draw(img, img.Bounds(), src, image.Pt(300, 420), draw.Src)
+	return img
+}
+
+func readTestFile(c *qt.C, name string) []byte {
+	b, err := ioutil.ReadFile(filepath.Join("..", "..", "testdata", "jpeg2000", name))
+	c.Assert(err, qt.IsNil)
+	return b
+}
+
+// maxDiff returns the maximum difference in any channel between a and b,
+// scaled to 16 bits.
+func maxDiff(c *qt.C, a, b image.Image) int {
+	c.Assert(a.Bounds(), qt.Equals, b.Bounds())
+	var max int
+	r := a.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c1 := color.NRGBA64Model.Convert(a.At(x, y)).(color.NRGBA64)
+			c2 := color.NRGBA64Model.Convert(b.At(x, y)).(color.NRGBA64)
+			for _, d := range []int{
+				int(c1.R) - int(c2.R), int(c1.G) - int(c2.G),
+				int(c1.B) - int(c2.B), int(c1.A) - int(c2.A),
+			} {
+				if d < 0 {
+					d = -d
+				}
+				if d > max {
+					max = d
+				}
+			}
+		}
+	}
+	return max
+}
+
+func TestDecode(t *testing.T) {
+	c := qt.New(t)
+
+	sunset := sunsetCrop(c)
+
+	gray := image.NewGray(sunset.Bounds())
+	draw.Draw(gray, gray.Bounds(), sunset, image.Point{}, draw.Src)
+
+	alpha := image.NewNRGBA(sunset.Bounds())
+	draw.Draw(alpha, alpha.Bounds(), sunset, image.Point{}, draw.Src)
+	for y := 0; y < 71; y++ {
+		for x := 0; x < 97; x++ {
+			p := alpha.NRGBAAt(x, y)
+			p.A = uint8(x * 255 / 96)
+			alpha.SetNRGBA(x, y, p)
+		}
+	}
+
+	gray16 := image.NewGray16(image.Rect(0, 0, 33, 21))
+	for y := 0; y < 21; y++ {
+		for x := 0; x < 33; x++ {
+			gray16.SetGray16(x, y, color.Gray16{Y: uint16(x*1987 + y*977)})
+		}
+	}
+
+	// Green and blue are stored at half the resolution, taking every
+	// other sample.
+	subsampled := image.NewNRGBA(sunset.Bounds())
+	for y := 0; y < 71; y++ {
+		for x := 0; x < 97; x++ {
+			p := sunset.NRGBAAt(x, y)
+			q := sunset.NRGBAAt(x&^1, y&^1)
+			p.G, p.B = q.G, q.B
+			subsampled.SetNRGBA(x, y, p)
+		}
+	}
+
+	for _, test := range []struct {
+		name    string
+		want    image.Image
+		maxDiff int
+	}{
+		{"lossless.jp2", sunset, 0},
+		// A raw codestream.
+		{"lossless.j2k", sunset, 0},
+		// 40x30 tiles with offsets, so the tiles are partial at the edges.
+		{"tiles.jp2", sunset, 0},
+		// Two layers, precincts and tiles in the other progression orders.
+		{"rlcp.jp2", sunset, 0},
+		{"rpcl.jp2", sunset, 0},
+		{"pcrl.jp2", sunset, 0},
+		{"cprl.jp2", sunset, 0},
+		// With SOP and EPH markers around the packet headers.
+		{"sopeph.jp2", sunset, 0},
+		{"subsampled.jp2", subsampled, 0},
+		{"alpha.jp2", alpha, 0},
+		{"gray16.jp2", gray16, 0},
+		// The irreversible wavelet and component transforms.
+		{"lossy.jp2", sunset, 2 << 8},
+		{"gray.j2k", gray, 2 << 8},
+	} {
+		test := test
+		c.Run(test.name, func(c *qt.C) {
+			img, err := Decode(bytes.NewReader(readTestFile(c, test.name)))
+			c.Assert(err, qt.IsNil)
+			diff := maxDiff(c, img, test.want)
+			c.Assert(diff <= test.maxDiff, qt.Equals, true, qt.Commentf("diff %d", diff))
+		})
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	c := qt.New(t)
+
+	for _, test := range []struct {
+		name   string
+		model  color.Model
+		width  int
+		height int
+	}{
+		{"lossless.jp2", color.NRGBAModel, 97, 71},
+		{"tiles.jp2", color.NRGBAModel, 97, 71},
+		{"gray.j2k", color.GrayModel, 97, 71},
+		{"gray16.jp2", color.Gray16Model, 33, 21},
+	} {
+		config, err := DecodeConfig(bytes.NewReader(readTestFile(c, test.name)))
+		c.Assert(err, qt.IsNil)
+		c.Assert(config.ColorModel, qt.Equals, test.model)
+		c.Assert(config.Width, qt.Equals, test.width)
+		c.Assert(config.Height, qt.Equals, test.height)
+
+		img, err := Decode(bytes.NewReader(readTestFile(c, test.name)))
+		c.Assert(err, qt.IsNil)
+		c.Assert(img.ColorModel(), qt.Equals, test.model)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	c := qt.New(t)
+
+	// High Throughput code-blocks from Part 15.
+	_, err := Decode(bytes.NewReader(readTestFile(c, "ht.jp2")))
+	_, ok := err.(UnsupportedError)
+	c.Assert(ok, qt.Equals, true)
+
+	_, err = Decode(bytes.NewReader([]byte("not a JPEG 2000 image")))
+	_, ok = err.(FormatError)
+	c.Assert(ok, qt.Equals, true)
+
+	b := readTestFile(c, "lossless.jp2")
+	_, err = DecodeConfig(bytes.NewReader(b[:100]))
+	_, ok = err.(FormatError)
+	c.Assert(ok, qt.Equals, true)
+
+	// A truncated codestream decodes to a lower quality image.
+	b = readTestFile(c, "lossless.j2k")
+	img, err := Decode(bytes.NewReader(b[:len(b)/2]))
+	c.Assert(err, qt.IsNil)
+	c.Assert(img.Bounds(), qt.Equals, image.Rect(0, 0, 97, 71))
+}
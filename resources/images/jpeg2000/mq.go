@@ -0,0 +1,221 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jpeg2000
+
+// The probability estimation table, see Table C.2 in the spec.
+var mqStates = [47]struct {
+	qe         uint32
+	nmps, nlps uint8
+	switchMPS  bool
+}{
+	{0x5601, 1, 1, true},
+	{0x3401, 2, 6, false},
+	{0x1801, 3, 9, false},
+	{0x0ac1, 4, 12, false},
+	{0x0521, 5, 29, false},
+	{0x0221, 38, 33, false},
+	{0x5601, 7, 6, true},
+	{0x5401, 8, 14, false},
+	{0x4801, 9, 14, false},
+	{0x3801, 10, 14, false},
+	{0x3001, 11, 17, false},
+	{0x2401, 12, 18, false},
+	{0x1c01, 13, 20, false},
+	{0x1601, 29, 21, false},
+	{0x5601, 15, 14, true},
+	{0x5401, 16, 14, false},
+	{0x5101, 17, 15, false},
+	{0x4801, 18, 16, false},
+	{0x3801, 19, 17, false},
+	{0x3401, 20, 18, false},
+	{0x3001, 21, 19, false},
+	{0x2801, 22, 19, false},
+	{0x2401, 23, 20, false},
+	{0x2201, 24, 21, false},
+	{0x1c01, 25, 22, false},
+	{0x1801, 26, 23, false},
+	{0x1601, 27, 24, false},
+	{0x1401, 28, 25, false},
+	{0x1201, 29, 26, false},
+	{0x1101, 30, 27, false},
+	{0x0ac1, 31, 28, false},
+	{0x09c1, 32, 29, false},
+	{0x08a1, 33, 30, false},
+	{0x0521, 34, 31, false},
+	{0x0441, 35, 32, false},
+	{0x02a1, 36, 33, false},
+	{0x0221, 37, 34, false},
+	{0x0141, 38, 35, false},
+	{0x0111, 39, 36, false},
+	{0x0085, 40, 37, false},
+	{0x0049, 41, 38, false},
+	{0x0025, 42, 39, false},
+	{0x0015, 43, 40, false},
+	{0x0009, 44, 41, false},
+	{0x0005, 45, 42, false},
+	{0x0001, 45, 43, false},
+	{0x5601, 46, 46, false},
+}
+
+// Context labels, see Annex D in the spec.
+const (
+	ctxZC       = 0  // 0-8
+	ctxSC       = 9  // 9-13
+	ctxMR       = 14 // 14-16
+	ctxRun      = 17
+	ctxUniform  = 18
+	numContexts = 19
+)
+
+type mqContext struct {
+	state uint8
+	mps   uint8
+}
+
+// mqDecoder is the arithmetic decoder described in Annex C in the spec. It
+// also implements the raw decoding used in the bypass mode.
+type mqDecoder struct {
+	data []byte
+	pos  int
+	a, c uint32
+	ct   uint
+
+	contexts [numContexts]mqContext
+}
+
+func (d *mqDecoder) resetContexts() {
+	for i := range d.contexts {
+		d.contexts[i] = mqContext{}
+	}
+	d.contexts[ctxZC].state = 4
+	d.contexts[ctxRun].state = 3
+	d.contexts[ctxUniform].state = 46
+}
+
+// init starts decoding the codeword segment b, see C.3.5 in the spec.
+func (d *mqDecoder) init(b []byte) {
+	// Terminate the data with a marker to make the decoder feed 1 bits
+	// past the end.
+	d.data = append(append(d.data[:0], b...), 0xff, 0xff)
+	d.pos = 0
+	d.c = uint32(d.data[0]) << 16
+	d.byteIn()
+	d.c <<= 7
+	d.ct -= 7
+	d.a = 0x8000
+}
+
+func (d *mqDecoder) byteIn() {
+	next := uint32(d.data[d.pos+1])
+	if d.data[d.pos] == 0xff {
+		if next > 0x8f {
+			d.c += 0xff00
+			d.ct = 8
+		} else {
+			d.pos++
+			d.c += next << 9
+			d.ct = 7
+		}
+	} else {
+		d.pos++
+		d.c += next << 8
+		d.ct = 8
+	}
+}
+
+// decode decodes a decision in context cx.
+func (d *mqDecoder) decode(cx int) int {
+	ctx := &d.contexts[cx]
+	s := &mqStates[ctx.state]
+	var bit uint8
+
+	d.a -= s.qe
+	if d.c>>16 < s.qe {
+		// The LPS exchange.
+		if d.a < s.qe {
+			bit = ctx.mps
+			ctx.state = s.nmps
+		} else {
+			bit = 1 - ctx.mps
+			if s.switchMPS {
+				ctx.mps = 1 - ctx.mps
+			}
+			ctx.state = s.nlps
+		}
+		d.a = s.qe
+		d.renormalize()
+	} else {
+		d.c -= s.qe << 16
+		if d.a&0x8000 != 0 {
+			return int(ctx.mps)
+		}
+		// The MPS exchange.
+		if d.a < s.qe {
+			bit = 1 - ctx.mps
+			if s.switchMPS {
+				ctx.mps = 1 - ctx.mps
+			}
+			ctx.state = s.nlps
+		} else {
+			bit = ctx.mps
+			ctx.state = s.nmps
+		}
+		d.renormalize()
+	}
+	return int(bit)
+}
+
+func (d *mqDecoder) renormalize() {
+	for {
+		if d.ct == 0 {
+			d.byteIn()
+		}
+		d.a <<= 1
+		d.c <<= 1
+		d.ct--
+		if d.a&0x8000 != 0 {
+			return
+		}
+	}
+}
+
+// initRaw starts decoding the raw codeword segment b, see D.6 in the spec.
+func (d *mqDecoder) initRaw(b []byte) {
+	d.data = append(append(d.data[:0], b...), 0xff, 0xff)
+	d.pos = 0
+	d.c = 0
+	d.ct = 0
+}
+
+// raw reads a raw bit.
+func (d *mqDecoder) raw() int {
+	if d.ct == 0 {
+		if d.c == 0xff {
+			if d.data[d.pos] > 0x8f {
+				d.c = 0xff
+				d.ct = 8
+			} else {
+				d.c = uint32(d.data[d.pos])
+				d.pos++
+				d.ct = 7
+			}
+		} else {
+			d.c = uint32(d.data[d.pos])
+			d.pos++
+			d.ct = 8
+		}
+	}
+	d.ct--
+	return int(d.c>>d.ct) & 1
+}
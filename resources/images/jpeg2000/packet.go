@@ -0,0 +1,312 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jpeg2000
+
+import "errors"
+
+// errTruncated is returned when the packet data ends prematurely. This is
+// not necessarily an error, as a codestream may be truncated to get a lower
+// quality image.
+var errTruncated = errors.New("jpeg2000: truncated packet data")
+
+// tagTree is a tag tree as described in B.10.2 in the spec.
+type tagTree struct {
+	levels [][]tagNode
+	widths []int
+}
+
+type tagNode struct {
+	value int
+	low   int
+}
+
+const tagUnknown = 1 << 30
+
+func newTagTree(w, h int) *tagTree {
+	t := &tagTree{}
+	for {
+		nodes := make([]tagNode, w*h)
+		for i := range nodes {
+			nodes[i].value = tagUnknown
+		}
+		t.levels = append(t.levels, nodes)
+		t.widths = append(t.widths, w)
+		if w == 1 && h == 1 {
+			return t
+		}
+		w, h = ceilDiv(w, 2), ceilDiv(h, 2)
+	}
+}
+
+// decode reads from r until it is known whether the value of the leaf at
+// x, y is below threshold, and reports whether it is.
+func (t *tagTree) decode(r *packetReader, x, y, threshold int) (bool, error) {
+	low := 0
+	for l := len(t.levels) - 1; l >= 0; l-- {
+		n := &t.levels[l][(y>>uint(l))*t.widths[l]+x>>uint(l)]
+		if low > n.low {
+			n.low = low
+		} else {
+			low = n.low
+		}
+		for low < threshold && low < n.value {
+			b, err := r.bit()
+			if err != nil {
+				return false, err
+			}
+			if b == 1 {
+				n.value = low
+			} else {
+				low++
+			}
+		}
+		n.low = low
+		if l == 0 {
+			return n.value < threshold, nil
+		}
+	}
+	panic("unreachable")
+}
+
+// value decodes the value of the leaf at x, y.
+func (t *tagTree) value(r *packetReader, x, y int) (int, error) {
+	for i := 1; ; i++ {
+		ok, err := t.decode(r, x, y, i)
+		if err != nil || ok {
+			return i - 1, err
+		}
+	}
+}
+
+// packetReader reads the packets of a tile.
+type packetReader struct {
+	data     []byte
+	pos      int
+	sop, eph bool
+
+	// The bit reader state for the packet headers.
+	buf    byte
+	nbits  uint
+	prevFF bool
+}
+
+// bit reads a bit from a packet header, see B.10.1 in the spec.
+func (r *packetReader) bit() (int, error) {
+	if r.nbits == 0 {
+		if r.pos >= len(r.data) {
+			return 0, errTruncated
+		}
+		r.buf = r.data[r.pos]
+		r.pos++
+		r.nbits = 8
+		if r.prevFF {
+			// A zero bit is stuffed after 0xFF.
+			r.nbits = 7
+		}
+		r.prevFF = r.buf == 0xff
+	}
+	r.nbits--
+	return int(r.buf>>r.nbits) & 1, nil
+}
+
+func (r *packetReader) bits(n int) (int, error) {
+	v := 0
+	for i := 0; i < n; i++ {
+		b, err := r.bit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | b
+	}
+	return v, nil
+}
+
+// alignHeader skips to the end of the packet header.
+func (r *packetReader) alignHeader() {
+	r.nbits = 0
+	if r.prevFF {
+		// The header cannot end with 0xFF, so a stuffed byte follows.
+		r.pos++
+	}
+	r.prevFF = false
+}
+
+// marker skips the marker m at the current position, if present.
+func (r *packetReader) marker(m int, length int) {
+	if r.pos+2 <= len(r.data) && int(r.data[r.pos])<<8|int(r.data[r.pos+1]) == m {
+		r.pos += length
+	}
+}
+
+// passes reads the number of coding passes, see Table B.4 in the spec.
+func (r *packetReader) passes() (int, error) {
+	codes := []struct{ bits, limit, offset int }{
+		{1, 1, 1},
+		{1, 1, 2},
+		{2, 3, 3},
+		{5, 31, 6},
+		{7, 128, 37},
+	}
+	for _, c := range codes {
+		v, err := r.bits(c.bits)
+		if err != nil {
+			return 0, err
+		}
+		if c.bits == 1 {
+			if v == 0 {
+				return c.offset, nil
+			}
+			continue
+		}
+		if v < c.limit {
+			return c.offset + v, nil
+		}
+	}
+	return 0, FormatError("invalid number of coding passes")
+}
+
+// contribution is the data of a code-block in a packet.
+type contribution struct {
+	seg    *segment
+	passes int
+	length int
+}
+
+// readPacket reads the packet for the given layer of precinct p, see B.9
+// and B.10 in the spec.
+func (r *packetReader) readPacket(p *precinct, layer int, cblkStyle int) error {
+	if r.sop {
+		r.marker(markerSOP, 6)
+	}
+
+	nonEmpty, err := r.bit()
+	if err != nil {
+		return err
+	}
+
+	var contribs []contribution
+	if nonEmpty == 1 {
+		for _, pb := range p.bands {
+			if len(pb.blocks) == 0 {
+				continue
+			}
+			w := pb.inclusion.widths[0]
+			for i, cb := range pb.blocks {
+				x, y := i%w, i/w
+
+				var included bool
+				if cb.included {
+					b, err := r.bit()
+					if err != nil {
+						return err
+					}
+					included = b == 1
+				} else {
+					included, err = pb.inclusion.decode(r, x, y, layer+1)
+					if err != nil {
+						return err
+					}
+					if included {
+						if cb.zeroPlanes, err = pb.zeroPlanes.value(r, x, y); err != nil {
+							return err
+						}
+						cb.included = true
+					}
+				}
+				if !included {
+					continue
+				}
+
+				n, err := r.passes()
+				if err != nil {
+					return err
+				}
+				for {
+					b, err := r.bit()
+					if err != nil {
+						return err
+					}
+					if b == 0 {
+						break
+					}
+					cb.lblock++
+				}
+
+				for n > 0 {
+					seg := cb.currentSegment(cblkStyle)
+					k := min(n, seg.maxPasses-seg.passes)
+					length, err := r.bits(cb.lblock + log2(k))
+					if err != nil {
+						return err
+					}
+					contribs = append(contribs, contribution{seg: seg, passes: k, length: length})
+					seg.passes += k
+					cb.passes += k
+					n -= k
+				}
+			}
+		}
+	}
+
+	r.alignHeader()
+	if r.eph {
+		r.marker(markerEPH, 2)
+	}
+
+	for _, c := range contribs {
+		if r.pos+c.length > len(r.data) {
+			return errTruncated
+		}
+		c.seg.data = append(c.seg.data, r.data[r.pos:r.pos+c.length]...)
+		r.pos += c.length
+	}
+	return nil
+}
+
+// currentSegment returns the codeword segment the next coding pass of cb
+// belongs to, see Table D.9 in the spec.
+func (cb *codeblock) currentSegment(cblkStyle int) *segment {
+	if n := len(cb.segments); n > 0 && cb.segments[n-1].passes < cb.segments[n-1].maxPasses {
+		return cb.segments[n-1]
+	}
+	maxPasses := 109
+	switch {
+	case cblkStyle&cblkTermAll != 0:
+		maxPasses = 1
+	case cblkStyle&cblkBypass != 0:
+		// The first 10 passes are MQ coded, then the significance
+		// propagation and magnitude refinement passes are raw and the
+		// cleanup passes MQ coded.
+		switch n := len(cb.segments); {
+		case n == 0:
+			maxPasses = 10
+		case cb.segments[n-1].maxPasses == 2:
+			maxPasses = 1
+		default:
+			maxPasses = 2
+		}
+	}
+	seg := &segment{maxPasses: maxPasses}
+	cb.segments = append(cb.segments, seg)
+	return seg
+}
+
+func log2(n int) int {
+	l := 0
+	for n > 1 {
+		n >>= 1
+		l++
+	}
+	return l
+}
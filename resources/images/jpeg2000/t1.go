@@ -0,0 +1,384 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jpeg2000
+
+// Coefficient state flags used in the coding passes.
+const (
+	flagSig     = 1 << iota // significant
+	flagVisited             // coded in the current significance propagation pass
+	flagRefined             // refined at least once
+	flagNeg                 // negative sign
+)
+
+// blockDecoder decodes code-blocks, see Annex D in the spec.
+type blockDecoder struct {
+	mq mqDecoder
+
+	w, h   int
+	orient int
+	causal bool
+
+	// The flags have a border of one coefficient to avoid bounds checks
+	// when looking at the neighbours.
+	flags []uint8
+	// The coefficient magnitudes with one extra fraction bit, i.e. the
+	// midpoint of the magnitude interval decoded so far times two.
+	mags []int32
+}
+
+func (d *blockDecoder) stride() int {
+	return d.w + 2
+}
+
+// decode decodes the code-block cb with the given style and number of
+// magnitude bit-planes, leaving the result in d.mags and d.flags.
+func (d *blockDecoder) decode(cb *codeblock, orient, style, magnitudeBits int) {
+	d.w, d.h = cb.x1-cb.x0, cb.y1-cb.y0
+	d.orient = orient
+	d.causal = style&cblkCausal != 0
+	n := (d.w + 2) * (d.h + 2)
+	if cap(d.flags) < n {
+		d.flags = make([]uint8, n)
+		d.mags = make([]int32, n)
+	}
+	d.flags = d.flags[:n]
+	d.mags = d.mags[:n]
+	for i := range d.flags {
+		d.flags[i] = 0
+		d.mags[i] = 0
+	}
+	d.mq.resetContexts()
+
+	plane := magnitudeBits - 1 - cb.zeroPlanes
+	pass := 0
+	for _, seg := range cb.segments {
+		for i := 0; i < seg.passes; i, pass = i+1, pass+1 {
+			// The first pass is a cleanup pass, then the
+			// significance propagation, magnitude refinement and
+			// cleanup passes follow for each bit-plane.
+			kind := 2
+			if pass > 0 {
+				kind = (pass - 1) % 3
+			}
+			p := plane - (pass+2)/3
+			if p < 0 {
+				return
+			}
+			raw := style&cblkBypass != 0 && pass >= 10 && kind != 2
+			if i == 0 {
+				if raw {
+					d.mq.initRaw(seg.data)
+				} else {
+					d.mq.init(seg.data)
+				}
+			}
+			switch kind {
+			case 0:
+				d.significancePass(p, raw)
+			case 1:
+				d.refinementPass(p, raw)
+			case 2:
+				d.cleanupPass(p, style&cblkSegSymbol != 0)
+			}
+			if style&cblkReset != 0 {
+				d.mq.resetContexts()
+			}
+		}
+	}
+}
+
+// neighbours returns the number of significant horizontal, vertical and
+// diagonal neighbours of the coefficient at index i in row y.
+func (d *blockDecoder) neighbours(i, y int) (h, v, dg int) {
+	s := d.stride()
+	f := d.flags
+	h = int(f[i-1]&flagSig) + int(f[i+1]&flagSig)
+	v = int(f[i-s] & flagSig)
+	dg = int(f[i-s-1]&flagSig) + int(f[i-s+1]&flagSig)
+	if !d.causal || y%4 != 3 {
+		v += int(f[i+s] & flagSig)
+		dg += int(f[i+s-1]&flagSig) + int(f[i+s+1]&flagSig)
+	}
+	return
+}
+
+// zeroContext returns the zero coding context, see Table D.1 in the spec.
+func (d *blockDecoder) zeroContext(i, y int) int {
+	h, v, dg := d.neighbours(i, y)
+	switch d.orient {
+	case bandHL:
+		h, v = v, h
+	case bandHH:
+		hv := h + v
+		switch {
+		case dg >= 3:
+			return 8
+		case dg == 2:
+			if hv >= 1 {
+				return 7
+			}
+			return 6
+		case dg == 1:
+			return 3 + min(hv, 2)
+		}
+		return min(hv, 2)
+	}
+	switch {
+	case h == 2:
+		return 8
+	case h == 1:
+		if v >= 1 {
+			return 7
+		}
+		if dg >= 1 {
+			return 6
+		}
+		return 5
+	case v == 2:
+		return 4
+	case v == 1:
+		return 3
+	}
+	return min(dg, 2)
+}
+
+// signContribution returns 1, -1 or 0 for a significant positive, a
+// significant negative or an insignificant neighbour.
+func signContribution(f uint8) int {
+	if f&flagSig == 0 {
+		return 0
+	}
+	if f&flagNeg != 0 {
+		return -1
+	}
+	return 1
+}
+
+// decodeSign decodes the sign of the coefficient at index i in row y, see
+// Table D.3 in the spec.
+func (d *blockDecoder) decodeSign(i, y int, raw bool) {
+	var neg int
+	if raw {
+		neg = d.mq.raw()
+	} else {
+		s := d.stride()
+		f := d.flags
+		h := signContribution(f[i-1]) + signContribution(f[i+1])
+		v := signContribution(f[i-s])
+		if !d.causal || y%4 != 3 {
+			v += signContribution(f[i+s])
+		}
+		h, v = clamp1(h), clamp1(v)
+		xor := 0
+		if h < 0 || (h == 0 && v < 0) {
+			h, v, xor = -h, -v, 1
+		}
+		// Now h is 0 or 1, and v is 0 or 1 when h is 0.
+		cx := ctxSC + v
+		if h == 1 {
+			cx = ctxSC + 3 + v
+		}
+		neg = d.mq.decode(cx) ^ xor
+	}
+	if neg == 1 {
+		d.flags[i] |= flagNeg
+	}
+}
+
+func clamp1(v int) int {
+	if v > 1 {
+		return 1
+	}
+	if v < -1 {
+		return -1
+	}
+	return v
+}
+
+// significant marks the coefficient at index i as significant in plane p.
+func (d *blockDecoder) significant(i, y, p int, raw bool) {
+	d.decodeSign(i, y, raw)
+	d.flags[i] |= flagSig
+	d.mags[i] = 3 << uint(p)
+}
+
+func (d *blockDecoder) significancePass(p int, raw bool) {
+	s := d.stride()
+	for y0 := 0; y0 < d.h; y0 += 4 {
+		for x := 0; x < d.w; x++ {
+			for y := y0; y < y0+4 && y < d.h; y++ {
+				i := (y+1)*s + x + 1
+				if d.flags[i]&flagSig != 0 {
+					continue
+				}
+				h, v, dg := d.neighbours(i, y)
+				if h+v+dg == 0 {
+					continue
+				}
+				var bit int
+				if raw {
+					bit = d.mq.raw()
+				} else {
+					bit = d.mq.decode(ctxZC + d.zeroContext(i, y))
+				}
+				if bit == 1 {
+					d.significant(i, y, p, raw)
+				}
+				d.flags[i] |= flagVisited
+			}
+		}
+	}
+}
+
+func (d *blockDecoder) refinementPass(p int, raw bool) {
+	s := d.stride()
+	for y0 := 0; y0 < d.h; y0 += 4 {
+		for x := 0; x < d.w; x++ {
+			for y := y0; y < y0+4 && y < d.h; y++ {
+				i := (y+1)*s + x + 1
+				f := d.flags[i]
+				if f&flagSig == 0 || f&flagVisited != 0 {
+					continue
+				}
+				var bit int
+				if raw {
+					bit = d.mq.raw()
+				} else {
+					cx := ctxMR + 2
+					if f&flagRefined == 0 {
+						cx = ctxMR
+						if h, v, dg := d.neighbours(i, y); h+v+dg > 0 {
+							cx++
+						}
+					}
+					bit = d.mq.decode(cx)
+				}
+				if bit == 1 {
+					d.mags[i] += 1 << uint(p)
+				} else {
+					d.mags[i] -= 1 << uint(p)
+				}
+				d.flags[i] |= flagRefined
+			}
+		}
+	}
+}
+
+func (d *blockDecoder) cleanupPass(p int, segSymbol bool) {
+	s := d.stride()
+	for y0 := 0; y0 < d.h; y0 += 4 {
+		for x := 0; x < d.w; x++ {
+			y := y0
+			if y0+4 <= d.h && d.runMode(x, y0) {
+				if d.mq.decode(ctxRun) == 0 {
+					continue
+				}
+				y += d.mq.decode(ctxUniform)<<1 | d.mq.decode(ctxUniform)
+				d.significant((y+1)*s+x+1, y, p, false)
+				y++
+			}
+			for ; y < y0+4 && y < d.h; y++ {
+				i := (y+1)*s + x + 1
+				if d.flags[i]&(flagSig|flagVisited) != 0 {
+					continue
+				}
+				if d.mq.decode(ctxZC+d.zeroContext(i, y)) == 1 {
+					d.significant(i, y, p, false)
+				}
+			}
+		}
+	}
+
+	for i := range d.flags {
+		d.flags[i] &^= flagVisited
+	}
+
+	if segSymbol {
+		for i := 0; i < 4; i++ {
+			d.mq.decode(ctxUniform)
+		}
+	}
+}
+
+// runMode reports whether column x of the stripe starting at row y0 is
+// decoded in run-length mode, i.e. when none of the coefficients in the
+// column are significant, visited or have significant neighbours.
+func (d *blockDecoder) runMode(x, y0 int) bool {
+	s := d.stride()
+	for y := y0; y < y0+4; y++ {
+		i := (y+1)*s + x + 1
+		if d.flags[i]&(flagSig|flagVisited) != 0 {
+			return false
+		}
+		if h, v, dg := d.neighbours(i, y); h+v+dg > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeCodeblocks decodes all the code-blocks of tc and dequantizes the
+// coefficients into the sub-bands, see Annex E in the spec.
+func (tc *tileComponent) decodeCodeblocks(roiShift int) {
+	var d blockDecoder
+	for _, res := range tc.resolutions {
+		for _, p := range res.precincts {
+			for bi, pb := range p.bands {
+				b := res.bands[bi]
+				for _, cb := range pb.blocks {
+					if cb.passes == 0 {
+						continue
+					}
+					d.decode(cb, b.orient, tc.style.cblkStyle, b.magnitudeBits+roiShift)
+					d.store(b, cb, roiShift, tc.style.reversible)
+				}
+			}
+		}
+	}
+}
+
+// store writes the dequantized coefficients of cb to b.
+func (d *blockDecoder) store(b *band, cb *codeblock, roiShift int, reversible bool) {
+	s := d.stride()
+	bw := b.x1 - b.x0
+	for y := 0; y < d.h; y++ {
+		o := (cb.y0-b.y0+y)*bw + cb.x0 - b.x0
+		for x := 0; x < d.w; x++ {
+			i := (y+1)*s + x + 1
+			m := d.mags[i]
+			if m == 0 {
+				continue
+			}
+			if roiShift > 0 && m>>1 >= 1<<uint(roiShift) {
+				// The coefficients in the region of interest are
+				// scaled up above the background, see Annex H.
+				m >>= uint(roiShift)
+			}
+			neg := d.flags[i]&flagNeg != 0
+			if reversible {
+				v := m >> 1
+				if neg {
+					v = -v
+				}
+				b.ints[o+x] = v
+			} else {
+				v := float32(m) / 2 * b.step
+				if neg {
+					v = -v
+				}
+				b.floats[o+x] = v
+			}
+		}
+	}
+}
@@ -0,0 +1,367 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jpeg2000
+
+import (
+	"math"
+	"sort"
+)
+
+// Sub-band orientations.
+const (
+	bandLL = iota
+	bandHL
+	bandLH
+	bandHH
+)
+
+// tileComponent is a component of a tile, see B.3 in the spec.
+type tileComponent struct {
+	x0, y0, x1, y1 int
+	style          *componentStyle
+	resolutions    []*resolution
+
+	// The reconstructed samples, one of these is set depending on the
+	// wavelet transform used.
+	ints   []int32
+	floats []float32
+}
+
+type resolution struct {
+	x0, y0, x1, y1 int
+	bands          []*band
+
+	// The precinct size exponents and the size of the precinct grid.
+	ppx, ppy  int
+	pw, ph    int
+	precincts []*precinct
+}
+
+type band struct {
+	orient         int
+	x0, y0, x1, y1 int
+
+	// The number of magnitude bit-planes, Mb in the spec.
+	magnitudeBits int
+	step          float32
+
+	// The decoded coefficients.
+	ints   []int32
+	floats []float32
+}
+
+// precinct holds the code-blocks of each band of a resolution that fall
+// within a precinct.
+type precinct struct {
+	bands []precinctBand
+}
+
+type precinctBand struct {
+	blocks     []*codeblock
+	inclusion  *tagTree
+	zeroPlanes *tagTree
+}
+
+type codeblock struct {
+	x0, y0, x1, y1 int
+
+	included   bool
+	zeroPlanes int
+	lblock     int
+	passes     int
+	segments   []*segment
+}
+
+// segment is a codeword segment, i.e. the data for a run of coding passes
+// terminated together.
+type segment struct {
+	data      []byte
+	passes    int
+	maxPasses int
+}
+
+// packet identifies a packet and its position in the progression.
+type packet struct {
+	layer, res, comp, prec int
+
+	// The position of the precinct on the reference grid.
+	x, y int
+}
+
+// decodeTile decodes tile number idx.
+func (cs *codestream) decodeTile(idx int) ([]*tileComponent, error) {
+	t := &cs.tiles[idx]
+	if !t.seen {
+		t.header = newHeader(len(cs.comps))
+	}
+	cod := cs.codingStyle(t)
+
+	p, q := idx%cs.ntx, idx/cs.ntx
+	tx0 := max(cs.tx0+p*cs.tw, cs.x0)
+	ty0 := max(cs.ty0+q*cs.th, cs.y0)
+	tx1 := min(cs.tx0+(p+1)*cs.tw, cs.x1)
+	ty1 := min(cs.ty0+(q+1)*cs.th, cs.y1)
+
+	tcs := make([]*tileComponent, len(cs.comps))
+	for c := range cs.comps {
+		tc, err := cs.newTileComponent(t, c, tx0, ty0, tx1, ty1)
+		if err != nil {
+			return nil, err
+		}
+		tcs[c] = tc
+	}
+
+	packets := cs.packets(cod, tcs, tx0, ty0)
+	r := &packetReader{data: t.data, sop: cod.sop, eph: cod.eph}
+	for _, pk := range packets {
+		tc := tcs[pk.comp]
+		res := tc.resolutions[pk.res]
+		if err := r.readPacket(res.precincts[pk.prec], pk.layer, tc.style.cblkStyle); err != nil {
+			if err == errTruncated {
+				// Decode what we have.
+				break
+			}
+			return nil, err
+		}
+	}
+
+	for c, tc := range tcs {
+		tc.decodeCodeblocks(cs.roiShift(t, c))
+		tc.inverseTransform()
+	}
+
+	if cod.mct && len(tcs) >= 3 {
+		if err := inverseMCT(tcs[:3]); err != nil {
+			return nil, err
+		}
+	}
+	return tcs, nil
+}
+
+func (cs *codestream) newTileComponent(t *tileData, c, tx0, ty0, tx1, ty1 int) (*tileComponent, error) {
+	comp := cs.comps[c]
+	style := cs.componentStyle(t, c)
+	quant := cs.quantization(t, c)
+	tc := &tileComponent{
+		x0:    ceilDiv(tx0, comp.dx),
+		y0:    ceilDiv(ty0, comp.dy),
+		x1:    ceilDiv(tx1, comp.dx),
+		y1:    ceilDiv(ty1, comp.dy),
+		style: style,
+	}
+
+	nl := style.levels
+	nbands := 3*nl + 1
+	if quant.style != quantDerived && len(quant.expns) < nbands {
+		return nil, FormatError("too few quantization step sizes")
+	}
+
+	for r := 0; r <= nl; r++ {
+		// The resolution level r is the result of nl-r decompositions.
+		scale := 1 << uint(nl-r)
+		res := &resolution{
+			x0:  ceilDiv(tc.x0, scale),
+			y0:  ceilDiv(tc.y0, scale),
+			x1:  ceilDiv(tc.x1, scale),
+			y1:  ceilDiv(tc.y1, scale),
+			ppx: style.ppx[r],
+			ppy: style.ppy[r],
+		}
+		if res.x1 > res.x0 && res.y1 > res.y0 {
+			res.pw = ceilDiv(res.x1, 1<<uint(res.ppx)) - res.x0>>uint(res.ppx)
+			res.ph = ceilDiv(res.y1, 1<<uint(res.ppy)) - res.y0>>uint(res.ppy)
+		}
+
+		orients := []int{bandLL}
+		if r > 0 {
+			orients = []int{bandHL, bandLH, bandHH}
+		}
+		for i, o := range orients {
+			b := &band{orient: o}
+			if r == 0 {
+				b.x0, b.y0, b.x1, b.y1 = res.x0, res.y0, res.x1, res.y1
+			} else {
+				// Band at decomposition level nb, see equation B-15.
+				nb := nl - r + 1
+				xo, yo := o&1, o>>1
+				s := 1 << uint(nb)
+				h := 1 << uint(nb-1)
+				b.x0 = ceilDiv(tc.x0-h*xo, s)
+				b.y0 = ceilDiv(tc.y0-h*yo, s)
+				b.x1 = ceilDiv(tc.x1-h*xo, s)
+				b.y1 = ceilDiv(tc.y1-h*yo, s)
+			}
+
+			bi := 0
+			if r > 0 {
+				bi = 3*(r-1) + i + 1
+			}
+			expn, mant := 0, 0
+			if quant.style == quantDerived {
+				expn = quant.expns[0]
+				if r > 0 {
+					expn -= r - 1
+				}
+				mant = quant.mants[0]
+			} else {
+				expn, mant = quant.expns[bi], quant.mants[bi]
+			}
+			b.magnitudeBits = quant.guard + expn - 1
+
+			// The nominal dynamic range is the precision plus the log2
+			// gain of the band, see Table E.1.
+			gain := 0
+			switch o {
+			case bandHL, bandLH:
+				gain = 1
+			case bandHH:
+				gain = 2
+			}
+			rb := comp.precision + gain
+			b.step = float32(math.Ldexp(1+float64(mant)/2048, rb-expn))
+
+			w, h := b.x1-b.x0, b.y1-b.y0
+			if w < 0 || h < 0 {
+				w, h = 0, 0
+				b.x1, b.y1 = b.x0, b.y0
+			}
+			if style.reversible {
+				b.ints = make([]int32, w*h)
+			} else {
+				b.floats = make([]float32, w*h)
+			}
+			res.bands = append(res.bands, b)
+		}
+
+		res.precincts = make([]*precinct, res.pw*res.ph)
+		for i := range res.precincts {
+			res.precincts[i] = res.newPrecinct(i, r, style)
+		}
+		tc.resolutions = append(tc.resolutions, res)
+	}
+
+	return tc, nil
+}
+
+// newPrecinct creates precinct number i in resolution r with its
+// code-blocks, see B.6 and B.7 in the spec.
+func (res *resolution) newPrecinct(i, r int, style *componentStyle) *precinct {
+	px, py := res.ppx, res.ppy
+	cbw, cbh := style.cbw, style.cbh
+	if r > 0 {
+		// Precincts are halved when projected onto the sub-bands.
+		px--
+		py--
+	}
+	cbw, cbh = min(cbw, px), min(cbh, py)
+
+	// The precinct area in the sub-band coordinates.
+	gx := (res.x0>>uint(res.ppx) + i%res.pw) << uint(px)
+	gy := (res.y0>>uint(res.ppy) + i/res.pw) << uint(py)
+
+	p := &precinct{}
+	for _, b := range res.bands {
+		x0, y0 := max(gx, b.x0), max(gy, b.y0)
+		x1, y1 := min(gx+1<<uint(px), b.x1), min(gy+1<<uint(py), b.y1)
+
+		var pb precinctBand
+		if x1 > x0 && y1 > y0 {
+			bx0, by0 := x0>>uint(cbw), y0>>uint(cbh)
+			bw := ceilDiv(x1, 1<<uint(cbw)) - bx0
+			bh := ceilDiv(y1, 1<<uint(cbh)) - by0
+			for y := 0; y < bh; y++ {
+				for x := 0; x < bw; x++ {
+					cx, cy := (bx0+x)<<uint(cbw), (by0+y)<<uint(cbh)
+					pb.blocks = append(pb.blocks, &codeblock{
+						x0:     max(cx, x0),
+						y0:     max(cy, y0),
+						x1:     min(cx+1<<uint(cbw), x1),
+						y1:     min(cy+1<<uint(cbh), y1),
+						lblock: 3,
+					})
+				}
+			}
+			pb.inclusion = newTagTree(bw, bh)
+			pb.zeroPlanes = newTagTree(bw, bh)
+		}
+		p.bands = append(p.bands, pb)
+	}
+	return p
+}
+
+// packets returns the packets of a tile in the progression order, see B.12
+// in the spec.
+func (cs *codestream) packets(cod *codingStyle, tcs []*tileComponent, tx0, ty0 int) []packet {
+	var packets []packet
+	for c, tc := range tcs {
+		comp := cs.comps[c]
+		nl := tc.style.levels
+		for r, res := range tc.resolutions {
+			for i := 0; i < res.pw*res.ph; i++ {
+				// The upper left corner of the precinct on the reference
+				// grid, or the tile origin if it starts outside the tile.
+				px := (res.x0>>uint(res.ppx) + i%res.pw) << uint(res.ppx)
+				py := (res.y0>>uint(res.ppy) + i/res.pw) << uint(res.ppy)
+				x, y := tx0, ty0
+				if px > res.x0 {
+					x = px * comp.dx << uint(nl-r)
+				}
+				if py > res.y0 {
+					y = py * comp.dy << uint(nl-r)
+				}
+				for l := 0; l < cod.layers; l++ {
+					packets = append(packets, packet{layer: l, res: r, comp: c, prec: i, x: x, y: y})
+				}
+			}
+		}
+	}
+
+	var keys func(p packet) [5]int
+	switch cod.order {
+	case orderLRCP:
+		keys = func(p packet) [5]int { return [5]int{p.layer, p.res, p.comp, p.prec} }
+	case orderRLCP:
+		keys = func(p packet) [5]int { return [5]int{p.res, p.layer, p.comp, p.prec} }
+	case orderRPCL:
+		keys = func(p packet) [5]int { return [5]int{p.res, p.y, p.x, p.comp, p.layer} }
+	case orderPCRL:
+		keys = func(p packet) [5]int { return [5]int{p.y, p.x, p.comp, p.res, p.layer} }
+	case orderCPRL:
+		keys = func(p packet) [5]int { return [5]int{p.comp, p.y, p.x, p.res, p.layer} }
+	}
+	sort.SliceStable(packets, func(i, j int) bool {
+		a, b := keys(packets[i]), keys(packets[j])
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+	return packets
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
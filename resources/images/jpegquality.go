@@ -0,0 +1,138 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package images
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+const jpegDQT = 0xdb
+
+// jpegLuminanceQuant is the example luminance quantization table from
+// Annex K of the JPEG specification, which libjpeg and Go's encoder
+// scale by the quality, in zig-zag order as stored in DQT.
+var jpegLuminanceQuant = [64]int{
+	16, 11, 12, 14, 12, 10, 16, 14,
+	13, 14, 18, 17, 16, 19, 24, 40,
+	26, 24, 22, 22, 24, 49, 35, 37,
+	29, 40, 58, 51, 61, 60, 57, 51,
+	56, 55, 64, 72, 92, 78, 64, 68,
+	87, 69, 55, 56, 80, 109, 81, 87,
+	95, 98, 103, 104, 103, 62, 77, 113,
+	121, 112, 100, 120, 92, 101, 103, 99,
+}
+
+// EstimateJPEGQuality estimates the quality (1-100) the JPEG read from r was
+// encoded with from its luminance quantization table, assuming the encoder
+// scaled the example table from the JPEG specification as libjpeg does.
+// It returns 0 if r is not a JPEG or has no such table.
+func EstimateJPEGQuality(r io.Reader) (int, error) {
+	table, err := jpegLuminanceTable(r)
+	if err != nil || table == nil {
+		return 0, err
+	}
+	return estimateJPEGQuality(table), nil
+}
+
+func estimateJPEGQuality(table []int) int {
+	// Values clamped to the 8 bit range say little about the scale, skip
+	// them unless they are all we have.
+	var sum, std int
+	for i, v := range table {
+		if v > 1 && v < 255 {
+			sum += v
+			std += jpegLuminanceQuant[i]
+		}
+	}
+	if sum == 0 {
+		for i, v := range table {
+			sum += v
+			std += jpegLuminanceQuant[i]
+		}
+	}
+
+	// The inverse of the quality scaling in libjpeg's jpeg_quality_scaling.
+	scale := float64(sum) * 100 / float64(std)
+	var q float64
+	if scale <= 100 {
+		q = (200 - scale) / 2
+	} else {
+		q = 5000 / scale
+	}
+
+	quality := int(q + 0.5)
+	if quality < 1 {
+		return 1
+	}
+	if quality > 100 {
+		return 100
+	}
+	return quality
+}
+
+// jpegLuminanceTable returns quantization table 0 (the luminance table) of
+// the JPEG read from r, nil if none.
+func jpegLuminanceTable(r io.Reader) ([]int, error) {
+	br := bufio.NewReader(r)
+	var marker [2]byte
+	if _, err := io.ReadFull(br, marker[:]); err != nil || marker != [2]byte{0xff, jpegSOI} {
+		return nil, nil
+	}
+
+	for {
+		if _, err := io.ReadFull(br, marker[:]); err != nil {
+			return nil, nil
+		}
+		if marker[0] != 0xff || marker[1] == jpegSOS {
+			// The tables come before the scan.
+			return nil, nil
+		}
+		var length uint16
+		if err := binary.Read(br, binary.BigEndian, &length); err != nil || length < 2 {
+			return nil, nil
+		}
+		data := make([]byte, length-2)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, nil
+		}
+		if marker[1] != jpegDQT {
+			continue
+		}
+
+		// A DQT segment may hold several tables.
+		for len(data) > 0 {
+			precision, id := data[0]>>4, data[0]&0x0f
+			size := 64
+			if precision != 0 {
+				size = 128
+			}
+			if len(data) < 1+size {
+				return nil, nil
+			}
+			if id == 0 {
+				table := make([]int, 64)
+				for i := range table {
+					if precision != 0 {
+						table[i] = int(binary.BigEndian.Uint16(data[1+2*i:]))
+					} else {
+						table[i] = int(data[1+i])
+					}
+				}
+				return table, nil
+			}
+			data = data[1+size:]
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestEstimateJPEGQuality(t *testing.T) {
+	c := qt.New(t)
+
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 16), G: uint8(y * 16), B: 0x80, A: 255})
+		}
+	}
+
+	for _, quality := range []int{5, 10, 30, 50, 75, 85, 90, 95, 100} {
+		var buf bytes.Buffer
+		c.Assert(jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}), qt.IsNil)
+		got, err := EstimateJPEGQuality(&buf)
+		c.Assert(err, qt.IsNil)
+		diff := got - quality
+		if diff < 0 {
+			diff = -diff
+		}
+		c.Assert(diff <= 2, qt.Equals, true, qt.Commentf("quality %d estimated as %d", quality, got))
+	}
+
+	var buf bytes.Buffer
+	c.Assert(png.Encode(&buf, img), qt.IsNil)
+	got, err := EstimateJPEGQuality(&buf)
+	c.Assert(err, qt.IsNil)
+	c.Assert(got, qt.Equals, 0)
+}
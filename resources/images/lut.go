@@ -0,0 +1,258 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/draw"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gohugoio/hugo/resources/resource"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*lutFilter)(nil)
+
+// lutFilter maps the colors of an image through a 3D lookup table.
+type lutFilter struct {
+	lut *colorLUT
+}
+
+// colorLUT is a 3D color lookup table with size entries per channel. The
+// output colors are stored with red changing fastest, then green and blue.
+type colorLUT struct {
+	size int
+	data []float32
+
+	// The input range of the table, 0 to 1 if not set.
+	domainMin, domainMax [3]float32
+}
+
+func (f lutFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	gift.ColorFunc(func(r, g, b, a float32) (float32, float32, float32, float32) {
+		r, g, b = f.lut.lookup(r, g, b)
+		return r, g, b, a
+	}).Draw(dst, src, options)
+}
+
+func (f lutFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
+
+// lookup finds the output color of r, g, b, in range 0-1, using trilinear
+// interpolation between the closest entries.
+func (l *colorLUT) lookup(r, g, b float32) (float32, float32, float32) {
+	max := float32(l.size - 1)
+
+	split := func(v float32, ch int) (int, int, float32) {
+		if l.domainMax[ch] != 0 {
+			v = (v - l.domainMin[ch]) / (l.domainMax[ch] - l.domainMin[ch])
+		}
+		v = float32(math.Max(0, math.Min(1, float64(v)))) * max
+		i0 := int(v)
+		if i0 >= l.size-1 {
+			return l.size - 1, l.size - 1, 0
+		}
+		return i0, i0 + 1, v - float32(i0)
+	}
+
+	r0, r1, fr := split(r, 0)
+	g0, g1, fg := split(g, 1)
+	b0, b1, fb := split(b, 2)
+
+	var out [3]float32
+	for ch := 0; ch < 3; ch++ {
+		at := func(ri, gi, bi int) float32 {
+			return l.data[3*(ri+gi*l.size+bi*l.size*l.size)+ch]
+		}
+		lerp := func(v0, v1, t float32) float32 {
+			return v0 + (v1-v0)*t
+		}
+
+		c00 := lerp(at(r0, g0, b0), at(r1, g0, b0), fr)
+		c10 := lerp(at(r0, g1, b0), at(r1, g1, b0), fr)
+		c01 := lerp(at(r0, g0, b1), at(r1, g0, b1), fr)
+		c11 := lerp(at(r0, g1, b1), at(r1, g1, b1), fr)
+
+		out[ch] = lerp(lerp(c00, c10, fg), lerp(c01, c11, fg), fb)
+	}
+
+	return out[0], out[1], out[2]
+}
+
+// loadLUT reads a HALD CLUT image or a .cube file from the given resource.
+// It also returns a hash of the content.
+func loadLUT(r resource.ReadSeekCloserResource) (*colorLUT, string, error) {
+	b, hash, err := readResource(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var lut *colorLUT
+	if img, _, err := image.Decode(bytes.NewReader(b)); err == nil {
+		lut, err = parseHALDCLUT(img)
+		if err != nil {
+			return nil, "", err
+		}
+	} else {
+		lut, err = parseCubeLUT(b)
+		if err != nil {
+			return nil, "", fmt.Errorf("not a HALD CLUT image or a valid .cube file: %s", err)
+		}
+	}
+
+	return lut, hash, nil
+}
+
+// readResource reads the content of r and returns it with its MD5 hash.
+func readResource(r resource.ReadSeekCloserResource) ([]byte, string, error) {
+	f, err := r.ReadSeekCloser()
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sum := md5.Sum(b)
+	return b, hex.EncodeToString(sum[:]), nil
+}
+
+// parseHALDCLUT reads the lookup table from a HALD CLUT image of level l,
+// a square image of l^3 pixels holding a table with l^2 entries per channel.
+func parseHALDCLUT(img image.Image) (*colorLUT, error) {
+	bounds := img.Bounds()
+	w := bounds.Dx()
+	level := int(math.Round(math.Cbrt(float64(w))))
+	if w != bounds.Dy() || level < 2 || level*level*level != w {
+		return nil, fmt.Errorf("invalid HALD CLUT image size %dx%d", w, bounds.Dy())
+	}
+
+	size := level * level
+	lut := &colorLUT{size: size, data: make([]float32, 0, 3*size*size*size)}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := nrgbaFloats(img.At(x, y))
+			lut.data = append(lut.data, r, g, b)
+		}
+	}
+
+	return lut, nil
+}
+
+// parseCubeLUT reads the lookup table from an Adobe/Resolve .cube file.
+// Only 3D tables are supported.
+func parseCubeLUT(b []byte) (*colorLUT, error) {
+	var (
+		lut                  *colorLUT
+		domainMin, domainMax [3]float32
+		domainSet            bool
+	)
+
+	parseTriple := func(fields []string) ([3]float32, error) {
+		var v [3]float32
+		if len(fields) != 3 {
+			return v, fmt.Errorf("expected 3 values, got %d", len(fields))
+		}
+		for i, s := range fields {
+			f, err := strconv.ParseFloat(s, 32)
+			if err != nil {
+				return v, err
+			}
+			v[i] = float32(f)
+		}
+		return v, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "TITLE":
+		case "LUT_1D_SIZE":
+			return nil, fmt.Errorf("1D LUTs are not supported")
+		case "LUT_3D_SIZE":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("invalid line %q", line)
+			}
+			size, err := strconv.Atoi(fields[1])
+			if err != nil || size < 2 || size > 256 {
+				return nil, fmt.Errorf("invalid LUT size %q", fields[1])
+			}
+			lut = &colorLUT{size: size, data: make([]float32, 0, 3*size*size*size)}
+		case "DOMAIN_MIN", "DOMAIN_MAX":
+			v, err := parseTriple(fields[1:])
+			if err != nil {
+				return nil, err
+			}
+			if fields[0] == "DOMAIN_MIN" {
+				domainMin = v
+			} else {
+				domainMax = v
+			}
+			domainSet = true
+		default:
+			if lut == nil {
+				return nil, fmt.Errorf("LUT_3D_SIZE must be set before the data")
+			}
+			v, err := parseTriple(fields)
+			if err != nil {
+				return nil, err
+			}
+			if len(lut.data) == cap(lut.data) {
+				return nil, fmt.Errorf("too many LUT entries")
+			}
+			lut.data = append(lut.data, v[0], v[1], v[2])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if lut == nil {
+		return nil, fmt.Errorf("missing LUT_3D_SIZE")
+	}
+	if len(lut.data) != cap(lut.data) {
+		return nil, fmt.Errorf("expected %d LUT entries, got %d", cap(lut.data)/3, len(lut.data)/3)
+	}
+
+	if domainSet {
+		for i := range domainMax {
+			if domainMax[i] <= domainMin[i] {
+				return nil, fmt.Errorf("invalid LUT domain")
+			}
+		}
+		lut.domainMin, lut.domainMax = domainMin, domainMax
+	}
+
+	return lut, nil
+}
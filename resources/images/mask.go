@@ -0,0 +1,71 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*circleMaskFilter)(nil)
+
+// circleMaskFilter makes the pixels outside the largest circle that fits in
+// the image transparent. The edge is anti-aliased.
+type circleMaskFilter struct{}
+
+func (f circleMaskFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	srcBounds := src.Bounds()
+	w, h := srcBounds.Dx(), srcBounds.Dy()
+	cx, cy := float64(w)/2, float64(h)/2
+	radius := math.Min(cx, cy)
+
+	dstBounds := dst.Bounds()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			// The part of the pixel covered by the circle.
+			coverage := math.Max(0, math.Min(1, radius-math.Sqrt(dx*dx+dy*dy)+0.5))
+
+			c := color.NRGBA64Model.Convert(src.At(srcBounds.Min.X+x, srcBounds.Min.Y+y)).(color.NRGBA64)
+			c.A = uint16(float64(c.A) * coverage)
+			dst.Set(dstBounds.Min.X+x, dstBounds.Min.Y+y, c)
+		}
+	}
+}
+
+func (f circleMaskFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
+
+func (f circleMaskFilter) requiresTransparency() bool {
+	return true
+}
+
+// AlphaMask returns the alpha channel of src as a grayscale image, white
+// where src is opaque.
+func AlphaMask(src image.Image) *image.Gray {
+	bounds := src.Bounds()
+	dst := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			_, _, _, a := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			dst.Pix[y*dst.Stride+x] = uint8(a >> 8)
+		}
+	}
+	return dst
+}
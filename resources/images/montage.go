@@ -0,0 +1,104 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/gohugoio/hugo/resources/resource"
+
+	"github.com/disintegration/gift"
+	"github.com/pkg/errors"
+)
+
+var _ gift.Filter = (*montageFilter)(nil)
+
+// montageFilter lays out the image and the other images in a grid of
+// cells, e.g. for a contact sheet. Each image is cropped to fill its cell.
+type montageFilter struct {
+	others []image.Image
+
+	cols                  int
+	cellWidth, cellHeight int
+	gap                   int
+	bg                    color.Color
+}
+
+// NewMontage creates a filter that lays out the image, followed by others, in
+// a grid with the given number of columns, e.g. for a contact sheet. Each
+// image is cropped to fill a cell of cellWidth x cellHeight, with gap pixels
+// between the cells. bg is the hex color of the gaps and any empty cells,
+// default is white.
+func NewMontage(others []resource.ReadSeekCloserResource, cols, cellWidth, cellHeight, gap int, bg string) (gift.Filter, error) {
+	if cols < 1 {
+		return nil, errors.New("montage must have at least one column")
+	}
+	if cellWidth < 1 || cellHeight < 1 {
+		return nil, errors.New("montage cell width and height must be positive numbers")
+	}
+	if gap < 0 {
+		return nil, errors.New("montage gap must be a positive number")
+	}
+
+	f := montageFilter{cols: cols, cellWidth: cellWidth, cellHeight: cellHeight, gap: gap, bg: color.White}
+	if bg != "" {
+		c, err := ParseColor(bg)
+		if err != nil {
+			return nil, err
+		}
+		f.bg = c
+	}
+
+	hashes := make([]string, len(others))
+	for i, r := range others {
+		img, hash, err := loadImageResource(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load montage image")
+		}
+		f.others = append(f.others, img)
+		hashes[i] = hash
+	}
+
+	return filter{
+		Options: newFilterOpts(hashes, cols, cellWidth, cellHeight, gap, hexColor(color.NRGBAModel.Convert(f.bg).(color.NRGBA))),
+		Filter:  f,
+	}, nil
+}
+
+func (f montageFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	db := dst.Bounds()
+	draw.Draw(dst, db, image.NewUniform(f.bg), image.Point{}, draw.Src)
+
+	g := gift.New(gift.ResizeToFill(f.cellWidth, f.cellHeight, gift.LinearResampling, gift.CenterAnchor))
+	for i, img := range append([]image.Image{src}, f.others...) {
+		cell := image.NewNRGBA(g.Bounds(img.Bounds()))
+		g.Draw(cell, img)
+
+		col, row := i%f.cols, i/f.cols
+		pt := image.Pt(col*(f.cellWidth+f.gap), row*(f.cellHeight+f.gap)).Add(db.Min)
+		draw.Draw(dst, cell.Bounds().Add(pt), cell, image.Point{}, draw.Over)
+	}
+}
+
+func (f montageFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	rows := (len(f.others) + f.cols) / f.cols
+	return image.Rect(0, 0, f.cols*f.cellWidth+(f.cols-1)*f.gap, rows*f.cellHeight+(rows-1)*f.gap)
+}
+
+func (f montageFilter) requiresTransparency() bool {
+	_, _, _, a := f.bg.RGBA()
+	return a < 0xffff
+}
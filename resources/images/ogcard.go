@@ -0,0 +1,152 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+
+	"github.com/gohugoio/hugo/resources/resource"
+)
+
+// The size of an Open Graph card, as recommended by e.g. Facebook.
+const (
+	OpenGraphCardWidth  = 1200
+	OpenGraphCardHeight = 630
+)
+
+// OpenGraphCardOptions configures an Open Graph card.
+type OpenGraphCardOptions struct {
+	// The title drawn in the lower part of the card.
+	Title string
+
+	// An optional logo image, drawn in the upper left corner.
+	Logo resource.ReadSeekCloserResource
+
+	// The hex color of the title. Default is white.
+	Color string
+
+	// The hex color the image is darkened to at the bottom. Default is black
+	// at 75% opacity.
+	Shade string
+
+	// The font size of the title in pixels. Default is 64. Long titles are
+	// drawn smaller to fit.
+	FontSize int
+}
+
+// DecodeOpenGraphCardOptions decodes the Open Graph card options in m, e.g.
+// from a dict in a template, and sets the defaults.
+func DecodeOpenGraphCardOptions(m map[string]interface{}) (OpenGraphCardOptions, error) {
+	opts := OpenGraphCardOptions{
+		Color:    "#ffffff",
+		Shade:    "#000000c0",
+		FontSize: 64,
+	}
+
+	if err := mapstructure.WeakDecode(m, &opts); err != nil {
+		return opts, errors.Wrap(err, "failed to decode Open Graph card options")
+	}
+
+	if opts.FontSize < minTextSize {
+		return opts, errors.Errorf("Open Graph card font size must be at least %d", minTextSize)
+	}
+
+	return opts, nil
+}
+
+var _ gift.Filter = (*openGraphCardFilter)(nil)
+
+// openGraphCardFilter darkens the image towards the bottom and draws a title
+// and an optional logo over it.
+type openGraphCardFilter struct {
+	title    string
+	logo     image.Image
+	color    color.Color
+	shade    color.Color
+	fontSize int
+}
+
+// NewOpenGraphCard creates a filter that composes an Open Graph card from
+// the image, which should already be filled to the card size.
+func NewOpenGraphCard(opts OpenGraphCardOptions) (gift.Filter, error) {
+	if _, err := getTextFont(); err != nil {
+		return nil, err
+	}
+
+	f := openGraphCardFilter{title: opts.Title, fontSize: opts.FontSize}
+
+	var err error
+	if f.color, err = ParseColor(opts.Color); err != nil {
+		return nil, err
+	}
+	if f.shade, err = ParseColor(opts.Shade); err != nil {
+		return nil, err
+	}
+
+	var logoHash string
+	if opts.Logo != nil {
+		f.logo, logoHash, err = loadImageResource(opts.Logo)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load Open Graph card logo")
+		}
+	}
+
+	return filter{
+		Options: newFilterOpts(
+			f.title, logoHash,
+			hexColor(color.NRGBAModel.Convert(f.color).(color.NRGBA)),
+			hexColor(color.NRGBAModel.Convert(f.shade).(color.NRGBA)),
+			f.fontSize),
+		Filter: f,
+	}, nil
+}
+
+func (f openGraphCardFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	shade := gradientOverlayFilter{direction: "bottom", startColor: color.Transparent, endColor: f.shade}
+	shade.Draw(dst, src, options)
+
+	b := dst.Bounds()
+	pad := b.Dx() / 20
+
+	if f.logo != nil {
+		// Scale the logo to fit a box in the upper left corner.
+		maxW, maxH := b.Dx()/4, b.Dy()/6
+		logo := f.logo
+		if lb := logo.Bounds(); lb.Dx() > maxW || lb.Dy() > maxH {
+			g := gift.New(gift.ResizeToFit(maxW, maxH, gift.LanczosResampling))
+			scaled := image.NewNRGBA(g.Bounds(lb))
+			g.Draw(scaled, logo)
+			logo = scaled
+		}
+		lb := logo.Bounds()
+		r := image.Rect(0, 0, lb.Dx(), lb.Dy()).Add(b.Min).Add(image.Pt(pad, pad))
+		draw.Draw(dst, r, logo, lb.Min, draw.Over)
+	}
+
+	if f.title != "" {
+		r := image.Rect(b.Min.X+pad, b.Min.Y+b.Dy()/3, b.Max.X-pad, b.Max.Y-pad)
+		// Any error is from the embedded font, checked in NewOpenGraphCard.
+		_ = drawText(dst, r, f.title, float64(f.fontSize), f.color)
+	}
+}
+
+func (f openGraphCardFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*padFilter)(nil)
+
+// padFilter scales the image to fit inside width x height and places it on
+// a canvas of exactly that size, filled with color.
+type padFilter struct {
+	width, height int
+	anchor        gift.Anchor
+	color         color.Color
+	resampling    gift.Resampling
+	noUpscale     bool
+}
+
+func (f padFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	sb := src.Bounds()
+	w, h := f.fitSize(sb.Dx(), sb.Dy())
+
+	var fitted image.Image = src
+	if w != sb.Dx() || h != sb.Dy() {
+		g := gift.New(gift.Resize(w, h, f.resampling))
+		tmp := image.NewNRGBA(g.Bounds(sb))
+		g.Draw(tmp, src)
+		fitted = tmp
+	}
+
+	b := dst.Bounds()
+	draw.Draw(dst, b, image.NewUniform(f.color), image.ZP, draw.Src)
+
+	pt := padAnchorPoint(f.anchor, b.Dx()-w, b.Dy()-h).Add(b.Min)
+	draw.Draw(dst, image.Rectangle{Min: pt, Max: pt.Add(image.Pt(w, h))}, fitted, fitted.Bounds().Min, draw.Over)
+}
+
+func (f padFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, f.width, f.height)
+}
+
+// fitSize returns the dimensions of a width x height image scaled to fit
+// inside the box, preserving the aspect ratio.
+func (f padFilter) fitSize(width, height int) (int, int) {
+	if width <= 0 || height <= 0 {
+		return 0, 0
+	}
+	if f.noUpscale && width <= f.width && height <= f.height {
+		return width, height
+	}
+
+	if width*f.height > height*f.width {
+		// Wider than the box.
+		h := int(float64(height)*float64(f.width)/float64(width) + 0.5)
+		if h < 1 {
+			h = 1
+		}
+		return f.width, h
+	}
+	w := int(float64(width)*float64(f.height)/float64(height) + 0.5)
+	if w < 1 {
+		w = 1
+	}
+	return w, f.height
+}
+
+// padAnchorPoint returns where to place the image given the free space
+// (dx, dy) in the canvas.
+func padAnchorPoint(anchor gift.Anchor, dx, dy int) image.Point {
+	switch anchor {
+	case gift.TopLeftAnchor:
+		return image.Pt(0, 0)
+	case gift.TopAnchor:
+		return image.Pt(dx/2, 0)
+	case gift.TopRightAnchor:
+		return image.Pt(dx, 0)
+	case gift.LeftAnchor:
+		return image.Pt(0, dy/2)
+	case gift.RightAnchor:
+		return image.Pt(dx, dy/2)
+	case gift.BottomLeftAnchor:
+		return image.Pt(0, dy)
+	case gift.BottomAnchor:
+		return image.Pt(dx/2, dy)
+	case gift.BottomRightAnchor:
+		return image.Pt(dx, dy)
+	default:
+		return image.Pt(dx/2, dy/2)
+	}
+}
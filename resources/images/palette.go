@@ -0,0 +1,139 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*paletteFilter)(nil)
+
+// The dithering modes of the palette filter.
+const (
+	ditherFloydSteinberg = "floydsteinberg"
+	ditherOrdered        = "ordered"
+	ditherNone           = "none"
+)
+
+// cgaPalette is the full 16 color palette of the IBM Color Graphics Adapter.
+var cgaPalette = color.Palette{
+	color.RGBA{0x00, 0x00, 0x00, 0xff},
+	color.RGBA{0x00, 0x00, 0xaa, 0xff},
+	color.RGBA{0x00, 0xaa, 0x00, 0xff},
+	color.RGBA{0x00, 0xaa, 0xaa, 0xff},
+	color.RGBA{0xaa, 0x00, 0x00, 0xff},
+	color.RGBA{0xaa, 0x00, 0xaa, 0xff},
+	color.RGBA{0xaa, 0x55, 0x00, 0xff},
+	color.RGBA{0xaa, 0xaa, 0xaa, 0xff},
+	color.RGBA{0x55, 0x55, 0x55, 0xff},
+	color.RGBA{0x55, 0x55, 0xff, 0xff},
+	color.RGBA{0x55, 0xff, 0x55, 0xff},
+	color.RGBA{0x55, 0xff, 0xff, 0xff},
+	color.RGBA{0xff, 0x55, 0x55, 0xff},
+	color.RGBA{0xff, 0x55, 0xff, 0xff},
+	color.RGBA{0xff, 0xff, 0x55, 0xff},
+	color.RGBA{0xff, 0xff, 0xff, 0xff},
+}
+
+// bayer4 is the 4x4 Bayer threshold matrix used for ordered dithering.
+var bayer4 = [4][4]float64{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// namedPalette returns the palette with the given name, one of "websafe",
+// "cga" or "grayscale-N" with N gray levels in range (2, 256), and the
+// distance between its neighboring color levels, used to spread the
+// ordered dithering.
+func namedPalette(name string) (color.Palette, float64, error) {
+	switch name {
+	case "websafe":
+		return palette.WebSafe, 0x33, nil
+	case "cga":
+		return cgaPalette, 0x55, nil
+	}
+
+	if strings.HasPrefix(name, "grayscale-") {
+		n, err := strconv.Atoi(strings.TrimPrefix(name, "grayscale-"))
+		if err != nil || n < 2 || n > 256 {
+			return nil, 0, fmt.Errorf("invalid number of gray levels in palette %q, must be in range (2, 256)", name)
+		}
+		p := make(color.Palette, n)
+		for i := range p {
+			v := uint8(i * 255 / (n - 1))
+			p[i] = color.Gray{Y: v}
+		}
+		return p, 255 / float64(n-1), nil
+	}
+
+	return nil, 0, fmt.Errorf("invalid palette %q, must be one of websafe, cga or grayscale-N", name)
+}
+
+// paletteFilter maps the colors of the image to the nearest color in a fixed
+// palette, with the given dithering.
+type paletteFilter struct {
+	palette color.Palette
+	spread  float64
+	dither  string
+}
+
+func (f paletteFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	srcBounds := src.Bounds()
+	paletted := image.NewPaletted(image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy()), f.palette)
+
+	switch f.dither {
+	case ditherFloydSteinberg:
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), src, srcBounds.Min)
+	case ditherOrdered:
+		for y := 0; y < srcBounds.Dy(); y++ {
+			for x := 0; x < srcBounds.Dx(); x++ {
+				c := color.NRGBAModel.Convert(src.At(srcBounds.Min.X+x, srcBounds.Min.Y+y)).(color.NRGBA)
+				offset := f.spread * ((bayer4[y%4][x%4]+0.5)/16 - 0.5)
+				c.R = clampUint8(float64(c.R) + offset)
+				c.G = clampUint8(float64(c.G) + offset)
+				c.B = clampUint8(float64(c.B) + offset)
+				paletted.SetColorIndex(x, y, uint8(f.palette.Index(c)))
+			}
+		}
+	default:
+		draw.Draw(paletted, paletted.Bounds(), src, srcBounds.Min, draw.Src)
+	}
+
+	dstBounds := dst.Bounds()
+	draw.Draw(dst, dstBounds, paletted, image.Point{}, draw.Src)
+}
+
+func (f paletteFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
+
+func clampUint8(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
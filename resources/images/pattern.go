@@ -0,0 +1,56 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*patternFilter)(nil)
+
+// patternFilter tiles an image across the image, e.g. for a watermark or a
+// texture, starting in the top left corner.
+type patternFilter struct {
+	tile image.Image
+
+	// Opacity of the tile in range 0 to 1.
+	opacity float64
+}
+
+func (f patternFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	db := dst.Bounds()
+	draw.Draw(dst, db, src, src.Bounds().Min, draw.Src)
+
+	tb := f.tile.Bounds()
+	if tb.Empty() || f.opacity <= 0 {
+		return
+	}
+
+	mask := image.NewUniform(color.Alpha16{A: uint16(f.opacity*0xffff + 0.5)})
+	for y := db.Min.Y; y < db.Max.Y; y += tb.Dy() {
+		for x := db.Min.X; x < db.Max.X; x += tb.Dx() {
+			// Tiles larger than the image are clipped.
+			r := image.Rect(x, y, x+tb.Dx(), y+tb.Dy()).Intersect(db)
+			draw.DrawMask(dst, r, f.tile, tb.Min, mask, image.Point{}, draw.Over)
+		}
+	}
+}
+
+func (f patternFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
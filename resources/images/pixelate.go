@@ -0,0 +1,135 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*pixelateFilter)(nil)
+
+const (
+	pixelateSquare = "square"
+	pixelateCircle = "circle"
+	pixelateHex    = "hex"
+)
+
+// pixelateFilter divides the image into cells of the given shape and size
+// and paints each cell with the average color of the pixels it covers.
+type pixelateFilter struct {
+	size  int
+	shape string
+}
+
+func (f pixelateFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	srcBounds := src.Bounds()
+	w, h := srcBounds.Dx(), srcBounds.Dy()
+
+	type sum struct {
+		r, g, b, a, n uint64
+	}
+
+	cells := make(map[image.Point]*sum)
+	keys := make([]image.Point, w*h)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			key := f.cell(x, y)
+			keys[y*w+x] = key
+			s, found := cells[key]
+			if !found {
+				s = &sum{}
+				cells[key] = s
+			}
+			r, g, b, a := src.At(srcBounds.Min.X+x, srcBounds.Min.Y+y).RGBA()
+			s.r += uint64(r)
+			s.g += uint64(g)
+			s.b += uint64(b)
+			s.a += uint64(a)
+			s.n++
+		}
+	}
+
+	averages := make(map[image.Point]color.RGBA64, len(cells))
+	for key, s := range cells {
+		averages[key] = color.RGBA64{
+			R: uint16(s.r / s.n),
+			G: uint16(s.g / s.n),
+			B: uint16(s.b / s.n),
+			A: uint16(s.a / s.n),
+		}
+	}
+
+	dstBounds := dst.Bounds()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var c color.Color = color.Transparent
+			if f.inShape(x, y) {
+				c = averages[keys[y*w+x]]
+			}
+			dst.Set(dstBounds.Min.X+x, dstBounds.Min.Y+y, c)
+		}
+	}
+}
+
+func (f pixelateFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
+
+// cell returns the identifier of the cell the pixel at x, y belongs to.
+func (f pixelateFilter) cell(x, y int) image.Point {
+	if f.shape != pixelateHex {
+		return image.Pt(x/f.size, y/f.size)
+	}
+
+	// Pointy-topped hexagons, size pixels between the centers in a row.
+	// See https://www.redblobgames.com/grids/hexagons/
+	radius := float64(f.size) / math.Sqrt(3)
+	px, py := float64(x)+0.5, float64(y)+0.5
+	q := (math.Sqrt(3)/3*px - py/3) / radius
+	r := (2.0 / 3 * py) / radius
+
+	// Round the cube coordinates to the nearest hexagon.
+	s := -q - r
+	rq, rr, rs := math.Round(q), math.Round(r), math.Round(s)
+	dq, dr, ds := math.Abs(rq-q), math.Abs(rr-r), math.Abs(rs-s)
+	if dq > dr && dq > ds {
+		rq = -rr - rs
+	} else if dr > ds {
+		rr = -rq - rs
+	}
+
+	return image.Pt(int(rq), int(rr))
+}
+
+// inShape reports whether the pixel at x, y is painted. Only circles leave
+// gaps between the cells.
+func (f pixelateFilter) inShape(x, y int) bool {
+	if f.shape != pixelateCircle {
+		return true
+	}
+	radius := float64(f.size) / 2
+	dx := float64(x%f.size) + 0.5 - radius
+	dy := float64(y%f.size) + 0.5 - radius
+	return dx*dx+dy*dy <= radius*radius
+}
+
+func (f pixelateFilter) requiresTransparency() bool {
+	return f.shape == pixelateCircle
+}
@@ -0,0 +1,382 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package pnm implements a decoder and encoder for the Netpbm formats, as
+// specified in http://netpbm.sourceforge.net/doc/pbm.html and its siblings
+// ppm.html and pgm.html.
+//
+// All the plain (ASCII) and raw (binary) variants of PBM, PGM and PPM are
+// decoded. Images are encoded as raw PPM or PGM with 8 bits per sample.
+// The formats have no alpha channel.
+package pnm
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// A FormatError reports that the input is not a valid Netpbm image.
+type FormatError string
+
+func (e FormatError) Error() string { return "pnm: invalid format: " + string(e) }
+
+// The limit of the image package's own decoders.
+const maxPixels = 1 << 30
+
+func init() {
+	image.RegisterFormat("pbm", "P1", Decode, DecodeConfig)
+	image.RegisterFormat("pbm", "P4", Decode, DecodeConfig)
+	image.RegisterFormat("pgm", "P2", Decode, DecodeConfig)
+	image.RegisterFormat("pgm", "P5", Decode, DecodeConfig)
+	image.RegisterFormat("ppm", "P3", Decode, DecodeConfig)
+	image.RegisterFormat("ppm", "P6", Decode, DecodeConfig)
+}
+
+type header struct {
+	magic         byte
+	width, height int
+	maxVal        int
+}
+
+func (h header) plain() bool {
+	return h.magic <= '3'
+}
+
+func (h header) bitmap() bool {
+	return h.magic == '1' || h.magic == '4'
+}
+
+func (h header) color() bool {
+	return h.magic == '3' || h.magic == '6'
+}
+
+func (h header) colorModel() color.Model {
+	switch {
+	case h.color() && h.maxVal > 0xff:
+		return color.RGBA64Model
+	case h.color():
+		return color.RGBAModel
+	case h.maxVal > 0xff:
+		return color.Gray16Model
+	default:
+		return color.GrayModel
+	}
+}
+
+// reader reads the whitespace separated tokens of the header and the
+// plain formats, skipping comments.
+type reader struct {
+	*bufio.Reader
+}
+
+func (r reader) skipSpace() error {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case b == '#':
+			if _, err := r.ReadString('\n'); err != nil {
+				return err
+			}
+		case isSpace(b):
+		default:
+			return r.UnreadByte()
+		}
+	}
+}
+
+// readInt reads a decimal number. In plain PBM the digits are not
+// required to be separated, so only one digit is read for those.
+func (r reader) readInt(oneDigit bool) (int, error) {
+	if err := r.skipSpace(); err != nil {
+		return 0, err
+	}
+	var v, n int
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF && n > 0 {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if b < '0' || b > '9' {
+			if err := r.UnreadByte(); err != nil {
+				return 0, err
+			}
+			break
+		}
+		v = v*10 + int(b-'0')
+		n++
+		if v > maxPixels {
+			return 0, FormatError("number too large")
+		}
+		if oneDigit {
+			break
+		}
+	}
+	if n == 0 {
+		return 0, FormatError("expected a number")
+	}
+	return v, nil
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+}
+
+func readHeader(r reader) (header, error) {
+	var magic [2]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return header{}, err
+	}
+	if magic[0] != 'P' || magic[1] < '1' || magic[1] > '6' {
+		return header{}, FormatError("bad magic number")
+	}
+
+	h := header{magic: magic[1], maxVal: 1}
+	var err error
+	if h.width, err = r.readInt(false); err != nil {
+		return header{}, eof(err)
+	}
+	if h.height, err = r.readInt(false); err != nil {
+		return header{}, eof(err)
+	}
+	if !h.bitmap() {
+		if h.maxVal, err = r.readInt(false); err != nil {
+			return header{}, eof(err)
+		}
+		if h.maxVal == 0 || h.maxVal > 0xffff {
+			return header{}, FormatError(fmt.Sprintf("maximum value %d out of range", h.maxVal))
+		}
+	}
+	if h.width == 0 || h.height == 0 {
+		return header{}, FormatError("zero width or height")
+	}
+	if h.width > maxPixels/h.height {
+		return header{}, FormatError("image too large")
+	}
+
+	if !h.plain() {
+		// Exactly one whitespace character separates the header from the
+		// raster.
+		b, err := r.ReadByte()
+		if err != nil {
+			return header{}, eof(err)
+		}
+		if !isSpace(b) {
+			return header{}, FormatError("missing whitespace after header")
+		}
+	}
+
+	return h, nil
+}
+
+func eof(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// DecodeConfig returns the color model and dimensions of a Netpbm image
+// without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := readHeader(reader{bufio.NewReader(r)})
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: h.colorModel(), Width: h.width, Height: h.height}, nil
+}
+
+// Decode reads a Netpbm image from r and returns it as an *image.Gray or
+// *image.Gray16 for PBM and PGM, and an *image.RGBA or *image.RGBA64 for
+// PPM, depending on the maximum sample value.
+func Decode(r io.Reader) (image.Image, error) {
+	br := reader{bufio.NewReader(r)}
+	h, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := 1
+	if h.color() {
+		channels = 3
+	}
+	wide := h.maxVal > 0xff
+	rect := image.Rect(0, 0, h.width, h.height)
+
+	var (
+		img    image.Image
+		pix    []uint8
+		stride int
+	)
+	switch {
+	case h.color() && wide:
+		m := image.NewRGBA64(rect)
+		img, pix, stride = m, m.Pix, m.Stride
+	case h.color():
+		m := image.NewRGBA(rect)
+		img, pix, stride = m, m.Pix, m.Stride
+	case wide:
+		m := image.NewGray16(rect)
+		img, pix, stride = m, m.Pix, m.Stride
+	default:
+		m := image.NewGray(rect)
+		img, pix, stride = m, m.Pix, m.Stride
+	}
+
+	samples := make([]int, h.width*channels)
+	var row []byte
+	for y := 0; y < h.height; y++ {
+		switch {
+		case h.magic == '4':
+			stride := (h.width + 7) / 8
+			if len(row) != stride {
+				row = make([]byte, stride)
+			}
+			if _, err := io.ReadFull(br, row); err != nil {
+				return nil, eof(err)
+			}
+			for x := range samples {
+				samples[x] = int(row[x/8]>>(7-uint(x%8))) & 1
+			}
+		case h.plain():
+			for x := range samples {
+				v, err := br.readInt(h.bitmap())
+				if err != nil {
+					return nil, eof(err)
+				}
+				if v > h.maxVal {
+					return nil, FormatError("sample out of range")
+				}
+				samples[x] = v
+			}
+		default:
+			size := len(samples)
+			if wide {
+				size *= 2
+			}
+			if len(row) != size {
+				row = make([]byte, size)
+			}
+			if _, err := io.ReadFull(br, row); err != nil {
+				return nil, eof(err)
+			}
+			for x := range samples {
+				var v int
+				if wide {
+					v = int(row[2*x])<<8 | int(row[2*x+1])
+				} else {
+					v = int(row[x])
+				}
+				if v > h.maxVal {
+					return nil, FormatError("sample out of range")
+				}
+				samples[x] = v
+			}
+		}
+
+		if h.bitmap() {
+			// In PBM 1 is black.
+			for x, v := range samples {
+				samples[x] = 1 - v
+			}
+		}
+
+		// Scale the samples to the full range of 8 or 16 bits.
+		max := 0xff
+		if wide {
+			max = 0xffff
+		}
+		if h.maxVal != max {
+			for x, v := range samples {
+				samples[x] = (v*max + h.maxVal/2) / h.maxVal
+			}
+		}
+
+		// The samples are stored as is, with an opaque alpha for PPM.
+		i := y * stride
+		for x := 0; x < h.width; x++ {
+			for c := 0; c < channels; c++ {
+				v := samples[x*channels+c]
+				if wide {
+					pix[i], pix[i+1] = uint8(v>>8), uint8(v)
+					i += 2
+				} else {
+					pix[i] = uint8(v)
+					i++
+				}
+			}
+			if h.color() {
+				if wide {
+					pix[i], pix[i+1] = 0xff, 0xff
+					i += 2
+				} else {
+					pix[i] = 0xff
+					i++
+				}
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// Encode writes the image m to w as a raw PPM. Any transparency is
+// composited onto black.
+func Encode(w io.Writer, m image.Image) error {
+	return encode(w, m, '6')
+}
+
+// EncodeGray writes the image m to w as a raw PGM, converting the colors
+// to gray.
+func EncodeGray(w io.Writer, m image.Image) error {
+	return encode(w, m, '5')
+}
+
+func encode(w io.Writer, m image.Image, magic byte) error {
+	b := m.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return FormatError("zero width or height")
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "P%c\n%d %d\n255\n", magic, b.Dx(), b.Dy()); err != nil {
+		return err
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var err error
+			if magic == '5' {
+				err = bw.WriteByte(color.GrayModel.Convert(m.At(x, y)).(color.Gray).Y)
+			} else {
+				c := color.RGBAModel.Convert(m.At(x, y)).(color.RGBA)
+				_, err = bw.Write([]byte{c.R, c.G, c.B})
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
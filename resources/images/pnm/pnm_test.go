@@ -0,0 +1,129 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pnm
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestRoundTrip(t *testing.T) {
+	c := qt.New(t)
+
+	src := image.NewRGBA(image.Rect(0, 0, 37, 21))
+	for y := 0; y < 21; y++ {
+		for x := 0; x < 37; x++ {
+			src.SetRGBA(x, y, color.RGBA{R: uint8(x * 7), G: uint8(y * 12), B: uint8(x * y), A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	c.Assert(Encode(&buf, src), qt.IsNil)
+	c.Assert(strings.HasPrefix(buf.String(), "P6\n37 21\n255\n"), qt.Equals, true)
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(buf.Bytes()))
+	c.Assert(err, qt.IsNil)
+	c.Assert(format, qt.Equals, "ppm")
+	c.Assert(config.Width, qt.Equals, 37)
+	c.Assert(config.Height, qt.Equals, 21)
+	c.Assert(config.ColorModel, qt.Equals, color.RGBAModel)
+
+	decoded, err := Decode(bytes.NewReader(buf.Bytes()))
+	c.Assert(err, qt.IsNil)
+	c.Assert(decoded.(*image.RGBA).Pix, qt.DeepEquals, src.Pix)
+
+	gray := image.NewGray(src.Bounds())
+	for y := 0; y < 21; y++ {
+		for x := 0; x < 37; x++ {
+			gray.SetGray(x, y, color.Gray{Y: uint8(x + y*37)})
+		}
+	}
+
+	buf.Reset()
+	c.Assert(EncodeGray(&buf, gray), qt.IsNil)
+	_, format, err = image.DecodeConfig(bytes.NewReader(buf.Bytes()))
+	c.Assert(err, qt.IsNil)
+	c.Assert(format, qt.Equals, "pgm")
+	decoded, err = Decode(bytes.NewReader(buf.Bytes()))
+	c.Assert(err, qt.IsNil)
+	c.Assert(decoded.(*image.Gray).Pix, qt.DeepEquals, gray.Pix)
+}
+
+func TestDecodeVariants(t *testing.T) {
+	c := qt.New(t)
+
+	for _, test := range []struct {
+		name     string
+		data     string
+		expected image.Image
+	}{
+		{
+			"plain PBM", "P1\n# A comment\n3 2\n101\n0 1 0\n",
+			&image.Gray{Pix: []uint8{0, 0xff, 0, 0xff, 0, 0xff}, Stride: 3, Rect: image.Rect(0, 0, 3, 2)},
+		},
+		{
+			"raw PBM", "P4\n3 2\n\xa0\x40",
+			&image.Gray{Pix: []uint8{0, 0xff, 0, 0xff, 0, 0xff}, Stride: 3, Rect: image.Rect(0, 0, 3, 2)},
+		},
+		{
+			"plain PGM with max value 15", "P2 2 1 15 0 15",
+			&image.Gray{Pix: []uint8{0, 0xff}, Stride: 2, Rect: image.Rect(0, 0, 2, 1)},
+		},
+		{
+			"raw PGM with 16 bits", "P5\n1 1\n65535\n\x12\x34",
+			&image.Gray16{Pix: []uint8{0x12, 0x34}, Stride: 2, Rect: image.Rect(0, 0, 1, 1)},
+		},
+		{
+			"plain PPM", "P3\n1 1\n255\n10 20 30\n",
+			&image.RGBA{Pix: []uint8{10, 20, 30, 0xff}, Stride: 4, Rect: image.Rect(0, 0, 1, 1)},
+		},
+		{
+			"raw PPM with 16 bits", "P6\n1 1\n65535\n\x00\x01\x00\x02\x00\x03",
+			&image.RGBA64{Pix: []uint8{0, 1, 0, 2, 0, 3, 0xff, 0xff}, Stride: 8, Rect: image.Rect(0, 0, 1, 1)},
+		},
+	} {
+		c.Run(test.name, func(c *qt.C) {
+			img, err := Decode(strings.NewReader(test.data))
+			c.Assert(err, qt.IsNil)
+			c.Assert(img, qt.DeepEquals, test.expected)
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	c := qt.New(t)
+
+	_, err := Decode(strings.NewReader("P6\n2 2\n255\n\x00\x00\x00"))
+	c.Assert(err, qt.Equals, io.ErrUnexpectedEOF)
+
+	_, err = Decode(strings.NewReader("P6\n2"))
+	c.Assert(err, qt.Equals, io.ErrUnexpectedEOF)
+
+	_, err = Decode(strings.NewReader("P7\n2 2\n255\n"))
+	c.Assert(err, qt.Equals, FormatError("bad magic number"))
+
+	_, err = DecodeConfig(strings.NewReader("P6\n0 2\n255\n"))
+	c.Assert(err, qt.Equals, FormatError("zero width or height"))
+
+	_, err = Decode(strings.NewReader("P2\n1 1\n15\n16\n"))
+	c.Assert(err, qt.Equals, FormatError("sample out of range"))
+
+	_, err = DecodeConfig(strings.NewReader("P6\n1 1\n70000\n"))
+	c.Assert(err, qt.ErrorMatches, ".*maximum value 70000 out of range")
+}
@@ -0,0 +1,276 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package qoi implements a decoder and encoder for QOI, the Quite OK Image
+// format, as specified in https://qoiformat.org/qoi-specification.pdf.
+//
+// QOI is lossless and much faster to decode and encode than PNG, at the cost
+// of larger files.
+package qoi
+
+import (
+	"bufio"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+// A FormatError reports that the input is not a valid QOI image.
+type FormatError string
+
+func (e FormatError) Error() string { return "qoi: invalid format: " + string(e) }
+
+const (
+	magic      = "qoif"
+	headerSize = 14
+
+	// The limit of the reference implementation.
+	maxPixels = 400000000
+)
+
+const (
+	opIndex = 0x00
+	opDiff  = 0x40
+	opLuma  = 0x80
+	opRun   = 0xc0
+	opRGB   = 0xfe
+	opRGBA  = 0xff
+
+	mask2 = 0xc0
+)
+
+var endMarker = []byte{0, 0, 0, 0, 0, 0, 0, 1}
+
+func init() {
+	image.RegisterFormat("qoi", magic, Decode, DecodeConfig)
+}
+
+type pixel struct {
+	r, g, b, a uint8
+}
+
+func (p pixel) hash() int {
+	return (int(p.r)*3 + int(p.g)*5 + int(p.b)*7 + int(p.a)*11) % 64
+}
+
+type header struct {
+	width, height int
+	channels      uint8
+}
+
+func readHeader(r io.Reader) (header, error) {
+	var b [headerSize]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return header{}, err
+	}
+	if string(b[:4]) != magic {
+		return header{}, FormatError("missing magic bytes")
+	}
+
+	h := header{
+		width:    int(binary.BigEndian.Uint32(b[4:8])),
+		height:   int(binary.BigEndian.Uint32(b[8:12])),
+		channels: b[12],
+	}
+	if h.channels != 3 && h.channels != 4 {
+		return h, FormatError("invalid number of channels")
+	}
+	if b[13] > 1 {
+		return h, FormatError("invalid color space")
+	}
+	if h.width == 0 || h.height == 0 || h.width > maxPixels/h.height {
+		return h, FormatError("invalid dimensions")
+	}
+
+	return h, nil
+}
+
+// DecodeConfig returns the color model and dimensions of a QOI image
+// without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: h.width, Height: h.height}, nil
+}
+
+// Decode reads a QOI image from r and returns it as an *image.NRGBA.
+func Decode(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, h.width, h.height))
+
+	var (
+		index [64]pixel
+		px    = pixel{a: 255}
+		run   int
+	)
+
+	for i := 0; i < len(img.Pix); i += 4 {
+		if run > 0 {
+			run--
+		} else {
+			b1, err := br.ReadByte()
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+
+			switch {
+			case b1 == opRGB || b1 == opRGBA:
+				n := 3
+				if b1 == opRGBA {
+					n = 4
+				}
+				var b [4]byte
+				if _, err := io.ReadFull(br, b[:n]); err != nil {
+					return nil, unexpectedEOF(err)
+				}
+				px.r, px.g, px.b = b[0], b[1], b[2]
+				if b1 == opRGBA {
+					px.a = b[3]
+				}
+			case b1&mask2 == opIndex:
+				px = index[b1]
+			case b1&mask2 == opDiff:
+				px.r += (b1>>4)&0x03 - 2
+				px.g += (b1>>2)&0x03 - 2
+				px.b += b1&0x03 - 2
+			case b1&mask2 == opLuma:
+				b2, err := br.ReadByte()
+				if err != nil {
+					return nil, unexpectedEOF(err)
+				}
+				vg := b1&0x3f - 32
+				px.r += vg - 8 + (b2>>4)&0x0f
+				px.g += vg
+				px.b += vg - 8 + b2&0x0f
+			default:
+				run = int(b1 & 0x3f)
+			}
+
+			index[px.hash()] = px
+		}
+
+		img.Pix[i+0] = px.r
+		img.Pix[i+1] = px.g
+		img.Pix[i+2] = px.b
+		img.Pix[i+3] = px.a
+	}
+
+	return img, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Encode writes img to w in QOI format. Opaque images are written with
+// three channels.
+func Encode(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 || b.Dx() > maxPixels/b.Dy() {
+		return FormatError("invalid dimensions")
+	}
+
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		nrgba = image.NewNRGBA(b)
+		draw.Draw(nrgba, b, img, b.Min, draw.Src)
+	}
+
+	var channels uint8 = 4
+	if nrgba.Opaque() {
+		channels = 3
+	}
+
+	bw := bufio.NewWriter(w)
+
+	var hb [headerSize]byte
+	copy(hb[:], magic)
+	binary.BigEndian.PutUint32(hb[4:8], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(hb[8:12], uint32(b.Dy()))
+	hb[12] = channels
+	bw.Write(hb[:])
+
+	var (
+		index [64]pixel
+		prev  = pixel{a: 255}
+		run   int
+	)
+
+	last := b.Dx()*b.Dy() - 1
+	n := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := nrgba.Pix[nrgba.PixOffset(b.Min.X, y):]
+		for x := 0; x < b.Dx(); x, n = x+1, n+1 {
+			px := pixel{row[x*4], row[x*4+1], row[x*4+2], row[x*4+3]}
+
+			if px == prev {
+				run++
+				if run == 62 || n == last {
+					bw.WriteByte(opRun | byte(run-1))
+					run = 0
+				}
+				continue
+			}
+
+			if run > 0 {
+				bw.WriteByte(opRun | byte(run-1))
+				run = 0
+			}
+
+			h := px.hash()
+			switch {
+			case index[h] == px:
+				bw.WriteByte(opIndex | byte(h))
+			case px.a != prev.a:
+				index[h] = px
+				bw.Write([]byte{opRGBA, px.r, px.g, px.b, px.a})
+			default:
+				index[h] = px
+				vr := int8(px.r - prev.r)
+				vg := int8(px.g - prev.g)
+				vb := int8(px.b - prev.b)
+				vgr, vgb := vr-vg, vb-vg
+
+				switch {
+				case vr > -3 && vr < 2 && vg > -3 && vg < 2 && vb > -3 && vb < 2:
+					bw.WriteByte(opDiff | byte(vr+2)<<4 | byte(vg+2)<<2 | byte(vb+2))
+				case vgr > -9 && vgr < 8 && vg > -33 && vg < 32 && vgb > -9 && vgb < 8:
+					bw.Write([]byte{opLuma | byte(vg+32), byte(vgr+8)<<4 | byte(vgb+8)})
+				default:
+					bw.Write([]byte{opRGB, px.r, px.g, px.b})
+				}
+			}
+
+			prev = px
+		}
+	}
+
+	bw.Write(endMarker)
+
+	return bw.Flush()
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qoi
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestRoundTrip(t *testing.T) {
+	c := qt.New(t)
+
+	for _, opaque := range []bool{true, false} {
+		src := image.NewNRGBA(image.Rect(0, 0, 97, 61))
+		for y := 0; y < 61; y++ {
+			for x := 0; x < 97; x++ {
+				col := color.NRGBA{R: uint8(x * 2), G: uint8(y * 4), B: uint8(x * y), A: 255}
+				switch {
+				case y < 5:
+					// Runs, longer than 62 pixels.
+					col = color.NRGBA{R: 10, G: 20, B: 30, A: 255}
+				case x%7 == 0:
+					// Repeated colors, found in the index.
+					col = color.NRGBA{R: 200, G: 100, B: 50, A: 255}
+				}
+				if !opaque {
+					col.A = uint8(x + y)
+				}
+				src.SetNRGBA(x, y, col)
+			}
+		}
+
+		var buf bytes.Buffer
+		c.Assert(Encode(&buf, src), qt.IsNil)
+		if opaque {
+			c.Assert(buf.Bytes()[12], qt.Equals, uint8(3))
+		} else {
+			c.Assert(buf.Bytes()[12], qt.Equals, uint8(4))
+		}
+		c.Assert(buf.Bytes()[buf.Len()-8:], qt.DeepEquals, endMarker)
+
+		config, format, err := image.DecodeConfig(bytes.NewReader(buf.Bytes()))
+		c.Assert(err, qt.IsNil)
+		c.Assert(format, qt.Equals, "qoi")
+		c.Assert(config.Width, qt.Equals, 97)
+		c.Assert(config.Height, qt.Equals, 61)
+
+		decoded, err := Decode(bytes.NewReader(buf.Bytes()))
+		c.Assert(err, qt.IsNil)
+		c.Assert(decoded.(*image.NRGBA).Pix, qt.DeepEquals, src.Pix)
+	}
+}
+
+func TestEncodeRun(t *testing.T) {
+	c := qt.New(t)
+
+	// Two pixels of the initial previous pixel, opaque black, are one run.
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{A: 255})
+	src.SetNRGBA(1, 0, color.NRGBA{A: 255})
+
+	var buf bytes.Buffer
+	c.Assert(Encode(&buf, src), qt.IsNil)
+	c.Assert(buf.Bytes(), qt.DeepEquals, []byte{
+		'q', 'o', 'i', 'f', 0, 0, 0, 2, 0, 0, 0, 1, 3, 0,
+		opRun | 1,
+		0, 0, 0, 0, 0, 0, 0, 1,
+	})
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	c := qt.New(t)
+
+	var buf bytes.Buffer
+	c.Assert(Encode(&buf, image.NewRGBA(image.Rect(0, 0, 10, 10))), qt.IsNil)
+	b := buf.Bytes()
+
+	_, err := Decode(bytes.NewReader(b[:headerSize+1]))
+	c.Assert(err, qt.Equals, io.ErrUnexpectedEOF)
+
+	_, err = Decode(bytes.NewReader(b[:5]))
+	c.Assert(err, qt.Equals, io.ErrUnexpectedEOF)
+
+	_, err = Decode(bytes.NewReader(append([]byte("qoiz"), b[4:]...)))
+	c.Assert(err, qt.Equals, FormatError("missing magic bytes"))
+
+	invalid := append([]byte(nil), b...)
+	invalid[12] = 2
+	_, err = DecodeConfig(bytes.NewReader(invalid))
+	c.Assert(err, qt.Not(qt.IsNil))
+}
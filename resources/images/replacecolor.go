@@ -0,0 +1,65 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*replaceColorFilter)(nil)
+
+// replaceColorFilter replaces the pixels within tolerance of the target
+// color with the replacement color.
+type replaceColorFilter struct {
+	target      color.Color
+	tolerance   float64
+	replacement color.Color
+}
+
+func (f replaceColorFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	tr, tg, tb, _ := nrgbaFloats(f.target)
+	rr, rg, rb, ra := nrgbaFloats(f.replacement)
+
+	// The tolerance is a percentage of the largest possible distance
+	// between two colors in the RGB cube.
+	maxDist := f.tolerance / 100 * math.Sqrt(3)
+
+	gift.ColorFunc(func(r, g, b, a float32) (float32, float32, float32, float32) {
+		dr, dg, db := float64(r-tr), float64(g-tg), float64(b-tb)
+		if math.Sqrt(dr*dr+dg*dg+db*db) <= maxDist {
+			return rr, rg, rb, ra * a
+		}
+		return r, g, b, a
+	}).Draw(dst, src, options)
+}
+
+func (f replaceColorFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
+
+func (f replaceColorFilter) requiresTransparency() bool {
+	_, _, _, a := f.replacement.RGBA()
+	return a != 0xffff
+}
+
+// nrgbaFloats returns the non-premultiplied color channels of c in range [0, 1].
+func nrgbaFloats(c color.Color) (r, g, b, a float32) {
+	n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	return float32(n.R) / 0xffff, float32(n.G) / 0xffff, float32(n.B) / 0xffff, float32(n.A) / 0xffff
+}
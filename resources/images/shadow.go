@@ -0,0 +1,82 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*dropShadowFilter)(nil)
+
+// dropShadowFilter draws a blurred, offset silhouette of the image in the
+// given color behind it, on a transparent canvas big enough to hold both.
+type dropShadowFilter struct {
+	offsetX, offsetY int
+	blur             int
+	color            color.Color
+}
+
+func (f dropShadowFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	srcBounds := src.Bounds()
+	imageRect, shadowRect := f.layout(srcBounds)
+
+	cr, cg, cb, ca := f.color.RGBA()
+	shadowColor := color.NRGBA64Model.Convert(color.RGBA64{R: uint16(cr), G: uint16(cg), B: uint16(cb), A: uint16(ca)}).(color.NRGBA64)
+
+	// The silhouette is the image's alpha in the shadow color.
+	silhouette := image.NewNRGBA64(dst.Bounds())
+	for y := 0; y < silhouette.Rect.Dy(); y++ {
+		for x := 0; x < silhouette.Rect.Dx(); x++ {
+			c := shadowColor
+			c.A = 0
+			p := image.Pt(x, y)
+			if p.In(shadowRect) {
+				_, _, _, a := src.At(srcBounds.Min.X+x-shadowRect.Min.X, srcBounds.Min.Y+y-shadowRect.Min.Y).RGBA()
+				c.A = uint16(a * uint32(shadowColor.A) / 0xffff)
+			}
+			silhouette.SetNRGBA64(x, y, c)
+		}
+	}
+
+	if f.blur > 0 {
+		gift.New(gift.GaussianBlur(float32(f.blur)/2)).Draw(dst, silhouette)
+	} else {
+		draw.Draw(dst, dst.Bounds(), silhouette, image.ZP, draw.Src)
+	}
+
+	draw.Draw(dst, imageRect, src, srcBounds.Min, draw.Over)
+}
+
+func (f dropShadowFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	imageRect, shadowRect := f.layout(srcBounds)
+	return imageRect.Union(shadowRect.Inset(-f.blur))
+}
+
+// layout returns the position of the image and its shadow on the canvas.
+func (f dropShadowFilter) layout(srcBounds image.Rectangle) (imageRect, shadowRect image.Rectangle) {
+	imageRect = image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+	shadowRect = imageRect.Add(image.Pt(f.offsetX, f.offsetY))
+
+	// Move everything into the positive quadrant.
+	min := imageRect.Union(shadowRect.Inset(-f.blur)).Min
+	return imageRect.Sub(min), shadowRect.Sub(min)
+}
+
+func (f dropShadowFilter) requiresTransparency() bool {
+	return true
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*shadowHighlightFilter)(nil)
+
+const shadowHighlightBins = 256
+
+// shadowHighlightFilter lifts the shadows and recovers the highlights of an
+// image. The tone curves are precomputed in a LUT indexed by the luminance
+// of the pixel, and weighted by the local luminance, a box blur of the
+// luminance around the pixel, so only dark and bright regions are changed,
+// not dark or bright details in midtone regions.
+type shadowHighlightFilter struct {
+	shadowLUT    [shadowHighlightBins]float64
+	highlightLUT [shadowHighlightBins]float64
+}
+
+// newShadowHighlightFilter creates a filter with shadows and highlights in
+// range 0 to 100.
+func newShadowHighlightFilter(shadows, highlights float64) shadowHighlightFilter {
+	var f shadowHighlightFilter
+	// The shadows are lifted with a gamma curve, the highlights compressed
+	// with its inverse. The LUTs hold the change to the luminance.
+	sg := 1 / (1 + 2*shadows/100)
+	hg := 1 + 2*highlights/100
+	for i := 0; i < shadowHighlightBins; i++ {
+		v := float64(i) / (shadowHighlightBins - 1)
+		f.shadowLUT[i] = math.Pow(v, sg) - v
+		f.highlightLUT[i] = (1 - math.Pow(1-v, 1/hg)) - v
+	}
+	return f
+}
+
+func (f shadowHighlightFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	srcBounds := src.Bounds()
+	w, h := srcBounds.Dx(), srcBounds.Dy()
+	if w == 0 || h == 0 {
+		return
+	}
+
+	type pixel struct {
+		r, g, b, a, y float64
+	}
+
+	pixels := make([]pixel, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, a := nrgbaFloats(src.At(srcBounds.Min.X+x, srcBounds.Min.Y+y))
+			pixels[y*w+x] = pixel{
+				r: float64(r),
+				g: float64(g),
+				b: float64(b),
+				a: float64(a),
+				y: 0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b),
+			}
+		}
+	}
+
+	// The summed-area table of the luminance, to get the local luminance
+	// of any box in constant time.
+	sums := make([]float64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		var row float64
+		for x := 0; x < w; x++ {
+			row += pixels[y*w+x].y
+			sums[(y+1)*(w+1)+x+1] = sums[y*(w+1)+x+1] + row
+		}
+	}
+
+	radius := w
+	if h < radius {
+		radius = h
+	}
+	radius /= 16
+	if radius < 1 {
+		radius = 1
+	}
+
+	bin := func(v float64) int {
+		return int(math.Max(0, math.Min(shadowHighlightBins-1, math.Round(v*(shadowHighlightBins-1)))))
+	}
+	clamp := func(v float64) float64 {
+		return math.Max(0, math.Min(1, v))
+	}
+
+	dstBounds := dst.Bounds()
+	for y := 0; y < h; y++ {
+		y0, y1 := y-radius, y+radius+1
+		if y0 < 0 {
+			y0 = 0
+		}
+		if y1 > h {
+			y1 = h
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x-radius, x+radius+1
+			if x0 < 0 {
+				x0 = 0
+			}
+			if x1 > w {
+				x1 = w
+			}
+			n := float64((x1 - x0) * (y1 - y0))
+			local := (sums[y1*(w+1)+x1] - sums[y0*(w+1)+x1] - sums[y1*(w+1)+x0] + sums[y0*(w+1)+x0]) / n
+
+			p := pixels[y*w+x]
+			b := bin(p.y)
+			dark := (1 - local) * (1 - local)
+			bright := local * local
+			yy := clamp(p.y + dark*f.shadowLUT[b] + bright*f.highlightLUT[b])
+
+			// Scale the channels to keep the hue and saturation. Pure
+			// black has no hue, so it is lifted to gray.
+			var r, g, bl float64
+			if p.y > 0 {
+				s := yy / p.y
+				r, g, bl = clamp(p.r*s), clamp(p.g*s), clamp(p.b*s)
+			} else {
+				r, g, bl = yy, yy, yy
+			}
+
+			dst.Set(dstBounds.Min.X+x, dstBounds.Min.Y+y, color.NRGBA64{
+				R: uint16(r*0xffff + 0.5),
+				G: uint16(g*0xffff + 0.5),
+				B: uint16(bl*0xffff + 0.5),
+				A: uint16(p.a*0xffff + 0.5),
+			})
+		}
+	}
+}
+
+func (f shadowHighlightFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
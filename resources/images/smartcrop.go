@@ -27,7 +27,7 @@ const (
 
 	// This is just a increment, starting on 1. If Smart Crop improves its cropping, we
 	// need a way to trigger a re-generation of the crops in the wild, so increment this.
-	smartCropVersionNumber = 1
+	smartCropVersionNumber = 2
 )
 
 func (p *ImageProcessor) newSmartCropAnalyzer(filter gift.Resampling) smartcrop.Analyzer {
@@ -45,7 +45,26 @@ func (r imagingResizer) Resize(img image.Image, width, height uint) image.Image
 	return result
 }
 
+// giftResizer resizes with gift only, for the analyzer in the SmartCrop
+// filter, which has no ImageProcessor.
+type giftResizer struct {
+	filter gift.Resampling
+}
+
+func (r giftResizer) Resize(img image.Image, width, height uint) image.Image {
+	g := gift.New(gift.Resize(int(width), int(height), r.filter))
+	dst := image.NewRGBA(g.Bounds(img.Bounds()))
+	g.Draw(dst, img)
+	return dst
+}
+
 func (p *ImageProcessor) smartCrop(img image.Image, width, height int, filter gift.Resampling) (image.Rectangle, error) {
+	return findSmartCrop(p.newSmartCropAnalyzer(filter), img, width, height)
+}
+
+// findSmartCrop returns the best crop of img with the aspect ratio of width
+// and height, an empty rectangle if there is nothing to find.
+func findSmartCrop(smart smartcrop.Analyzer, img image.Image, width, height int) (image.Rectangle, error) {
 	if width <= 0 || height <= 0 {
 		return image.Rectangle{}, nil
 	}
@@ -62,7 +81,10 @@ func (p *ImageProcessor) smartCrop(img image.Image, width, height int, filter gi
 		return srcBounds, nil
 	}
 
-	smart := p.newSmartCropAnalyzer(filter)
+	if isFlat(img) {
+		// There is nothing for the analyzer to find.
+		return image.Rectangle{}, nil
+	}
 
 	rect, err := smart.FindBestCrop(img, width, height)
 	if err != nil {
@@ -72,3 +94,39 @@ func (p *ImageProcessor) smartCrop(img image.Image, width, height int, filter gi
 	return img.Bounds().Intersect(rect), nil
 
 }
+
+// isFlat reports whether img is a single color, sampled on a grid.
+func isFlat(img image.Image) bool {
+	const (
+		steps     = 64
+		tolerance = 2 << 8
+	)
+
+	b := img.Bounds()
+	stepX, stepY := b.Dx()/steps, b.Dy()/steps
+	if stepX < 1 {
+		stepX = 1
+	}
+	if stepY < 1 {
+		stepY = 1
+	}
+
+	r0, g0, b0, a0 := img.At(b.Min.X, b.Min.Y).RGBA()
+	within := func(v, v0 uint32) bool {
+		if v > v0 {
+			return v-v0 <= tolerance
+		}
+		return v0-v <= tolerance
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y += stepY {
+		for x := b.Min.X; x < b.Max.X; x += stepX {
+			r, g, bl, a := img.At(x, y).RGBA()
+			if !within(r, r0) || !within(g, g0) || !within(bl, b0) || !within(a, a0) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package images
+
+import (
+	"image"
+	"image/draw"
+
+	"github.com/disintegration/gift"
+	"github.com/muesli/smartcrop"
+)
+
+var _ gift.Filter = (*smartCropFilter)(nil)
+
+// smartCropFilter crops the image to the most interesting region with the
+// aspect ratio of width and height, as found by the smart crop analyzer, and
+// resizes it to width x height.
+type smartCropFilter struct {
+	width, height int
+}
+
+func (f smartCropFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	g := gift.New(
+		gift.Crop(f.cropBox(src)),
+		gift.Resize(f.width, f.height, gift.LinearResampling),
+	)
+	g.Draw(dst, src)
+}
+
+func (f smartCropFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, f.width, f.height)
+}
+
+// cropBox returns the region of src to crop to. Flat images and images the
+// analyzer fails on are cropped in the center.
+func (f smartCropFilter) cropBox(src image.Image) image.Rectangle {
+	smart := smartcrop.NewAnalyzer(giftResizer{filter: gift.LinearResampling})
+	rect, err := findSmartCrop(smart, src, f.width, f.height)
+	if err == nil && !rect.Empty() {
+		return rect
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w*f.height > h*f.width {
+		w = h * f.width / f.height
+	} else {
+		h = w * f.height / f.width
+	}
+	min := b.Min.Add(image.Pt((b.Dx()-w)/2, (b.Dy()-h)/2))
+	return image.Rectangle{Min: min, Max: min.Add(image.Pt(w, h))}
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*straightenFilter)(nil)
+
+// NewStraighten creates a filter that rotates the image by the given angle
+// in degrees counter-clockwise, e.g. to straighten a crooked horizon, and
+// crops it to the largest rectangle without any of the corners the rotation
+// leaves empty.
+func NewStraighten(angle float64) gift.Filter {
+	return straightenFilter{angle: angle}
+}
+
+type straightenFilter struct {
+	angle float64
+}
+
+func (f straightenFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	sb := src.Bounds()
+	w, h := f.cropSize(sb.Dx(), sb.Dy())
+	g := gift.New(
+		gift.Rotate(float32(f.angle), color.Transparent, gift.CubicInterpolation),
+		gift.CropToSize(w, h, gift.CenterAnchor),
+	)
+	g.SetParallelization(options.Parallelization)
+	g.Draw(dst, src)
+}
+
+func (f straightenFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	w, h := f.cropSize(srcBounds.Dx(), srcBounds.Dy())
+	return image.Rect(0, 0, w, h)
+}
+
+// cropSize returns the dimensions of the largest axis-aligned rectangle
+// inside a width x height rectangle rotated by the angle.
+// See https://stackoverflow.com/a/16778797
+func (f straightenFilter) cropSize(width, height int) (int, int) {
+	if width <= 0 || height <= 0 {
+		return 0, 0
+	}
+	if math.Mod(f.angle, 180) == 0 {
+		return width, height
+	}
+
+	w, h := float64(width), float64(height)
+	rad := f.angle * math.Pi / 180
+	sin, cos := math.Abs(math.Sin(rad)), math.Abs(math.Cos(rad))
+
+	long, short := w, h
+	if h > w {
+		long, short = h, w
+	}
+
+	var cw, ch float64
+	if short <= 2*sin*cos*long || math.Abs(sin-cos) < 1e-10 {
+		// Half constrained, two of the crop corners touch the longer side.
+		x := 0.5 * short
+		if w >= h {
+			cw, ch = x/sin, x/cos
+		} else {
+			cw, ch = x/cos, x/sin
+		}
+	} else {
+		cos2 := cos*cos - sin*sin
+		cw, ch = (w*cos-h*sin)/cos2, (h*cos-w*sin)/cos2
+	}
+
+	// Leave out the edge pixels blended with the empty corners.
+	return straightenInset(cw), straightenInset(ch)
+}
+
+func straightenInset(v float64) int {
+	n := int(v) - 2
+	if n < 1 {
+		return 1
+	}
+	return n
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"encoding/xml"
+	"image"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// svgUnits maps the absolute CSS length units to pixels. em and ex assume
+// the default font size of 16 pixels.
+var svgUnits = map[string]float64{
+	"px": 1,
+	"pt": 96.0 / 72,
+	"pc": 16,
+	"in": 96,
+	"cm": 96 / 2.54,
+	"mm": 96 / 25.4,
+	"q":  96 / 101.6,
+	"em": 16,
+	"ex": 8,
+}
+
+// DecodeSVGConfig returns the intrinsic dimensions of the SVG image in r,
+// read from the width and height attributes of the root element, without
+// rendering the image. Lengths with units are converted to pixels. A missing
+// or percentage width or height is taken from the viewBox, keeping its
+// aspect ratio. The dimensions are 0 if they can't be resolved.
+func DecodeSVGConfig(r io.Reader) (image.Config, error) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return image.Config{}, errors.New("svg: no root element")
+			}
+			return image.Config{}, errors.Wrap(err, "svg")
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local != "svg" {
+			return image.Config{}, errors.Errorf("svg: invalid root element %q", start.Name.Local)
+		}
+
+		var width, height, vbWidth, vbHeight float64
+		for _, attr := range start.Attr {
+			switch attr.Name.Local {
+			case "width":
+				width = parseSVGLength(attr.Value)
+			case "height":
+				height = parseSVGLength(attr.Value)
+			case "viewBox":
+				vbWidth, vbHeight = parseSVGViewBox(attr.Value)
+			}
+		}
+
+		if vbWidth > 0 && vbHeight > 0 {
+			switch {
+			case width == 0 && height == 0:
+				width, height = vbWidth, vbHeight
+			case width == 0:
+				width = height * vbWidth / vbHeight
+			case height == 0:
+				height = width * vbHeight / vbWidth
+			}
+		}
+
+		return image.Config{Width: int(math.Round(width)), Height: int(math.Round(height))}, nil
+	}
+}
+
+// parseSVGLength parses a length, e.g. "100", "100px" or "2.5in", into pixels.
+// It returns 0 for percentages and invalid lengths.
+func parseSVGLength(s string) float64 {
+	s = strings.ToLower(strings.TrimSpace(s))
+	factor := 1.0
+	for unit, f := range svgUnits {
+		if strings.HasSuffix(s, unit) {
+			s, factor = strings.TrimSpace(strings.TrimSuffix(s, unit)), f
+			break
+		}
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v * factor
+}
+
+// parseSVGViewBox returns the width and height of a viewBox, e.g. "0 0 100 50".
+func parseSVGViewBox(s string) (float64, float64) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if len(fields) != 4 {
+		return 0, 0
+	}
+	w, err1 := strconv.ParseFloat(fields[2], 64)
+	h, err2 := strconv.ParseFloat(fields[3], 64)
+	if err1 != nil || err2 != nil || w <= 0 || h <= 0 {
+		return 0, 0
+	}
+	return w, h
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDecodeSVGConfig(t *testing.T) {
+	c := qt.New(t)
+
+	for _, test := range []struct {
+		svg           string
+		width, height int
+	}{
+		{`<svg height="100" width="100"></svg>`, 100, 100},
+		{`<?xml version="1.0"?><!-- A comment --><svg xmlns="http://www.w3.org/2000/svg" width="300px" height=" 150 "/>`, 300, 150},
+		{`<svg width="1in" height="2.54cm"/>`, 96, 96},
+		{`<svg width="12pt" height="2em"/>`, 16, 32},
+		{`<svg viewBox="0 0 640 480"/>`, 640, 480},
+		{`<svg viewBox="0,0,640,480" width="320"/>`, 320, 240},
+		{`<svg viewBox="0 0 640 480" height="120mm"/>`, 605, 454},
+		{`<svg viewBox="0 0 640 480" width="100%" height="100%"/>`, 640, 480},
+		{`<svg width="100%" height="50"/>`, 0, 50},
+		{`<svg width="abc"/>`, 0, 0},
+	} {
+		config, err := DecodeSVGConfig(strings.NewReader(test.svg))
+		c.Assert(err, qt.IsNil, qt.Commentf(test.svg))
+		c.Assert(config.Width, qt.Equals, test.width, qt.Commentf(test.svg))
+		c.Assert(config.Height, qt.Equals, test.height, qt.Commentf(test.svg))
+	}
+
+	_, err := DecodeSVGConfig(strings.NewReader(`<html></html>`))
+	c.Assert(err, qt.Not(qt.IsNil))
+	_, err = DecodeSVGConfig(strings.NewReader(``))
+	c.Assert(err, qt.Not(qt.IsNil))
+}
@@ -0,0 +1,207 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// minTextSize is the smallest font size, in pixels, drawText will shrink
+// text to.
+const minTextSize = 12
+
+var (
+	textFontInit sync.Once
+	textFont     *sfnt.Font
+	textFontErr  error
+)
+
+// getTextFont returns the font used to draw text, Go Bold.
+func getTextFont() (*sfnt.Font, error) {
+	textFontInit.Do(func() {
+		textFont, textFontErr = sfnt.Parse(gobold.TTF)
+	})
+	return textFont, textFontErr
+}
+
+// textDrawer draws text with one font at one size.
+type textDrawer struct {
+	f    *sfnt.Font
+	buf  sfnt.Buffer
+	ppem fixed.Int26_6
+}
+
+func (d *textDrawer) metrics() (font.Metrics, error) {
+	return d.f.Metrics(&d.buf, d.ppem, font.HintingNone)
+}
+
+// width returns the advance width of s.
+func (d *textDrawer) width(s string) (fixed.Int26_6, error) {
+	var (
+		w    fixed.Int26_6
+		prev sfnt.GlyphIndex
+	)
+	for i, r := range []rune(s) {
+		x, err := d.f.GlyphIndex(&d.buf, r)
+		if err != nil {
+			return 0, err
+		}
+		if i > 0 {
+			if k, err := d.f.Kern(&d.buf, prev, x, d.ppem, font.HintingNone); err == nil {
+				w += k
+			}
+		}
+		adv, err := d.f.GlyphAdvance(&d.buf, x, d.ppem, font.HintingNone)
+		if err != nil {
+			return 0, err
+		}
+		w += adv
+		prev = x
+	}
+	return w, nil
+}
+
+// wrap splits text into lines no wider than maxWidth, breaking on spaces.
+// A single word wider than maxWidth gets a line of its own.
+func (d *textDrawer) wrap(text string, maxWidth int) ([]string, error) {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		var line string
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			w, err := d.width(candidate)
+			if err != nil {
+				return nil, err
+			}
+			if line != "" && w.Ceil() > maxWidth {
+				lines = append(lines, line)
+				candidate = word
+			}
+			line = candidate
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// drawLine draws s on dst in the color c with the baseline starting at
+// dot.
+func (d *textDrawer) drawLine(dst draw.Image, s string, dot fixed.Point26_6, c color.Color) error {
+	b := dst.Bounds()
+	z := vector.NewRasterizer(b.Dx(), b.Dy())
+	origin := b.Min
+
+	pt := func(p fixed.Point26_6) (float32, float32) {
+		return float32(dot.X+p.X)/64 - float32(origin.X), float32(dot.Y+p.Y)/64 - float32(origin.Y)
+	}
+
+	var prev sfnt.GlyphIndex
+	for i, r := range []rune(s) {
+		x, err := d.f.GlyphIndex(&d.buf, r)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if k, err := d.f.Kern(&d.buf, prev, x, d.ppem, font.HintingNone); err == nil {
+				dot.X += k
+			}
+		}
+		segments, err := d.f.LoadGlyph(&d.buf, x, d.ppem, nil)
+		if err != nil {
+			return err
+		}
+		for _, seg := range segments {
+			switch seg.Op {
+			case sfnt.SegmentOpMoveTo:
+				z.MoveTo(pt(seg.Args[0]))
+			case sfnt.SegmentOpLineTo:
+				z.LineTo(pt(seg.Args[0]))
+			case sfnt.SegmentOpQuadTo:
+				bx, by := pt(seg.Args[0])
+				cx, cy := pt(seg.Args[1])
+				z.QuadTo(bx, by, cx, cy)
+			case sfnt.SegmentOpCubeTo:
+				bx, by := pt(seg.Args[0])
+				cx, cy := pt(seg.Args[1])
+				dx, dy := pt(seg.Args[2])
+				z.CubeTo(bx, by, cx, cy, dx, dy)
+			}
+		}
+		adv, err := d.f.GlyphAdvance(&d.buf, x, d.ppem, font.HintingNone)
+		if err != nil {
+			return err
+		}
+		dot.X += adv
+		prev = x
+	}
+
+	z.Draw(dst, b, image.NewUniform(c), image.ZP)
+
+	return nil
+}
+
+// drawText draws text on dst in the color c inside r, left aligned and
+// wrapped to lines that fit the width of r, with the last line at the
+// bottom of r. The font size starts at size pixels and is reduced until
+// the text fits the height of r.
+func drawText(dst draw.Image, r image.Rectangle, text string, size float64, c color.Color) error {
+	f, err := getTextFont()
+	if err != nil {
+		return err
+	}
+
+	var (
+		d       *textDrawer
+		lines   []string
+		metrics font.Metrics
+	)
+	for ; ; size *= 0.9 {
+		if size < minTextSize {
+			size = minTextSize
+		}
+		d = &textDrawer{f: f, ppem: fixed.Int26_6(size * 64)}
+		if lines, err = d.wrap(text, r.Dx()); err != nil {
+			return err
+		}
+		if metrics, err = d.metrics(); err != nil {
+			return err
+		}
+		if size == minTextSize || (metrics.Height*fixed.Int26_6(len(lines))).Ceil() <= r.Dy() {
+			break
+		}
+	}
+
+	y := fixed.I(r.Max.Y) - metrics.Descent - metrics.Height*fixed.Int26_6(len(lines)-1)
+	for _, line := range lines {
+		if err := d.drawLine(dst, line, fixed.Point26_6{X: fixed.I(r.Min.X), Y: y}, c); err != nil {
+			return err
+		}
+		y += metrics.Height
+	}
+
+	return nil
+}
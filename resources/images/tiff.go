@@ -0,0 +1,105 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/image/tiff"
+)
+
+// TIFFPageCount returns the number of pages (image file directories) in the
+// TIFF image read from r.
+func TIFFPageCount(r io.Reader) (int, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	offsets, _, err := tiffPageOffsets(b)
+	if err != nil {
+		return 0, err
+	}
+	return len(offsets), nil
+}
+
+// DecodeTIFFPage decodes the given page, starting at 1, of the TIFF image
+// read from r.
+func DecodeTIFFPage(r io.Reader, page int) (image.Image, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	offsets, order, err := tiffPageOffsets(b)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 || page > len(offsets) {
+		return nil, fmt.Errorf("page %d out of range, the image has %d page(s)", page, len(offsets))
+	}
+
+	// The TIFF decoder only reads the first page, so point the header
+	// to the page we want.
+	b = append([]byte(nil), b...)
+	order.PutUint32(b[4:8], offsets[page-1])
+
+	return tiff.Decode(bytes.NewReader(b))
+}
+
+// tiffPageOffsets returns the offsets of the image file directories in b.
+func tiffPageOffsets(b []byte) ([]uint32, binary.ByteOrder, error) {
+	if len(b) < 8 {
+		return nil, nil, errors.New("invalid TIFF header")
+	}
+
+	var order binary.ByteOrder
+	switch string(b[:4]) {
+	case "II\x2a\x00":
+		order = binary.LittleEndian
+	case "MM\x00\x2a":
+		order = binary.BigEndian
+	default:
+		return nil, nil, errors.New("invalid TIFF header")
+	}
+
+	var offsets []uint32
+	seen := make(map[uint32]bool)
+	offset := order.Uint32(b[4:8])
+
+	for offset != 0 {
+		if seen[offset] {
+			return nil, nil, errors.New("invalid TIFF: IFD loop")
+		}
+		seen[offset] = true
+
+		if int(offset)+2 > len(b) {
+			return nil, nil, errors.New("invalid TIFF: IFD offset out of range")
+		}
+		numEntries := int(order.Uint16(b[offset:]))
+		next := int(offset) + 2 + numEntries*12
+		if next+4 > len(b) {
+			return nil, nil, errors.New("invalid TIFF: IFD out of range")
+		}
+
+		offsets = append(offsets, offset)
+		offset = order.Uint32(b[next:])
+	}
+
+	return offsets, order, nil
+}
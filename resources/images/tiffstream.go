@@ -0,0 +1,353 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+
+	"golang.org/x/image/tiff/lzw"
+)
+
+// More TIFF tags, used when reading a TIFF image in strips.
+const (
+	tiffTagImageWidth      = 256
+	tiffTagImageLength     = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagSamplesPerPixel = 277
+	tiffTagRowsPerStrip    = 278
+	tiffTagPlanarConfig    = 284
+	tiffTagPredictor       = 317
+	tiffTagTileWidth       = 322
+	tiffTagExtraSamples    = 338
+)
+
+// ErrStreamingNotSupported is returned by DownscaleTIFF for TIFF images it
+// cannot read in strips, e.g. tiled, 16 bit or JPEG compressed images, and
+// for sizes that are not a downscale.
+var ErrStreamingNotSupported = errors.New("streaming not supported for this TIFF image")
+
+// The maximum number of values we read for a tag, e.g. the strip offsets.
+const tiffMaxTagValues = 1 << 20
+
+// DownscaleTIFF decodes the first page of the TIFF image read from r and
+// downscales it to the given width and height using a box filter.
+// The image is read one row at a time, so the memory used is about one
+// source row and the result, and not the full source image.
+func DownscaleTIFF(r io.ReaderAt, width, height int) (image.Image, error) {
+	s, err := newTIFFStrips(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if width <= 0 || height <= 0 || width > s.width || height > s.height {
+		return nil, ErrStreamingNotSupported
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	// The premultiplied colour sums and pixel counts for the output row
+	// we are currently on.
+	sums := make([]uint64, width*4)
+	counts := make([]uint64, width)
+
+	// The output column for each source column.
+	columns := make([]int, s.width)
+	for x := range columns {
+		columns[x] = x * width / s.width
+	}
+
+	flush := func(oy int) {
+		row := dst.Pix[oy*dst.Stride:]
+		for ox := 0; ox < width; ox++ {
+			n := counts[ox]
+			if n == 0 {
+				continue
+			}
+			sum := sums[ox*4 : ox*4+4]
+			if a := sum[3]; a > 0 {
+				row[ox*4] = uint8(sum[0] / a)
+				row[ox*4+1] = uint8(sum[1] / a)
+				row[ox*4+2] = uint8(sum[2] / a)
+				row[ox*4+3] = uint8(a / n)
+			}
+			counts[ox] = 0
+			sum[0], sum[1], sum[2], sum[3] = 0, 0, 0, 0
+		}
+	}
+
+	oy := 0
+	err = s.readRows(func(y int, row []byte) {
+		if y*height/s.height != oy {
+			flush(oy)
+			oy = y * height / s.height
+		}
+		for x, ox := range columns {
+			r, g, b, a := s.pixel(row, x)
+			sum := sums[ox*4 : ox*4+4]
+			sum[0] += r
+			sum[1] += g
+			sum[2] += b
+			sum[3] += a
+			counts[ox]++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	flush(oy)
+
+	return dst, nil
+}
+
+// tiffStrips reads the rows of an 8 bit, stripped TIFF image.
+type tiffStrips struct {
+	r     io.ReaderAt
+	order binary.ByteOrder
+
+	width, height   int
+	samples         int
+	photometric     uint32
+	compression     uint32
+	predictor       uint32
+	extraSamples    uint32
+	rowsPerStrip    int
+	stripOffsets    []uint32
+	stripByteCounts []uint32
+}
+
+func newTIFFStrips(r io.ReaderAt) (*tiffStrips, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, errors.New("invalid TIFF header")
+	}
+
+	s := &tiffStrips{r: r}
+	switch string(header[:4]) {
+	case "II\x2a\x00":
+		s.order = binary.LittleEndian
+	case "MM\x00\x2a":
+		s.order = binary.BigEndian
+	default:
+		return nil, errors.New("invalid TIFF header")
+	}
+
+	tags, err := s.readTags(s.order.Uint32(header[4:]))
+	if err != nil {
+		return nil, err
+	}
+
+	first := func(tag uint16, def uint32) uint32 {
+		if v := tags[tag]; len(v) > 0 {
+			return v[0]
+		}
+		return def
+	}
+
+	s.width = int(first(tiffTagImageWidth, 0))
+	s.height = int(first(tiffTagImageLength, 0))
+	s.samples = int(first(tiffTagSamplesPerPixel, 1))
+	s.photometric = first(tiffTagPhotometric, 0)
+	s.compression = first(tiffTagCompression, 1)
+	s.predictor = first(tiffTagPredictor, 1)
+	s.extraSamples = first(tiffTagExtraSamples, 0)
+	s.rowsPerStrip = int(first(tiffTagRowsPerStrip, uint32(s.height)))
+	s.stripOffsets = tags[tiffTagStripOffsets]
+	s.stripByteCounts = tags[tiffTagStripByteCounts]
+
+	if s.width <= 0 || s.height <= 0 {
+		return nil, errors.New("invalid TIFF: missing image dimensions")
+	}
+
+	bits := tags[tiffTagBitsPerSample]
+	if len(bits) != s.samples {
+		return nil, ErrStreamingNotSupported
+	}
+	for _, b := range bits {
+		if b != 8 {
+			return nil, ErrStreamingNotSupported
+		}
+	}
+
+	switch s.photometric {
+	case 0, 1: // WhiteIsZero, BlackIsZero
+		if s.samples != 1 {
+			return nil, ErrStreamingNotSupported
+		}
+	case 2: // RGB
+		if s.samples == 4 && s.extraSamples != 1 && s.extraSamples != 2 {
+			return nil, ErrStreamingNotSupported
+		}
+		if s.samples != 3 && s.samples != 4 {
+			return nil, ErrStreamingNotSupported
+		}
+	default:
+		return nil, ErrStreamingNotSupported
+	}
+
+	switch s.compression {
+	case 1, 5, 8, 32946: // None, LZW, Deflate
+	default:
+		return nil, ErrStreamingNotSupported
+	}
+
+	if s.predictor != 1 && s.predictor != 2 {
+		return nil, ErrStreamingNotSupported
+	}
+
+	if first(tiffTagPlanarConfig, 1) != 1 || len(tags[tiffTagTileWidth]) > 0 {
+		return nil, ErrStreamingNotSupported
+	}
+
+	if s.rowsPerStrip <= 0 || s.rowsPerStrip > s.height {
+		s.rowsPerStrip = s.height
+	}
+	numStrips := (s.height + s.rowsPerStrip - 1) / s.rowsPerStrip
+	if len(s.stripOffsets) != numStrips || len(s.stripByteCounts) != numStrips {
+		return nil, errors.New("invalid TIFF: wrong number of strips")
+	}
+
+	return s, nil
+}
+
+// readTags reads the SHORT and LONG valued tags in the IFD at offset.
+func (s *tiffStrips) readTags(offset uint32) (map[uint16][]uint32, error) {
+	b := make([]byte, 2)
+	if _, err := s.r.ReadAt(b, int64(offset)); err != nil {
+		return nil, errors.New("invalid TIFF: IFD offset out of range")
+	}
+	numEntries := int(s.order.Uint16(b))
+
+	entries := make([]byte, numEntries*12)
+	if _, err := s.r.ReadAt(entries, int64(offset)+2); err != nil {
+		return nil, errors.New("invalid TIFF: IFD out of range")
+	}
+
+	tags := make(map[uint16][]uint32)
+
+	for i := 0; i < numEntries; i++ {
+		e := entries[i*12:]
+		tag, typ, count := s.order.Uint16(e), s.order.Uint16(e[2:]), s.order.Uint32(e[4:])
+
+		var size uint32
+		switch typ {
+		case 3: // SHORT
+			size = 2
+		case 4: // LONG
+			size = 4
+		default:
+			continue
+		}
+
+		if count == 0 || count > tiffMaxTagValues {
+			continue
+		}
+
+		data := e[8:12]
+		if count*size > 4 {
+			data = make([]byte, count*size)
+			if _, err := s.r.ReadAt(data, int64(s.order.Uint32(e[8:]))); err != nil {
+				return nil, errors.New("invalid TIFF: tag value out of range")
+			}
+		}
+
+		vals := make([]uint32, count)
+		for j := range vals {
+			if size == 2 {
+				vals[j] = uint32(s.order.Uint16(data[j*2:]))
+			} else {
+				vals[j] = s.order.Uint32(data[j*4:])
+			}
+		}
+		tags[tag] = vals
+	}
+
+	return tags, nil
+}
+
+// readRows calls f with each row of the image, from the top. The row slice
+// is reused between calls.
+func (s *tiffStrips) readRows(f func(y int, row []byte)) error {
+	row := make([]byte, s.width*s.samples)
+
+	for i := range s.stripOffsets {
+		if err := s.readStrip(i, row, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readStrip calls f with each row in strip i.
+func (s *tiffStrips) readStrip(i int, row []byte, f func(y int, row []byte)) error {
+	var r io.Reader = io.NewSectionReader(s.r, int64(s.stripOffsets[i]), int64(s.stripByteCounts[i]))
+
+	switch s.compression {
+	case 5:
+		lr := lzw.NewReader(r, lzw.MSB, 8)
+		defer lr.Close()
+		r = lr
+	case 8, 32946:
+		zr, err := zlib.NewReader(bufio.NewReader(r))
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	for y := i * s.rowsPerStrip; y < (i+1)*s.rowsPerStrip && y < s.height; y++ {
+		if _, err := io.ReadFull(r, row); err != nil {
+			return err
+		}
+		if s.predictor == 2 {
+			for x := s.samples; x < len(row); x++ {
+				row[x] += row[x-s.samples]
+			}
+		}
+		f(y, row)
+	}
+
+	return nil
+}
+
+// pixel returns the colour of the pixel at x in row with the colour values
+// premultiplied by alpha, i.e. in the range 0 to 255*255, and alpha.
+func (s *tiffStrips) pixel(row []byte, x int) (r, g, b, a uint64) {
+	p := row[x*s.samples:]
+
+	switch s.samples {
+	case 1:
+		v := p[0]
+		if s.photometric == 0 {
+			v = 255 - v
+		}
+		r = uint64(v) * 255
+		return r, r, r, 255
+	case 3:
+		return uint64(p[0]) * 255, uint64(p[1]) * 255, uint64(p[2]) * 255, 255
+	}
+
+	a = uint64(p[3])
+	if s.extraSamples == 1 {
+		// Associated alpha, the colour is already premultiplied.
+		return uint64(p[0]) * 255, uint64(p[1]) * 255, uint64(p[2]) * 255, a
+	}
+	return uint64(p[0]) * a, uint64(p[1]) * a, uint64(p[2]) * a, a
+}
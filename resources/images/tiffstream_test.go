@@ -0,0 +1,90 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/gift"
+	"golang.org/x/image/tiff"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDownscaleTIFF(t *testing.T) {
+	c := qt.New(t)
+
+	gradient := image.NewNRGBA(image.Rect(0, 0, 200, 150))
+	for y := 0; y < 150; y++ {
+		for x := 0; x < 200; x++ {
+			gradient.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(255 - x), A: uint8(255 - y)})
+		}
+	}
+	opaque := image.NewRGBA(gradient.Bounds())
+	gray := image.NewGray(gradient.Bounds())
+	for y := 0; y < 150; y++ {
+		for x := 0; x < 200; x++ {
+			opaque.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+			gray.Set(x, y, color.Gray{Y: uint8(x + y)})
+		}
+	}
+
+	for _, test := range []struct {
+		name string
+		src  image.Image
+		opts *tiff.Options
+	}{
+		{"NRGBA", gradient, nil},
+		{"RGBA deflate", opaque, &tiff.Options{Compression: tiff.Deflate, Predictor: true}},
+		{"Gray deflate", gray, &tiff.Options{Compression: tiff.Deflate}},
+	} {
+		c.Run(test.name, func(c *qt.C) {
+			var buf bytes.Buffer
+			c.Assert(tiff.Encode(&buf, test.src, test.opts), qt.IsNil)
+
+			dst, err := DownscaleTIFF(bytes.NewReader(buf.Bytes()), 50, 30)
+			c.Assert(err, qt.IsNil)
+			c.Assert(dst.Bounds(), qt.Equals, image.Rect(0, 0, 50, 30))
+
+			expected := applyTestFilter(c, test.src, gift.Resize(50, 30, gift.BoxResampling))
+
+			for y := 0; y < 30; y++ {
+				for x := 0; x < 50; x++ {
+					got, want := color.NRGBAModel.Convert(dst.At(x, y)).(color.NRGBA), color.NRGBAModel.Convert(expected.At(x, y)).(color.NRGBA)
+					for i, v := range []int{int(got.R) - int(want.R), int(got.G) - int(want.G), int(got.B) - int(want.B), int(got.A) - int(want.A)} {
+						if v < -4 || v > 4 {
+							c.Fatalf("%d,%d: channel %d: got %v, want %v", x, y, i, got, want)
+						}
+					}
+				}
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	c.Assert(tiff.Encode(&buf, gradient, nil), qt.IsNil)
+	_, err := DownscaleTIFF(bytes.NewReader(buf.Bytes()), 400, 300)
+	c.Assert(err, qt.Equals, ErrStreamingNotSupported)
+
+	buf.Reset()
+	c.Assert(tiff.Encode(&buf, image.NewRGBA64(image.Rect(0, 0, 20, 10)), nil), qt.IsNil)
+	_, err = DownscaleTIFF(bytes.NewReader(buf.Bytes()), 10, 5)
+	c.Assert(err, qt.Equals, ErrStreamingNotSupported)
+
+	_, err = DownscaleTIFF(bytes.NewReader([]byte("not a TIFF")), 10, 5)
+	c.Assert(err, qt.Not(qt.IsNil))
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*vibranceFilter)(nil)
+
+// vibranceFilter changes the saturation of the pixels, weighted by how
+// saturated they already are.
+type vibranceFilter struct {
+	amount float32
+}
+
+func (f vibranceFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	gift.ColorFunc(func(r, g, b, a float32) (float32, float32, float32, float32) {
+		max := float32(math.Max(float64(r), math.Max(float64(g), float64(b))))
+		min := float32(math.Min(float64(r), math.Min(float64(g), float64(b))))
+
+		// The HSL saturation of the pixel. Pixels that are already saturated,
+		// which includes most skin tones, are changed less.
+		var sat float32
+		if l := (max + min) / 2; max != min {
+			if l <= 0.5 {
+				sat = (max - min) / (max + min)
+			} else {
+				sat = (max - min) / (2 - max - min)
+			}
+		}
+
+		scale := 1 + f.amount*(1-sat)
+		lum := 0.2126*r + 0.7152*g + 0.0722*b
+
+		adjust := func(v float32) float32 {
+			v = lum + (v-lum)*scale
+			if v < 0 {
+				return 0
+			}
+			if v > 1 {
+				return 1
+			}
+			return v
+		}
+
+		return adjust(r), adjust(g), adjust(b), a
+	}).Draw(dst, src, options)
+}
+
+func (f vibranceFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
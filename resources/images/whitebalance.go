@@ -0,0 +1,94 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/gift"
+)
+
+var _ gift.Filter = (*whiteBalanceFilter)(nil)
+
+// The neutral color temperature in Kelvin.
+const whiteBalanceNeutral = 6500
+
+// whiteBalanceFilter multiplies the color channels with the given gains.
+type whiteBalanceFilter struct {
+	r, g, b float32
+}
+
+func newWhiteBalanceFilter(temperature, tint float64) whiteBalanceFilter {
+	// Correct for light of the given temperature, as in a camera's white
+	// balance setting: a higher temperature gives a warmer image.
+	nr, ng, nb := blackbodyRGB(whiteBalanceNeutral)
+	tr, tg, tb := blackbodyRGB(temperature)
+	r, g, b := nr/tr, ng/tg, nb/tb
+
+	// A positive tint shifts towards magenta, a negative towards green.
+	g *= 1 - tint/100*0.3
+
+	// Keep the luminance of white.
+	lum := 0.2126*r + 0.7152*g + 0.0722*b
+	return whiteBalanceFilter{r: float32(r / lum), g: float32(g / lum), b: float32(b / lum)}
+}
+
+func (f whiteBalanceFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	clamp := func(v float32) float32 {
+		if v > 1 {
+			return 1
+		}
+		return v
+	}
+	gift.ColorFunc(func(r, g, b, a float32) (float32, float32, float32, float32) {
+		return clamp(r * f.r), clamp(g * f.g), clamp(b * f.b), a
+	}).Draw(dst, src, options)
+}
+
+func (f whiteBalanceFilter) Bounds(srcBounds image.Rectangle) image.Rectangle {
+	return image.Rect(0, 0, srcBounds.Dx(), srcBounds.Dy())
+}
+
+// blackbodyRGB approximates the color of a black body radiator at the given
+// temperature in Kelvin, see
+// http://www.tannerhelland.com/4435/convert-temperature-rgb-algorithm-code/
+func blackbodyRGB(temperature float64) (r, g, b float64) {
+	t := temperature / 100
+
+	if t <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(t) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(t-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+	}
+
+	switch {
+	case t >= 66:
+		b = 255
+	case t <= 19:
+		b = 0
+	default:
+		b = 138.5177312231*math.Log(t-10) - 305.0447927307
+	}
+
+	clamp := func(v float64) float64 {
+		// Avoid zero, we divide by these.
+		return math.Max(1, math.Min(255, v)) / 255
+	}
+
+	return clamp(r), clamp(g), clamp(b)
+}
@@ -0,0 +1,167 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/gift"
+)
+
+// The header of the APP1 segment holding XMP in a JPEG.
+const xmpJPEGHeader = "http://ns.adobe.com/xap/1.0/\x00"
+
+// XMPCrop is the non-destructive crop written to XMP by Lightroom and
+// Camera Raw. The edges are relative to the image dimensions, from 0 to 1,
+// and Angle is the straighten angle in degrees, clockwise.
+type XMPCrop struct {
+	Top, Left, Bottom, Right float64
+	Angle                    float64
+}
+
+var xmpCropValueRe = regexp.MustCompile(`[<\s]crs:(HasCrop|CropTop|CropLeft|CropBottom|CropRight|CropAngle)(?:="([^"]*)"|>([^<]*)<)`)
+
+// DecodeXMPCrop reads the crop from the XMP in the JPEG image read from r.
+// It returns false if the image has no XMP or no crop.
+func DecodeXMPCrop(r io.Reader) (XMPCrop, bool, error) {
+	xmp, err := jpegXMP(r)
+	if err != nil || xmp == nil {
+		return XMPCrop{}, false, err
+	}
+
+	var (
+		c       XMPCrop
+		hasCrop bool
+	)
+	c.Right, c.Bottom = 1, 1
+
+	for _, m := range xmpCropValueRe.FindAllSubmatch(xmp, -1) {
+		name, value := string(m[1]), strings.TrimSpace(string(m[2])+string(m[3]))
+		if name == "HasCrop" {
+			hasCrop = strings.EqualFold(value, "true")
+			continue
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return XMPCrop{}, false, fmt.Errorf("invalid XMP crs:%s %q", name, value)
+		}
+		switch name {
+		case "CropTop":
+			c.Top = v
+		case "CropLeft":
+			c.Left = v
+		case "CropBottom":
+			c.Bottom = v
+		case "CropRight":
+			c.Right = v
+		case "CropAngle":
+			c.Angle = v
+		}
+	}
+
+	if !hasCrop || c.Left < 0 || c.Top < 0 || c.Right > 1 || c.Bottom > 1 || c.Left >= c.Right || c.Top >= c.Bottom {
+		return XMPCrop{}, false, nil
+	}
+	if c == (XMPCrop{Right: 1, Bottom: 1}) {
+		// Nothing to crop.
+		return XMPCrop{}, false, nil
+	}
+
+	return c, true, nil
+}
+
+// jpegXMP returns the XMP packet in the JPEG read from r, nil if none.
+func jpegXMP(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+	var marker [2]byte
+	if _, err := io.ReadFull(br, marker[:]); err != nil || marker != [2]byte{0xff, 0xd8} {
+		return nil, nil
+	}
+
+	for {
+		if _, err := io.ReadFull(br, marker[:]); err != nil {
+			return nil, nil
+		}
+		if marker[0] != 0xff || marker[1] == 0xda {
+			// Start of scan, the metadata comes before this.
+			return nil, nil
+		}
+		var length uint16
+		if err := binary.Read(br, binary.BigEndian, &length); err != nil || length < 2 {
+			return nil, nil
+		}
+		data := make([]byte, length-2)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, nil
+		}
+		if marker[1] == 0xe1 && bytes.HasPrefix(data, []byte(xmpJPEGHeader)) {
+			return data[len(xmpJPEGHeader):], nil
+		}
+	}
+}
+
+// Apply straightens img and crops it as described by c.
+func (c XMPCrop) Apply(img image.Image) image.Image {
+	b := img.Bounds()
+	w, h := float64(b.Dx()), float64(b.Dy())
+
+	// The center and the size of the crop.
+	cx, cy := (c.Left+c.Right)/2*w, (c.Top+c.Bottom)/2*h
+	cw, ch := (c.Right-c.Left)*w, (c.Bottom-c.Top)*h
+
+	var filters []gift.Filter
+	bounds := image.Rect(0, 0, b.Dx(), b.Dy())
+
+	if c.Angle != 0 {
+		// Rotate the image around its center, and find the center of the
+		// crop in the now larger image.
+		rotate := gift.Rotate(float32(-c.Angle), color.Transparent, gift.CubicInterpolation)
+		bounds = rotate.Bounds(bounds)
+		filters = append(filters, rotate)
+
+		a := -c.Angle * math.Pi / 180
+		dx, dy := cx-w/2, cy-h/2
+		cx = float64(bounds.Dx())/2 + dx*math.Cos(a) + dy*math.Sin(a)
+		cy = float64(bounds.Dy())/2 - dx*math.Sin(a) + dy*math.Cos(a)
+	}
+
+	crop := image.Rect(
+		int(math.Round(cx-cw/2)), int(math.Round(cy-ch/2)),
+		int(math.Round(cx+cw/2)), int(math.Round(cy+ch/2)),
+	).Intersect(bounds)
+	filters = append(filters, gift.Crop(crop))
+
+	g := gift.New(filters...)
+	dst := image.NewRGBA(g.Bounds(b))
+	g.Draw(dst, img)
+	return dst
+}
+
+// hash returns a short hash of c, used in the key.
+func (c XMPCrop) hash() string {
+	sum := md5.Sum([]byte(fmt.Sprintf("%.5f,%.5f,%.5f,%.5f,%.3f", c.Top, c.Left, c.Bottom, c.Right, c.Angle)))
+	return hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDecodeXMPCrop(t *testing.T) {
+	c := qt.New(t)
+
+	f, err := os.Open(filepath.FromSlash("../testdata/xmpcrop.jpg"))
+	c.Assert(err, qt.IsNil)
+	defer f.Close()
+
+	crop, ok, err := DecodeXMPCrop(f)
+	c.Assert(err, qt.IsNil)
+	c.Assert(ok, qt.Equals, true)
+	c.Assert(crop, qt.Equals, XMPCrop{Top: 0, Left: 0.5, Bottom: 0.5, Right: 1})
+
+	xmpJPEG := func(xmp string) *bytes.Reader {
+		var b bytes.Buffer
+		b.Write([]byte{0xff, 0xd8, 0xff, 0xe1})
+		n := len(xmpJPEGHeader) + len(xmp) + 2
+		b.Write([]byte{byte(n >> 8), byte(n)})
+		b.WriteString(xmpJPEGHeader)
+		b.WriteString(xmp)
+		b.Write([]byte{0xff, 0xda})
+		return bytes.NewReader(b.Bytes())
+	}
+
+	// Element form.
+	crop, ok, err = DecodeXMPCrop(xmpJPEG(`<rdf:Description>
+	<crs:HasCrop>True</crs:HasCrop>
+	<crs:CropTop>0.1</crs:CropTop>
+	<crs:CropLeft>0.2</crs:CropLeft>
+	<crs:CropBottom>0.9</crs:CropBottom>
+	<crs:CropRight>0.8</crs:CropRight>
+	<crs:CropAngle>-2.5</crs:CropAngle>
+</rdf:Description>`))
+	c.Assert(err, qt.IsNil)
+	c.Assert(ok, qt.Equals, true)
+	c.Assert(crop, qt.Equals, XMPCrop{Top: 0.1, Left: 0.2, Bottom: 0.9, Right: 0.8, Angle: -2.5})
+
+	_, ok, err = DecodeXMPCrop(xmpJPEG(`crs:HasCrop="False" crs:CropLeft="0.5"`))
+	c.Assert(err, qt.IsNil)
+	c.Assert(ok, qt.Equals, false)
+
+	_, _, err = DecodeXMPCrop(xmpJPEG(`crs:HasCrop="True" crs:CropLeft="abc"`))
+	c.Assert(err, qt.Not(qt.IsNil))
+
+	// No XMP.
+	_, ok, err = DecodeXMPCrop(bytes.NewReader([]byte{0xff, 0xd8, 0xff, 0xda}))
+	c.Assert(err, qt.IsNil)
+	c.Assert(ok, qt.Equals, false)
+}
+
+func TestXMPCropApply(t *testing.T) {
+	c := qt.New(t)
+
+	red, green := color.NRGBA{R: 255, A: 255}, color.NRGBA{G: 255, A: 255}
+	src := newTestImage(80, 60, red)
+	for y := 0; y < 30; y++ {
+		for x := 40; x < 80; x++ {
+			src.Set(x, y, green)
+		}
+	}
+
+	dst := XMPCrop{Left: 0.5, Right: 1, Bottom: 0.5}.Apply(src)
+	c.Assert(dst.Bounds(), qt.Equals, image.Rect(0, 0, 40, 30))
+	for _, p := range []image.Point{{0, 0}, {39, 0}, {0, 29}, {39, 29}} {
+		c.Assert(rgba(dst.At(p.X, p.Y)), qt.Equals, rgba(green), qt.Commentf("%v", p))
+	}
+
+	// Straightened, the center of the crop stays the same.
+	dst = XMPCrop{Left: 0.55, Top: 0.05, Right: 0.95, Bottom: 0.45, Angle: 3}.Apply(src)
+	c.Assert(dst.Bounds(), qt.Equals, image.Rect(0, 0, 32, 24))
+	c.Assert(rgba(dst.At(16, 12)), qt.Equals, rgba(green))
+	c.Assert(rgba(dst.At(2, 2)), qt.Equals, rgba(green))
+}
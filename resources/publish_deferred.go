@@ -0,0 +1,73 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package resources
+
+import (
+	"sync"
+
+	"github.com/gohugoio/hugo/resources/resource"
+)
+
+// deferredPublisher holds the resources used during the build that are
+// published in PublishDeferred.
+type deferredPublisher struct {
+	mu      sync.Mutex
+	pending []*resourceAdapter
+}
+
+func (d *deferredPublisher) add(r *resourceAdapter) {
+	d.mu.Lock()
+	d.pending = append(d.pending, r)
+	d.mu.Unlock()
+}
+
+// PublishDeferred publishes the resources whose publishing were deferred
+// until the end of the build with the deferPublish imaging option, the
+// images whose .Permalink or .RelPermalink were used. Errors are logged.
+func (s *Spec) PublishDeferred() {
+	s.deferred.mu.Lock()
+	pending := s.deferred.pending
+	s.deferred.pending = nil
+	s.deferred.mu.Unlock()
+
+	for _, r := range pending {
+		r.publish()
+	}
+}
+
+// PublishIsDeferred reports whether r is published in Spec.PublishDeferred,
+// and only if used, rather than when its page is rendered.
+func PublishIsDeferred(r resource.Resource) bool {
+	ra, ok := r.(*resourceAdapter)
+	return ok && ra.publishIsDeferred()
+}
+
+// RelPermalinkNoUsage returns the relative permalink of r, for Hugo's own
+// use, e.g. to sort. With the deferPublish imaging option this does not mark
+// r as used.
+func RelPermalinkNoUsage(r resource.Resource) string {
+	ra, ok := r.(*resourceAdapter)
+	if !ok || !ra.publishIsDeferred() {
+		return r.RelPermalink()
+	}
+	ra.init(false, false)
+	return ra.target.RelPermalink()
+}
+
+func (r *resourceAdapter) publishIsDeferred() bool {
+	if !r.spec.imaging.Cfg.DeferPublish {
+		return false
+	}
+	_, isImage := r.target.(*imageResource)
+	return isImage
+}
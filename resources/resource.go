@@ -21,6 +21,7 @@ import (
 	"path"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/gohugoio/hugo/media"
 	"github.com/gohugoio/hugo/source"
@@ -116,6 +117,7 @@ type baseResourceInternal interface {
 	specProvider
 	getResourcePaths() *resourcePathDescriptor
 	getTargetFilenames() []string
+	setMediaType(mediaType media.Type)
 	openDestinationsForWriting() (io.WriteCloser, error)
 	openPublishFileForWriting(relTargetPath string) (io.WriteCloser, error)
 
@@ -173,7 +175,9 @@ type fileInfo interface {
 	setSourceFilename(string)
 	setSourceFs(afero.Fs)
 	hash() (string, error)
+	hashWith(hashFile func(r io.ReadSeeker) (string, error)) (string, error)
 	size() int
+	modTime() time.Time
 }
 
 // genericResource represents a generic linkable resource.
@@ -303,6 +307,10 @@ func (l *genericResource) initContent() error {
 	return err
 }
 
+func (l *genericResource) setMediaType(mediaType media.Type) {
+	l.mediaType = mediaType
+}
+
 func (l *genericResource) setName(name string) {
 	l.name = name
 }
@@ -574,6 +582,12 @@ func (fi *resourceFileInfo) setSourceFs(fs afero.Fs) {
 }
 
 func (fi *resourceFileInfo) hash() (string, error) {
+	return fi.hashWith(helpers.MD5FromFileFast)
+}
+
+// hashWith is hash with the file hash function hashFile. The hash is only
+// calculated once, so a resource must always use the same function.
+func (fi *resourceFileInfo) hashWith(hashFile func(r io.ReadSeeker) (string, error)) (string, error) {
 	var err error
 	fi.h.init.Do(func() {
 		var hash string
@@ -585,7 +599,7 @@ func (fi *resourceFileInfo) hash() (string, error) {
 		}
 		defer f.Close()
 
-		hash, err = helpers.MD5FromFileFast(f)
+		hash, err = hashFile(f)
 		if err != nil {
 			return
 		}
@@ -603,6 +617,14 @@ func (fi *resourceFileInfo) size() int {
 	return int(fi.fi.Size())
 }
 
+func (fi *resourceFileInfo) modTime() time.Time {
+	if fi.fi == nil {
+		return time.Time{}
+	}
+
+	return fi.fi.ModTime()
+}
+
 type resourceHash struct {
 	value string
 	init  sync.Once
@@ -41,6 +41,10 @@ type Resource interface {
 type Image interface {
 	Resource
 	ImageOps
+
+	// ReadSeekCloser streams the image content. For processed images this
+	// reads from the file cache and does not load the image into memory.
+	ReadSeekCloserProvider
 }
 
 type ImageOps interface {
@@ -49,8 +53,38 @@ type ImageOps interface {
 	Fill(spec string) (Image, error)
 	Fit(spec string) (Image, error)
 	Resize(spec string) (Image, error)
+	Pad(spec string) (Image, error)
+	Avatar(size int) (Image, error)
+	ICO(sizes ...int) (Image, error)
+	AlphaMask() (Image, error)
+	CheckerboardPreview(cellSize int) (Image, error)
+	Straighten(degrees float64) (Image, error)
+	OpenGraphCard(opts map[string]interface{}) (Image, error)
 	Filter(filters ...gift.Filter) (Image, error)
 	Exif() (*exif.Exif, error)
+	ExifJSON() (string, error)
+	Orientation() int
+	DisplayWidth() int
+	DisplayHeight() int
+	PageCount() int
+	AspectRatio() float64
+	IsLandscape() bool
+	IsPortrait() bool
+	IsSquare() bool
+	SrcSet(widths ...int) (SrcSet, error)
+	ScaleFactor() float64
+	WasCropped() bool
+	SourceQuality() int
+	FileSize() (int64, error)
+}
+
+// SrcSet holds a set of resized versions of an image, ordered by width.
+type SrcSet struct {
+	Images []Image
+
+	// Attr is the value to use in an img element's srcset attribute,
+	// e.g. "https://example.org/a_320.jpg 320w, https://example.org/a_640.jpg 640w".
+	Attr string
 }
 
 type ResourceTypesProvider interface {
@@ -116,13 +116,25 @@ func (c *Client) match(pattern string, firstOnly bool) (resource.Resources, erro
 
 // FromString creates a new Resource from a string with the given relative target path.
 func (c *Client) FromString(targetPath, content string) (resource.Resource, error) {
+	return c.FromStringFunc(targetPath, func() (string, error) {
+		return content, nil
+	})
+}
+
+// FromStringFunc is like FromString, but content is only called if the
+// Resource is not already cached, e.g. when it is expensive to create.
+func (c *Client) FromStringFunc(targetPath string, content func() (string, error)) (resource.Resource, error) {
 	return c.rs.ResourceCache.GetOrCreate(path.Join(resources.CACHE_OTHER, targetPath), func() (resource.Resource, error) {
+		s, err := content()
+		if err != nil {
+			return nil, err
+		}
 		return c.rs.New(
 			resources.ResourceSourceDescriptor{
 				Fs:          c.rs.FileCaches.AssetsCache().Fs,
 				LazyPublish: true,
 				OpenReadSeekCloser: func() (hugio.ReadSeekCloser, error) {
-					return hugio.NewReadSeekerNoOpCloserFromString(content), nil
+					return hugio.NewReadSeekerNoOpCloserFromString(s), nil
 				},
 				RelTargetFilename: filepath.Clean(targetPath)})
 
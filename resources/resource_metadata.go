@@ -32,6 +32,8 @@ var (
 	_ metaAssigner         = (*genericResource)(nil)
 	_ metaAssigner         = (*imageResource)(nil)
 	_ metaAssignerProvider = (*resourceAdapter)(nil)
+
+	_ resampleFilterAssigner = (*imageResource)(nil)
 )
 
 type metaAssignerProvider interface {
@@ -45,6 +47,12 @@ type metaAssigner interface {
 	updateParams(params map[string]interface{})
 }
 
+// resampleFilterAssigner is implemented by resources with a default
+// resample filter that can be set in metadata, i.e. images.
+type resampleFilterAssigner interface {
+	setResampleFilter(filter string) error
+}
+
 const counterPlaceHolder = ":counter"
 
 // AssignMetadata assigns the given metadata to those resources that supports updates
@@ -68,7 +76,7 @@ func AssignMetadata(metadata []map[string]interface{}, resources ...resource.Res
 		}
 
 		var (
-			nameSet, titleSet                   bool
+			nameSet, titleSet, filterSet        bool
 			nameCounter, titleCounter           = 0, 0
 			nameCounterFound, titleCounterFound bool
 			resourceSrcKey                      = strings.ToLower(r.Name())
@@ -125,6 +133,18 @@ func AssignMetadata(metadata []map[string]interface{}, resources ...resource.Res
 					}
 				}
 
+				if !filterSet {
+					filter, found := meta["filter"]
+					if found {
+						if fa, ok := ma.(resampleFilterAssigner); ok {
+							if err := fa.setResampleFilter(cast.ToString(filter)); err != nil {
+								return err
+							}
+						}
+						filterSet = true
+					}
+				}
+
 				params, found := meta["params"]
 				if found {
 					m := cast.ToStringMap(params)
@@ -21,6 +21,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 
 	"github.com/gohugoio/hugo/helpers"
 
@@ -55,6 +56,7 @@ func NewSpec(
 	if logger == nil {
 		logger = loggers.NewErrorLogger()
 	}
+	imaging.Warn = logger.WARN
 
 	permalinks, err := page.NewPermalinkExpander(s)
 	if err != nil {
@@ -68,6 +70,8 @@ func NewSpec(
 		OutputFormats: outputFormats,
 		Permalinks:    permalinks,
 		FileCaches:    fileCaches,
+		imageMemory:   newImageMemoryBudget(imgConfig.MaxMemory),
+		deferred:      &deferredPublisher{},
 		imageCache: newImageCache(
 			fileCaches.ImageCache(),
 
@@ -96,8 +100,39 @@ type Spec struct {
 	imaging *images.ImageProcessor
 
 	imageCache    *imageCache
+	imageMemory   *imageMemoryBudget
+	deferred      *deferredPublisher
 	ResourceCache *ResourceCache
 	FileCaches    filecache.Caches
+
+	// ImageProcessedHook is an optional hook called when an image is created,
+	// i.e. on a cache miss, e.g. to find the slow image transforms.
+	// Image processing runs in parallel, so it must be safe for concurrent use.
+	ImageProcessedHook func(ImageProcessedEvent)
+
+	// ImageProgress is an optional reporter notified each time an image is
+	// created, i.e. on a cache miss, e.g. to show progress on big sites.
+	ImageProgress ImageProgressReporter
+
+	// The number of images created, used for ImageProgress.
+	imagesProcessed uint32
+}
+
+// ImageProgressReporter reports progress of the image processing.
+type ImageProgressReporter interface {
+	// ImageProcessed is called with the number of images created so far
+	// by the Spec. Images are processed in parallel, so this must be safe
+	// for concurrent use, and the counts may arrive out of order.
+	ImageProcessed(count int)
+}
+
+// reportImageProcessed increments the count of created images and passes it
+// on to ImageProgress, if set.
+func (r *Spec) reportImageProcessed() {
+	if r.ImageProgress == nil {
+		return
+	}
+	r.ImageProgress.ImageProcessed(int(atomic.AddUint32(&r.imagesProcessed, 1)))
 }
 
 func (r *Spec) New(fd ResourceSourceDescriptor) (resource.Resource, error) {
@@ -131,6 +166,14 @@ func (r *Spec) DeleteCacheByPrefix(prefix string) {
 	r.imageCache.deleteByPrefix(prefix)
 }
 
+// DeleteImageCacheBySourceHash removes all processed images derived from the
+// source image with the given hash, in memory and on disk. This is more
+// surgical than clearing the entire cache. The images will be regenerated
+// on next access.
+func (r *Spec) DeleteImageCacheBySourceHash(hash string) error {
+	return r.imageCache.deleteBySourceHash(hash)
+}
+
 // TODO(bep) unify
 func (r *Spec) IsInImageCache(key string) bool {
 	// This is used for cache pruning. We currently only have images, but we could
@@ -277,9 +320,13 @@ func (r *Spec) newResource(sourceFs afero.Fs, fd ResourceSourceDescriptor) (reso
 				baseResource: gr,
 			}
 			ir.root = ir
+			ir.isOriginal = true
 			return newResourceAdapter(gr.spec, fd.LazyPublish, ir), nil
 		}
 
+		if isSVG(mimeType) {
+			return newResourceAdapter(gr.spec, fd.LazyPublish, newSVGResource(gr)), nil
+		}
 	}
 
 	return newResourceAdapter(gr.spec, fd.LazyPublish, gr), nil
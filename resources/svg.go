@@ -0,0 +1,92 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"sync"
+
+	"github.com/gohugoio/hugo/media"
+	"github.com/gohugoio/hugo/resources/images"
+	"github.com/gohugoio/hugo/resources/resource"
+)
+
+var _ dimensionsProvider = (*svgResource)(nil)
+
+// dimensionsProvider is implemented by the resources with dimensions, the
+// images and the SVG images.
+type dimensionsProvider interface {
+	Width() int
+	Height() int
+}
+
+// svgResource is an SVG image. It can't be processed, but its intrinsic
+// dimensions are read from the root element.
+type svgResource struct {
+	baseResource
+
+	configInit sync.Once
+	width      int
+	height     int
+}
+
+func newSVGResource(base baseResource) *svgResource {
+	return &svgResource{baseResource: base}
+}
+
+func isSVG(m media.Type) bool {
+	return m.MainType == media.SVGType.MainType && m.SubType == media.SVGType.SubType
+}
+
+// Width returns the intrinsic width of the SVG image, or 0 if not known.
+func (s *svgResource) Width() int {
+	s.initConfig()
+	return s.width
+}
+
+// Height returns the intrinsic height of the SVG image, or 0 if not known.
+func (s *svgResource) Height() int {
+	s.initConfig()
+	return s.height
+}
+
+func (s *svgResource) Clone() resource.Resource {
+	return newSVGResource(s.baseResource.Clone().(baseResource))
+}
+
+func (s *svgResource) cloneWithUpdates(u *transformationUpdate) (baseResource, error) {
+	base, err := s.baseResource.cloneWithUpdates(u)
+	if err != nil {
+		return nil, err
+	}
+	if !isSVG(base.MediaType()) {
+		return base, nil
+	}
+	return newSVGResource(base), nil
+}
+
+func (s *svgResource) initConfig() {
+	s.configInit.Do(func() {
+		f, err := s.ReadSeekCloser()
+		if err != nil {
+			return
+		}
+		defer f.Close()
+
+		config, err := images.DecodeSVGConfig(f)
+		if err != nil {
+			return
+		}
+		s.width, s.height = config.Width, config.Height
+	})
+}
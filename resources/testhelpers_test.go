@@ -1,10 +1,13 @@
 package resources
 
 import (
+	"bytes"
 	"path/filepath"
 	"testing"
 
 	"image"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"io/ioutil"
 	"os"
@@ -20,6 +23,7 @@ import (
 	"github.com/gohugoio/hugo/hugofs"
 	"github.com/gohugoio/hugo/media"
 	"github.com/gohugoio/hugo/output"
+	"github.com/gohugoio/hugo/resources/images/pnm"
 	"github.com/gohugoio/hugo/resources/page"
 	"github.com/gohugoio/hugo/resources/resource"
 	"github.com/spf13/afero"
@@ -179,6 +183,41 @@ func fetchResourceForSpec(spec *Spec, c *qt.C, name string, targetPathAddends ..
 	return r.(resource.ContentResource)
 }
 
+// newTestImageResource encodes img in the format given by the extension of
+// name and creates an image resource from it.
+func newTestImageResource(c *qt.C, spec *Spec, name string, img image.Image) resource.Image {
+	var buf bytes.Buffer
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		c.Assert(jpeg.Encode(&buf, img, nil), qt.IsNil)
+	case ".ppm":
+		c.Assert(pnm.Encode(&buf, img), qt.IsNil)
+	default:
+		c.Assert(png.Encode(&buf, img), qt.IsNil)
+	}
+	return newTestImageResourceFromBytes(c, spec, name, buf.Bytes())
+}
+
+// newTestImageResourceFromBytes creates an image resource with the file
+// content b, e.g. a corrupt image.
+func newTestImageResourceFromBytes(c *qt.C, spec *Spec, name string, b []byte) resource.Image {
+	filename := filepath.Join(spec.WorkingDir, name)
+	c.Assert(afero.WriteFile(spec.Fs.Source, filename, b, 0755), qt.IsNil)
+	r, err := spec.New(ResourceSourceDescriptor{Fs: spec.Fs.Source, TargetPaths: newTargetPaths("/a"), LazyPublish: true, RelTargetFilename: name, SourceFilename: filename})
+	c.Assert(err, qt.IsNil)
+	return r.(resource.Image)
+}
+
+// decodeImage decodes the content of img.
+func decodeImage(c *qt.C, img resource.Image) image.Image {
+	f, err := img.ReadSeekCloser()
+	c.Assert(err, qt.IsNil)
+	defer f.Close()
+	decoded, _, err := image.Decode(f)
+	c.Assert(err, qt.IsNil)
+	return decoded
+}
+
 func assertImageFile(c *qt.C, fs afero.Fs, filename string, width, height int) {
 	filename = filepath.Clean(filename)
 	f, err := fs.Open(filename)
@@ -16,12 +16,14 @@ package resources
 import (
 	"bytes"
 	"fmt"
+	"image"
 	"io"
 	"path"
 	"strings"
 	"sync"
 
 	"github.com/disintegration/gift"
+	"github.com/gohugoio/hugo/resources/images"
 	"github.com/gohugoio/hugo/resources/images/exif"
 	"github.com/spf13/afero"
 
@@ -145,12 +147,18 @@ func (ctx *ResourceTransformationCtx) addPathIdentifier(inPath, identifier strin
 type publishOnce struct {
 	publisherInit sync.Once
 	publisherErr  error
+
+	// Used with the deferPublish imaging option, see Spec.PublishDeferred.
+	usedInit sync.Once
 }
 
 type resourceAdapter struct {
 	commonResource
 	*resourceTransformations
 	*resourceAdapterInner
+
+	// Set for processed images taken from the memory or file cache.
+	fromCache bool
 }
 
 func (r *resourceAdapter) Content() (interface{}, error) {
@@ -167,11 +175,133 @@ func (r *resourceAdapter) Data() interface{} {
 }
 
 func (r *resourceAdapter) Fill(spec string) (resource.Image, error) {
-	return r.getImageOps().Fill(spec)
+	return r.imageResult(r.getImageOps().Fill(spec))
+}
+
+// FromCache reports whether this processed image was taken from the cache
+// rather than created in this build, e.g. to find images that are created
+// again on every build.
+func (r *resourceAdapter) FromCache() bool {
+	return r.fromCache
 }
 
 func (r *resourceAdapter) Fit(spec string) (resource.Image, error) {
-	return r.getImageOps().Fit(spec)
+	return r.imageResult(r.getImageOps().Fit(spec))
+}
+
+func (r *resourceAdapter) Avatar(size int) (resource.Image, error) {
+	return r.imageResult(r.getImageOps().Avatar(size))
+}
+
+func (r *resourceAdapter) ICO(sizes ...int) (resource.Image, error) {
+	return r.imageResult(r.getImageOps().ICO(sizes...))
+}
+
+func (r *resourceAdapter) AlphaMask() (resource.Image, error) {
+	return r.imageResult(r.getImageOps().AlphaMask())
+}
+
+func (r *resourceAdapter) CheckerboardPreview(cellSize int) (resource.Image, error) {
+	return r.imageResult(r.getImageOps().CheckerboardPreview(cellSize))
+}
+
+func (r *resourceAdapter) Straighten(degrees float64) (resource.Image, error) {
+	return r.imageResult(r.getImageOps().Straighten(degrees))
+}
+
+func (r *resourceAdapter) OpenGraphCard(opts map[string]interface{}) (resource.Image, error) {
+	return r.imageResult(r.getImageOps().OpenGraphCard(opts))
+}
+
+func (r *resourceAdapter) ScaleFactor() float64 {
+	return r.getImageOps().ScaleFactor()
+}
+
+func (r *resourceAdapter) WasCropped() bool {
+	return r.getImageOps().WasCropped()
+}
+
+func (r *resourceAdapter) SourceQuality() int {
+	return r.getImageOps().SourceQuality()
+}
+
+func (r *resourceAdapter) FileSize() (int64, error) {
+	return r.getImageOps().FileSize()
+}
+
+func (r *resourceAdapter) Pad(spec string) (resource.Image, error) {
+	return r.imageResult(r.getImageOps().Pad(spec))
+}
+
+func (r *resourceAdapter) FitBox(spec string) (FitInfo, error) {
+	img, err := r.getImageResource()
+	if err != nil {
+		return FitInfo{}, err
+	}
+	info, err := img.FitBox(spec)
+	if err != nil {
+		return info, err
+	}
+	info.Image, err = r.imageResult(info.Image, nil)
+	return info, err
+}
+
+func (r *resourceAdapter) WithName(name string) (resource.Image, error) {
+	img, err := r.getImageResource()
+	if err != nil {
+		return nil, err
+	}
+	return newResourceAdapter(r.spec, r.publishOnce != nil, img.WithName(name).(*imageResource)), nil
+}
+
+func (r *resourceAdapter) Variants(specs ...string) ([]ImageVariant, error) {
+	img, err := r.getImageResource()
+	if err != nil {
+		return nil, err
+	}
+	variants, err := img.Variants(specs...)
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range variants {
+		variants[i].Image, err = r.imageResult(v.Image, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return variants, nil
+}
+
+func (r *resourceAdapter) ColorInfo() (images.ColorInfo, error) {
+	img, err := r.getImageResource()
+	if err != nil {
+		return images.ColorInfo{}, err
+	}
+	return img.ColorInfo()
+}
+
+func (r *resourceAdapter) Derivatives() ([]resource.Image, error) {
+	img, err := r.getImageResource()
+	if err != nil {
+		return nil, err
+	}
+	return img.Derivatives()
+}
+
+func (r *resourceAdapter) DecodedImage() (image.Image, error) {
+	img, err := r.getImageResource()
+	if err != nil {
+		return nil, err
+	}
+	return img.DecodedImage()
+}
+
+func (r *resourceAdapter) PixelAt(x, y int) (string, error) {
+	img, err := r.getImageResource()
+	if err != nil {
+		return "", err
+	}
+	return img.PixelAt(x, y)
 }
 
 func (r *resourceAdapter) Filter(filters ...gift.Filter) (resource.Image, error) {
@@ -179,13 +309,57 @@ func (r *resourceAdapter) Filter(filters ...gift.Filter) (resource.Image, error)
 }
 
 func (r *resourceAdapter) Height() int {
-	return r.getImageOps().Height()
+	return r.getDimensions().Height()
 }
 
 func (r *resourceAdapter) Exif() (*exif.Exif, error) {
 	return r.getImageOps().Exif()
 }
 
+func (r *resourceAdapter) ExifJSON() (string, error) {
+	return r.getImageOps().ExifJSON()
+}
+
+func (r *resourceAdapter) Orientation() int {
+	return r.getImageOps().Orientation()
+}
+
+func (r *resourceAdapter) DisplayWidth() int {
+	return r.getImageOps().DisplayWidth()
+}
+
+func (r *resourceAdapter) DisplayHeight() int {
+	return r.getImageOps().DisplayHeight()
+}
+
+func (r *resourceAdapter) PageCount() int {
+	return r.getImageOps().PageCount()
+}
+
+func (r *resourceAdapter) AspectRatio() float64 {
+	return r.getImageOps().AspectRatio()
+}
+
+func (r *resourceAdapter) IsLandscape() bool {
+	return r.getImageOps().IsLandscape()
+}
+
+func (r *resourceAdapter) IsPortrait() bool {
+	return r.getImageOps().IsPortrait()
+}
+
+func (r *resourceAdapter) IsSquare() bool {
+	return r.getImageOps().IsSquare()
+}
+
+func (r *resourceAdapter) SrcSet(widths ...int) (resource.SrcSet, error) {
+	img, err := r.getImageResource()
+	if err != nil {
+		return resource.SrcSet{}, err
+	}
+	return img.srcSet(r.Resize, widths...)
+}
+
 func (r *resourceAdapter) Key() string {
 	r.init(false, false)
 	return r.target.(resource.Identifier).Key()
@@ -228,7 +402,7 @@ func (r *resourceAdapter) RelPermalink() string {
 }
 
 func (r *resourceAdapter) Resize(spec string) (resource.Image, error) {
-	return r.getImageOps().Resize(spec)
+	return r.imageResult(r.getImageOps().Resize(spec))
 }
 
 func (r *resourceAdapter) ResourceType() string {
@@ -260,7 +434,17 @@ func (r resourceAdapter) Transform(t ...ResourceTransformation) (ResourceTransfo
 }
 
 func (r *resourceAdapter) Width() int {
-	return r.getImageOps().Width()
+	return r.getDimensions().Width()
+}
+
+// getDimensions is getImageOps for Width and Height, which SVG images have too.
+func (r *resourceAdapter) getDimensions() dimensionsProvider {
+	r.init(false, false)
+	d, ok := r.target.(dimensionsProvider)
+	if !ok {
+		panic(fmt.Sprintf("%T is not an image", r.target))
+	}
+	return d
 }
 
 func (r *resourceAdapter) getImageOps() resource.ImageOps {
@@ -272,6 +456,39 @@ func (r *resourceAdapter) getImageOps() resource.ImageOps {
 	return img
 }
 
+// getImageResource returns the raster image this adapter wraps, or an error
+// if it is not one, e.g. an SVG image.
+func (r *resourceAdapter) getImageResource() (*imageResource, error) {
+	img, ok := toImageResource(r)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a raster image", r.target)
+	}
+	return img, nil
+}
+
+// imageResult makes sure that an image operation that returns the
+// image itself unchanged keeps this adapter, and with it the publisher.
+func (r *resourceAdapter) imageResult(img resource.Image, err error) (resource.Image, error) {
+	if err != nil {
+		return nil, err
+	}
+	if ir, ok := img.(*imageResource); ok && ir == r.target {
+		return r, nil
+	}
+	return img, nil
+}
+
+// withFromCache returns r, or a shallow copy of r if needed, with the given
+// fromCache. The copy shares the state of r, so it is the same resource.
+func (r *resourceAdapter) withFromCache(fromCache bool) *resourceAdapter {
+	if r.fromCache == fromCache {
+		return r
+	}
+	c := *r
+	c.fromCache = fromCache
+	return &c
+}
+
 func (r *resourceAdapter) getMetaAssigner() metaAssigner {
 	return r.target
 }
@@ -514,6 +731,12 @@ func (r *resourceAdapter) initTransform(publish, setContent bool) {
 	})
 
 	if publish && r.publishOnce != nil {
+		if r.publishIsDeferred() {
+			r.usedInit.Do(func() {
+				r.spec.deferred.add(r)
+			})
+			return
+		}
 		r.publish()
 	}
 }
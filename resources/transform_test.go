@@ -392,6 +392,22 @@ func TestTransform(t *testing.T) {
 
 	})
 
+	c.Run("SVG", func(c *qt.C) {
+		c.Parallel()
+
+		spec := newTestResourceSpec(specDescriptor{c: c})
+
+		r := createTransformer(spec, "f1.svg", `<svg width="100" height="50"></svg>`)
+		c.Assert(r.(resource.Image).Width(), qt.Equals, 100)
+
+		// The dimensions are read from the transformed content.
+		tr, err := r.Transform(createContentReplacer("width", `width="100"`, `width="200"`))
+		c.Assert(err, qt.IsNil)
+		c.Assert(tr.(resource.Image).Width(), qt.Equals, 200)
+		c.Assert(tr.(resource.Image).Height(), qt.Equals, 50)
+		c.Assert(tr.RelPermalink(), qt.Equals, "/f1.width.svg")
+	})
+
 	c.Run("Concurrent", func(c *qt.C) {
 		spec := newTestResourceSpec(specDescriptor{c: c})
 
@@ -0,0 +1,153 @@
+// Copyright 2019 The Hugo Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package images
+
+import (
+	"github.com/disintegration/gift"
+	"github.com/gohugoio/hugo/resources/images"
+)
+
+// filterOrError returns f, or the error if f was created with invalid
+// arguments.
+func filterOrError(f gift.Filter) (gift.Filter, error) {
+	if err := images.FilterError(f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// CLAHE creates a filter that applies Contrast-Limited Adaptive Histogram
+// Equalization to an image, see images.Filters.CLAHE.
+func (ns *Namespace) CLAHE(tileGrid, clipLimit interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.CLAHE(tileGrid, clipLimit))
+}
+
+// Border creates a filter that draws a solid border around an image, see
+// images.Filters.Border.
+func (ns *Namespace) Border(width, color interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.Border(width, color))
+}
+
+// DropShadow creates a filter that draws a shadow behind an image, see
+// images.Filters.DropShadow.
+func (ns *Namespace) DropShadow(offsetX, offsetY, blur, color interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.DropShadow(offsetX, offsetY, blur, color))
+}
+
+// Pixelate creates a filter that applies a pixelation effect to an image,
+// see images.Filters.Pixelate.
+func (ns *Namespace) Pixelate(size interface{}, shape ...interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.Pixelate(size, shape...))
+}
+
+// GradientOverlay creates a filter that composites a linear gradient over an
+// image, see images.Filters.GradientOverlay.
+func (ns *Namespace) GradientOverlay(direction, startColor, endColor interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.GradientOverlay(direction, startColor, endColor))
+}
+
+// WhiteBalance creates a filter that corrects the color temperature and tint
+// of an image, see images.Filters.WhiteBalance.
+func (ns *Namespace) WhiteBalance(temperature, tint interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.WhiteBalance(temperature, tint))
+}
+
+// ReplaceColor creates a filter that replaces the colors near the target color
+// with the replacement color, see images.Filters.ReplaceColor.
+func (ns *Namespace) ReplaceColor(target, tolerance, replacement interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.ReplaceColor(target, tolerance, replacement))
+}
+
+// Vibrance creates a filter that changes the saturation of an image, see
+// images.Filters.Vibrance.
+func (ns *Namespace) Vibrance(percentage interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.Vibrance(percentage))
+}
+
+// HueTo creates a filter that rotates the hue of an image so its dominant hue
+// moves to the hue of the given color, see images.Filters.HueTo.
+func (ns *Namespace) HueTo(target interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.HueTo(target))
+}
+
+// LUT creates a filter that maps the colors of an image through a 3D lookup
+// table, see images.Filters.LUT.
+func (ns *Namespace) LUT(lut interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.LUT(lut))
+}
+
+// Frame creates a filter that places the image in a rectangle of the frame
+// image, see images.Filters.Frame.
+func (ns *Namespace) Frame(frame, x, y interface{}, size ...interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.Frame(frame, x, y, size...))
+}
+
+// ColorBlind creates a filter that simulates how an image is seen with a color
+// vision deficiency, see images.Filters.ColorBlind.
+func (ns *Namespace) ColorBlind(mode interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.ColorBlind(mode))
+}
+
+// GradientMap creates a filter that maps the luminance of an image to a color
+// gradient, see images.Filters.GradientMap.
+func (ns *Namespace) GradientMap(stops ...interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.GradientMap(stops...))
+}
+
+// Pattern creates a filter that tiles an image across the image, see
+// images.Filters.Pattern.
+func (ns *Namespace) Pattern(tile, opacity interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.Pattern(tile, opacity))
+}
+
+// Palette creates a filter that maps the colors of an image to a fixed
+// palette, see images.Filters.Palette.
+func (ns *Namespace) Palette(name interface{}, dither ...interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.Palette(name, dither...))
+}
+
+// BlurRegion creates a filter that applies a gaussian blur to a rectangle of
+// an image, see images.Filters.BlurRegion.
+func (ns *Namespace) BlurRegion(x, y, width, height, sigma interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.BlurRegion(x, y, width, height, sigma))
+}
+
+// ExifCaption creates a filter that draws a caption strip at the bottom of
+// an image with text from its EXIF data, see images.Filters.ExifCaption.
+func (ns *Namespace) ExifCaption(tmpl interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.ExifCaption(tmpl))
+}
+
+// FilmGrain creates a filter that adds film grain to an image, see
+// images.Filters.FilmGrain.
+func (ns *Namespace) FilmGrain(intensity, grainSize, monochrome interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.FilmGrain(intensity, grainSize, monochrome))
+}
+
+// SmartCrop creates a filter that crops an image to its most interesting
+// region, see images.Filters.SmartCrop.
+func (ns *Namespace) SmartCrop(width, height interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.SmartCrop(width, height))
+}
+
+// Compose creates a filter that applies the given filters in turn, see
+// images.Filters.Compose.
+func (ns *Namespace) Compose(name interface{}, filters ...gift.Filter) (gift.Filter, error) {
+	return filterOrError(ns.Filters.Compose(name, filters...))
+}
+
+// ShadowHighlight creates a filter that lifts the shadows and recovers the
+// highlights of an image, see images.Filters.ShadowHighlight.
+func (ns *Namespace) ShadowHighlight(shadows, highlights interface{}) (gift.Filter, error) {
+	return filterOrError(ns.Filters.ShadowHighlight(shadows, highlights))
+}
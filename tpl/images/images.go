@@ -15,15 +15,23 @@
 package images
 
 import (
+	"bytes"
+	"fmt"
 	"image"
+	"image/color"
+	"image/png"
+	"reflect"
 	"sync"
 
 	"github.com/disintegration/gift"
 
 	"github.com/pkg/errors"
 
+	"github.com/gohugoio/hugo/helpers"
+	"github.com/gohugoio/hugo/resources"
 	"github.com/gohugoio/hugo/resources/images"
 	"github.com/gohugoio/hugo/resources/resource"
+	"github.com/gohugoio/hugo/resources/resource_factories/create"
 
 	// Importing image codecs for image.DecodeConfig
 	_ "image/gif"
@@ -108,3 +116,170 @@ func (ns *Namespace) Filter(args ...interface{}) (resource.Image, error) {
 
 	return img.Filter(filters...)
 }
+
+// Montage lays out the images in imgs in a grid with the given number of
+// columns, e.g. for a gallery index. Each image is cropped to fill a cell of
+// cellWidth x cellHeight, with gap pixels between the cells in the bg color.
+// The result is processed from the first image.
+func (ns *Namespace) Montage(imgs interface{}, cols, cellWidth, cellHeight, gap, bg interface{}) (resource.Image, error) {
+	v := reflect.ValueOf(imgs)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, errors.Errorf("montage needs a slice of images, got %T", imgs)
+	}
+	if v.Len() == 0 {
+		return nil, errors.New("montage needs at least one image")
+	}
+
+	list := make([]resource.Image, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		img, ok := v.Index(i).Interface().(resource.Image)
+		if !ok {
+			return nil, errors.Errorf("montage needs images, got %T", v.Index(i).Interface())
+		}
+		list[i] = img
+	}
+
+	colsi, err := cast.ToIntE(cols)
+	if err != nil {
+		return nil, err
+	}
+	cellWidthi, err := cast.ToIntE(cellWidth)
+	if err != nil {
+		return nil, err
+	}
+	cellHeighti, err := cast.ToIntE(cellHeight)
+	if err != nil {
+		return nil, err
+	}
+	gapi, err := cast.ToIntE(gap)
+	if err != nil {
+		return nil, err
+	}
+	bgs, err := cast.ToStringE(bg)
+	if err != nil {
+		return nil, err
+	}
+
+	others := make([]resource.ReadSeekCloserResource, len(list)-1)
+	for i, img := range list[1:] {
+		others[i] = img
+	}
+
+	f, err := images.NewMontage(others, colsi, cellWidthi, cellHeighti, gapi, bgs)
+	if err != nil {
+		return nil, err
+	}
+
+	return list[0].Filter(f)
+}
+
+// SameSource reports whether the images a and b are processed from the same
+// original image, e.g. a resized image and the image it was resized from.
+func (ns *Namespace) SameSource(a, b interface{}) (bool, error) {
+	imga, ok := a.(resource.Image)
+	if !ok {
+		return false, errors.Errorf("sameSource needs images, got %T", a)
+	}
+	imgb, ok := b.(resource.Image)
+	if !ok {
+		return false, errors.Errorf("sameSource needs images, got %T", b)
+	}
+	return resources.SameSource(imga, imgb), nil
+}
+
+// NewSolid creates a PNG image of width x height filled with the given
+// color, e.g. "#336699", to use as a placeholder or background. The
+// image can be processed and published as any other image.
+func (ns *Namespace) NewSolid(width, height, c interface{}) (resource.Image, error) {
+	w, h, err := toSize(width, height)
+	if err != nil {
+		return nil, err
+	}
+	col, err := toColor(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return ns.fromImage("solid", func() (image.Image, error) {
+		return images.NewSolid(w, h, col)
+	}, w, h, col)
+}
+
+// NewGradient creates a PNG image of width x height with a linear gradient
+// from left to right through the given colors, e.g. "#336699" "#99ccff".
+// The image can be processed and published as any other image.
+func (ns *Namespace) NewGradient(width, height interface{}, stops ...interface{}) (resource.Image, error) {
+	w, h, err := toSize(width, height)
+	if err != nil {
+		return nil, err
+	}
+	cols := make([]color.Color, len(stops))
+	for i, s := range stops {
+		cols[i], err = toColor(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	opts := []interface{}{w, h}
+	for _, c := range cols {
+		opts = append(opts, c)
+	}
+
+	return ns.fromImage("gradient", func() (image.Image, error) {
+		return images.NewGradient(w, h, cols...)
+	}, opts...)
+}
+
+// fromImage creates an image resource with a target filename unique for the
+// given options. The image from newImage is only created and encoded as PNG
+// if the resource is not already cached.
+func (ns *Namespace) fromImage(name string, newImage func() (image.Image, error), opts ...interface{}) (resource.Image, error) {
+	targetPath := fmt.Sprintf("images/%s_%s.png", name, helpers.MD5String(fmt.Sprint(opts...)))
+	r, err := create.New(ns.deps.ResourceSpec).FromStringFunc(targetPath, func() (string, error) {
+		img, err := newImage()
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ri, ok := r.(resource.Image)
+	if !ok {
+		return nil, errors.Errorf("%s is not an image", targetPath)
+	}
+
+	return ri, nil
+}
+
+func toSize(width, height interface{}) (int, int, error) {
+	w, err := cast.ToIntE(width)
+	if err != nil {
+		return 0, 0, err
+	}
+	h, err := cast.ToIntE(height)
+	if err != nil {
+		return 0, 0, err
+	}
+	return w, h, nil
+}
+
+func toColor(v interface{}) (color.Color, error) {
+	s, err := cast.ToStringE(v)
+	if err != nil {
+		return nil, err
+	}
+	c, err := images.ParseColor(s)
+	if err != nil {
+		return nil, err
+	}
+	// Normalize the color, so equal colors give the same target filename.
+	return color.NRGBAModel.Convert(c), nil
+}
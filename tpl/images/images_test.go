@@ -21,9 +21,18 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/disintegration/gift"
 	qt "github.com/frankban/quicktest"
+	"github.com/gohugoio/hugo/cache/filecache"
 	"github.com/gohugoio/hugo/deps"
+	"github.com/gohugoio/hugo/helpers"
 	"github.com/gohugoio/hugo/hugofs"
+	"github.com/gohugoio/hugo/langs"
+	"github.com/gohugoio/hugo/media"
+	"github.com/gohugoio/hugo/modules"
+	"github.com/gohugoio/hugo/output"
+	"github.com/gohugoio/hugo/resources"
+	"github.com/gohugoio/hugo/resources/resource"
 	"github.com/spf13/afero"
 	"github.com/spf13/cast"
 	"github.com/spf13/viper"
@@ -109,6 +118,191 @@ func TestNSConfig(t *testing.T) {
 	}
 }
 
+func TestNSMontage(t *testing.T) {
+	c := qt.New(t)
+
+	ns := New(&deps.Deps{})
+
+	_, err := ns.Montage("a.png", 2, 100, 100, 0, "")
+	c.Assert(err, qt.Not(qt.IsNil))
+	_, err = ns.Montage([]interface{}{}, 2, 100, 100, 0, "")
+	c.Assert(err, qt.Not(qt.IsNil))
+	_, err = ns.Montage([]interface{}{"a.png"}, 2, 100, 100, 0, "")
+	c.Assert(err, qt.ErrorMatches, "montage needs images, got string")
+}
+
+func TestNSFilters(t *testing.T) {
+	c := qt.New(t)
+
+	ns := New(&deps.Deps{})
+
+	f, err := ns.CLAHE(8, 2)
+	c.Assert(err, qt.IsNil)
+	c.Assert(f, qt.Not(qt.IsNil))
+
+	for _, test := range []struct {
+		name   string
+		create func() (gift.Filter, error)
+		expect string
+	}{
+		{"CLAHE", func() (gift.Filter, error) { return ns.CLAHE(0, 2) }, ".*tile grid.*"},
+		{"Border", func() (gift.Filter, error) { return ns.Border(1, "foo") }, `invalid color "foo"`},
+		{"DropShadow", func() (gift.Filter, error) { return ns.DropShadow(1, 1, -1, "red") }, ".*non-negative.*"},
+		{"Pixelate", func() (gift.Filter, error) { return ns.Pixelate(4, "triangle") }, ".*invalid pixelate shape.*"},
+		{"GradientOverlay", func() (gift.Filter, error) { return ns.GradientOverlay("diagonal", "#000", "#fff") }, ".*invalid gradient direction.*"},
+		{"WhiteBalance", func() (gift.Filter, error) { return ns.WhiteBalance(100, 0) }, ".*temperature.*"},
+		{"ReplaceColor", func() (gift.Filter, error) { return ns.ReplaceColor("#00ff00", 10, "nocolor") }, ".*invalid color.*"},
+		{"Vibrance", func() (gift.Filter, error) { return ns.Vibrance(200) }, ".*vibrance.*"},
+		{"HueTo", func() (gift.Filter, error) { return ns.HueTo("#808080") }, ".*gray.*"},
+		{"LUT", func() (gift.Filter, error) { return ns.LUT("foo") }, ".*must be a resource.*"},
+		{"Frame", func() (gift.Filter, error) { return ns.Frame("foo", 0, 0) }, "frame must be a resource.*"},
+		{"ColorBlind", func() (gift.Filter, error) { return ns.ColorBlind("foo") }, `invalid color blindness mode "foo".*`},
+		{"GradientMap", func() (gift.Filter, error) { return ns.GradientMap([]interface{}{0, "#000"}) }, ".*at least two stops.*"},
+		{"Pattern", func() (gift.Filter, error) { return ns.Pattern("foo", 1) }, "tile must be a resource.*"},
+		{"Palette", func() (gift.Filter, error) { return ns.Palette("ega") }, ".*invalid palette.*"},
+		{"BlurRegion", func() (gift.Filter, error) { return ns.BlurRegion(0, 0, 10, 10, 0) }, ".*sigma.*"},
+		{"ExifCaption", func() (gift.Filter, error) { return ns.ExifCaption("") }, "EXIF caption template must be set"},
+		{"FilmGrain", func() (gift.Filter, error) { return ns.FilmGrain(0, 1, false) }, ".*intensity.*"},
+		{"SmartCrop", func() (gift.Filter, error) { return ns.SmartCrop(0, 50) }, ".*size.*"},
+		{"Compose", func() (gift.Filter, error) { return ns.Compose("empty") }, ".*at least one filter.*"},
+		{"ShadowHighlight", func() (gift.Filter, error) { return ns.ShadowHighlight(101, 0) }, ".*must be in range 0 to 100"},
+	} {
+		_, err := test.create()
+		c.Assert(err, qt.ErrorMatches, test.expect, qt.Commentf(test.name))
+	}
+}
+
+func TestNSNewSolid(t *testing.T) {
+	c := qt.New(t)
+
+	ns := New(newResourceDeps(c))
+
+	img, err := ns.NewSolid(100, 100, "#336699")
+	c.Assert(err, qt.IsNil)
+	c.Assert(img.Width(), qt.Equals, 100)
+	c.Assert(img.Height(), qt.Equals, 100)
+	c.Assert(img.MediaType().Type(), qt.Equals, "image/png")
+
+	decoded := decodeImage(c, img)
+	for _, p := range []image.Point{{0, 0}, {50, 50}, {99, 99}} {
+		c.Assert(color.NRGBAModel.Convert(decoded.At(p.X, p.Y)), qt.Equals, color.NRGBA{R: 0x33, G: 0x66, B: 0x99, A: 0xff})
+	}
+
+	same, err := ns.NewSolid("100", 100, "336699")
+	c.Assert(err, qt.IsNil)
+	c.Assert(same.RelPermalink(), qt.Equals, img.RelPermalink())
+
+	other, err := ns.NewSolid(100, 100, "#ff0000")
+	c.Assert(err, qt.IsNil)
+	c.Assert(other.RelPermalink(), qt.Not(qt.Equals), img.RelPermalink())
+
+	resized, err := img.Resize("50x")
+	c.Assert(err, qt.IsNil)
+	c.Assert(resized.Width(), qt.Equals, 50)
+
+	_, err = ns.NewSolid(0, 100, "#336699")
+	c.Assert(err, qt.Not(qt.IsNil))
+	_, err = ns.NewSolid(100000, 100000, "#336699")
+	c.Assert(err, qt.ErrorMatches, ".*must be at most 8192")
+	_, err = ns.NewSolid(100, 100, "#33669")
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestNSSameSource(t *testing.T) {
+	c := qt.New(t)
+
+	ns := New(newResourceDeps(c))
+
+	img, err := ns.NewSolid(100, 100, "#336699")
+	c.Assert(err, qt.IsNil)
+	resized, err := img.Resize("50x")
+	c.Assert(err, qt.IsNil)
+	other, err := ns.NewSolid(100, 100, "#ff0000")
+	c.Assert(err, qt.IsNil)
+
+	same, err := ns.SameSource(resized, img)
+	c.Assert(err, qt.IsNil)
+	c.Assert(same, qt.Equals, true)
+	same, err = ns.SameSource(img, other)
+	c.Assert(err, qt.IsNil)
+	c.Assert(same, qt.Equals, false)
+
+	_, err = ns.SameSource(img, "a.png")
+	c.Assert(err, qt.ErrorMatches, "sameSource needs images, got string")
+}
+
+func TestNSNewGradient(t *testing.T) {
+	c := qt.New(t)
+
+	ns := New(newResourceDeps(c))
+
+	img, err := ns.NewGradient(101, 10, "#000000", "#ffffff")
+	c.Assert(err, qt.IsNil)
+	c.Assert(img.Width(), qt.Equals, 101)
+	c.Assert(img.Height(), qt.Equals, 10)
+
+	decoded := decodeImage(c, img)
+	c.Assert(color.NRGBAModel.Convert(decoded.At(0, 5)), qt.Equals, color.NRGBA{A: 0xff})
+	c.Assert(color.NRGBAModel.Convert(decoded.At(50, 5)), qt.Equals, color.NRGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xff})
+	c.Assert(color.NRGBAModel.Convert(decoded.At(100, 5)), qt.Equals, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})
+
+	three, err := ns.NewGradient(101, 10, "#ff0000", "#00ff00", "#0000ff")
+	c.Assert(err, qt.IsNil)
+	c.Assert(three.RelPermalink(), qt.Not(qt.Equals), img.RelPermalink())
+	decoded = decodeImage(c, three)
+	c.Assert(color.NRGBAModel.Convert(decoded.At(50, 0)), qt.Equals, color.NRGBA{G: 0xff, A: 0xff})
+
+	_, err = ns.NewGradient(100, 100, "#000000")
+	c.Assert(err, qt.Not(qt.IsNil))
+	_, err = ns.NewGradient(100, 100000, "#000000", "#ffffff")
+	c.Assert(err, qt.ErrorMatches, ".*must be at most 8192")
+}
+
+func decodeImage(c *qt.C, img resource.Image) image.Image {
+	f, err := img.ReadSeekCloser()
+	c.Assert(err, qt.IsNil)
+	defer f.Close()
+	decoded, _, err := image.Decode(f)
+	c.Assert(err, qt.IsNil)
+	return decoded
+}
+
+func newResourceDeps(c *qt.C) *deps.Deps {
+	cfg := viper.New()
+	cfg.Set("baseURL", "https://example.com/")
+	cfg.Set("resourceDir", "resources")
+	cfg.Set("contentDir", "content")
+	cfg.Set("dataDir", "data")
+	cfg.Set("i18nDir", "i18n")
+	cfg.Set("layoutDir", "layouts")
+	cfg.Set("assetDir", "assets")
+	cfg.Set("archetypeDir", "archetypes")
+	cfg.Set("publishDir", "public")
+
+	langs.LoadLanguageSettings(cfg, nil)
+	mod, err := modules.CreateProjectModule(cfg)
+	c.Assert(err, qt.IsNil)
+	cfg.Set("allModules", modules.Modules{mod})
+
+	fs := hugofs.NewMem(cfg)
+
+	p, err := helpers.NewPathSpec(fs, cfg, nil)
+	c.Assert(err, qt.IsNil)
+
+	fileCaches, err := filecache.NewCaches(p)
+	c.Assert(err, qt.IsNil)
+
+	spec, err := resources.NewSpec(p, fileCaches, nil, output.DefaultFormats, media.DefaultTypes)
+	c.Assert(err, qt.IsNil)
+
+	return &deps.Deps{
+		Cfg:          cfg,
+		Fs:           fs,
+		FileCaches:   fileCaches,
+		ResourceSpec: spec,
+	}
+}
+
 func blankImage(width, height int) []byte {
 	var buf bytes.Buffer
 	img := image.NewRGBA(image.Rect(0, 0, width, height))